@@ -0,0 +1,80 @@
+package headerblock
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// parseASNs parses autonomous system numbers such as "13335" or "AS13335".
+// Entries may be comma separated like allowedIPs.
+func parseASNs(raw []string, field string) (map[uint]struct{}, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	asns := make(map[uint]struct{})
+	for _, entry := range raw {
+		for _, part := range strings.Split(entry, ",") {
+			value := strings.TrimSpace(part)
+			if value == "" {
+				continue
+			}
+
+			trimmed := value
+			if len(trimmed) > 2 && strings.EqualFold(trimmed[:2], "AS") {
+				trimmed = trimmed[2:]
+			}
+
+			asn, err := strconv.ParseUint(trimmed, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid ASN %q", field, value)
+			}
+			asns[uint(asn)] = struct{}{}
+		}
+	}
+	return asns, nil
+}
+
+// openASNDatabase opens the ASN database when ASN lists are configured.
+func openASNDatabase(config *Config) (*mmdbReader, error) {
+	if len(config.AllowedASNs) == 0 && len(config.BlockedASNs) == 0 {
+		return nil, nil
+	}
+	if config.ASNDatabase == "" {
+		return nil, fmt.Errorf("asnDatabase: required by allowedASNs and blockedASNs")
+	}
+
+	reader, err := openMMDB(config.ASNDatabase)
+	if err != nil {
+		return nil, fmt.Errorf("asnDatabase: %w", err)
+	}
+	return reader, nil
+}
+
+// lookupASN returns the autonomous system number of ip, or 0 when unknown.
+func (c *headerBlock) lookupASN(ip net.IP) uint {
+	if c.asnDB == nil || ip == nil {
+		return 0
+	}
+
+	record, err := c.asnDB.lookup(ip)
+	if err != nil {
+		if c.log {
+			log.Printf("headerblock: ASN lookup failed for %s: %v", ip, err)
+		}
+		return 0
+	}
+
+	return mmdbUint(mmdbPath(record, "autonomous_system_number"))
+}
+
+func hasASN(asns map[uint]struct{}, asn uint) bool {
+	if asn == 0 {
+		return false
+	}
+	_, ok := asns[asn]
+	return ok
+}
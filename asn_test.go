@@ -0,0 +1,67 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestASNLists(t *testing.T) {
+	database := writeTestMMDB(t, map[string]map[string]interface{}{
+		"192.0.2.0/24":    {"autonomous_system_number": uint32(64500)},
+		"198.51.100.0/24": {"autonomous_system_number": uint32(64501)},
+	})
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		header         string
+		expectedStatus int
+	}{
+		{name: "BlockedASN", remoteAddr: "198.51.100.9:1234", expectedStatus: http.StatusForbidden},
+		{name: "AllowedASNBypassesRule", remoteAddr: "192.0.2.9:1234", header: "X-Debug", expectedStatus: http.StatusTeapot},
+		{name: "UnknownASNStillFiltered", remoteAddr: "10.0.0.1:1234", header: "X-Debug", expectedStatus: http.StatusForbidden},
+		{name: "UnknownASNClean", remoteAddr: "10.0.0.1:1234", expectedStatus: http.StatusTeapot},
+	}
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Debug"}}
+	cfg.ASNDatabase = database
+	cfg.AllowedASNs = []string{"AS64500"}
+	cfg.BlockedASNs = []string{"64501, 64502"}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.header != "" {
+				req.Header.Set(tt.header, "1")
+			}
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidASN(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.ASNDatabase = "unused.mmdb"
+	cfg.BlockedASNs = []string{"ASX"}
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error for invalid ASN")
+	}
+}
@@ -0,0 +1,136 @@
+package headerblock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultAuditRedactHeaders are redacted in audit records unless
+// auditRedactHeaders lists other headers.
+var defaultAuditRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", defaultBypassTokenHeader}
+
+// auditRecord is the full record of a denied request.
+type auditRecord struct {
+	Time     string              `json:"time"`
+	Decision string              `json:"decision"`
+	Rule     string              `json:"rule,omitempty"`
+	Header   string              `json:"header,omitempty"`
+	ClientIP string              `json:"clientIP,omitempty"`
+	Method   string              `json:"method"`
+	Host     string              `json:"host"`
+	Path     string              `json:"path"`
+	Headers  map[string][]string `json:"headers"`
+}
+
+// auditTrail records every denied request with its headers for forensics,
+// in a JSONL file and/or the webhook events.
+type auditTrail struct {
+	file    *rotatingFile
+	webhook bool
+	redact  map[string]struct{}
+}
+
+func newAuditTrail(config *Config) (*auditTrail, error) {
+	if config.AuditFile == "" && !config.AuditWebhook {
+		if len(config.AuditRedactHeaders) > 0 {
+			return nil, errors.New("auditRedactHeaders: requires auditFile or auditWebhook")
+		}
+		return nil, nil
+	}
+	if config.AuditWebhook && config.WebhookURL == "" {
+		return nil, errors.New("auditWebhook: requires webhookURL")
+	}
+
+	redactHeaders := config.AuditRedactHeaders
+	if len(redactHeaders) == 0 {
+		redactHeaders = defaultAuditRedactHeaders
+	}
+	audit := &auditTrail{
+		webhook: config.AuditWebhook,
+		redact:  make(map[string]struct{}, len(redactHeaders)),
+	}
+	for _, name := range redactHeaders {
+		audit.redact[http.CanonicalHeaderKey(strings.TrimSpace(name))] = struct{}{}
+	}
+
+	if config.AuditFile != "" {
+		maxSize := config.LogMaxSize
+		if maxSize == 0 {
+			maxSize = defaultLogMaxSize
+		}
+		maxBackups := config.LogMaxBackups
+		if maxBackups == 0 {
+			maxBackups = defaultLogMaxBackups
+		}
+		file, err := openRotatingFile(config.AuditFile, int64(maxSize)<<20, maxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("auditFile: %w", err)
+		}
+		audit.file = file
+	}
+	return audit, nil
+}
+
+// headers returns a copy of header with the values of redacted headers
+// replaced.
+func (a *auditTrail) headers(header http.Header) map[string][]string {
+	headers := make(map[string][]string, len(header))
+	for name, values := range header {
+		if _, ok := a.redact[http.CanonicalHeaderKey(name)]; ok {
+			headers[name] = []string{redactedValue}
+			continue
+		}
+		headers[name] = append([]string(nil), values...)
+	}
+	return headers
+}
+
+// write appends record to the audit file.
+func (a *auditTrail) write(record auditRecord) {
+	if a.file == nil {
+		return
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("headerblock: failed to encode audit record: %v", err)
+		return
+	}
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		log.Printf("headerblock: failed to write audit record: %v", err)
+	}
+}
+
+// Close closes the audit file.
+func (a *auditTrail) Close() error {
+	if a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+// auditBlock records a denied request in the audit trail and returns the
+// redacted headers for the webhook event when auditWebhook is set.
+func (c *headerBlock) auditBlock(req *http.Request, entry logEntry, now time.Time) map[string][]string {
+	headers := c.audit.headers(req.Header)
+	c.audit.write(auditRecord{
+		Time:     now.UTC().Format(time.RFC3339Nano),
+		Decision: entry.Decision,
+		Rule:     entry.Rule,
+		Header:   entry.Header,
+		ClientIP: entry.ClientIP,
+		Method:   req.Method,
+		Host:     req.Host,
+		Path:     req.URL.Path,
+		Headers:  headers,
+	})
+	if !c.audit.webhook {
+		return nil
+	}
+	return headers
+}
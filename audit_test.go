@@ -0,0 +1,185 @@
+package headerblock_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+type auditRecord struct {
+	Decision string              `json:"decision"`
+	Rule     string              `json:"rule"`
+	ClientIP string              `json:"clientIP"`
+	Method   string              `json:"method"`
+	Path     string              `json:"path"`
+	Headers  map[string][]string `json:"headers"`
+}
+
+func TestAuditFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Scan"},
+	}
+	cfg.AuditFile = path
+	cfg.AuditRedactHeaders = []string{"x-api-key"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p, err := tbua.New(ctx, &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, scan := range []string{"1", "", "2"} {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Api-Key", "secret")
+		req.Header.Set("Authorization", "Bearer token")
+		if scan != "" {
+			req.Header.Set("X-Scan", scan)
+		}
+		p.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open audit file: %v", err)
+	}
+	defer file.Close()
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("audit line is not JSON: %v: %q", err, scanner.Text())
+		}
+		records = append(records, record)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected a record per denied request, got %d", len(records))
+	}
+	expected := auditRecord{
+		Decision: "denied",
+		Rule:     "requestHeaders[0]",
+		ClientIP: "192.0.2.1",
+		Method:   http.MethodPost,
+		Path:     "/login",
+		Headers: map[string][]string{
+			"X-Api-Key":     {"[REDACTED]"},
+			"Authorization": {"Bearer token"},
+			"X-Scan":        {"2"},
+		},
+	}
+	if !reflect.DeepEqual(records[1], expected) {
+		t.Fatalf("expected %+v, got %+v", expected, records[1])
+	}
+}
+
+func TestAuditWebhook(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []auditRecord
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var batch []auditRecord
+		if err := json.NewDecoder(req.Body).Decode(&batch); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+		mu.Lock()
+		events = append(events, batch...)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Scan"},
+	}
+	cfg.WebhookURL = server.URL
+	cfg.WebhookBatchSize = 1
+	cfg.AuditWebhook = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p, err := tbua.New(ctx, &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Scan", "1")
+	req.Header.Set("Cookie", "session=secret")
+	p.ServeHTTP(httptest.NewRecorder(), req)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		done := len(events) == 1
+		mu.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("webhook event was never delivered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	expected := map[string][]string{
+		"X-Scan": {"1"},
+		"Cookie": {"[REDACTED]"},
+	}
+	if !reflect.DeepEqual(events[0].Headers, expected) {
+		t.Fatalf("expected headers %v, got %v", expected, events[0].Headers)
+	}
+}
+
+func TestInvalidAudit(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(cfg *tbua.Config)
+	}{
+		{
+			name:   "webhook without webhookURL",
+			config: func(cfg *tbua.Config) { cfg.AuditWebhook = true },
+		},
+		{
+			name:   "redaction without audit",
+			config: func(cfg *tbua.Config) { cfg.AuditRedactHeaders = []string{"Cookie"} },
+		},
+		{
+			name:   "missing directory",
+			config: func(cfg *tbua.Config) { cfg.AuditFile = filepath.Join(t.TempDir(), "missing", "audit.jsonl") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			tt.config(cfg)
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected error for invalid audit configuration")
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package headerblock
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// minBackoff and maxBackoff bound the wait before a failed backend is
+	// contacted again.
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+	// warnInterval is the minimum time between two warnings of a backend.
+	warnInterval = 10 * time.Second
+)
+
+// backoff stops contacting a failing backend for a wait doubling with every
+// failure, then lets a single caller probe it again.
+type backoff struct {
+	mu      sync.Mutex
+	wait    time.Duration
+	retryAt time.Time
+	probing bool
+}
+
+// allow reports whether the backend may be contacted. While backing off it
+// only allows the one caller probing the backend again.
+func (b *backoff) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.wait == 0 {
+		return true
+	}
+	if b.probing || now.Before(b.retryAt) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// succeeded ends the backoff.
+func (b *backoff) succeeded() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.wait = 0
+	b.probing = false
+}
+
+// abandoned lets another caller probe the backend after the probe ended
+// without telling whether the backend works.
+func (b *backoff) abandoned() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// failed doubles the wait, between minBackoff and maxBackoff.
+func (b *backoff) failed(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	b.wait *= 2
+	if b.wait < minBackoff {
+		b.wait = minBackoff
+	}
+	if b.wait > maxBackoff {
+		b.wait = maxBackoff
+	}
+	b.retryAt = now.Add(b.wait)
+}
+
+// warnLimiter logs a warning at most once per warnInterval, so an outage of
+// a backend does not log a line per request.
+type warnLimiter struct {
+	mu         sync.Mutex
+	last       time.Time
+	suppressed int
+}
+
+func (w *warnLimiter) printf(format string, args ...interface{}) {
+	now := time.Now()
+	w.mu.Lock()
+	if now.Sub(w.last) < warnInterval {
+		w.suppressed++
+		w.mu.Unlock()
+		return
+	}
+	suppressed := w.suppressed
+	w.last = now
+	w.suppressed = 0
+	w.mu.Unlock()
+
+	message := fmt.Sprintf(format, args...)
+	if suppressed > 0 {
+		message += fmt.Sprintf(" (%d similar messages suppressed)", suppressed)
+	}
+	log.Printf("headerblock: %s", message)
+}
@@ -0,0 +1,194 @@
+package headerblock
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBanWindow   = 10 * time.Minute
+	defaultBanDuration = time.Hour
+	// banCacheTTL is how long a ban state read from Redis is trusted
+	// before it is read again.
+	banCacheTTL = time.Second
+)
+
+// remoteBan is a ban state read from Redis.
+type remoteBan struct {
+	banned bool
+	until  time.Time
+}
+
+// banTable bans client IPs for duration once they reach threshold blocking
+// matches within window, or right away when a ban rule matches. A threshold
+// of 0 leaves bans to ban rules.
+type banTable struct {
+	threshold  int
+	duration   time.Duration
+	violations *violationTracker
+	store      *redisStore
+	mu         sync.Mutex
+	bans       map[string]time.Time
+	lastSweep  time.Time
+	// remote caches the ban states read from Redis for banCacheTTL.
+	remote          map[string]remoteBan
+	lastRemoteSweep time.Time
+}
+
+// newBanTable returns nil when banThreshold is not set and no rule bans.
+func newBanTable(config *Config, store *redisStore, rulesBan bool) (*banTable, error) {
+	if config.BanThreshold < 0 {
+		return nil, fmt.Errorf("banThreshold: must not be negative, got %d", config.BanThreshold)
+	}
+	if config.BanThreshold == 0 && !rulesBan {
+		return nil, nil
+	}
+
+	window, err := parsePositiveDuration(config.BanWindow, defaultBanWindow)
+	if err != nil {
+		return nil, fmt.Errorf("banWindow: %w", err)
+	}
+	duration, err := parsePositiveDuration(config.BanDuration, defaultBanDuration)
+	if err != nil {
+		return nil, fmt.Errorf("banDuration: %w", err)
+	}
+
+	return &banTable{
+		threshold: config.BanThreshold,
+		duration:  duration,
+		violations: &violationTracker{
+			window:   window,
+			clients:  make(map[string]*violationCounter),
+			store:    store,
+			keyspace: "banViolations",
+		},
+		store:  store,
+		bans:   make(map[string]time.Time),
+		remote: make(map[string]remoteBan),
+	}, nil
+}
+
+// recordViolation counts a blocking match of client and bans it once the
+// threshold is reached. It reports whether the client got banned.
+func (b *banTable) recordViolation(client string, now time.Time) bool {
+	if b.threshold == 0 || b.violations.record(client, now) < b.threshold {
+		return false
+	}
+	b.ban(client, now)
+	return true
+}
+
+// ban bans client for the ban duration.
+func (b *banTable) ban(client string, now time.Time) {
+	if b.store != nil {
+		if err := b.store.set("bans:"+client, b.duration); err != nil {
+			b.store.warnf("falling back to local ban: %v", err)
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sweep(now)
+	b.bans[client] = now.Add(b.duration)
+}
+
+// banned reports whether client is currently banned, by this instance or,
+// with Redis, by any instance. Ban states read from Redis are cached for
+// banCacheTTL so requests do not wait on Redis every time.
+func (b *banTable) banned(client string, now time.Time) bool {
+	b.mu.Lock()
+	if until, ok := b.bans[client]; ok {
+		if now.Before(until) {
+			b.mu.Unlock()
+			return true
+		}
+		delete(b.bans, client)
+	}
+	cached, ok := b.remote[client]
+	b.mu.Unlock()
+
+	if b.store == nil {
+		return false
+	}
+	if ok && now.Before(cached.until) {
+		return cached.banned
+	}
+
+	ttl, err := b.store.ttl("bans:" + client)
+	if err != nil {
+		b.store.warnf("falling back to local bans: %v", err)
+		return false
+	}
+	// A ban without an expiry would never end, so it is limited to one
+	// banDuration from now.
+	if ttl < 0 {
+		if err := b.store.expire("bans:"+client, b.duration); err != nil {
+			b.store.warnf("failed to set the expiry of a ban: %v", err)
+		}
+		ttl = b.duration
+	}
+
+	cached = remoteBan{banned: ttl != 0, until: now.Add(banCacheTTL)}
+	if ttl > 0 && ttl < banCacheTTL {
+		cached.until = now.Add(ttl)
+	}
+	b.mu.Lock()
+	b.sweepRemote(now)
+	b.remote[client] = cached
+	b.mu.Unlock()
+	return cached.banned
+}
+
+// size returns the number of local bans, including expired bans not swept
+// yet. Bans kept in Redis are not counted.
+func (b *banTable) size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.bans)
+}
+
+// sweep drops expired bans at most once per ban duration. Callers hold mu.
+func (b *banTable) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < b.duration {
+		return
+	}
+	b.lastSweep = now
+
+	for client, until := range b.bans {
+		if !now.Before(until) {
+			delete(b.bans, client)
+		}
+	}
+}
+
+// sweepRemote drops expired ban states read from Redis at most once per
+// banCacheTTL. Callers hold mu.
+func (b *banTable) sweepRemote(now time.Time) {
+	if now.Sub(b.lastRemoteSweep) < banCacheTTL {
+		return
+	}
+	b.lastRemoteSweep = now
+
+	for client, cached := range b.remote {
+		if !now.Before(cached.until) {
+			delete(b.remote, client)
+		}
+	}
+}
+
+// parsePositiveDuration parses raw, returning fallback when it is empty.
+func parsePositiveDuration(raw string, fallback time.Duration) (time.Duration, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+
+	duration, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, err
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("must be positive, got %s", duration)
+	}
+	return duration, nil
+}
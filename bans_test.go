@@ -0,0 +1,83 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestTemporaryBan(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Scan"}}
+	cfg.BlockedIPsStatusCode = http.StatusGone
+	cfg.BanThreshold = 2
+	cfg.BanDuration = "100ms"
+
+	next := &noopHandler{}
+	p, err := tbua.New(context.Background(), next, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	send := func(remoteAddr string, scan bool) int {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = remoteAddr
+		if scan {
+			req.Header.Set("X-Scan", "1")
+		}
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	steps := []struct {
+		name       string
+		remoteAddr string
+		scan       bool
+		expected   int
+	}{
+		{name: "FirstViolation", remoteAddr: "192.0.2.1:1", scan: true, expected: http.StatusForbidden},
+		{name: "CleanBeforeBan", remoteAddr: "192.0.2.1:1", expected: http.StatusTeapot},
+		{name: "SecondViolationBans", remoteAddr: "192.0.2.1:1", scan: true, expected: http.StatusForbidden},
+		{name: "CleanWhileBanned", remoteAddr: "192.0.2.1:1", expected: http.StatusGone},
+		{name: "OtherClient", remoteAddr: "192.0.2.2:1", expected: http.StatusTeapot},
+	}
+
+	for _, step := range steps {
+		if code := send(step.remoteAddr, step.scan); code != step.expected {
+			t.Fatalf("%s: expected %d, got %d", step.name, step.expected, code)
+		}
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if code := send("192.0.2.1:1", false); code != http.StatusTeapot {
+		t.Fatalf("after ban: expected %d, got %d", http.StatusTeapot, code)
+	}
+}
+
+func TestInvalidBanConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(*tbua.Config)
+	}{
+		{name: "NegativeThreshold", cfg: func(c *tbua.Config) { c.BanThreshold = -1 }},
+		{name: "BadDuration", cfg: func(c *tbua.Config) { c.BanThreshold = 1; c.BanDuration = "forever" }},
+		{name: "ZeroWindow", cfg: func(c *tbua.Config) { c.BanThreshold = 1; c.BanWindow = "0s" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			tt.cfg(cfg)
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package headerblock
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// basicAuthCacheSize bounds the verified credentials remembered so
+	// PBKDF2 runs once per credential rather than once per request, and the
+	// clients whose failures are counted.
+	basicAuthCacheSize = 256
+
+	// maxPBKDF2Iterations bounds the work a single wrong password costs.
+	// The key derivation runs in the plugin interpreter, so it is kept
+	// just above passlib's default of 29000.
+	maxPBKDF2Iterations = 30000
+
+	// basicAuthMaxFailures wrong passwords within basicAuthFailureWindow
+	// stop a client IP, and separately a user, from running PBKDF2 until
+	// the window ends. Client IPs can be forged through forwarding headers,
+	// the per-user count bounds the work however many IPs are used.
+	basicAuthMaxFailures   = 5
+	basicAuthFailureWindow = time.Minute
+)
+
+// basicAuthBypass lets requests with listed Basic credentials skip the
+// rules. Passwords are stored as PBKDF2-SHA256 hashes; bcrypt needs a
+// cipher that is not part of the Go standard library plugins are limited to.
+type basicAuthBypass struct {
+	users    map[string]pbkdf2Hash
+	verified *lruCache
+	failures *lruCache
+
+	// userFailures counts the key derivations of every listed user that
+	// did not end in a verified password, including those still running.
+	mu           sync.Mutex
+	userFailures map[string]basicAuthFailures
+}
+
+// basicAuthFailures counts the wrong passwords of a client or user until
+// expires.
+type basicAuthFailures struct {
+	count   int
+	expires time.Time
+}
+
+// pbkdf2Hash is a hash in the passlib format
+// $pbkdf2-sha256$<iterations>$<salt>$<key>.
+type pbkdf2Hash struct {
+	iterations int
+	salt       []byte
+	key        []byte
+}
+
+func newBasicAuthBypass(config *Config) (*basicAuthBypass, error) {
+	if len(config.BasicAuthBypass) == 0 {
+		return nil, nil
+	}
+
+	bypass := &basicAuthBypass{
+		users:    make(map[string]pbkdf2Hash, len(config.BasicAuthBypass)),
+		verified: newLRUCache(basicAuthCacheSize),
+		failures: newLRUCache(basicAuthCacheSize),
+
+		userFailures: make(map[string]basicAuthFailures, len(config.BasicAuthBypass)),
+	}
+	for i, entry := range config.BasicAuthBypass {
+		user, rawHash, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("basicAuthBypass[%d]: expected user:hash", i)
+		}
+		hash, err := parsePBKDF2Hash(rawHash)
+		if err != nil {
+			return nil, fmt.Errorf("basicAuthBypass[%d]: %w", i, err)
+		}
+		bypass.users[user] = hash
+	}
+	return bypass, nil
+}
+
+func parsePBKDF2Hash(raw string) (pbkdf2Hash, error) {
+	if strings.HasPrefix(raw, "$2a$") || strings.HasPrefix(raw, "$2b$") || strings.HasPrefix(raw, "$2y$") {
+		return pbkdf2Hash{}, errors.New("bcrypt hashes are not supported, use $pbkdf2-sha256$")
+	}
+
+	parts := strings.Split(raw, "$")
+	if len(parts) != 5 || parts[0] != "" || parts[1] != "pbkdf2-sha256" {
+		return pbkdf2Hash{}, errors.New("expected a $pbkdf2-sha256$<iterations>$<salt>$<key> hash")
+	}
+
+	iterations, err := strconv.Atoi(parts[2])
+	if err != nil || iterations < 1 {
+		return pbkdf2Hash{}, fmt.Errorf("invalid iteration count %q", parts[2])
+	}
+	if iterations > maxPBKDF2Iterations {
+		return pbkdf2Hash{}, fmt.Errorf("iteration count %d exceeds the maximum of %d", iterations, maxPBKDF2Iterations)
+	}
+	salt, err := decodeAdaptedBase64(parts[3])
+	if err != nil {
+		return pbkdf2Hash{}, fmt.Errorf("invalid salt: %w", err)
+	}
+	key, err := decodeAdaptedBase64(parts[4])
+	if err != nil || len(key) == 0 {
+		return pbkdf2Hash{}, errors.New("invalid key")
+	}
+	return pbkdf2Hash{iterations: iterations, salt: salt, key: key}, nil
+}
+
+// decodeAdaptedBase64 decodes passlib's unpadded base64 using "." for "+".
+func decodeAdaptedBase64(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.ReplaceAll(s, ".", "+"))
+}
+
+// allows reports whether the request carries listed Basic credentials.
+// Credentials that are not cached are only verified while both the client
+// and the user are under basicAuthMaxFailures.
+func (b *basicAuthBypass) allows(req *http.Request, clientIP string, now time.Time) bool {
+	user, password, ok := req.BasicAuth()
+	if !ok {
+		return false
+	}
+	hash, ok := b.users[user]
+	if !ok {
+		return false
+	}
+
+	digest := sha256.Sum256([]byte(user + ":" + password))
+	cacheKey := hex.EncodeToString(digest[:])
+	if _, ok := b.verified.get(cacheKey); ok {
+		return true
+	}
+
+	failures := basicAuthFailures{expires: now.Add(basicAuthFailureWindow)}
+	if cached, ok := b.failures.get(clientIP); ok && now.Before(cached.(basicAuthFailures).expires) {
+		failures = cached.(basicAuthFailures)
+	}
+	if failures.count >= basicAuthMaxFailures || !b.reserve(user, now) {
+		return false
+	}
+
+	derived := pbkdf2SHA256([]byte(password), hash.salt, hash.iterations, len(hash.key))
+	if subtle.ConstantTimeCompare(derived, hash.key) != 1 {
+		failures.count++
+		b.failures.add(clientIP, failures)
+		return false
+	}
+	b.unreserve(user)
+	b.verified.add(cacheKey, true)
+	return true
+}
+
+// reserve counts a key derivation for user up front, so concurrent wrong
+// passwords cannot exceed basicAuthMaxFailures either. It reports false
+// when the user is over the limit.
+func (b *basicAuthBypass) reserve(user string, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failures := b.userFailures[user]
+	if !now.Before(failures.expires) {
+		failures = basicAuthFailures{expires: now.Add(basicAuthFailureWindow)}
+	}
+	if failures.count >= basicAuthMaxFailures {
+		return false
+	}
+	failures.count++
+	b.userFailures[user] = failures
+	return true
+}
+
+// unreserve takes back the count of a derivation that verified the
+// password.
+func (b *basicAuthBypass) unreserve(user string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if failures := b.userFailures[user]; failures.count > 0 {
+		failures.count--
+		b.userFailures[user] = failures
+	}
+}
+
+// pbkdf2SHA256 derives a key as specified by RFC 8018 with HMAC-SHA256.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLength int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var derived []byte
+	for block := uint32(1); len(derived) < keyLength; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		derived = append(derived, t...)
+	}
+	return derived[:keyLength]
+}
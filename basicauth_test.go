@@ -0,0 +1,122 @@
+package headerblock_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+// devPasswordHash is the $pbkdf2-sha256$ hash of "dev-password".
+const devPasswordHash = "$pbkdf2-sha256$1000$c2FsdHNhbHQxMjM0NTY3OA$s4JKNq4W9phie3lWLU0irAmEo.rBkdVwWm/5yuNGwGQ"
+
+func TestBasicAuthBypass(t *testing.T) {
+	tests := []struct {
+		name           string
+		user           string
+		password       string
+		expectedStatus int
+	}{
+		{name: "NoCredentials", expectedStatus: http.StatusForbidden},
+		{name: "Valid", user: "dev", password: "dev-password", expectedStatus: http.StatusTeapot},
+		{name: "WrongPassword", user: "dev", password: "guess", expectedStatus: http.StatusForbidden},
+		{name: "UnknownUser", user: "ops", password: "dev-password", expectedStatus: http.StatusForbidden},
+	}
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "^X-Debug$"}}
+	cfg.BasicAuthBypass = []string{"dev:" + devPasswordHash}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Twice, so the second request is answered from the cache.
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest(http.MethodGet, "/test", nil)
+				req.Header.Set("X-Debug", "1")
+				if tt.user != "" {
+					req.SetBasicAuth(tt.user, tt.password)
+				}
+
+				rr := httptest.NewRecorder()
+				p.ServeHTTP(rr, req)
+
+				if rr.Code != tt.expectedStatus {
+					t.Fatalf("request %d: expected %d, got %d", i, tt.expectedStatus, rr.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestBasicAuthBypassFailureLimit(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "^X-Debug$"}}
+	cfg.BasicAuthBypass = []string{"dev:" + devPasswordHash, "ops:" + devPasswordHash}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	send := func(remoteAddr, user, password string) int {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Debug", "1")
+		req.SetBasicAuth(user, password)
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// Five wrong passwords from one client, spread over two users.
+	for i, user := range []string{"dev", "dev", "dev", "ops", "ops"} {
+		if code := send("192.0.2.1:1", user, "guess"); code != http.StatusForbidden {
+			t.Fatalf("guess %d: expected %d, got %d", i, http.StatusForbidden, code)
+		}
+	}
+	if code := send("192.0.2.1:1", "dev", "dev-password"); code != http.StatusForbidden {
+		t.Fatalf("client after the limit: expected %d, got %d", http.StatusForbidden, code)
+	}
+	if code := send("192.0.2.2:1", "dev", "dev-password"); code != http.StatusTeapot {
+		t.Fatalf("other client: expected %d, got %d", http.StatusTeapot, code)
+	}
+	// Verified credentials are cached and no longer depend on the limit.
+	if code := send("192.0.2.1:1", "dev", "dev-password"); code != http.StatusTeapot {
+		t.Fatalf("cached credentials: expected %d, got %d", http.StatusTeapot, code)
+	}
+
+	// Changing the client IP for every guess still reaches the limit of
+	// the user.
+	for i := 0; i < 3; i++ {
+		if code := send(fmt.Sprintf("198.51.100.%d:1", i+1), "ops", "guess"); code != http.StatusForbidden {
+			t.Fatalf("rotated guess %d: expected %d, got %d", i, http.StatusForbidden, code)
+		}
+	}
+	if code := send("203.0.113.1:1", "ops", "dev-password"); code != http.StatusForbidden {
+		t.Fatalf("user after the limit: expected %d, got %d", http.StatusForbidden, code)
+	}
+}
+
+func TestInvalidBasicAuthBypass(t *testing.T) {
+	for _, entry := range []string{
+		"dev",
+		"dev:$2y$10$abcdefghijklmnopqrstuuJq3N0XyJ6hY0VbS0zC0m1rxl3b5v5.",
+		"dev:$pbkdf2-sha256$0$c2FsdA$a2V5",
+		"dev:$pbkdf2-sha256$30001$c2FsdA$a2V5",
+	} {
+		cfg := tbua.CreateConfig()
+		cfg.BasicAuthBypass = []string{entry}
+
+		if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+			t.Errorf("expected error for %q", entry)
+		}
+	}
+}
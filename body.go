@@ -0,0 +1,55 @@
+package headerblock
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+const defaultBodyInspectLimit = 8192
+
+// replayBody returns the buffered start of a body followed by the rest of
+// the original body.
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+// filterBody matches the body rules against the first bodyInspectLimit bytes
+// of the request body. The bytes read are replayed to the next handler. It
+// reports whether the request was denied.
+func (c *headerBlock) filterBody(ev *evaluation) bool {
+	if len(ev.rules.bodyRules) == 0 || !hasBody(ev.req) || isGRPC(ev.req) {
+		return false
+	}
+
+	// A read error is returned again by the original body once the
+	// buffered bytes are replayed, so the next handler still sees it.
+	prefix, _ := io.ReadAll(io.LimitReader(ev.req.Body, int64(c.bodyInspectLimit)))
+	ev.req.Body = replayBody{Reader: io.MultiReader(bytes.NewReader(prefix), ev.req.Body), Closer: ev.req.Body}
+	if len(prefix) == 0 {
+		return false
+	}
+
+	values := []string{string(prefix)}
+	for _, bodyRule := range ev.rules.bodyRules {
+		if !bodyRule.appliesTo(ev.req) || !applyRule(bodyRule, "", values) {
+			continue
+		}
+		c.hits.inc(bodyRule.id)
+
+		entry := logEntry{Rule: bodyRule.id, Header: "body"}
+		if c.enforce(ev, bodyRule, entry, "request body") == outcomeDenied {
+			return true
+		}
+	}
+	return false
+}
+
+// hasBody reports whether a request may carry a body.
+func hasBody(req *http.Request) bool {
+	if req.Body == nil || req.Body == http.NoBody {
+		return false
+	}
+	return req.ContentLength != 0 || len(req.TransferEncoding) > 0
+}
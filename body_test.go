@@ -0,0 +1,106 @@
+package headerblock_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+// bodyRecorder keeps the body received by the next handler.
+type bodyRecorder struct {
+	body string
+}
+
+func (b *bodyRecorder) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	data, _ := io.ReadAll(req.Body)
+	b.body = string(data)
+	rw.WriteHeader(http.StatusTeapot)
+}
+
+func TestBodyRules(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		grpc           bool
+		expectedStatus int
+	}{
+		{name: "clean body", path: "/", body: "name=alice", expectedStatus: http.StatusTeapot},
+		{name: "payload in body", path: "/", body: "q=1%20UNION%20SELECT%20password", expectedStatus: http.StatusForbidden},
+		{name: "payload after limit", path: "/", body: strings.Repeat("a", 32) + "union select", expectedStatus: http.StatusTeapot},
+		{name: "path scoped rule", path: "/comments", body: "<script>", expectedStatus: http.StatusForbidden},
+		{name: "path scoped rule elsewhere", path: "/other", body: "<script>", expectedStatus: http.StatusTeapot},
+		{name: "grpc call", path: "/", body: "union select", grpc: true, expectedStatus: http.StatusTeapot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.BodyRules = []tbua.HeaderConfig{
+				{Value: `(?i)union\s+select`, Normalize: []string{"urlDecode"}},
+				{Value: "<script", PathRegex: "^/comments"},
+			}
+			cfg.BodyInspectLimit = 32
+
+			next := &bodyRecorder{}
+			p, err := tbua.New(context.Background(), next, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.grpc {
+				req.Header.Set("Content-Type", "application/grpc")
+			}
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Code == http.StatusTeapot && next.body != tt.body {
+				t.Fatalf("expected the backend to receive %q, got %q", tt.body, next.body)
+			}
+		})
+	}
+}
+
+func TestInvalidBodyRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(cfg *tbua.Config)
+	}{
+		{
+			name:   "name pattern",
+			config: func(cfg *tbua.Config) { cfg.BodyRules = []tbua.HeaderConfig{{Name: "X-Token", Value: "a"}} },
+		},
+		{
+			name:   "missing value",
+			config: func(cfg *tbua.Config) { cfg.BodyRules = []tbua.HeaderConfig{{Action: "log"}} },
+		},
+		{
+			name:   "strip action",
+			config: func(cfg *tbua.Config) { cfg.BodyRules = []tbua.HeaderConfig{{Value: "a", Action: "strip"}} },
+		},
+		{
+			name:   "negative limit",
+			config: func(cfg *tbua.Config) { cfg.BodyInspectLimit = -1 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			tt.config(cfg)
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected error for invalid body rules")
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package headerblock
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultBypassTokenHeader = "X-HeaderBlock-Bypass"
+
+// BypassTokenConfig configures signed tokens letting clients skip the rules.
+// A token has the form "<id>.<expiry>.<signature>": expiry is a Unix time,
+// 0 for none, and signature the hex HMAC-SHA256 of "<id>.<expiry>" with
+// Secret. Tokens are revoked by listing their id in Revoked or by rotating
+// the secret.
+type BypassTokenConfig struct {
+	Secret  string   `json:"secret,omitempty"`
+	Header  string   `json:"header,omitempty"`
+	Revoked []string `json:"revoked,omitempty"`
+}
+
+// bypassTokens verifies bypass tokens.
+type bypassTokens struct {
+	secret  []byte
+	header  string
+	revoked map[string]struct{}
+}
+
+func newBypassTokens(config *Config) (*bypassTokens, error) {
+	if config.BypassToken.Secret == "" {
+		if config.BypassToken.Header != "" || len(config.BypassToken.Revoked) > 0 {
+			return nil, errors.New("bypassToken.secret: required")
+		}
+		return nil, nil
+	}
+
+	tokens := &bypassTokens{
+		secret:  []byte(config.BypassToken.Secret),
+		header:  strings.TrimSpace(config.BypassToken.Header),
+		revoked: make(map[string]struct{}, len(config.BypassToken.Revoked)),
+	}
+	if tokens.header == "" {
+		tokens.header = defaultBypassTokenHeader
+	}
+	for _, id := range config.BypassToken.Revoked {
+		tokens.revoked[strings.TrimSpace(id)] = struct{}{}
+	}
+	return tokens, nil
+}
+
+// allows reports whether the request carries a valid, unexpired and
+// unrevoked token.
+func (b *bypassTokens) allows(req *http.Request, now time.Time) bool {
+	token := req.Header.Get(b.header)
+	if token == "" {
+		return false
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	id, rawExpiry, rawSignature := parts[0], parts[1], parts[2]
+
+	signature, err := hex.DecodeString(rawSignature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, b.secret)
+	mac.Write([]byte(id + "." + rawExpiry))
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return false
+	}
+
+	if _, ok := b.revoked[id]; ok {
+		return false
+	}
+	expiry, err := strconv.ParseInt(rawExpiry, 10, 64)
+	if err != nil {
+		return false
+	}
+	return expiry == 0 || now.Unix() < expiry
+}
@@ -0,0 +1,80 @@
+package headerblock_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func newBypassToken(secret, id string, expiry int64) string {
+	payload := id + "." + strconv.FormatInt(expiry, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return payload + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestBypassToken(t *testing.T) {
+	const secret = "s3cr3t"
+	future := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{name: "NoToken", expectedStatus: http.StatusForbidden},
+		{name: "Valid", token: newBypassToken(secret, "partner-a", future), expectedStatus: http.StatusTeapot},
+		{name: "NoExpiry", token: newBypassToken(secret, "partner-a", 0), expectedStatus: http.StatusTeapot},
+		{name: "Expired", token: newBypassToken(secret, "partner-a", time.Now().Add(-time.Minute).Unix()), expectedStatus: http.StatusForbidden},
+		{name: "Revoked", token: newBypassToken(secret, "partner-b", future), expectedStatus: http.StatusForbidden},
+		{name: "WrongSecret", token: newBypassToken("guess", "partner-a", future), expectedStatus: http.StatusForbidden},
+		{name: "Malformed", token: "partner-a." + strconv.FormatInt(future, 10), expectedStatus: http.StatusForbidden},
+	}
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "^X-Debug$"}}
+	cfg.BypassToken = tbua.BypassTokenConfig{
+		Secret:  secret,
+		Header:  "X-Partner-Token",
+		Revoked: []string{"partner-b"},
+	}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("X-Debug", "1")
+			if tt.token != "" {
+				req.Header.Set("X-Partner-Token", tt.token)
+			}
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestBypassTokenRequiresSecret(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.BypassToken.Header = "X-Partner-Token"
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error for bypassToken without secret")
+	}
+}
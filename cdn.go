@@ -0,0 +1,97 @@
+package headerblock
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// cdnProvider names a CDN whose edge servers report the client IP in a
+// header of their own.
+type cdnProvider struct {
+	header string
+	// ranges are the edge networks the provider publishes, empty when it
+	// publishes none and cdnRanges must list them.
+	ranges []string
+}
+
+// cdnProviders are the supported cdnProvider values. The Cloudflare and
+// Fastly ranges are the lists published at https://www.cloudflare.com/ips/
+// and https://api.fastly.com/public-ip-list; cdnRanges replaces them when
+// they change. Akamai and Azure Front Door ranges depend on the account.
+var cdnProviders = map[string]cdnProvider{
+	"cloudflare": {
+		header: "Cf-Connecting-Ip",
+		ranges: []string{
+			"173.245.48.0/20", "103.21.244.0/22", "103.22.200.0/22", "103.31.4.0/22",
+			"141.101.64.0/18", "108.162.192.0/18", "190.93.240.0/20", "188.114.96.0/20",
+			"197.234.240.0/22", "198.41.128.0/17", "162.158.0.0/15", "104.16.0.0/13",
+			"104.24.0.0/14", "172.64.0.0/13", "131.0.72.0/22",
+			"2400:cb00::/32", "2606:4700::/32", "2803:f800::/32", "2405:b500::/32",
+			"2405:8100::/32", "2a06:98c0::/29", "2c0f:f248::/32",
+		},
+	},
+	"fastly": {
+		header: "Fastly-Client-Ip",
+		ranges: []string{
+			"23.235.32.0/20", "43.249.72.0/22", "103.244.50.0/24", "103.245.222.0/23",
+			"103.245.224.0/24", "104.156.80.0/20", "140.248.64.0/18", "140.248.128.0/17",
+			"146.75.0.0/17", "151.101.0.0/16", "157.52.64.0/18", "167.82.0.0/17",
+			"167.82.128.0/20", "167.82.160.0/20", "167.82.224.0/20", "172.111.64.0/18",
+			"185.31.16.0/22", "199.27.72.0/21", "199.232.0.0/16",
+			"2a04:4e40::/32", "2a04:4e42::/32",
+		},
+	},
+	"akamai": {header: "True-Client-Ip"},
+	"azure":  {header: "X-Azure-Clientip"},
+}
+
+// cdnClientIP reads the client IP from the header of a CDN, trusted only on
+// connections from the CDN's edge networks.
+type cdnClientIP struct {
+	header string
+	ranges ipList
+}
+
+func newCDNClientIP(config *Config) (*cdnClientIP, error) {
+	name := strings.ToLower(strings.TrimSpace(config.CDNProvider))
+	if name == "" {
+		if len(config.CDNRanges) > 0 {
+			return nil, fmt.Errorf("cdnRanges: requires cdnProvider")
+		}
+		return nil, nil
+	}
+	provider, ok := cdnProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("cdnProvider: unknown provider %q", config.CDNProvider)
+	}
+	if config.IPFromRemoteAddrOnly {
+		return nil, fmt.Errorf("cdnProvider: cannot be combined with ipFromRemoteAddrOnly")
+	}
+
+	ranges := provider.ranges
+	if len(config.CDNRanges) > 0 {
+		ranges = config.CDNRanges
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("cdnRanges: required for cdnProvider %s, which publishes no ranges", name)
+	}
+	cdn := &cdnClientIP{
+		header: provider.header,
+		ranges: parseIPNets(ranges, "cdnRanges", config.Log),
+	}
+	if cdn.ranges.empty() {
+		return nil, fmt.Errorf("cdnRanges: no valid network")
+	}
+	return cdn, nil
+}
+
+// clientIP returns the address in the CDN header when remoteIP is one of the
+// CDN's edge servers, nil otherwise.
+func (c *cdnClientIP) clientIP(req *http.Request, remoteIP net.IP) net.IP {
+	if !isIPAllowed(remoteIP, c.ranges) {
+		return nil
+	}
+	return net.ParseIP(strings.TrimSpace(req.Header.Get(c.header)))
+}
@@ -0,0 +1,90 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestCDNProvider(t *testing.T) {
+	tests := []struct {
+		name           string
+		provider       string
+		ranges         []string
+		remoteAddr     string
+		header         string
+		value          string
+		expectedStatus int
+	}{
+		{name: "cloudflare edge", provider: "cloudflare", remoteAddr: "173.245.48.10:443", header: "CF-Connecting-IP", value: "203.0.113.7", expectedStatus: http.StatusForbidden},
+		{name: "cloudflare IPv6 edge", provider: "Cloudflare", remoteAddr: "[2606:4700::1]:443", header: "CF-Connecting-IP", value: "203.0.113.7", expectedStatus: http.StatusForbidden},
+		{name: "forged outside the edge", provider: "cloudflare", remoteAddr: "198.51.100.1:443", header: "CF-Connecting-IP", value: "192.0.2.1", expectedStatus: http.StatusTeapot},
+		{name: "bypass keeps connection address", provider: "cloudflare", remoteAddr: "203.0.113.7:443", header: "CF-Connecting-IP", value: "192.0.2.1", expectedStatus: http.StatusForbidden},
+		{name: "edge without header", provider: "cloudflare", remoteAddr: "173.245.48.10:443", expectedStatus: http.StatusTeapot},
+		{name: "invalid header value", provider: "cloudflare", remoteAddr: "173.245.48.10:443", header: "CF-Connecting-IP", value: "unknown", expectedStatus: http.StatusTeapot},
+		{name: "fastly edge", provider: "fastly", remoteAddr: "151.101.1.1:443", header: "Fastly-Client-IP", value: "203.0.113.7", expectedStatus: http.StatusForbidden},
+		{name: "akamai ranges", provider: "akamai", ranges: []string{"198.51.100.0/24"}, remoteAddr: "198.51.100.9:443", header: "True-Client-IP", value: "203.0.113.7", expectedStatus: http.StatusForbidden},
+		{name: "azure ranges", provider: "azure", ranges: []string{"198.51.100.0/24"}, remoteAddr: "198.51.100.9:443", header: "X-Azure-ClientIP", value: "203.0.113.7", expectedStatus: http.StatusForbidden},
+		{name: "ranges replace built-in list", provider: "cloudflare", ranges: []string{"198.51.100.0/24"}, remoteAddr: "173.245.48.10:443", header: "CF-Connecting-IP", value: "203.0.113.7", expectedStatus: http.StatusTeapot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.BlockedIPs = []string{"203.0.113.7"}
+			cfg.ClientIPStrategy = []string{"RemoteAddr"}
+			cfg.CDNProvider = tt.provider
+			cfg.CDNRanges = tt.ranges
+
+			p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidCDNProvider(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(cfg *tbua.Config)
+	}{
+		{name: "unknown provider", config: func(cfg *tbua.Config) { cfg.CDNProvider = "bunny" }},
+		{name: "ranges without provider", config: func(cfg *tbua.Config) { cfg.CDNRanges = []string{"198.51.100.0/24"} }},
+		{name: "akamai without ranges", config: func(cfg *tbua.Config) { cfg.CDNProvider = "akamai" }},
+		{name: "invalid ranges", config: func(cfg *tbua.Config) {
+			cfg.CDNProvider = "azure"
+			cfg.CDNRanges = []string{"not-a-network"}
+		}},
+		{name: "remote address only", config: func(cfg *tbua.Config) {
+			cfg.CDNProvider = "cloudflare"
+			cfg.IPFromRemoteAddrOnly = true
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			tt.config(cfg)
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected error for invalid CDN configuration")
+			}
+		})
+	}
+}
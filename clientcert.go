@@ -0,0 +1,219 @@
+package headerblock
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Headers set by Traefik's passTLSClientCert middleware.
+const (
+	clientCertHeader     = "X-Forwarded-Tls-Client-Cert"
+	clientCertInfoHeader = "X-Forwarded-Tls-Client-Cert-Info"
+)
+
+// Client certificate fields matched by the name of a certificate rule.
+const (
+	certFieldSubject   = "subject"
+	certFieldSubjectCN = "subjectcn"
+	certFieldIssuer    = "issuer"
+	certFieldIssuerCN  = "issuercn"
+	certFieldSAN       = "san"
+)
+
+// prepareCertRules compiles a client certificate section. The name of each
+// rule selects one certificate field instead of being a pattern.
+func prepareCertRules(headerConfig []HeaderConfig, section string, logEnabled bool) ([]rule, error) {
+	var problems []string
+	for i, certRule := range headerConfig {
+		switch strings.ToLower(strings.TrimSpace(certRule.Name)) {
+		case certFieldSubject, certFieldSubjectCN, certFieldIssuer, certFieldIssuerCN, certFieldSAN:
+		default:
+			problems = append(problems, fmt.Sprintf("%s[%d].name: unknown certificate field %q", section, i, certRule.Name))
+		}
+		if strings.EqualFold(strings.TrimSpace(certRule.Action), actionStrip) {
+			problems = append(problems, fmt.Sprintf("%s[%d].action: %s is not supported", section, i, actionStrip))
+		}
+		if certRule.Negate || len(certRule.All) > 0 {
+			problems = append(problems, fmt.Sprintf("%s[%d]: negate and all are not supported", section, i))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid rules: %s", strings.Join(problems, "; "))
+	}
+
+	rules, err := prepareRules(headerConfig, section, logEnabled)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		field := strings.ToLower(strings.TrimSpace(headerConfig[i].Name))
+		rules[i].name = literalMatcher{matchType: matchExact, pattern: field, fold: true}
+		rules[i].literalName = ""
+	}
+	return rules, nil
+}
+
+// clientCert returns the fields of the client certificate forwarded by
+// Traefik, parsed once per request. It is empty without a certificate.
+func (e *evaluation) clientCert() map[string][]string {
+	if !e.certParsed {
+		e.certFields = parseClientCert(e.req.Header)
+		e.certParsed = true
+	}
+	return e.certFields
+}
+
+// parseClientCert reads the leaf certificate from the PEM header and falls
+// back to the info header when only that one is forwarded.
+func parseClientCert(header http.Header) map[string][]string {
+	if raw := header.Get(clientCertHeader); raw != "" {
+		if fields := parseCertPEM(raw); fields != nil {
+			return fields
+		}
+	}
+	if raw := header.Get(clientCertInfoHeader); raw != "" {
+		return parseCertInfo(raw)
+	}
+	return nil
+}
+
+// parseCertPEM parses the URL-escaped, comma-separated base64 DER chain of
+// the PEM header. Only the first (leaf) certificate is used.
+func parseCertPEM(raw string) map[string][]string {
+	unescaped, err := url.QueryUnescape(raw)
+	if err != nil {
+		return nil
+	}
+	leaf := strings.SplitN(unescaped, ",", 2)[0]
+	leaf = strings.TrimPrefix(leaf, "-----BEGIN CERTIFICATE-----")
+	leaf = strings.TrimSuffix(leaf, "-----END CERTIFICATE-----")
+	leaf = strings.Join(strings.Fields(leaf), "")
+
+	der, err := base64.StdEncoding.DecodeString(leaf)
+	if err != nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil
+	}
+
+	fields := map[string][]string{
+		certFieldSubject:   {cert.Subject.String()},
+		certFieldSubjectCN: {cert.Subject.CommonName},
+		certFieldIssuer:    {cert.Issuer.String()},
+		certFieldIssuerCN:  {cert.Issuer.CommonName},
+	}
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	if len(sans) > 0 {
+		fields[certFieldSAN] = sans
+	}
+	return fields
+}
+
+// parseCertInfo parses the info header, e.g.
+// Subject="C=FR,CN=client";Issuer="CN=ca";SAN="client.example.org,10.0.0.1".
+func parseCertInfo(raw string) map[string][]string {
+	unescaped, err := url.QueryUnescape(raw)
+	if err != nil {
+		return nil
+	}
+
+	fields := make(map[string][]string)
+	for _, part := range strings.Split(unescaped, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"`)
+
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case certFieldSubject:
+			fields[certFieldSubject] = []string{value}
+			fields[certFieldSubjectCN] = []string{distinguishedNameCN(value)}
+		case certFieldIssuer:
+			fields[certFieldIssuer] = []string{value}
+			fields[certFieldIssuerCN] = []string{distinguishedNameCN(value)}
+		case certFieldSAN:
+			for _, san := range strings.Split(value, ",") {
+				if san = strings.TrimSpace(san); san != "" {
+					fields[certFieldSAN] = append(fields[certFieldSAN], san)
+				}
+			}
+		}
+	}
+	return fields
+}
+
+// distinguishedNameCN returns the common name of a comma-separated
+// distinguished name.
+func distinguishedNameCN(dn string) string {
+	for _, attribute := range strings.Split(dn, ",") {
+		if key, value, ok := strings.Cut(attribute, "="); ok && strings.EqualFold(strings.TrimSpace(key), "CN") {
+			return value
+		}
+	}
+	return ""
+}
+
+// clientCertWhitelisted reports whether the client certificate matches a
+// whitelistTLSClientCerts rule.
+func (c *headerBlock) clientCertWhitelisted(ev *evaluation) bool {
+	if len(ev.rules.whitelistCertRules) == 0 {
+		return false
+	}
+	for name, values := range ev.clientCert() {
+		if isWhitelisted(name, values, ev.ip(), ev.rules.whitelistCertRules) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterClientCert applies the tlsClientCertRules to the client certificate
+// and reports whether the request was denied.
+func (c *headerBlock) filterClientCert(ev *evaluation) bool {
+	if len(ev.rules.certRules) == 0 {
+		return false
+	}
+
+	fields := ev.clientCert()
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	// Fields are checked in a fixed order so the same rule always reports.
+	sort.Strings(names)
+
+	for _, certRule := range ev.rules.certRules {
+		if !certRule.appliesTo(ev.req) {
+			continue
+		}
+		for _, name := range names {
+			if !applyRule(certRule, name, fields[name]) {
+				continue
+			}
+			c.hits.inc(certRule.id)
+
+			entry := matchEntry(certRule, clientCertHeader, fields[name])
+			if c.enforce(ev, certRule, entry, "client certificate "+name) == outcomeDenied {
+				return true
+			}
+			break
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package headerblock_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+// newClientCertHeader returns a self-signed certificate encoded the way
+// Traefik's passTLSClientCert middleware forwards it.
+func newClientCertHeader(t *testing.T, commonName string, dnsNames ...string) string {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"Example"}},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	return url.QueryEscape(base64.StdEncoding.EncodeToString(der))
+}
+
+func TestClientCertRules(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "^X-Debug$"}}
+	cfg.TLSClientCertRules = []tbua.HeaderConfig{
+		{ID: "revoked-client", Name: "subjectCN", Value: "^revoked\\."},
+		{ID: "legacy-san", Name: "san", Value: "\\.legacy\\.example\\.org$"},
+	}
+	cfg.WhitelistTLSClientCerts = []tbua.HeaderConfig{
+		{Name: "subjectCN", Value: "^admin\\.example\\.org$"},
+	}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{name: "NoCertificate", expectedStatus: http.StatusTeapot},
+		{
+			name:           "ValidCertificate",
+			headers:        map[string]string{"X-Forwarded-Tls-Client-Cert": newClientCertHeader(t, "client.example.org", "client.example.org")},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "SubjectDenied",
+			headers:        map[string]string{"X-Forwarded-Tls-Client-Cert": newClientCertHeader(t, "revoked.example.org")},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "SANDenied",
+			headers:        map[string]string{"X-Forwarded-Tls-Client-Cert": newClientCertHeader(t, "client", "a.example.org", "b.legacy.example.org")},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "WhitelistedSkipsRules",
+			headers: map[string]string{
+				"X-Forwarded-Tls-Client-Cert": newClientCertHeader(t, "admin.example.org"),
+				"X-Debug":                     "1",
+			},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name: "InfoHeader",
+			headers: map[string]string{
+				"X-Forwarded-Tls-Client-Cert-Info": url.QueryEscape(`Subject="O=Example,CN=revoked.example.org";Issuer="CN=ca";SAN="revoked.example.org"`),
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "UnparsableCertificate",
+			headers:        map[string]string{"X-Forwarded-Tls-Client-Cert": "not-a-certificate"},
+			expectedStatus: http.StatusTeapot,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidClientCertRules(t *testing.T) {
+	for _, certRule := range []tbua.HeaderConfig{
+		{Name: "fingerprint", Value: "abc"},
+		{Name: "subjectCN", Value: "x", Action: "strip"},
+	} {
+		cfg := tbua.CreateConfig()
+		cfg.TLSClientCertRules = []tbua.HeaderConfig{certRule}
+
+		if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+			t.Errorf("expected error for certificate rule %+v", certRule)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package headerblock
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// ContentTypeConfig limits the request media types accepted for the requests
+// matching Methods (all when empty) and PathRegex (all when empty).
+type ContentTypeConfig struct {
+	Methods   []string `json:"methods,omitempty"`
+	PathRegex string   `json:"pathRegex,omitempty"`
+	// Types are media types such as application/json, text/* or
+	// "text/plain; charset=utf-8"; parameters must be sent with the same
+	// value.
+	Types []string `json:"types,omitempty"`
+}
+
+// contentTypeScope is a compiled ContentTypeConfig.
+type contentTypeScope struct {
+	id      string
+	methods map[string]struct{}
+	path    *regexp.Regexp
+	types   []mediaRange
+}
+
+// mediaRange is a parsed allowed media type; type and subtype may be "*".
+type mediaRange struct {
+	typ     string
+	subtype string
+	params  map[string]string
+}
+
+func newContentTypeScopes(configs []ContentTypeConfig) ([]contentTypeScope, error) {
+	scopes := make([]contentTypeScope, 0, len(configs))
+	for i, config := range configs {
+		scope := contentTypeScope{id: fmt.Sprintf("allowedContentTypes[%d]", i)}
+		if len(config.Types) == 0 {
+			return nil, fmt.Errorf("%s.types: required", scope.id)
+		}
+
+		for _, method := range config.Methods {
+			if scope.methods == nil {
+				scope.methods = make(map[string]struct{}, len(config.Methods))
+			}
+			scope.methods[strings.ToUpper(strings.TrimSpace(method))] = struct{}{}
+		}
+		if config.PathRegex != "" {
+			path, err := regexp.Compile(config.PathRegex)
+			if err != nil {
+				return nil, fmt.Errorf("%s.pathRegex: %w", scope.id, err)
+			}
+			scope.path = path
+		}
+		for _, raw := range config.Types {
+			allowed, err := parseMediaRange(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s.types: %w", scope.id, err)
+			}
+			scope.types = append(scope.types, allowed)
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
+
+// parseMediaRange parses a media type with optional parameters. Type and
+// subtype are lowercased by mime.ParseMediaType.
+func parseMediaRange(raw string) (mediaRange, error) {
+	mediaType, params, err := mime.ParseMediaType(raw)
+	if err != nil {
+		return mediaRange{}, fmt.Errorf("invalid media type %q: %w", raw, err)
+	}
+	typ, subtype, ok := strings.Cut(mediaType, "/")
+	if !ok || typ == "" || subtype == "" || (typ == "*" && subtype != "*") {
+		return mediaRange{}, fmt.Errorf("invalid media type %q", raw)
+	}
+	return mediaRange{typ: typ, subtype: subtype, params: params}, nil
+}
+
+// matches reports whether the media type sent covers r, i.e. has its type,
+// subtype and every parameter of r.
+func (r mediaRange) matches(sent mediaRange) bool {
+	if (r.typ != "*" && r.typ != sent.typ) || (r.subtype != "*" && r.subtype != sent.subtype) {
+		return false
+	}
+	for name, value := range r.params {
+		if !strings.EqualFold(sent.params[name], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// applies reports whether the scope covers the request.
+func (s contentTypeScope) applies(req *http.Request) bool {
+	if s.methods != nil {
+		if _, ok := s.methods[req.Method]; !ok {
+			return false
+		}
+	}
+	return s.path == nil || s.path.MatchString(req.URL.Path)
+}
+
+// allows reports whether the Content-Type values of a request are accepted.
+// Requests without a body need no Content-Type.
+func (s contentTypeScope) allows(req *http.Request) bool {
+	values := req.Header.Values("Content-Type")
+	switch len(values) {
+	case 0:
+		return req.ContentLength == 0 && len(req.TransferEncoding) == 0
+	case 1:
+	default:
+		return false
+	}
+
+	sent, err := parseMediaRange(values[0])
+	if err != nil || sent.typ == "*" || sent.subtype == "*" {
+		return false
+	}
+	for _, allowed := range s.types {
+		if allowed.matches(sent) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkContentType denies requests whose Content-Type the first scope
+// covering them does not allow, and reports whether it did. Clients in
+// allowedIPs are exempt.
+func (c *headerBlock) checkContentType(ev *evaluation) bool {
+	if len(c.contentTypes) == 0 || c.allowedIP(ev) {
+		return false
+	}
+
+	for _, scope := range c.contentTypes {
+		if !scope.applies(ev.req) {
+			continue
+		}
+		if scope.allows(ev.req) {
+			return false
+		}
+
+		entry := logEntry{
+			Decision: decisionContentType,
+			Rule:     scope.id,
+			Header:   "Content-Type",
+		}
+		if ip := ev.ip(); ip != nil {
+			entry.ClientIP = ip.String()
+		}
+		if c.log {
+			c.logDecision(ev.req, entry, "access denied - Content-Type from IP %s not allowed by %s", entry.ClientIP, scope.id)
+		}
+		c.recordBlock(ev.req, entry)
+		c.deny(ev.rw, ev.req, http.StatusUnsupportedMediaType, entry)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestAllowedContentTypes(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.AllowedContentTypes = []tbua.ContentTypeConfig{
+		{Methods: []string{"post"}, PathRegex: "^/upload", Types: []string{"multipart/form-data", "image/*"}},
+		{Methods: []string{"POST", "PUT"}, PathRegex: "^/api/", Types: []string{"application/json; charset=utf-8", "application/x-www-form-urlencoded"}},
+	}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		contentTypes   []string
+		expectedStatus int
+	}{
+		{name: "allowed with parameters", method: http.MethodPost, path: "/api/users", body: "{}", contentTypes: []string{"Application/JSON; charset=UTF-8"}, expectedStatus: http.StatusTeapot},
+		{name: "missing required parameter", method: http.MethodPost, path: "/api/users", body: "{}", contentTypes: []string{"application/json"}, expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "type not listed", method: http.MethodPut, path: "/api/users", body: "<a/>", contentTypes: []string{"application/xml"}, expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "wildcard subtype", method: http.MethodPost, path: "/upload/api/", body: "x", contentTypes: []string{"image/png"}, expectedStatus: http.StatusTeapot},
+		{name: "multipart boundary", method: http.MethodPost, path: "/upload", body: "x", contentTypes: []string{"multipart/form-data; boundary=abc"}, expectedStatus: http.StatusTeapot},
+		{name: "malformed type", method: http.MethodPost, path: "/upload", body: "x", contentTypes: []string{"image/png; ="}, expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "several values", method: http.MethodPost, path: "/upload", body: "x", contentTypes: []string{"image/png", "text/html"}, expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "body without type", method: http.MethodPost, path: "/api/users", body: "{}", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "no body", method: http.MethodPost, path: "/api/users", expectedStatus: http.StatusTeapot},
+		{name: "method out of scope", method: http.MethodPatch, path: "/api/users", body: "<a/>", contentTypes: []string{"application/xml"}, expectedStatus: http.StatusTeapot},
+		{name: "path out of scope", method: http.MethodPost, path: "/other", body: "<a/>", contentTypes: []string{"application/xml"}, expectedStatus: http.StatusTeapot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			for _, contentType := range tt.contentTypes {
+				req.Header.Add("Content-Type", contentType)
+			}
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidAllowedContentTypes(t *testing.T) {
+	tests := []struct {
+		name   string
+		config tbua.ContentTypeConfig
+	}{
+		{name: "no types", config: tbua.ContentTypeConfig{PathRegex: "^/api/"}},
+		{name: "invalid type", config: tbua.ContentTypeConfig{Types: []string{"json"}}},
+		{name: "wildcard type with subtype", config: tbua.ContentTypeConfig{Types: []string{"*/json"}}},
+		{name: "invalid path regex", config: tbua.ContentTypeConfig{PathRegex: "(", Types: []string{"application/json"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.AllowedContentTypes = []tbua.ContentTypeConfig{tt.config}
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected error for invalid allowedContentTypes")
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package headerblock
+
+import (
+	"strings"
+)
+
+// filterCookies applies the cookie rules to each request cookie. Stripped
+// cookies are removed from the Cookie header; every other pair is kept as
+// sent, so the backend gets them byte-for-byte. It reports whether the
+// request was denied.
+func (c *headerBlock) filterCookies(ev *evaluation) bool {
+	if len(ev.rules.cookieRules) == 0 {
+		return false
+	}
+
+	lines := ev.req.Header["Cookie"]
+	if len(lines) == 0 {
+		return false
+	}
+
+	var (
+		kept     []string
+		stripped bool
+	)
+	for _, line := range lines {
+		for _, pair := range strings.Split(line, ";") {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+			name, value, _ := strings.Cut(pair, "=")
+			name = strings.TrimSpace(name)
+			value = strings.TrimSpace(value)
+			if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
+				value = value[1 : len(value)-1]
+			}
+
+			keep := true
+			values := []string{value}
+			for _, cookieRule := range ev.rules.cookieRules {
+				if !cookieRule.appliesTo(ev.req) || !applyRule(cookieRule, name, values) {
+					continue
+				}
+				c.hits.inc(cookieRule.id)
+
+				entry := logEntry{Rule: cookieRule.id, Header: "Cookie", Value: name + "=" + value}
+				result := c.enforce(ev, cookieRule, entry, "cookie "+name)
+				if result == outcomeDenied {
+					return true
+				}
+				if result == outcomeStrip {
+					keep = false
+					break
+				}
+			}
+
+			if keep {
+				kept = append(kept, pair)
+			} else {
+				stripped = true
+			}
+		}
+	}
+
+	if !stripped {
+		return false
+	}
+
+	ev.req.Header.Del("Cookie")
+	if len(kept) > 0 {
+		ev.req.Header.Set("Cookie", strings.Join(kept, "; "))
+	}
+
+	return false
+}
@@ -0,0 +1,322 @@
+package headerblock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCrowdSecTimeout       = 500 * time.Millisecond
+	defaultCrowdSecCacheTTL      = time.Minute
+	defaultCrowdSecCacheSize     = 4096
+	defaultCrowdSecScenario      = "headerblock/header-violation"
+	defaultCrowdSecAlertInterval = 10 * time.Second
+	crowdSecAlertQueueSize       = 1024
+)
+
+// crowdSecVerdict is a cached LAPI answer for one IP.
+type crowdSecVerdict struct {
+	decision string // decision type such as "ban", empty when none
+	expires  time.Time
+}
+
+// crowdSecDecision is the subset of a LAPI decision the bouncer uses.
+type crowdSecDecision struct {
+	Type  string `json:"type"`
+	Scope string `json:"scope"`
+	Value string `json:"value"`
+}
+
+// crowdSecAlert is a header rule violation pushed to the LAPI.
+type crowdSecAlert struct {
+	Scenario        string              `json:"scenario"`
+	ScenarioHash    string              `json:"scenario_hash"`
+	ScenarioVersion string              `json:"scenario_version"`
+	Message         string              `json:"message"`
+	EventsCount     int                 `json:"events_count"`
+	StartAt         string              `json:"start_at"`
+	StopAt          string              `json:"stop_at"`
+	Capacity        int                 `json:"capacity"`
+	Leakspeed       string              `json:"leakspeed"`
+	Simulated       bool                `json:"simulated"`
+	Events          []interface{}       `json:"events"`
+	Source          crowdSecAlertSource `json:"source"`
+}
+
+type crowdSecAlertSource struct {
+	Scope string `json:"scope"`
+	Value string `json:"value"`
+	IP    string `json:"ip"`
+}
+
+// crowdSecBouncer asks a CrowdSec LAPI for decisions about client IPs and
+// optionally reports header rule violations back as alerts.
+type crowdSecBouncer struct {
+	lapiURL  string
+	apiKey   string
+	client   *http.Client
+	cacheTTL time.Duration
+	cache    *lruCache
+	// retry stops querying the LAPI for a while after a failure, so an
+	// outage does not make every request wait for the timeout.
+	retry    backoff
+	warnings warnLimiter
+
+	// Alerts are only pushed when machine credentials are configured.
+	machineID string
+	password  string
+	scenario  string
+	alerts    chan crowdSecAlert
+	interval  time.Duration
+	tokenMu   sync.Mutex
+	token     string
+}
+
+func newCrowdSecBouncer(config *Config) (*crowdSecBouncer, error) {
+	if config.CrowdSecLAPIURL == "" {
+		return nil, nil
+	}
+	if config.CrowdSecAPIKey == "" {
+		return nil, fmt.Errorf("crowdSecAPIKey: required with crowdSecLAPIURL")
+	}
+
+	timeout, err := parsePositiveDuration(config.CrowdSecTimeout, defaultCrowdSecTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("crowdSecTimeout: %w", err)
+	}
+	cacheTTL, err := parsePositiveDuration(config.CrowdSecCacheTTL, defaultCrowdSecCacheTTL)
+	if err != nil {
+		return nil, fmt.Errorf("crowdSecCacheTTL: %w", err)
+	}
+
+	bouncer := &crowdSecBouncer{
+		lapiURL:   strings.TrimSuffix(config.CrowdSecLAPIURL, "/"),
+		apiKey:    config.CrowdSecAPIKey,
+		client:    &http.Client{Timeout: timeout},
+		cacheTTL:  cacheTTL,
+		cache:     newLRUCache(defaultCrowdSecCacheSize),
+		machineID: config.CrowdSecMachineID,
+		password:  config.CrowdSecPassword,
+		scenario:  defaultCrowdSecScenario,
+	}
+
+	if (bouncer.machineID == "") != (bouncer.password == "") {
+		return nil, fmt.Errorf("crowdSecMachineID and crowdSecPassword must be set together")
+	}
+	if bouncer.machineID != "" {
+		bouncer.alerts = make(chan crowdSecAlert, crowdSecAlertQueueSize)
+		if bouncer.interval, err = parsePositiveDuration(config.CrowdSecAlertInterval, defaultCrowdSecAlertInterval); err != nil {
+			return nil, fmt.Errorf("crowdSecAlertInterval: %w", err)
+		}
+	}
+
+	return bouncer, nil
+}
+
+// decision returns the type of the LAPI decision for ip, or an empty string.
+// LAPI errors are logged and let the request through, and so do the
+// requests while the bouncer backs off after an error.
+func (b *crowdSecBouncer) decision(ctx context.Context, ip string) string {
+	if cached, ok := b.cache.get(ip); ok {
+		verdict := cached.(crowdSecVerdict)
+		if time.Now().Before(verdict.expires) {
+			b.cache.count(true)
+			return verdict.decision
+		}
+	}
+	b.cache.count(false)
+
+	if !b.retry.allow(time.Now()) {
+		return ""
+	}
+	decision, err := b.queryDecision(ctx, ip)
+	if err != nil {
+		// A request canceled by its client says nothing about the LAPI.
+		if ctx.Err() == nil {
+			b.retry.failed(time.Now())
+		} else {
+			b.retry.abandoned()
+		}
+		b.warnings.printf("crowdsec lookup failed, letting requests through: %v", err)
+		return ""
+	}
+	b.retry.succeeded()
+
+	b.cache.add(ip, crowdSecVerdict{decision: decision, expires: time.Now().Add(b.cacheTTL)})
+	return decision
+}
+
+func (b *crowdSecBouncer) queryDecision(ctx context.Context, ip string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		b.lapiURL+"/v1/decisions?ip="+url.QueryEscape(ip), http.NoBody)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Api-Key", b.apiKey)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	// The LAPI answers "null" when there is no decision.
+	var decisions []crowdSecDecision
+	if err := json.NewDecoder(resp.Body).Decode(&decisions); err != nil {
+		return "", err
+	}
+	for _, decision := range decisions {
+		if decision.Type != "" {
+			return decision.Type, nil
+		}
+	}
+	return "", nil
+}
+
+// reportViolation queues an alert for a client that hit a blocking rule. It
+// is a no-op without a bouncer or machine credentials.
+func (b *crowdSecBouncer) reportViolation(entry logEntry, path string) {
+	if b == nil || b.alerts == nil || entry.ClientIP == "" {
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	alert := crowdSecAlert{
+		Scenario:        b.scenario,
+		ScenarioVersion: "1",
+		Message:         fmt.Sprintf("headerblock: %s matched rule %s on %s", entry.ClientIP, entry.Rule, path),
+		EventsCount:     1,
+		StartAt:         now,
+		StopAt:          now,
+		Leakspeed:       "0",
+		Events:          []interface{}{},
+		Source:          crowdSecAlertSource{Scope: "Ip", Value: entry.ClientIP, IP: entry.ClientIP},
+	}
+
+	select {
+	case b.alerts <- alert:
+	default:
+		log.Printf("headerblock: crowdsec alert queue full, dropping alert for %s", entry.ClientIP)
+	}
+}
+
+// runAlerts pushes queued alerts to the LAPI until ctx is done.
+func (b *crowdSecBouncer) runAlerts(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	var pending []crowdSecAlert
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case alert := <-b.alerts:
+			pending = append(pending, alert)
+		case <-ticker.C:
+			if len(pending) == 0 {
+				continue
+			}
+			if err := b.pushAlerts(ctx, pending); err != nil {
+				log.Printf("headerblock: dropping %d crowdsec alerts: %v", len(pending), err)
+			}
+			pending = nil
+		}
+	}
+}
+
+func (b *crowdSecBouncer) pushAlerts(ctx context.Context, alerts []crowdSecAlert) error {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+
+	// A token may expire at any time, so log in again once on 401.
+	for attempt := 0; attempt < 2; attempt++ {
+		token, err := b.loginToken(ctx, attempt > 0)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.lapiURL+"/v1/alerts", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := b.client.Do(req)
+		if err != nil {
+			return err
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized:
+			continue
+		case resp.StatusCode < 200 || resp.StatusCode > 299:
+			return fmt.Errorf("unexpected status %s", resp.Status)
+		default:
+			return nil
+		}
+	}
+	return fmt.Errorf("unauthorized")
+}
+
+// loginToken returns the watcher JWT, logging in when there is none yet or
+// refresh is set.
+func (b *crowdSecBouncer) loginToken(ctx context.Context, refresh bool) (string, error) {
+	b.tokenMu.Lock()
+	defer b.tokenMu.Unlock()
+
+	if b.token != "" && !refresh {
+		return b.token, nil
+	}
+
+	body, err := json.Marshal(map[string]string{"machine_id": b.machineID, "password": b.password})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.lapiURL+"/v1/watchers/login", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("login failed: %s", resp.Status)
+	}
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil {
+		return "", err
+	}
+	if login.Token == "" {
+		return "", fmt.Errorf("login failed: empty token")
+	}
+
+	b.token = login.Token
+	return b.token, nil
+}
@@ -0,0 +1,180 @@
+package headerblock_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+// fakeLAPI serves CrowdSec decisions and records pushed alerts.
+type fakeLAPI struct {
+	mu      sync.Mutex
+	queries int
+	alerts  []map[string]interface{}
+}
+
+func (f *fakeLAPI) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch req.URL.Path {
+	case "/v1/decisions":
+		if req.Header.Get("X-Api-Key") != "bouncer-key" {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+		f.queries++
+		if req.URL.Query().Get("ip") == "192.0.2.66" {
+			_, _ = rw.Write([]byte(`[{"type":"ban","scope":"Ip","value":"192.0.2.66","duration":"4h"}]`))
+			return
+		}
+		_, _ = rw.Write([]byte(`null`))
+
+	case "/v1/watchers/login":
+		_, _ = rw.Write([]byte(`{"code":200,"token":"jwt"}`))
+
+	case "/v1/alerts":
+		if req.Header.Get("Authorization") != "Bearer jwt" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var alerts []map[string]interface{}
+		_ = json.NewDecoder(req.Body).Decode(&alerts)
+		f.alerts = append(f.alerts, alerts...)
+		rw.WriteHeader(http.StatusCreated)
+
+	default:
+		rw.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestCrowdSecBouncer(t *testing.T) {
+	lapi := &fakeLAPI{}
+	server := httptest.NewServer(lapi)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Scan"}}
+	cfg.CrowdSecLAPIURL = server.URL
+	cfg.CrowdSecAPIKey = "bouncer-key"
+	cfg.CrowdSecMachineID = "traefik"
+	cfg.CrowdSecPassword = "secret"
+	cfg.CrowdSecAlertInterval = "20ms"
+
+	p, err := tbua.New(ctx, &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	send := func(remoteAddr string, scan bool) int {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = remoteAddr
+		if scan {
+			req.Header.Set("X-Scan", "1")
+		}
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := send("192.0.2.66:1", false); code != http.StatusForbidden {
+		t.Errorf("banned IP: expected %d, got %d", http.StatusForbidden, code)
+	}
+	if code := send("192.0.2.1:1", false); code != http.StatusTeapot {
+		t.Errorf("clean IP: expected %d, got %d", http.StatusTeapot, code)
+	}
+	if code := send("192.0.2.1:1", true); code != http.StatusForbidden {
+		t.Errorf("violation: expected %d, got %d", http.StatusForbidden, code)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lapi.mu.Lock()
+		alerts := len(lapi.alerts)
+		lapi.mu.Unlock()
+		if alerts > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("alert was never pushed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	lapi.mu.Lock()
+	defer lapi.mu.Unlock()
+
+	if lapi.queries != 2 {
+		t.Errorf("expected cached decisions, got %d queries", lapi.queries)
+	}
+	source, _ := lapi.alerts[0]["source"].(map[string]interface{})
+	if source["value"] != "192.0.2.1" || lapi.alerts[0]["scenario"] != "headerblock/header-violation" {
+		t.Errorf("unexpected alert %v", lapi.alerts[0])
+	}
+}
+
+func TestCrowdSecOutageBacksOff(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		queries int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		queries++
+		mu.Unlock()
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var buf lockedBuffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	cfg := tbua.CreateConfig()
+	cfg.CrowdSecLAPIURL = server.URL
+	cfg.CrowdSecAPIKey = "bouncer-key"
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	// Every client misses the cache, yet only the first one queries the
+	// LAPI; the others are let through during the backoff.
+	for i := 1; i <= 5; i++ {
+		if code := statusFrom(p, fmt.Sprintf("192.0.2.%d:1", i)); code != http.StatusTeapot {
+			t.Fatalf("client %d: expected %d, got %d", i, http.StatusTeapot, code)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if queries != 1 {
+		t.Errorf("expected a single query during the outage, got %d", queries)
+	}
+	if count := strings.Count(buf.String(), "crowdsec lookup failed"); count != 1 {
+		t.Errorf("expected one warning, got %d:\n%s", count, buf.String())
+	}
+}
+
+func TestCrowdSecRequiresAPIKey(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.CrowdSecLAPIURL = "http://crowdsec:8080"
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error without crowdSecAPIKey")
+	}
+}
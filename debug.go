@@ -0,0 +1,16 @@
+package headerblock
+
+import "net/http"
+
+// debugRuleHeader names the rule behind a decision when debug is enabled.
+const debugRuleHeader = "X-HeaderBlock-Rule"
+
+// setDebugHeader reports the rule that denied the request, or the decision
+// for checks that are not rules such as blockedIPs.
+func (c *headerBlock) setDebugHeader(rw http.ResponseWriter, entry logEntry) {
+	rule := entry.Rule
+	if rule == "" {
+		rule = entry.Decision
+	}
+	rw.Header().Set(debugRuleHeader, rule)
+}
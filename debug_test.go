@@ -0,0 +1,76 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestDebugRuleHeader(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         func(*tbua.Config)
+		remoteAddr     string
+		expectedStatus int
+		expectedRule   string
+	}{
+		{
+			name:           "DeniedByRule",
+			expectedStatus: http.StatusForbidden,
+			expectedRule:   "debug-header",
+		},
+		{
+			name:           "DeniedByBlockedIPs",
+			config:         func(c *tbua.Config) { c.BlockedIPs = []string{"192.0.2.1"} },
+			remoteAddr:     "192.0.2.1:1234",
+			expectedStatus: http.StatusForbidden,
+			expectedRule:   "ip-blocked",
+		},
+		{
+			name:           "DryRun",
+			config:         func(c *tbua.Config) { c.DryRun = true },
+			expectedStatus: http.StatusTeapot,
+			expectedRule:   "debug-header",
+		},
+		{
+			name:           "DebugDisabled",
+			config:         func(c *tbua.Config) { c.Debug = false },
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.Debug = true
+			cfg.RequestHeaders = []tbua.HeaderConfig{{ID: "debug-header", Name: "X-Debug"}}
+			if tt.config != nil {
+				tt.config(cfg)
+			}
+
+			p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("X-Debug", "1")
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if got := rr.Header().Get("X-HeaderBlock-Rule"); got != tt.expectedRule {
+				t.Fatalf("expected rule header %q, got %q", tt.expectedRule, got)
+			}
+		})
+	}
+}
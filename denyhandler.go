@@ -0,0 +1,85 @@
+package headerblock
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+// Request headers telling the deny handler why the request was denied.
+const (
+	denyDecisionHeader = "X-Headerblock-Decision"
+	denyRuleHeader     = "X-Headerblock-Rule"
+)
+
+// Option configures the middleware beyond the dynamic configuration, for
+// programs embedding it with NewWithOptions.
+type Option func(*options)
+
+type options struct {
+	denyHandler http.Handler
+}
+
+// WithDenyHandler hands denied requests to h, e.g. a honeypot or a challenge
+// page, instead of writing the deny response.
+func WithDenyHandler(h http.Handler) Option {
+	return func(o *options) {
+		o.denyHandler = h
+	}
+}
+
+// newDenyHandler returns the handler of denied requests: the one set with
+// WithDenyHandler or a reverse proxy to denyProxyURL. It returns nil when
+// denied requests get the deny response.
+func newDenyHandler(config *Config, opts options) (http.Handler, error) {
+	if config.DenyProxyURL == "" {
+		if opts.denyHandler != nil && config.DenyMode == denyModeDrop {
+			return nil, fmt.Errorf("denyMode: drop cannot be combined with a deny handler")
+		}
+		return opts.denyHandler, nil
+	}
+	if opts.denyHandler != nil {
+		return nil, fmt.Errorf("denyProxyURL: cannot be combined with WithDenyHandler")
+	}
+	if config.DenyMode == denyModeDrop {
+		return nil, fmt.Errorf("denyProxyURL: cannot be combined with denyMode drop")
+	}
+
+	target, err := url.Parse(config.DenyProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("denyProxyURL: %w", err)
+	}
+	if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("denyProxyURL: must be an absolute http or https URL, got %q", config.DenyProxyURL)
+	}
+
+	statusCode := config.DenyStatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusForbidden
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	// An unreachable backend must not let the request through or leak the
+	// proxy error, so the client gets the bare deny status code.
+	proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
+		if config.Log {
+			log.Printf("headerblock: deny proxy %s failed: %v", target.Host, err)
+		}
+		rw.WriteHeader(statusCode)
+	}
+	return proxy, nil
+}
+
+// handOff passes a denied request to the deny handler, telling it the
+// decision and the rule in request headers.
+func (c *headerBlock) handOff(rw http.ResponseWriter, req *http.Request, entry logEntry) {
+	req = req.Clone(req.Context())
+	req.Header.Set(denyDecisionHeader, entry.Decision)
+	if entry.Rule != "" {
+		req.Header.Set(denyRuleHeader, entry.Rule)
+	} else {
+		req.Header.Del(denyRuleHeader)
+	}
+	c.denyHandler.ServeHTTP(rw, req)
+}
@@ -0,0 +1,148 @@
+package headerblock_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestWithDenyHandler(t *testing.T) {
+	var denied *http.Request
+	honeypot := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		denied = req
+		rw.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(rw, "welcome")
+	})
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{ID: "scanner", Name: "User-Agent", Value: "sqlmap"},
+	}
+	cfg.BlockedIPs = []string{"203.0.113.7"}
+
+	next := &noopHandler{}
+	p, err := tbua.NewWithOptions(context.Background(), next, cfg, pluginName, tbua.WithDenyHandler(honeypot))
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		userAgent        string
+		remoteAddr       string
+		expectedStatus   int
+		expectedDecision string
+		expectedRule     string
+	}{
+		{name: "rule", userAgent: "sqlmap/1.7", expectedStatus: http.StatusOK, expectedDecision: "denied", expectedRule: "scanner"},
+		{name: "blocked IP", remoteAddr: "203.0.113.7:1234", expectedStatus: http.StatusOK, expectedDecision: "ip-blocked"},
+		{name: "allowed", userAgent: "curl/8.0", expectedStatus: http.StatusTeapot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			denied = nil
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			// A client cannot pass its own rule name to the deny handler.
+			req.Header.Set("X-Headerblock-Rule", "forged")
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedDecision == "" {
+				if denied != nil {
+					t.Fatal("expected the deny handler not to be called")
+				}
+				return
+			}
+			if denied == nil {
+				t.Fatal("expected the deny handler to be called")
+			}
+			if got := denied.Header.Get("X-Headerblock-Decision"); got != tt.expectedDecision {
+				t.Errorf("expected decision %q, got %q", tt.expectedDecision, got)
+			}
+			if got := denied.Header.Get("X-Headerblock-Rule"); got != tt.expectedRule {
+				t.Errorf("expected rule %q, got %q", tt.expectedRule, got)
+			}
+		})
+	}
+}
+
+func TestDenyProxyURL(t *testing.T) {
+	var decision string
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		decision = req.Header.Get("X-Headerblock-Decision")
+		rw.WriteHeader(http.StatusUnauthorized)
+		_, _ = io.WriteString(rw, "challenge")
+	}))
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Scan"},
+	}
+	cfg.DenyProxyURL = backend.URL
+	cfg.DenyBody = "blocked"
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Scan", "1")
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve()
+	if rr.Code != http.StatusUnauthorized || rr.Body.String() != "challenge" || decision != "denied" {
+		t.Fatalf("expected the challenge backend response, got %d %q (decision %q)", rr.Code, rr.Body.String(), decision)
+	}
+
+	// An unreachable backend still denies the request.
+	backend.Close()
+	if rr := serve(); rr.Code != http.StatusForbidden || rr.Body.Len() != 0 {
+		t.Fatalf("expected an empty %d, got %d %q", http.StatusForbidden, rr.Code, rr.Body.String())
+	}
+}
+
+func TestInvalidDenyHandler(t *testing.T) {
+	handler := http.NotFoundHandler()
+	tests := []struct {
+		name   string
+		config func(cfg *tbua.Config)
+		opts   []tbua.Option
+	}{
+		{name: "relative URL", config: func(cfg *tbua.Config) { cfg.DenyProxyURL = "/honeypot" }},
+		{name: "unsupported scheme", config: func(cfg *tbua.Config) { cfg.DenyProxyURL = "ftp://honeypot" }},
+		{name: "URL with drop", config: func(cfg *tbua.Config) {
+			cfg.DenyProxyURL = "http://honeypot:8080"
+			cfg.DenyMode = "drop"
+		}},
+		{name: "handler with drop", config: func(cfg *tbua.Config) { cfg.DenyMode = "drop" }, opts: []tbua.Option{tbua.WithDenyHandler(handler)}},
+		{name: "handler with URL", config: func(cfg *tbua.Config) { cfg.DenyProxyURL = "http://honeypot:8080" }, opts: []tbua.Option{tbua.WithDenyHandler(handler)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			tt.config(cfg)
+
+			if _, err := tbua.NewWithOptions(context.Background(), &noopHandler{}, cfg, pluginName, tt.opts...); err == nil {
+				t.Fatal("expected error for invalid deny handler")
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package headerblock
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+)
+
+const (
+	// denyModeRespond writes the deny status code, headers and body.
+	denyModeRespond = "respond"
+	// denyModeDrop closes the connection without a response, like nginx's
+	// 444.
+	denyModeDrop = "drop"
+)
+
+func parseDenyMode(config *Config) (string, error) {
+	switch config.DenyMode {
+	case "", denyModeRespond:
+		return denyModeRespond, nil
+	case denyModeDrop:
+		return denyModeDrop, nil
+	default:
+		return "", fmt.Errorf("denyMode: must be %s or %s, got %q", denyModeRespond, denyModeDrop, config.DenyMode)
+	}
+}
+
+// drop closes the connection of a denied request without writing anything.
+// Connections that cannot be hijacked, such as HTTP/2 streams, get the bare
+// status code with Connection: close and no body instead.
+func (c *headerBlock) drop(rw http.ResponseWriter, statusCode int) {
+	conn, _, err := http.NewResponseController(rw).Hijack()
+	if err == nil {
+		if err := conn.Close(); err != nil && c.log {
+			log.Printf("headerblock: failed to close dropped connection: %v", err)
+		}
+		return
+	}
+
+	rw.Header().Set("Connection", "close")
+	rw.Header().Set("Content-Length", "0")
+	rw.WriteHeader(statusCode)
+}
@@ -0,0 +1,95 @@
+package headerblock_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func newDropPlugin(t *testing.T) http.Handler {
+	t.Helper()
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Scan"},
+	}
+	cfg.DenyMode = "drop"
+	cfg.DenyBody = "blocked"
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+	return p
+}
+
+func TestDenyModeDrop(t *testing.T) {
+	server := httptest.NewServer(newDropPlugin(t))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example.com\r\nX-Scan: 1\r\n\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(conn); err != nil || len(data) != 0 {
+		t.Fatalf("expected the connection to close without a response, got %q (%v)", data, err)
+	}
+
+	// Allowed requests are still answered.
+	conn, err = net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusTeapot {
+		t.Fatalf("expected %d, got %d", http.StatusTeapot, resp.StatusCode)
+	}
+}
+
+func TestDenyModeDropWithoutHijacking(t *testing.T) {
+	p := newDropPlugin(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Scan", "1")
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d", http.StatusForbidden, rr.Code)
+	}
+	if rr.Header().Get("Connection") != "close" || rr.Body.Len() != 0 {
+		t.Fatalf("expected an empty response with Connection: close, got %v %q", rr.Header(), rr.Body.String())
+	}
+}
+
+func TestInvalidDenyMode(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.DenyMode = "reset"
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error for invalid denyMode")
+	}
+}
@@ -0,0 +1,197 @@
+package headerblock
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// denyPageData are the variables available to denyTemplateFile.
+type denyPageData struct {
+	StatusCode int
+	Status     string
+	RequestID  string
+	ClientIP   string
+	Rule       string
+	Decision   string
+	Host       string
+	Path       string
+	Time       string
+}
+
+// loadDenyTemplate parses denyTemplateFile. The page replaces denyBody, so
+// both cannot be set.
+func loadDenyTemplate(config *Config) (*template.Template, error) {
+	if config.DenyTemplateFile == "" {
+		return nil, nil
+	}
+	if config.DenyBody != "" {
+		return nil, errors.New("denyTemplateFile: cannot be combined with denyBody")
+	}
+
+	data, err := os.ReadFile(config.DenyTemplateFile)
+	if err != nil {
+		return nil, fmt.Errorf("denyTemplateFile: %w", err)
+	}
+	tmpl, err := template.New("denyTemplateFile").Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("denyTemplateFile: %w", err)
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, denyPageData{}); err != nil {
+		return nil, fmt.Errorf("denyTemplateFile: %w", err)
+	}
+	return tmpl, nil
+}
+
+// loadDenyJSONTemplate parses denyJSONBody, sent instead of the regular deny
+// body to clients that prefer JSON. It must render valid JSON.
+func loadDenyJSONTemplate(config *Config) (*texttemplate.Template, error) {
+	if config.DenyJSONBody == "" {
+		return nil, nil
+	}
+
+	tmpl, err := texttemplate.New("denyJSONBody").Option("missingkey=error").Parse(config.DenyJSONBody)
+	if err != nil {
+		return nil, fmt.Errorf("denyJSONBody: %w", err)
+	}
+	var sample bytes.Buffer
+	if err := tmpl.Execute(&sample, denyPageData{StatusCode: http.StatusForbidden, Status: `"quoted"`}.jsonEscaped()); err != nil {
+		return nil, fmt.Errorf("denyJSONBody: %w", err)
+	}
+	if !json.Valid(sample.Bytes()) {
+		return nil, fmt.Errorf("denyJSONBody: not valid JSON: %s", sample.String())
+	}
+	return tmpl, nil
+}
+
+// jsonEscaped returns d with its strings escaped for use inside JSON strings.
+func (d denyPageData) jsonEscaped() denyPageData {
+	for _, field := range []*string{&d.Status, &d.RequestID, &d.ClientIP, &d.Rule, &d.Decision, &d.Host, &d.Path, &d.Time} {
+		quoted, _ := json.Marshal(*field)
+		*field = string(quoted[1 : len(quoted)-1])
+	}
+	return d
+}
+
+// prefersJSON reports whether the Accept header ranks a JSON media type above
+// text/html. As in RFC 9110, a type named explicitly takes the quality of
+// that range instead of a wildcard's; on a tie the explicitly named type
+// wins, so "application/json, */*" prefers JSON and browsers get the page.
+func prefersJSON(accept string) bool {
+	jsonQuality := newMediaQuality()
+	htmlQuality := newMediaQuality()
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(mediaRange, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if key, value, ok := strings.Cut(param, "="); ok && strings.TrimSpace(key) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					quality = q
+				}
+			}
+		}
+
+		switch {
+		case mediaType == "application/json" || (strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json")):
+			jsonQuality.explicit = math.Max(jsonQuality.explicit, quality)
+		case mediaType == "text/html":
+			htmlQuality.explicit = math.Max(htmlQuality.explicit, quality)
+		case mediaType == "application/*":
+			jsonQuality.wildcard = math.Max(jsonQuality.wildcard, quality)
+		case mediaType == "text/*":
+			htmlQuality.wildcard = math.Max(htmlQuality.wildcard, quality)
+		case mediaType == "*/*":
+			jsonQuality.wildcard = math.Max(jsonQuality.wildcard, quality)
+			htmlQuality.wildcard = math.Max(htmlQuality.wildcard, quality)
+		}
+	}
+
+	if jsonQuality.value() != htmlQuality.value() {
+		return jsonQuality.value() > htmlQuality.value()
+	}
+	return jsonQuality.value() > 0 && jsonQuality.explicit >= 0 && htmlQuality.explicit < 0
+}
+
+// mediaQuality is the quality of a media type from the ranges naming it
+// explicitly, -1 when none does, and from wildcard ranges.
+type mediaQuality struct {
+	explicit float64
+	wildcard float64
+}
+
+func newMediaQuality() mediaQuality {
+	return mediaQuality{explicit: -1}
+}
+
+func (m mediaQuality) value() float64 {
+	if m.explicit >= 0 {
+		return m.explicit
+	}
+	return m.wildcard
+}
+
+// denyPageData returns the variables of the deny bodies for a denied request.
+func (c *headerBlock) denyPageData(req *http.Request, statusCode int, entry logEntry) denyPageData {
+	requestID := c.requestID(req)
+	if requestID == "" {
+		requestID = req.Header.Get(defaultRequestIDHeader)
+	}
+	clientIP := entry.ClientIP
+	if clientIP == "" {
+		if ip := c.clientIPs.resolve(req); ip != nil {
+			clientIP = ip.String()
+		}
+	}
+
+	return denyPageData{
+		StatusCode: statusCode,
+		Status:     http.StatusText(statusCode),
+		RequestID:  requestID,
+		ClientIP:   clientIP,
+		Rule:       entry.Rule,
+		Decision:   entry.Decision,
+		Host:       req.Host,
+		Path:       req.URL.Path,
+		Time:       time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// denyResponse returns the content type and body of the deny response,
+// negotiated from the Accept header when denyJSONBody is set. The body is nil
+// when a template fails, so the denial goes out without a body.
+func (c *headerBlock) denyResponse(req *http.Request, statusCode int, entry logEntry) (string, []byte) {
+	var (
+		contentType = c.denyContentType
+		body        bytes.Buffer
+		err         error
+	)
+	switch {
+	case c.denyJSONTemplate != nil && prefersJSON(req.Header.Get("Accept")):
+		contentType = "application/json"
+		err = c.denyJSONTemplate.Execute(&body, c.denyPageData(req, statusCode, entry).jsonEscaped())
+	case c.denyTemplate != nil:
+		err = c.denyTemplate.Execute(&body, c.denyPageData(req, statusCode, entry))
+	default:
+		return contentType, c.denyBody
+	}
+
+	if err != nil {
+		if c.log {
+			log.Printf("headerblock: failed to render deny body: %v", err)
+		}
+		return contentType, nil
+	}
+	return contentType, body.Bytes()
+}
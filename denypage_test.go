@@ -0,0 +1,239 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func writeDenyTemplate(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "deny.html")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+	return path
+}
+
+func TestDenyTemplateFile(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{ID: "debug-header", Name: "X-Debug"},
+	}
+	cfg.DenyTemplateFile = writeDenyTemplate(t,
+		`<p>{{.StatusCode}} {{.Status}}: request {{.RequestID}} from {{.ClientIP}} blocked by {{.Rule}} on {{.Path}}</p>`)
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/<script>", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Debug", "1")
+	req.Header.Set("X-Request-Id", "abc-123")
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Fatalf("expected HTML content type, got %q", got)
+	}
+	expected := `<p>403 Forbidden: request abc-123 from 192.0.2.1 blocked by debug-header on /&lt;script&gt;</p>`
+	if rr.Body.String() != expected {
+		t.Fatalf("expected body %q, got %q", expected, rr.Body.String())
+	}
+}
+
+func TestDenyContentNegotiation(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{ID: "debug-header", Name: "X-Debug"},
+	}
+	cfg.DenyTemplateFile = writeDenyTemplate(t, `<p>Blocked by {{.Rule}}</p>`)
+	cfg.DenyJSONBody = `{"error":"{{.Status}}","requestID":"{{.RequestID}}","rule":"{{.Rule}}"}`
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	const (
+		htmlBody = `<p>Blocked by debug-header</p>`
+		jsonBody = `{"error":"Forbidden","requestID":"a\"b","rule":"debug-header"}`
+	)
+	tests := []struct {
+		accept       string
+		expectedType string
+		expectedBody string
+	}{
+		{accept: "application/json", expectedType: "application/json", expectedBody: jsonBody},
+		{accept: "application/problem+json", expectedType: "application/json", expectedBody: jsonBody},
+		{accept: "application/json, text/plain, */*", expectedType: "application/json", expectedBody: jsonBody},
+		{accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", expectedType: "text/html; charset=utf-8", expectedBody: htmlBody},
+		{accept: "application/json;q=0.5, text/html", expectedType: "text/html; charset=utf-8", expectedBody: htmlBody},
+		{accept: "*/*", expectedType: "text/html; charset=utf-8", expectedBody: htmlBody},
+		{accept: "", expectedType: "text/html; charset=utf-8", expectedBody: htmlBody},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Debug", "1")
+			req.Header.Set("X-Request-Id", `a"b`)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if got := rr.Header().Get("Content-Type"); got != tt.expectedType {
+				t.Fatalf("expected content type %q, got %q", tt.expectedType, got)
+			}
+			if rr.Body.String() != tt.expectedBody {
+				t.Fatalf("expected body %q, got %q", tt.expectedBody, rr.Body.String())
+			}
+			if rr.Header().Get("Vary") != "Accept" {
+				t.Fatalf("expected Vary: Accept, got %q", rr.Header().Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestInvalidDenyTemplateFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(cfg *tbua.Config)
+	}{
+		{
+			name:   "missing file",
+			config: func(cfg *tbua.Config) { cfg.DenyTemplateFile = filepath.Join(t.TempDir(), "missing.html") },
+		},
+		{
+			name:   "syntax error",
+			config: func(cfg *tbua.Config) { cfg.DenyTemplateFile = writeDenyTemplate(t, "{{.Rule") },
+		},
+		{
+			name:   "unknown variable",
+			config: func(cfg *tbua.Config) { cfg.DenyTemplateFile = writeDenyTemplate(t, "{{.Value}}") },
+		},
+		{
+			name:   "invalid JSON body",
+			config: func(cfg *tbua.Config) { cfg.DenyJSONBody = `{"rule":{{.Rule}}}` },
+		},
+		{
+			name:   "unknown JSON variable",
+			config: func(cfg *tbua.Config) { cfg.DenyJSONBody = `{"value":"{{.Value}}"}` },
+		},
+		{
+			name: "combined with denyBody",
+			config: func(cfg *tbua.Config) {
+				cfg.DenyTemplateFile = writeDenyTemplate(t, "{{.Rule}}")
+				cfg.DenyBody = "blocked"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			tt.config(cfg)
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected error for invalid deny template")
+			}
+		})
+	}
+}
+
+func TestRuleDenyResponse(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.DenyBody = "denied"
+	cfg.DenyHeaders = map[string]string{"Cache-Control": "no-store"}
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Debug", StatusCode: http.StatusNotFound, Body: "404 page not found"},
+		{
+			Name:        "Authorization",
+			Value:       "^Basic ",
+			StatusCode:  http.StatusUnauthorized,
+			DenyHeaders: map[string]string{"WWW-Authenticate": `Bearer realm="api"`},
+		},
+		{Name: "X-Scan"},
+	}
+	cfg.ResponseHeaders = []tbua.HeaderConfig{
+		{Name: "X-Internal", StatusCode: http.StatusBadGateway},
+	}
+
+	tests := []struct {
+		name            string
+		header          string
+		value           string
+		upstreamHeader  string
+		expectedStatus  int
+		expectedBody    string
+		expectedHeaders map[string]string
+	}{
+		{name: "status and body", header: "X-Debug", value: "1", expectedStatus: http.StatusNotFound, expectedBody: "404 page not found", expectedHeaders: map[string]string{"Cache-Control": "no-store"}},
+		{name: "status and headers", header: "Authorization", value: "Basic Zm9vOmJhcg==", expectedStatus: http.StatusUnauthorized, expectedBody: "denied", expectedHeaders: map[string]string{"WWW-Authenticate": `Bearer realm="api"`, "Cache-Control": "no-store"}},
+		{name: "global fallback", header: "X-Scan", value: "1", expectedStatus: http.StatusForbidden, expectedBody: "denied"},
+		{name: "response rule", upstreamHeader: "X-Internal", expectedStatus: http.StatusBadGateway, expectedBody: "denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+				if tt.upstreamHeader != "" {
+					rw.Header().Set(tt.upstreamHeader, "1")
+				}
+				rw.WriteHeader(http.StatusOK)
+			})
+			p, err := tbua.New(context.Background(), next, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Body.String() != tt.expectedBody {
+				t.Fatalf("expected body %q, got %q", tt.expectedBody, rr.Body.String())
+			}
+			for name, value := range tt.expectedHeaders {
+				if got := rr.Header().Get(name); got != value {
+					t.Fatalf("expected %s %q, got %q", name, value, got)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidRuleDenyResponse(t *testing.T) {
+	for _, rule := range []tbua.HeaderConfig{
+		{Name: "X-Debug", StatusCode: 999},
+		{Name: "X-Debug", Action: "log", StatusCode: http.StatusNotFound},
+		{Name: "X-Debug", Action: "strip", Body: "gone"},
+		{Name: "X-Debug", DenyHeaders: map[string]string{"Bad Name": "1"}},
+	} {
+		cfg := tbua.CreateConfig()
+		cfg.RequestHeaders = []tbua.HeaderConfig{rule}
+
+		if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+			t.Errorf("expected error for rule %+v", rule)
+		}
+	}
+}
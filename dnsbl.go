@@ -0,0 +1,222 @@
+package headerblock
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDNSBLTimeout   = 200 * time.Millisecond
+	defaultDNSBLCacheTTL  = 10 * time.Minute
+	defaultDNSBLCacheSize = 4096
+	// maxDNSBLLookups bounds the lookups running at once. Client IPs can be
+	// chosen freely through forwarding headers, so without a bound every
+	// request with a new IP would start another lookup.
+	maxDNSBLLookups = 64
+	// dnsblLookupTimeouts is how many dnsblTimeouts a lookup may keep
+	// running in the background, so slow answers are still cached.
+	dnsblLookupTimeouts = 10
+)
+
+// dnsblVerdict is a cached DNSBL result for one IP.
+type dnsblVerdict struct {
+	zone    string // zone listing the IP, empty when not listed
+	expires time.Time
+}
+
+// dnsblChecker queries DNS blocklists for client IPs. Lookups run in the
+// background: a request waits at most timeout for the verdict and is let
+// through when it is not available yet, so the result is cached for the
+// next request from the same client. Requests are also let through without
+// a lookup while maxDNSBLLookups are running.
+type dnsblChecker struct {
+	zones      []string
+	action     string
+	timeout    time.Duration
+	ttl        time.Duration
+	cache      *lruCache
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+
+	mu       sync.Mutex
+	inflight map[string]chan struct{}
+	// lookups holds a token per running lookup.
+	lookups chan struct{}
+}
+
+func newDNSBLChecker(config *Config) (*dnsblChecker, error) {
+	var zones []string
+	for _, entry := range config.DNSBLZones {
+		for _, part := range strings.Split(entry, ",") {
+			if zone := strings.Trim(strings.TrimSpace(part), "."); zone != "" {
+				zones = append(zones, zone)
+			}
+		}
+	}
+	if len(zones) == 0 {
+		return nil, nil
+	}
+
+	checker := &dnsblChecker{
+		zones:      zones,
+		timeout:    defaultDNSBLTimeout,
+		ttl:        defaultDNSBLCacheTTL,
+		cache:      newLRUCache(defaultDNSBLCacheSize),
+		lookupHost: net.DefaultResolver.LookupHost,
+		inflight:   make(map[string]chan struct{}),
+		lookups:    make(chan struct{}, maxDNSBLLookups),
+	}
+
+	var err error
+	if checker.action, err = parseAction(config.DNSBLAction); err != nil {
+		return nil, fmt.Errorf("dnsblAction: %w", err)
+	}
+	switch checker.action {
+	case actionBlock, actionLog, actionTag:
+	default:
+		return nil, fmt.Errorf("dnsblAction: %s is not supported", checker.action)
+	}
+
+	if config.DNSBLTimeout != "" {
+		if checker.timeout, err = time.ParseDuration(config.DNSBLTimeout); err != nil {
+			return nil, fmt.Errorf("dnsblTimeout: %w", err)
+		}
+	}
+	if config.DNSBLCacheTTL != "" {
+		if checker.ttl, err = time.ParseDuration(config.DNSBLCacheTTL); err != nil {
+			return nil, fmt.Errorf("dnsblCacheTTL: %w", err)
+		}
+	}
+	if config.DNSBLCacheSize > 0 {
+		checker.cache = newLRUCache(config.DNSBLCacheSize)
+	}
+
+	return checker, nil
+}
+
+// listed returns the zone listing ip, or an empty string.
+func (d *dnsblChecker) listed(ctx context.Context, ip net.IP) string {
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() {
+		return ""
+	}
+
+	key := ip.String()
+	if cached, ok := d.cache.get(key); ok {
+		verdict := cached.(dnsblVerdict)
+		if time.Now().Before(verdict.expires) {
+			d.cache.count(true)
+			return verdict.zone
+		}
+	}
+	d.cache.count(false)
+
+	done := d.startLookup(key, ip)
+	if done == nil {
+		return ""
+	}
+
+	timer := time.NewTimer(d.timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		if cached, ok := d.cache.get(key); ok {
+			return cached.(dnsblVerdict).zone
+		}
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	return ""
+}
+
+// startLookup queries all zones for ip unless a lookup is already running and
+// returns a channel closed once the verdict is cached. It returns nil when
+// maxDNSBLLookups are already running.
+func (d *dnsblChecker) startLookup(key string, ip net.IP) chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if done, ok := d.inflight[key]; ok {
+		return done
+	}
+	select {
+	case d.lookups <- struct{}{}:
+	default:
+		return nil
+	}
+
+	done := make(chan struct{})
+	d.inflight[key] = done
+
+	go func() {
+		zone := d.query(ip)
+		d.cache.add(key, dnsblVerdict{zone: zone, expires: time.Now().Add(d.ttl)})
+
+		d.mu.Lock()
+		delete(d.inflight, key)
+		d.mu.Unlock()
+		<-d.lookups
+		close(done)
+	}()
+
+	return done
+}
+
+// query looks ip up in every zone concurrently and returns the first zone
+// that lists it.
+func (d *dnsblChecker) query(ip net.IP) string {
+	// The lookup outlives the request on purpose, it only has to be bounded.
+	ctx, cancel := context.WithTimeout(context.Background(), dnsblLookupTimeouts*d.timeout)
+	defer cancel()
+
+	prefix := reverseIP(ip)
+	results := make(chan string, len(d.zones))
+
+	for _, zone := range d.zones {
+		go func(zone string) {
+			addrs, err := d.lookupHost(ctx, prefix+"."+zone)
+			if err == nil && listedAnswer(addrs) {
+				results <- zone
+				return
+			}
+			results <- ""
+		}(zone)
+	}
+
+	for range d.zones {
+		if zone := <-results; zone != "" {
+			return zone
+		}
+	}
+	return ""
+}
+
+// listedAnswer reports whether a DNSBL answer is a listing (127.0.0.0/8).
+func listedAnswer(addrs []string) bool {
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil && ip.To4()[0] == 127 {
+			return true
+		}
+	}
+	return false
+}
+
+// reverseIP returns the DNSBL query label of ip: reversed octets for IPv4,
+// reversed nibbles for IPv6.
+func reverseIP(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+
+	const hexDigits = "0123456789abcdef"
+	ip16 := ip.To16()
+	labels := make([]string, 0, 32)
+	for i := len(ip16) - 1; i >= 0; i-- {
+		labels = append(labels, string(hexDigits[ip16[i]&0x0F]), string(hexDigits[ip16[i]>>4]))
+	}
+	return strings.Join(labels, ".")
+}
@@ -0,0 +1,202 @@
+package headerblock
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeDNSBL answers DNSBL queries for the given listed query names.
+func fakeDNSBL(listed map[string]bool, delay time.Duration, queries *int32) func(context.Context, string) ([]string, error) {
+	return func(ctx context.Context, host string) ([]string, error) {
+		atomic.AddInt32(queries, 1)
+		time.Sleep(delay)
+		if listed[host] {
+			return []string{"127.0.0.2"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+}
+
+func TestReverseIP(t *testing.T) {
+	if got := reverseIP(net.ParseIP("192.0.2.1")); got != "1.2.0.192" {
+		t.Errorf("IPv4: got %q", got)
+	}
+
+	want := "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2"
+	if got := reverseIP(net.ParseIP("2001:db8::1")); got != want {
+		t.Errorf("IPv6: got %q", got)
+	}
+}
+
+func TestDNSBL(t *testing.T) {
+	var queries int32
+
+	ctx := context.Background()
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	})
+
+	cfg := CreateConfig()
+	cfg.DNSBLZones = []string{"zen.example.org, bl.example.net"}
+
+	handler, err := New(ctx, next, cfg, "headerblock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker := handler.(*headerBlock).dnsbl
+	checker.lookupHost = fakeDNSBL(map[string]bool{"7.2.0.192.bl.example.net": true}, 0, &queries)
+
+	tests := []struct {
+		remoteAddr     string
+		expectedStatus int
+	}{
+		{remoteAddr: "192.0.2.7:1234", expectedStatus: http.StatusForbidden},
+		{remoteAddr: "192.0.2.8:1234", expectedStatus: http.StatusTeapot},
+		{remoteAddr: "10.0.0.7:1234", expectedStatus: http.StatusTeapot},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		recorder := httptest.NewRecorder()
+
+		handler.ServeHTTP(recorder, req)
+
+		if recorder.Code != test.expectedStatus {
+			t.Errorf("%s: expected status %d, got %d", test.remoteAddr, test.expectedStatus, recorder.Code)
+		}
+	}
+
+	// Cached verdicts must not trigger new lookups.
+	before := atomic.LoadInt32(&queries)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.7:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if after := atomic.LoadInt32(&queries); after != before {
+		t.Errorf("expected cached verdict, got %d new queries", after-before)
+	}
+}
+
+func TestDNSBLTimeoutFailsOpen(t *testing.T) {
+	var queries int32
+
+	checker, err := newDNSBLChecker(&Config{DNSBLZones: []string{"zen.example.org"}, DNSBLTimeout: "10ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker.lookupHost = fakeDNSBL(map[string]bool{"7.2.0.192.zen.example.org": true}, 50*time.Millisecond, &queries)
+
+	ip := net.ParseIP("192.0.2.7")
+	if zone := checker.listed(context.Background(), ip); zone != "" {
+		t.Fatalf("expected slow lookup to fail open, got %q", zone)
+	}
+
+	// The background lookup still caches its verdict for the next request.
+	deadline := time.Now().Add(time.Second)
+	for checker.listed(context.Background(), ip) == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("verdict was never cached")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := atomic.LoadInt32(&queries); got != 1 {
+		t.Errorf("expected a single lookup, got %d", got)
+	}
+}
+
+func TestDNSBLBoundsLookups(t *testing.T) {
+	checker, err := newDNSBLChecker(&Config{DNSBLZones: []string{"zen.example.org"}, DNSBLTimeout: "1ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	deadlines := make(chan time.Duration, 2*maxDNSBLLookups)
+	checker.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		deadline, _ := ctx.Deadline()
+		deadlines <- time.Until(deadline)
+		<-release
+		return nil, errors.New("no such host")
+	}
+
+	// The lookups hang, so every further client is let through without
+	// one.
+	for i := 0; i < 2*maxDNSBLLookups; i++ {
+		checker.listed(context.Background(), net.IPv4(192, 0, 2, byte(i)))
+	}
+	if got := len(checker.lookups); got != maxDNSBLLookups {
+		t.Fatalf("expected %d running lookups, got %d", maxDNSBLLookups, got)
+	}
+	close(release)
+
+	// Finished lookups free their slot.
+	deadline := time.Now().Add(time.Second)
+	for len(checker.lookups) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("lookups never finished")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := len(deadlines); got != maxDNSBLLookups {
+		t.Fatalf("expected %d lookups, got %d", maxDNSBLLookups, got)
+	}
+	if remaining := <-deadlines; remaining > dnsblLookupTimeouts*time.Millisecond {
+		t.Fatalf("expected the lookup to be bounded by dnsblTimeout, got %s", remaining)
+	}
+
+	before := len(deadlines)
+	checker.listed(context.Background(), net.ParseIP("198.51.100.1"))
+	for len(deadlines) == before {
+		if time.Now().After(deadline) {
+			t.Fatal("expected a new lookup once the others finished")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDNSBLTag(t *testing.T) {
+	var queries int32
+
+	var forwarded http.Header
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		forwarded = req.Header
+	})
+
+	cfg := CreateConfig()
+	cfg.DNSBLZones = []string{"zen.example.org"}
+	cfg.DNSBLAction = "tag"
+
+	handler, err := New(context.Background(), next, cfg, "headerblock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.(*headerBlock).dnsbl.lookupHost = fakeDNSBL(map[string]bool{"7.2.0.192.zen.example.org": true}, 0, &queries)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.7:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := forwarded.Get(defaultTagHeader); got != "dnsbl:zen.example.org" {
+		t.Errorf("expected dnsbl tag, got %q", got)
+	}
+}
+
+func TestInvalidDNSBLAction(t *testing.T) {
+	for _, action := range []string{"strip", "allow", "tarpit", "redirect", "ban", "explode"} {
+		cfg := CreateConfig()
+		cfg.DNSBLZones = []string{"zen.example.org"}
+		cfg.DNSBLAction = action
+
+		if _, err := New(context.Background(), http.NotFoundHandler(), cfg, "headerblock"); err == nil {
+			t.Errorf("expected an error for dnsblAction %s", action)
+		}
+	}
+}
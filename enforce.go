@@ -0,0 +1,306 @@
+package headerblock
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// outcome is the result of enforcing a matched rule.
+type outcome int
+
+const (
+	// outcomePass lets the request continue: the rule was bypassed, is in
+	// dry-run, or only logs or tags.
+	outcomePass outcome = iota
+	// outcomeStrip asks the caller to remove the matched element.
+	outcomeStrip
+	// outcomeDenied means the deny response has already been written.
+	outcomeDenied
+	// outcomeAllow lets the request skip the remaining request header rules.
+	outcomeAllow
+)
+
+// evaluation is the per-request state shared by all rule sections.
+type evaluation struct {
+	plugin          *headerBlock
+	rw              http.ResponseWriter
+	req             *http.Request
+	rules           *ruleSet
+	host            *hostPolicy
+	clientIP        net.IP
+	ipResolved      bool
+	countryCode     string
+	countryResolved bool
+	asNumber        uint
+	asnResolved     bool
+	tags            []string
+	// overLimit caches the violation verdict so a request matching several
+	// rules only counts as one violation.
+	overLimit         bool
+	violationRecorded bool
+	banRecorded       bool
+	// dryRunRules are the rules that would have been enforced, reported in
+	// the debug header.
+	dryRunRules []string
+	// certFields are the parsed client certificate fields.
+	certFields map[string][]string
+	certParsed bool
+	// jwtAllowed caches whether the bearer token grants a bypass.
+	jwtAllowed bool
+	jwtChecked bool
+	// tokenAllowed caches whether the bypass token header is valid.
+	tokenAllowed bool
+	tokenChecked bool
+	// basicAuthAllowed caches whether the Basic credentials are listed.
+	basicAuthAllowed bool
+	basicAuthChecked bool
+}
+
+// ip resolves the client IP once per request.
+func (e *evaluation) ip() net.IP {
+	if !e.ipResolved {
+		e.clientIP = e.plugin.clientIPs.resolve(e.req)
+		e.ipResolved = true
+	}
+	return e.clientIP
+}
+
+// country resolves the client country once per request.
+func (e *evaluation) country() string {
+	if !e.countryResolved {
+		e.countryCode = e.plugin.lookupCountry(e.ip())
+		e.countryResolved = true
+	}
+	return e.countryCode
+}
+
+// asn resolves the client autonomous system number once per request.
+func (e *evaluation) asn() uint {
+	if !e.asnResolved {
+		e.asNumber = e.plugin.lookupASN(e.ip())
+		e.asnResolved = true
+	}
+	return e.asNumber
+}
+
+// bypasses reports whether the client is exempt from r through the rule's
+// own allowedIPs or, unless precedence puts rules first, clientAllowed.
+func (c *headerBlock) bypasses(ev *evaluation, r rule) bool {
+	if isIPAllowed(ev.ip(), r.allowedIPNets) {
+		return true
+	}
+	return c.precedence.allowedIPs && c.clientAllowed(ev)
+}
+
+// clientAllowed reports whether the client is in allowedIPs,
+// allowedCountries or allowedASNs, or carries a bearer token with the
+// jwtBypassClaims, a valid bypass token or listed Basic credentials.
+func (c *headerBlock) clientAllowed(ev *evaluation) bool {
+	if c.allowedIP(ev) {
+		return true
+	}
+	if len(c.allowedCountries) > 0 && hasCountry(c.allowedCountries, ev.country()) {
+		return true
+	}
+	if len(c.allowedASNs) > 0 && hasASN(c.allowedASNs, ev.asn()) {
+		return true
+	}
+	return c.jwtAllows(ev) || c.tokenAllows(ev) || c.basicAuthAllows(ev)
+}
+
+// basicAuthAllows verifies the Basic credentials once per request.
+func (c *headerBlock) basicAuthAllows(ev *evaluation) bool {
+	if c.basicAuth == nil {
+		return false
+	}
+	if !ev.basicAuthChecked {
+		ev.basicAuthAllowed = c.basicAuth.allows(ev.req, ev.ip().String(), time.Now())
+		ev.basicAuthChecked = true
+	}
+	return ev.basicAuthAllowed
+}
+
+// tokenAllows verifies the bypass token once per request.
+func (c *headerBlock) tokenAllows(ev *evaluation) bool {
+	if c.bypassTokens == nil {
+		return false
+	}
+	if !ev.tokenChecked {
+		ev.tokenAllowed = c.bypassTokens.allows(ev.req, time.Now())
+		ev.tokenChecked = true
+	}
+	return ev.tokenAllowed
+}
+
+// jwtAllows verifies the bearer token once per request.
+func (c *headerBlock) jwtAllows(ev *evaluation) bool {
+	if c.jwt == nil {
+		return false
+	}
+	if !ev.jwtChecked {
+		ev.jwtAllowed = c.jwt.allows(ev.req, time.Now())
+		ev.jwtChecked = true
+	}
+	return ev.jwtAllowed
+}
+
+// enforce applies the bypasses and the action of a rule that matched.
+// subject describes what matched (e.g. "header User-Agent") for log messages.
+func (c *headerBlock) enforce(ev *evaluation, r rule, entry logEntry, subject string) outcome {
+	clientIP := ev.ip()
+	if clientIP != nil {
+		entry.ClientIP = clientIP.String()
+	}
+
+	if c.bypasses(ev, r) {
+		if c.log {
+			c.logDecision(ev.req, entry.withDecision(decisionIPBypass),
+				"access allowed - IP %s bypassed %s (rule %s)", clientIP, subject, r.id)
+		}
+		c.metrics.incIPBypass()
+		return outcomePass
+	}
+
+	if c.dryRun || r.dryRun {
+		c.logDecision(ev.req, entry.withDecision(decisionDryRun),
+			"dry-run - would %s %s from IP %s (rule %s)", r.action, subject, clientIP, r.id)
+		ev.dryRunRules = append(ev.dryRunRules, r.id)
+		return outcomePass
+	}
+
+	switch r.action {
+	case actionLog:
+		c.logDecision(ev.req, entry.withDecision(decisionLogged),
+			"%s from IP %s matched rule %s", subject, clientIP, r.id)
+		return outcomePass
+
+	case actionTag:
+		if c.log {
+			c.logDecision(ev.req, entry.withDecision(decisionTagged),
+				"request tagged by rule %s on %s from IP %s", r.id, subject, clientIP)
+		}
+		ev.tags = append(ev.tags, r.id)
+		return outcomePass
+
+	case actionStrip:
+		if c.log {
+			c.logDecision(ev.req, entry.withDecision(decisionStripped),
+				"%s stripped from IP %s (rule %s)", subject, clientIP, r.id)
+		}
+		return outcomeStrip
+
+	case actionAllow:
+		if c.log {
+			c.logDecision(ev.req, entry.withDecision(decisionWhitelisted),
+				"access allowed - %s from IP %s (rule %s)", subject, clientIP, r.id)
+		}
+		return outcomeAllow
+
+	case actionBan:
+		return c.enforceBan(ev, r, entry, subject)
+
+	default:
+		c.recordBanViolation(ev, entry)
+
+		if c.violations != nil {
+			return c.enforceViolation(ev, r, entry, subject)
+		}
+
+		if r.action == actionRedirect {
+			entry = entry.withDecision(decisionRedirected)
+			if c.log {
+				c.logDecision(ev.req, entry,
+					"access redirected - %s from IP %s to %s (rule %s)", subject, clientIP, r.redirectURL, r.id)
+			}
+		} else {
+			entry = entry.withDecision(decisionDenied)
+			if c.log {
+				c.logDecision(ev.req, entry,
+					"access denied - %s from IP %s (rule %s)", subject, clientIP, r.id)
+			}
+		}
+		c.recordBlock(ev.req, entry)
+		c.crowdSec.reportViolation(entry, ev.req.URL.Path)
+		c.denyRule(ev, r, r.denyStatus(c.denyStatusCode), entry)
+		return outcomeDenied
+	}
+}
+
+// denyRule writes the response of a rule that denied the request: a redirect
+// for redirect rules, the deny response otherwise, delayed for tarpit rules.
+func (c *headerBlock) denyRule(ev *evaluation, r rule, statusCode int, entry logEntry) {
+	switch r.action {
+	case actionRedirect:
+		if c.debug {
+			c.setDebugHeader(ev.rw, entry)
+		}
+		http.Redirect(ev.rw, ev.req, r.redirectURL, r.redirectStatusCode)
+		return
+	case actionTarpit:
+		c.tarpit.wait(ev.req.Context())
+	}
+	c.denyWith(ev.rw, ev.req, statusCode, entry, &r)
+}
+
+// enforceViolation counts a blocking match against the client and only
+// denies the request once the client exceeds violationLimit in the window.
+func (c *headerBlock) enforceViolation(ev *evaluation, r rule, entry logEntry, subject string) outcome {
+	if !ev.violationRecorded {
+		ev.overLimit = c.violations.record(entry.ClientIP, time.Now()) > c.violations.limit
+		ev.violationRecorded = true
+	}
+
+	if !ev.overLimit {
+		if c.log {
+			c.logDecision(ev.req, entry.withDecision(decisionTolerated),
+				"violation tolerated - %s from IP %s (rule %s)", subject, entry.ClientIP, r.id)
+		}
+		return outcomePass
+	}
+
+	entry = entry.withDecision(decisionRateLimited)
+	if c.log {
+		c.logDecision(ev.req, entry,
+			"access denied - %s from IP %s over violation limit (rule %s)", subject, entry.ClientIP, r.id)
+	}
+	c.recordBlock(ev.req, entry)
+	c.crowdSec.reportViolation(entry, ev.req.URL.Path)
+	c.denyRule(ev, r, c.violations.statusCode, entry)
+	return outcomeDenied
+}
+
+// enforceBan denies the request of a ban rule and bans the client, whatever
+// its violation count.
+func (c *headerBlock) enforceBan(ev *evaluation, r rule, entry logEntry, subject string) outcome {
+	entry = entry.withDecision(decisionBanned)
+	if c.bans != nil && entry.ClientIP != "" {
+		c.bans.ban(entry.ClientIP, time.Now())
+		ev.banRecorded = true
+		if c.log {
+			c.logDecision(ev.req, entry,
+				"access denied - %s from IP %s, banned for %s (rule %s)", subject, entry.ClientIP, c.bans.duration, r.id)
+		}
+	} else if c.log {
+		c.logDecision(ev.req, entry,
+			"access denied - %s from IP %s (rule %s)", subject, entry.ClientIP, r.id)
+	}
+	c.recordBlock(ev.req, entry)
+	c.crowdSec.reportViolation(entry, ev.req.URL.Path)
+	c.denyRule(ev, r, r.denyStatus(c.denyStatusCode), entry)
+	return outcomeDenied
+}
+
+// recordBanViolation counts a blocking match towards a temporary ban of the
+// client, once per request.
+func (c *headerBlock) recordBanViolation(ev *evaluation, entry logEntry) {
+	if c.bans == nil || ev.banRecorded || entry.ClientIP == "" {
+		return
+	}
+	ev.banRecorded = true
+
+	if c.bans.recordViolation(entry.ClientIP, time.Now()) && c.log {
+		c.logDecision(ev.req, entry.withDecision(decisionBanned),
+			"IP %s banned for %s after %d violations", entry.ClientIP, c.bans.duration, c.bans.threshold)
+	}
+}
@@ -0,0 +1,121 @@
+package headerblock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// expandConfigEnv returns a copy of config with every ${NAME} reference in
+// its string values replaced by the environment variable NAME, so patterns,
+// networks and secrets need not be written into the dynamic configuration.
+// "$${" stands for a literal "${". The copy is made through JSON, so every
+// Config field needs a json tag.
+func expandConfigEnv(config *Config) (*Config, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(data, []byte("${")) {
+		return config, nil
+	}
+
+	var values interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, err
+	}
+	if values, err = expandValue(values, ""); err != nil {
+		return nil, err
+	}
+	if data, err = json.Marshal(values); err != nil {
+		return nil, err
+	}
+
+	expanded := &Config{}
+	if err := json.Unmarshal(data, expanded); err != nil {
+		return nil, err
+	}
+	return expanded, nil
+}
+
+// expandValue expands the strings of a decoded JSON value. field is the path
+// of the value, used in errors.
+func expandValue(value interface{}, field string) (interface{}, error) {
+	var err error
+	switch v := value.(type) {
+	case string:
+		return expandEnv(v, field)
+	case []interface{}:
+		for i := range v {
+			if v[i], err = expandValue(v[i], fmt.Sprintf("%s[%d]", field, i)); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			name := key
+			if field != "" {
+				name = field + "." + key
+			}
+			if v[key], err = expandValue(item, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return value, nil
+}
+
+// expandEnv replaces the ${NAME} references in s. Referencing an unset
+// variable is an error, so a missing secret is not silently left empty.
+func expandEnv(s, field string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			break
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+
+		end := strings.IndexByte(s[i+2:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("%s: unterminated ${", field)
+		}
+		name := s[i+2 : i+2+end]
+		if !validEnvName(name) {
+			return "", fmt.Errorf("%s: invalid environment variable name %q", field, name)
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("%s: environment variable %s is not set", field, name)
+		}
+		b.WriteString(s[:i])
+		b.WriteString(value)
+		s = s[i+3+end:]
+	}
+	b.WriteString(s)
+	return b.String(), nil
+}
+
+func validEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
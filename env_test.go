@@ -0,0 +1,79 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestConfigEnvExpansion(t *testing.T) {
+	t.Setenv("HEADERBLOCK_SCANNER", "sqlmap")
+	t.Setenv("HEADERBLOCK_OFFICE", "203.0.113.0/24")
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "User-Agent", Value: "(?i)${HEADERBLOCK_SCANNER}"},
+		{Name: "X-Literal", Value: "$${HEADERBLOCK_SCANNER}", MatchType: "exact"},
+	}
+	cfg.AllowedIPs = []string{"${HEADERBLOCK_OFFICE}"}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+	if cfg.RequestHeaders[0].Value != "(?i)${HEADERBLOCK_SCANNER}" {
+		t.Fatalf("expected the configuration to be left unchanged, got %q", cfg.RequestHeaders[0].Value)
+	}
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		header         string
+		value          string
+		expectedStatus int
+	}{
+		{name: "expanded pattern", remoteAddr: "192.0.2.1:1234", header: "User-Agent", value: "SQLMap/1.7", expectedStatus: http.StatusForbidden},
+		{name: "expanded allowedIPs", remoteAddr: "203.0.113.7:1234", header: "User-Agent", value: "SQLMap/1.7", expectedStatus: http.StatusTeapot},
+		{name: "escaped reference", remoteAddr: "192.0.2.1:1234", header: "X-Literal", value: "${HEADERBLOCK_SCANNER}", expectedStatus: http.StatusForbidden},
+		{name: "escaped reference not expanded", remoteAddr: "192.0.2.1:1234", header: "X-Literal", value: "sqlmap", expectedStatus: http.StatusTeapot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set(tt.header, tt.value)
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidConfigEnvExpansion(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "unset variable", value: "${HEADERBLOCK_UNSET}"},
+		{name: "unterminated reference", value: "${HEADERBLOCK_UNSET"},
+		{name: "invalid name", value: "${1SECRET}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.JWTSecret = tt.value
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
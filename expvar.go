@@ -0,0 +1,70 @@
+package headerblock
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// expvarPrefix namespaces the published variables by middleware name, e.g.
+// headerblock.my-middleware.
+const expvarPrefix = "headerblock."
+
+// expvarHandlers maps published variable names to the latest handler of that
+// middleware. Traefik creates a new handler for every configuration reload
+// and expvar cannot unpublish variables, so each name is published once and
+// reads whichever handler is current.
+var (
+	expvarMu       sync.Mutex
+	expvarHandlers = make(map[string]*headerBlock)
+)
+
+// expvarStats is the value of the published variable.
+type expvarStats struct {
+	UptimeSeconds   float64           `json:"uptimeSeconds"`
+	Evaluated       uint64            `json:"evaluated"`
+	Blocked         uint64            `json:"blocked"`
+	WhitelistBypass uint64            `json:"whitelistBypass"`
+	IPBypass        uint64            `json:"ipBypass"`
+	HeaderInjection uint64            `json:"headerInjection"`
+	Rules           map[string]uint64 `json:"rules"`
+}
+
+// publishExpvar publishes the counters of c as headerblock.<name> in the
+// expvar registry, served on /debug/vars by programs that import expvar.
+func publishExpvar(name string, c *headerBlock) error {
+	key := expvarPrefix + name
+
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+
+	if _, published := expvarHandlers[key]; published {
+		expvarHandlers[key] = c
+		return nil
+	}
+	if expvar.Get(key) != nil {
+		return fmt.Errorf("expvar: variable %q is already published", key)
+	}
+	expvarHandlers[key] = c
+	expvar.Publish(key, expvar.Func(func() interface{} {
+		expvarMu.Lock()
+		current := expvarHandlers[key]
+		expvarMu.Unlock()
+		return current.expvarStats()
+	}))
+	return nil
+}
+
+func (c *headerBlock) expvarStats() expvarStats {
+	return expvarStats{
+		UptimeSeconds:   time.Since(c.started).Seconds(),
+		Evaluated:       atomic.LoadUint64(&c.metrics.evaluated),
+		Blocked:         atomic.LoadUint64(&c.metrics.blocked),
+		WhitelistBypass: atomic.LoadUint64(&c.metrics.whitelistBypass),
+		IPBypass:        atomic.LoadUint64(&c.metrics.ipBypass),
+		HeaderInjection: atomic.LoadUint64(&c.metrics.headerInjections),
+		Rules:           c.RuleHits(),
+	}
+}
@@ -0,0 +1,81 @@
+package headerblock_test
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+type expvarStats struct {
+	Evaluated uint64            `json:"evaluated"`
+	Blocked   uint64            `json:"blocked"`
+	Rules     map[string]uint64 `json:"rules"`
+}
+
+func readExpvar(t *testing.T, name string) expvarStats {
+	t.Helper()
+
+	v := expvar.Get(name)
+	if v == nil {
+		t.Fatalf("expvar %q is not published", name)
+	}
+	var stats expvarStats
+	if err := json.Unmarshal([]byte(v.String()), &stats); err != nil {
+		t.Fatalf("expvar %q is not JSON: %v: %s", name, err, v.String())
+	}
+	return stats
+}
+
+func TestExpvar(t *testing.T) {
+	newPlugin := func() http.Handler {
+		cfg := tbua.CreateConfig()
+		cfg.RequestHeaders = []tbua.HeaderConfig{
+			{ID: "scanner", Name: "X-Scan"},
+		}
+		cfg.Expvar = true
+
+		p, err := tbua.New(context.Background(), &noopHandler{}, cfg, "expvar-test")
+		if err != nil {
+			t.Fatalf("plugin init error: %v", err)
+		}
+		return p
+	}
+
+	p := newPlugin()
+	for _, scan := range []string{"1", "", "2"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if scan != "" {
+			req.Header.Set("X-Scan", scan)
+		}
+		p.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	stats := readExpvar(t, "headerblock.expvar-test")
+	if stats.Evaluated != 3 || stats.Blocked != 2 || stats.Rules["scanner"] != 2 {
+		t.Fatalf("unexpected counters %+v", stats)
+	}
+
+	// A configuration reload creates a new handler under the same name.
+	newPlugin()
+	if stats := readExpvar(t, "headerblock.expvar-test"); stats.Evaluated != 0 {
+		t.Fatalf("expected the counters of the new handler, got %+v", stats)
+	}
+}
+
+func TestExpvarNameTaken(t *testing.T) {
+	if expvar.Get("headerblock.expvar-taken") == nil {
+		expvar.NewInt("headerblock.expvar-taken")
+	}
+
+	cfg := tbua.CreateConfig()
+	cfg.Expvar = true
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, "expvar-taken"); err == nil {
+		t.Fatal("expected error for an expvar name published by other code")
+	}
+}
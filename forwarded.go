@@ -0,0 +1,108 @@
+package headerblock
+
+import (
+	"net/http"
+	"strings"
+)
+
+// forwardedHeader is the RFC 7239 header, used as a clientIPStrategy source
+// like X-Forwarded-For.
+const forwardedHeader = "Forwarded"
+
+// forwardedChain returns the for= node of every element of the Forwarded
+// header values, e.g. `for=192.0.2.60;proto=http, for="[2001:db8::17]:4711"`,
+// with quotes, brackets and ports removed. Elements without for= and
+// obfuscated identifiers such as "_hidden" or "unknown" are kept as written
+// so proxyDepth still counts every hop; they never parse as an address.
+func forwardedChain(values []string) []string {
+	var chain []string
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			node := "unknown"
+			for _, pair := range splitQuoted(element, ';') {
+				key, raw, ok := strings.Cut(pair, "=")
+				if ok && strings.EqualFold(strings.TrimSpace(key), "for") {
+					node = forwardedNode(unquote(strings.TrimSpace(raw)))
+					break
+				}
+			}
+			chain = append(chain, node)
+		}
+	}
+	return chain
+}
+
+// forwardedNode strips the port of a node: "[2001:db8::17]:4711" becomes
+// "2001:db8::17" and "192.0.2.43:47011" becomes "192.0.2.43".
+func forwardedNode(node string) string {
+	if strings.HasPrefix(node, "[") {
+		if end := strings.IndexByte(node, ']'); end > 0 {
+			return node[1:end]
+		}
+		return node
+	}
+	if host, _, ok := strings.Cut(node, ":"); ok && strings.Count(node, ":") == 1 {
+		return host
+	}
+	return node
+}
+
+// splitQuoted splits s at sep outside of quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var (
+		parts  []string
+		quoted bool
+		start  int
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquote removes the quotes and escapes of a quoted string and returns
+// other values unchanged.
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	var b strings.Builder
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] == '\\' && i+1 < len(s)-1 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// forwardingHeaders are the spoofable headers sanitizeForwardingHeaders
+// removes from requests that did not come from a trusted proxy.
+var forwardingHeaders = []string{"X-Forwarded-For", forwardedHeader, "X-Real-Ip", "X-Forwarded-Host"}
+
+// sanitizeForwardingHeaders removes the forwarding headers of a request whose
+// connection address is not in trustedProxies, so backends can trust them.
+// X-Real-Ip and X-Forwarded-Host are rewritten to the connection address and
+// the Host header, as Traefik sets them for untrusted clients.
+func (c *headerBlock) sanitizeForwardingHeaders(req *http.Request) {
+	remoteIP := remoteAddrIP(req)
+	if c.clientIPs.trustedProxy(remoteIP) {
+		return
+	}
+
+	for _, name := range forwardingHeaders {
+		req.Header.Del(name)
+	}
+	if remoteIP != nil {
+		req.Header.Set("X-Real-Ip", remoteIP.String())
+	}
+	req.Header.Set("X-Forwarded-Host", req.Host)
+}
@@ -0,0 +1,179 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestForwardedClientIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		forwarded      []string
+		trustedProxies []string
+		proxyDepth     int
+		expectedStatus int
+	}{
+		{name: "IPv4", forwarded: []string{"for=203.0.113.7;proto=https;host=example.com"}, expectedStatus: http.StatusForbidden},
+		{name: "IPv4 with port", forwarded: []string{`for="203.0.113.7:47011"`}, expectedStatus: http.StatusForbidden},
+		{name: "quoted IPv6", forwarded: []string{`for="[2001:db8:cafe::17]"`}, expectedStatus: http.StatusForbidden},
+		{name: "quoted IPv6 with port", forwarded: []string{`For="[2001:db8:cafe::17]:4711"`}, expectedStatus: http.StatusForbidden},
+		{name: "first of chain", forwarded: []string{"for=203.0.113.7, for=198.51.100.17"}, expectedStatus: http.StatusForbidden},
+		{name: "repeated headers", forwarded: []string{"for=203.0.113.7", "for=198.51.100.17"}, expectedStatus: http.StatusForbidden},
+		{name: "other client", forwarded: []string{"for=192.0.2.60;proto=http;by=203.0.113.43"}, expectedStatus: http.StatusTeapot},
+		{name: "quoted separators", forwarded: []string{`host="a;b,c";for=203.0.113.7`}, expectedStatus: http.StatusForbidden},
+		{name: "obfuscated falls back to RemoteAddr", forwarded: []string{"for=_hidden"}, expectedStatus: http.StatusForbidden},
+		{name: "unknown falls back to RemoteAddr", forwarded: []string{"for=unknown, for=198.51.100.17"}, expectedStatus: http.StatusForbidden},
+		{
+			name:           "trusted proxies",
+			forwarded:      []string{"for=192.0.2.60, for=203.0.113.7, for=10.0.0.2"},
+			trustedProxies: []string{"10.0.0.0/8"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "proxy depth counts obfuscated hops",
+			forwarded:      []string{"for=203.0.113.7, for=_proxy1, for=192.0.2.60"},
+			proxyDepth:     3,
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.BlockedIPs = []string{"203.0.113.7", "2001:db8:cafe::17", "10.0.0.1"}
+			cfg.ClientIPStrategy = []string{"Forwarded", "RemoteAddr"}
+			cfg.TrustedProxies = tt.trustedProxies
+			cfg.ProxyDepth = tt.proxyDepth
+			p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			for _, value := range tt.forwarded {
+				req.Header.Add("Forwarded", value)
+			}
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestSanitizeForwardingHeaders(t *testing.T) {
+	spoofed := map[string]string{
+		"X-Forwarded-For":  "192.0.2.1",
+		"Forwarded":        "for=192.0.2.1",
+		"X-Real-Ip":        "192.0.2.1",
+		"X-Forwarded-Host": "admin.internal",
+	}
+
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		expected       map[string]string
+	}{
+		{
+			name:       "untrusted client",
+			remoteAddr: "203.0.113.7:1234",
+			expected: map[string]string{
+				"X-Forwarded-For":  "",
+				"Forwarded":        "",
+				"X-Real-Ip":        "203.0.113.7",
+				"X-Forwarded-Host": "example.com",
+			},
+		},
+		{
+			name:           "client outside trusted proxies",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "203.0.113.7:1234",
+			expected: map[string]string{
+				"X-Forwarded-For":  "",
+				"Forwarded":        "",
+				"X-Real-Ip":        "203.0.113.7",
+				"X-Forwarded-Host": "example.com",
+			},
+		},
+		{
+			name:           "trusted proxy",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			expected:       spoofed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.SanitizeForwardingHeaders = true
+			cfg.TrustedProxies = tt.trustedProxies
+
+			next := &noopHandler{}
+			p, err := tbua.New(context.Background(), next, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range spoofed {
+				req.Header.Set(name, value)
+			}
+			p.ServeHTTP(httptest.NewRecorder(), req)
+
+			if next.req == nil {
+				t.Fatal("expected the request to reach the backend")
+			}
+			for name, value := range tt.expected {
+				if got := next.req.Header.Get(name); got != value {
+					t.Errorf("expected %s %q, got %q", name, value, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSanitizedHeadersAreNotTrustedForClientIP(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.SanitizeForwardingHeaders = true
+	cfg.AllowedIPs = []string{"192.0.2.1"}
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Scan"},
+	}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.RemoteAddr = "203.0.113.7:1234"
+	req.Header.Set("X-Forwarded-For", "192.0.2.1")
+	req.Header.Set("X-Scan", "1")
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected a forged X-Forwarded-For not to pass allowedIPs, got %d", rr.Code)
+	}
+}
+
+func TestSanitizeForwardingHeadersExcludesProxyDepth(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.SanitizeForwardingHeaders = true
+	cfg.ProxyDepth = 1
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error when sanitizeForwardingHeaders is combined with proxyDepth")
+	}
+}
@@ -0,0 +1,72 @@
+package headerblock
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+)
+
+// parseCountries normalizes a list of ISO 3166-1 alpha-2 codes. Entries may
+// be comma separated like allowedIPs.
+func parseCountries(raw []string) map[string]struct{} {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	countries := make(map[string]struct{})
+	for _, entry := range raw {
+		for _, part := range strings.Split(entry, ",") {
+			if code := strings.ToUpper(strings.TrimSpace(part)); code != "" {
+				countries[code] = struct{}{}
+			}
+		}
+	}
+	return countries
+}
+
+// openGeoIP opens the country database when country lists are configured.
+func openGeoIP(config *Config) (*mmdbReader, error) {
+	if len(config.AllowedCountries) == 0 && len(config.BlockedCountries) == 0 {
+		return nil, nil
+	}
+	if config.GeoIPDatabase == "" {
+		return nil, fmt.Errorf("geoIPDatabase: required by allowedCountries and blockedCountries")
+	}
+
+	reader, err := openMMDB(config.GeoIPDatabase)
+	if err != nil {
+		return nil, fmt.Errorf("geoIPDatabase: %w", err)
+	}
+	return reader, nil
+}
+
+// lookupCountry returns the ISO code of the country ip is located in, or an
+// empty string when it is unknown.
+func (c *headerBlock) lookupCountry(ip net.IP) string {
+	if c.geoIP == nil || ip == nil {
+		return ""
+	}
+
+	record, err := c.geoIP.lookup(ip)
+	if err != nil {
+		if c.log {
+			log.Printf("headerblock: GeoIP lookup failed for %s: %v", ip, err)
+		}
+		return ""
+	}
+
+	if code, ok := mmdbPath(record, "country", "iso_code").(string); ok {
+		return code
+	}
+	code, _ := mmdbPath(record, "registered_country", "iso_code").(string)
+	return code
+}
+
+func hasCountry(countries map[string]struct{}, code string) bool {
+	if code == "" {
+		return false
+	}
+	_, ok := countries[code]
+	return ok
+}
@@ -0,0 +1,68 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestGeoIPCountries(t *testing.T) {
+	database := writeTestMMDB(t, map[string]map[string]interface{}{
+		"192.0.2.0/24":    {"country": map[string]interface{}{"iso_code": "VN"}},
+		"198.51.100.0/24": {"country": map[string]interface{}{"iso_code": "RU"}},
+		"203.0.113.0/24":  {"registered_country": map[string]interface{}{"iso_code": "FR"}},
+	})
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		header         string
+		expectedStatus int
+	}{
+		{name: "BlockedCountry", remoteAddr: "198.51.100.9:1234", expectedStatus: http.StatusForbidden},
+		{name: "AllowedCountryBypassesRule", remoteAddr: "192.0.2.9:1234", header: "X-Debug", expectedStatus: http.StatusTeapot},
+		{name: "RegisteredCountryFallback", remoteAddr: "203.0.113.9:1234", header: "X-Debug", expectedStatus: http.StatusTeapot},
+		{name: "OtherCountryStillFiltered", remoteAddr: "10.0.0.1:1234", header: "X-Debug", expectedStatus: http.StatusForbidden},
+		{name: "OtherCountryClean", remoteAddr: "10.0.0.1:1234", expectedStatus: http.StatusTeapot},
+	}
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Debug"}}
+	cfg.GeoIPDatabase = database
+	cfg.AllowedCountries = []string{"vn, fr"}
+	cfg.BlockedCountries = []string{"RU"}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.header != "" {
+				req.Header.Set(tt.header, "1")
+			}
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestCountriesRequireDatabase(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.BlockedCountries = []string{"RU"}
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error without geoIPDatabase")
+	}
+}
@@ -0,0 +1,56 @@
+package headerblock
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gRPC status codes sent to denied gRPC clients.
+const (
+	grpcPermissionDenied  = 7
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcUnavailable       = 14
+	grpcUnauthenticated   = 16
+)
+
+// grpcDenyMessage is plain ASCII, so it needs no percent-encoding.
+const grpcDenyMessage = "access denied"
+
+// isGRPC reports whether req is a gRPC call. gRPC-Web is excluded: it sends
+// trailers in the body, which browsers would not expect from a denial.
+func isGRPC(req *http.Request) bool {
+	contentType := strings.ToLower(req.Header.Get("Content-Type"))
+	if !strings.HasPrefix(contentType, "application/grpc") {
+		return false
+	}
+	rest := contentType[len("application/grpc"):]
+	return rest == "" || rest[0] == '+' || rest[0] == ';'
+}
+
+// grpcStatus maps the deny status code to the gRPC status a client sees.
+func grpcStatus(statusCode int) int {
+	switch statusCode {
+	case http.StatusUnauthorized:
+		return grpcUnauthenticated
+	case http.StatusTooManyRequests:
+		return grpcResourceExhausted
+	case http.StatusNotFound:
+		return grpcUnimplemented
+	case http.StatusServiceUnavailable:
+		return grpcUnavailable
+	default:
+		return grpcPermissionDenied
+	}
+}
+
+// denyGRPC writes a Trailers-Only gRPC response: HTTP 200 without a body and
+// the status in the headers, so gRPC clients get a status such as
+// PermissionDenied instead of a protocol error.
+func denyGRPC(rw http.ResponseWriter, statusCode int) {
+	rw.Header().Set("Content-Type", "application/grpc")
+	rw.Header().Set("Grpc-Status", strconv.Itoa(grpcStatus(statusCode)))
+	rw.Header().Set("Grpc-Message", grpcDenyMessage)
+	rw.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,65 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestGRPCDenial(t *testing.T) {
+	tests := []struct {
+		name           string
+		contentType    string
+		denyStatusCode int
+		expectedStatus int
+		grpcStatus     string
+	}{
+		{name: "grpc", contentType: "application/grpc", expectedStatus: http.StatusOK, grpcStatus: "7"},
+		{name: "grpc with codec", contentType: "application/grpc+proto", expectedStatus: http.StatusOK, grpcStatus: "7"},
+		{name: "rate limit status", contentType: "application/grpc", denyStatusCode: http.StatusTooManyRequests, expectedStatus: http.StatusOK, grpcStatus: "8"},
+		{name: "unauthorized status", contentType: "application/grpc", denyStatusCode: http.StatusUnauthorized, expectedStatus: http.StatusOK, grpcStatus: "16"},
+		{name: "grpc-web", contentType: "application/grpc-web+proto", expectedStatus: http.StatusForbidden},
+		{name: "json", contentType: "application/json", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.RequestHeaders = []tbua.HeaderConfig{
+				{Name: "X-Debug"},
+			}
+			cfg.DenyStatusCode = tt.denyStatusCode
+			cfg.DenyBody = "blocked"
+
+			p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/helloworld.Greeter/SayHello", nil)
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("X-Debug", "1")
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if got := rr.Header().Get("Grpc-Status"); got != tt.grpcStatus {
+				t.Fatalf("expected grpc-status %q, got %q", tt.grpcStatus, got)
+			}
+			if tt.grpcStatus == "" {
+				return
+			}
+			if rr.Header().Get("Content-Type") != "application/grpc" || rr.Header().Get("Grpc-Message") != "access denied" {
+				t.Fatalf("unexpected gRPC headers: %v", rr.Header())
+			}
+			if rr.Body.Len() != 0 {
+				t.Fatalf("expected no body, got %q", rr.Body.String())
+			}
+		})
+	}
+}
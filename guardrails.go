@@ -0,0 +1,166 @@
+package headerblock
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	guardrailFailClosed = "fail-closed"
+	guardrailFailOpen   = "fail-open"
+)
+
+// guardrails bound the pattern matching spent on one request, so rules
+// meeting adversarially long or numerous header values cannot stall the
+// gateway. Zero limits are disabled.
+type guardrails struct {
+	// maxValueLength caps the header values request header rules match.
+	maxValueLength int
+	// maxEvaluations and maxTime are the budget of a request: rule
+	// evaluations, one per header value, and time spent matching.
+	maxEvaluations int
+	maxTime        time.Duration
+	// failOpen skips the rules left when a limit is hit instead of denying
+	// the request; values over maxValueLength are matched truncated.
+	failOpen bool
+}
+
+func newGuardrails(config *Config) (*guardrails, error) {
+	if config.MaxMatchedValueLength < 0 {
+		return nil, fmt.Errorf("maxMatchedValueLength: must not be negative, got %d", config.MaxMatchedValueLength)
+	}
+	if config.MaxRegexEvaluations < 0 {
+		return nil, fmt.Errorf("maxRegexEvaluations: must not be negative, got %d", config.MaxRegexEvaluations)
+	}
+
+	g := &guardrails{
+		maxValueLength: config.MaxMatchedValueLength,
+		maxEvaluations: config.MaxRegexEvaluations,
+	}
+	if config.MaxEvaluationTime != "" {
+		maxTime, err := time.ParseDuration(config.MaxEvaluationTime)
+		if err != nil {
+			return nil, fmt.Errorf("maxEvaluationTime: %w", err)
+		}
+		if maxTime <= 0 {
+			return nil, fmt.Errorf("maxEvaluationTime: must be positive, got %s", config.MaxEvaluationTime)
+		}
+		g.maxTime = maxTime
+	}
+
+	policy := strings.ToLower(strings.TrimSpace(config.GuardrailPolicy))
+	if g.maxValueLength == 0 && g.maxEvaluations == 0 && g.maxTime == 0 {
+		if policy != "" {
+			return nil, errors.New("guardrailPolicy: requires maxMatchedValueLength, maxRegexEvaluations or maxEvaluationTime")
+		}
+		return nil, nil
+	}
+	switch policy {
+	case "", guardrailFailClosed:
+	case guardrailFailOpen:
+		g.failOpen = true
+	default:
+		return nil, fmt.Errorf("guardrailPolicy: unknown policy %q", config.GuardrailPolicy)
+	}
+	return g, nil
+}
+
+// evaluationBudget tracks the guardrails of one request. A nil
+// *evaluationBudget has no limits.
+type evaluationBudget struct {
+	guardrails  *guardrails
+	evaluations int
+	deadline    time.Time
+	// exceeded says which limit was hit, empty while within budget.
+	exceeded string
+}
+
+// newBudget returns the budget of a request, nil without guardrails.
+func (c *headerBlock) newBudget() *evaluationBudget {
+	if c.guardrails == nil {
+		return nil
+	}
+	b := &evaluationBudget{guardrails: c.guardrails}
+	if c.guardrails.maxTime > 0 {
+		b.deadline = time.Now().Add(c.guardrails.maxTime)
+	}
+	return b
+}
+
+// spend counts n rule evaluations and reports whether the request is still
+// within budget.
+func (b *evaluationBudget) spend(n int) bool {
+	if b == nil {
+		return true
+	}
+	if b.exceeded != "" {
+		return false
+	}
+	b.evaluations += n
+	switch {
+	case b.guardrails.maxEvaluations > 0 && b.evaluations > b.guardrails.maxEvaluations:
+		b.exceeded = fmt.Sprintf("more than %d rule evaluations", b.guardrails.maxEvaluations)
+	case !b.deadline.IsZero() && time.Now().After(b.deadline):
+		b.exceeded = fmt.Sprintf("rule evaluation took longer than %s", b.guardrails.maxTime)
+	}
+	return b.exceeded == ""
+}
+
+// capValues returns the values rules match for a header. Values longer than
+// maxMatchedValueLength are truncated when failing open and exceed the
+// budget otherwise, in which case ok is false.
+func (b *evaluationBudget) capValues(name string, values []string) (capped []string, ok bool) {
+	if b == nil || b.guardrails.maxValueLength == 0 {
+		return values, true
+	}
+	limit := b.guardrails.maxValueLength
+	for i, value := range values {
+		if len(value) <= limit {
+			continue
+		}
+		if !b.guardrails.failOpen {
+			b.exceeded = fmt.Sprintf("header %s longer than %d bytes", name, limit)
+			return nil, false
+		}
+		if capped == nil {
+			capped = append([]string(nil), values...)
+		}
+		capped[i] = value[:limit]
+	}
+	if capped == nil {
+		return values, true
+	}
+	return capped, true
+}
+
+// checkBudget handles a request whose budget was exceeded while matching
+// request header rules: it is denied unless the guardrails fail open, and
+// the decision is logged either way. It reports whether it denied the
+// request.
+func (c *headerBlock) checkBudget(ev *evaluation, budget *evaluationBudget) bool {
+	if budget == nil || budget.exceeded == "" {
+		return false
+	}
+
+	entry := logEntry{
+		Decision: decisionBudgetExceeded,
+		Rule:     "guardrails",
+	}
+	if ip := ev.ip(); ip != nil {
+		entry.ClientIP = ip.String()
+	}
+	if budget.guardrails.failOpen {
+		if c.log {
+			c.logDecision(ev.req, entry, "evaluation budget exceeded - %s from IP %s, remaining rules skipped", budget.exceeded, entry.ClientIP)
+		}
+		return false
+	}
+	if c.log {
+		c.logDecision(ev.req, entry, "access denied - %s from IP %s", budget.exceeded, entry.ClientIP)
+	}
+	c.recordBlock(ev.req, entry)
+	c.deny(ev.rw, ev.req, c.denyStatusCode, entry)
+	return true
+}
@@ -0,0 +1,137 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestGuardrails(t *testing.T) {
+	long := strings.Repeat("a", 64)
+
+	tests := []struct {
+		name           string
+		config         func(cfg *tbua.Config)
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{
+			name:           "short value within length cap",
+			config:         func(cfg *tbua.Config) { cfg.MaxMatchedValueLength = 16 },
+			headers:        map[string]string{"X-Data": "clean"},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "long value fails closed",
+			config:         func(cfg *tbua.Config) { cfg.MaxMatchedValueLength = 16 },
+			headers:        map[string]string{"X-Data": long},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "long value fails open",
+			config: func(cfg *tbua.Config) {
+				cfg.MaxMatchedValueLength = 16
+				cfg.GuardrailPolicy = "fail-open"
+			},
+			headers:        map[string]string{"X-Data": long + "evil"},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name: "truncated value still matched",
+			config: func(cfg *tbua.Config) {
+				cfg.MaxMatchedValueLength = 16
+				cfg.GuardrailPolicy = "fail-open"
+			},
+			headers:        map[string]string{"X-Data": "evil" + long},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "evaluations within budget",
+			config:         func(cfg *tbua.Config) { cfg.MaxRegexEvaluations = 2 },
+			headers:        map[string]string{"X-One": "clean", "X-Two": "clean"},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "evaluation budget fails closed",
+			config:         func(cfg *tbua.Config) { cfg.MaxRegexEvaluations = 1 },
+			headers:        map[string]string{"X-One": "clean", "X-Two": "clean"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "evaluation budget fails open",
+			config: func(cfg *tbua.Config) {
+				cfg.MaxRegexEvaluations = 1
+				cfg.GuardrailPolicy = "fail-open"
+			},
+			headers:        map[string]string{"X-One": "clean", "X-Two": "clean"},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "time budget fails closed",
+			config:         func(cfg *tbua.Config) { cfg.MaxEvaluationTime = "1ns" },
+			headers:        map[string]string{"X-One": "clean"},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.RequestHeaders = []tbua.HeaderConfig{
+				{Name: "^X-", Value: "^evil"},
+			}
+			tt.config(cfg)
+
+			p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidGuardrails(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(cfg *tbua.Config)
+	}{
+		{name: "negative length", config: func(cfg *tbua.Config) { cfg.MaxMatchedValueLength = -1 }},
+		{name: "negative evaluations", config: func(cfg *tbua.Config) { cfg.MaxRegexEvaluations = -1 }},
+		{name: "invalid time", config: func(cfg *tbua.Config) { cfg.MaxEvaluationTime = "soon" }},
+		{name: "zero time", config: func(cfg *tbua.Config) { cfg.MaxEvaluationTime = "0s" }},
+		{name: "policy without limits", config: func(cfg *tbua.Config) { cfg.GuardrailPolicy = "fail-open" }},
+		{
+			name: "unknown policy",
+			config: func(cfg *tbua.Config) {
+				cfg.MaxRegexEvaluations = 10
+				cfg.GuardrailPolicy = "ignore"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			tt.config(cfg)
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected error for invalid guardrails")
+			}
+		})
+	}
+}
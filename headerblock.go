@@ -3,229 +3,1207 @@ package headerblock
 
 import (
 	"context"
+	"fmt"
+	htmltemplate "html/template"
 	"log"
-	"net"
 	"net/http"
-	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
 )
 
 // Config the plugin configuration.
 type Config struct {
-	RequestHeaders          []HeaderConfig `json:"requestHeaders,omitempty"`
-	WhitelistRequestHeaders []HeaderConfig `json:"whitelistRequestHeaders,omitempty"`
-	AllowedIPs              []string       `json:"allowedIPs,omitempty"`
-	Log                     bool           `json:"log,omitempty"`
+	RequestHeaders           []HeaderConfig `json:"requestHeaders,omitempty"`
+	WhitelistRequestHeaders  []HeaderConfig `json:"whitelistRequestHeaders,omitempty"`
+	RequiredHeaders          []HeaderConfig `json:"requiredHeaders,omitempty"`
+	RequestCookies           []HeaderConfig `json:"requestCookies,omitempty"`
+	RequestURIRules          []HeaderConfig `json:"requestURIRules,omitempty"`
+	ResponseHeaders          []HeaderConfig `json:"responseHeaders,omitempty"`
+	WhitelistResponseHeaders []HeaderConfig `json:"whitelistResponseHeaders,omitempty"`
+	TLSClientCertRules       []HeaderConfig `json:"tlsClientCertRules,omitempty"`
+	WhitelistTLSClientCerts  []HeaderConfig `json:"whitelistTLSClientCerts,omitempty"`
+	BodyRules                []HeaderConfig `json:"bodyRules,omitempty"`
+	BodyInspectLimit         int            `json:"bodyInspectLimit,omitempty"`
+	WhitelistPaths           []string       `json:"whitelistPaths,omitempty"`
+	SkipPathPrefixes         []string       `json:"skipPathPrefixes,omitempty"`
+	SkipMethods              []string       `json:"skipMethods,omitempty"`
+	SkipUserAgents           []string       `json:"skipUserAgents,omitempty"`
+	WebSocketSkipPaths       []string       `json:"webSocketSkipPaths,omitempty"`
+	InspectTrailers          bool           `json:"inspectTrailers,omitempty"`
+	SmugglingProtection      bool           `json:"smugglingProtection,omitempty"`
+	StrictHeaderBytes        bool           `json:"strictHeaderBytes,omitempty"`
+	DetectHeaderInjection    bool           `json:"detectHeaderInjection,omitempty"`
+	StrictHeaderNames        bool           `json:"strictHeaderNames,omitempty"`
+	StrictHeaderNamesAction  string         `json:"strictHeaderNamesAction,omitempty"`
+	RejectUnderscoreHeaders  bool           `json:"rejectUnderscoreHeaders,omitempty"`
+	HopByHopHeaders          string         `json:"hopByHopHeaders,omitempty"`
+	BlockedRefererDomains    []string       `json:"blockedRefererDomains,omitempty"`
+	AllowedRefererDomains    []string       `json:"allowedRefererDomains,omitempty"`
+	Presets                  []string       `json:"presets,omitempty"`
+	DisabledPresetRules      []string       `json:"disabledPresetRules,omitempty"`
+	Precedence               []string       `json:"precedence,omitempty"`
+	IncludeFiles             []string       `json:"includeFiles,omitempty"`
+	RulesFile                string         `json:"rulesFile,omitempty"`
+	RulesFileInterval        string         `json:"rulesFileInterval,omitempty"`
+	RulesURL                 string         `json:"rulesURL,omitempty"`
+	RulesURLInterval         string         `json:"rulesURLInterval,omitempty"`
+	MatchCacheSize           int            `json:"matchCacheSize,omitempty"`
+	MaxMatchedValueLength    int            `json:"maxMatchedValueLength,omitempty"`
+	MaxRegexEvaluations      int            `json:"maxRegexEvaluations,omitempty"`
+	MaxEvaluationTime        string         `json:"maxEvaluationTime,omitempty"`
+	GuardrailPolicy          string         `json:"guardrailPolicy,omitempty"`
+	MaxHeaderCount           int            `json:"maxHeaderCount,omitempty"`
+	MaxHeaderBytes           int            `json:"maxHeaderBytes,omitempty"`
+	MaxHeaderValueLength     int            `json:"maxHeaderValueLength,omitempty"`
+	MaxHeaderValueLengths    map[string]int `json:"maxHeaderValueLengths,omitempty"`
+	HeaderValueLengthAction  string         `json:"headerValueLengthAction,omitempty"`
+	AllowedIPs               []string       `json:"allowedIPs,omitempty"`
+	ExcludedIPs              []string       `json:"excludedIPs,omitempty"`
+	BlockedIPs               []string       `json:"blockedIPs,omitempty"`
+	AllowedIPsFile           string         `json:"allowedIPsFile,omitempty"`
+	AllowedIPsURL            string         `json:"allowedIPsURL,omitempty"`
+	BlockedIPsFile           string         `json:"blockedIPsFile,omitempty"`
+	BlockedIPsURL            string         `json:"blockedIPsURL,omitempty"`
+	IPListsInterval          string         `json:"ipListsInterval,omitempty"`
+	BlockedIPsStatusCode     int            `json:"blockedIPsStatusCode,omitempty"`
+	ClientIPStrategy         []string       `json:"clientIPStrategy,omitempty"`
+	IPFromRemoteAddrOnly     bool           `json:"ipFromRemoteAddrOnly,omitempty"`
+	ClientIPHeader           string         `json:"clientIPHeader,omitempty"`
+	TrustedProxies           []string       `json:"trustedProxies,omitempty"`
+	ProxyDepth               int            `json:"proxyDepth,omitempty"`
+	CDNProvider              string         `json:"cdnProvider,omitempty"`
+	CDNRanges                []string       `json:"cdnRanges,omitempty"`
+	GeoIPDatabase            string         `json:"geoIPDatabase,omitempty"`
+	AllowedCountries         []string       `json:"allowedCountries,omitempty"`
+	BlockedCountries         []string       `json:"blockedCountries,omitempty"`
+	ASNDatabase              string         `json:"asnDatabase,omitempty"`
+	AllowedASNs              []string       `json:"allowedASNs,omitempty"`
+	BlockedASNs              []string       `json:"blockedASNs,omitempty"`
+	DNSBLZones               []string       `json:"dnsblZones,omitempty"`
+	DNSBLAction              string         `json:"dnsblAction,omitempty"`
+	DNSBLTimeout             string         `json:"dnsblTimeout,omitempty"`
+	DNSBLCacheTTL            string         `json:"dnsblCacheTTL,omitempty"`
+	DNSBLCacheSize           int            `json:"dnsblCacheSize,omitempty"`
+	DenyStatusCode           int            `json:"denyStatusCode,omitempty"`
+	ViolationLimit           int            `json:"violationLimit,omitempty"`
+	ViolationWindow          string         `json:"violationWindow,omitempty"`
+	ViolationStatusCode      int            `json:"violationStatusCode,omitempty"`
+	BanThreshold             int            `json:"banThreshold,omitempty"`
+	BanWindow                string         `json:"banWindow,omitempty"`
+	BanDuration              string         `json:"banDuration,omitempty"`
+	RedisAddress             string         `json:"redisAddress,omitempty"`
+	RedisPassword            string         `json:"redisPassword,omitempty"`
+	RedisDB                  int            `json:"redisDB,omitempty"`
+	RedisKeyPrefix           string         `json:"redisKeyPrefix,omitempty"`
+	RedisTimeout             string         `json:"redisTimeout,omitempty"`
+	WebhookURL               string         `json:"webhookURL,omitempty"`
+	WebhookBatchSize         int            `json:"webhookBatchSize,omitempty"`
+	WebhookFlushInterval     string         `json:"webhookFlushInterval,omitempty"`
+	WebhookRetries           *int           `json:"webhookRetries,omitempty"`
+	CrowdSecLAPIURL          string         `json:"crowdSecLAPIURL,omitempty"`
+	CrowdSecAPIKey           string         `json:"crowdSecAPIKey,omitempty"`
+	CrowdSecTimeout          string         `json:"crowdSecTimeout,omitempty"`
+	CrowdSecCacheTTL         string         `json:"crowdSecCacheTTL,omitempty"`
+	CrowdSecMachineID        string         `json:"crowdSecMachineID,omitempty"`
+	CrowdSecPassword         string         `json:"crowdSecPassword,omitempty"`
+	CrowdSecAlertInterval    string         `json:"crowdSecAlertInterval,omitempty"`
+	DenyBody                 string         `json:"denyBody,omitempty"`
+	DenyTemplateFile         string         `json:"denyTemplateFile,omitempty"`
+	DenyJSONBody             string         `json:"denyJSONBody,omitempty"`
+	DenyContentType          string         `json:"denyContentType,omitempty"`
+	DenyMode                 string         `json:"denyMode,omitempty"`
+	DenyProxyURL             string         `json:"denyProxyURL,omitempty"`
+	DryRun                   bool           `json:"dryRun,omitempty"`
+	Debug                    bool           `json:"debug,omitempty"`
+	TarpitDelay              string         `json:"tarpitDelay,omitempty"`
+	TarpitJitter             string         `json:"tarpitJitter,omitempty"`
+	TagHeader                string         `json:"tagHeader,omitempty"`
+	MetricsPath              string         `json:"metricsPath,omitempty"`
+	StatsPath                string         `json:"statsPath,omitempty"`
+	Expvar                   bool           `json:"expvar,omitempty"`
+	Log                      bool           `json:"log,omitempty"`
+	LogFormat                string         `json:"logFormat,omitempty"`
+	LogTemplate              string         `json:"logTemplate,omitempty"`
+	LogOutput                string         `json:"logOutput,omitempty"`
+	LogMaxSize               int            `json:"logMaxSize,omitempty"`
+	LogMaxBackups            int            `json:"logMaxBackups,omitempty"`
+	LogSampleRate            float64        `json:"logSampleRate,omitempty"`
+	LogDedupWindow           string         `json:"logDedupWindow,omitempty"`
+	AuditFile                string         `json:"auditFile,omitempty"`
+	AuditWebhook             bool           `json:"auditWebhook,omitempty"`
+	AuditRedactHeaders       []string       `json:"auditRedactHeaders,omitempty"`
+	RedactLogValues          bool           `json:"redactLogValues,omitempty"`
+	Tracing                  bool           `json:"tracing,omitempty"`
+	RequestID                bool           `json:"requestID,omitempty"`
+	RequestIDHeader          string         `json:"requestIDHeader,omitempty"`
+
+	// JWTSecret (HMAC) or JWTJWKSURL (RSA and ECDSA keys) verify bearer
+	// tokens; tokens carrying every JWTBypassClaims claim skip the rules.
+	JWTSecret       string            `json:"jwtSecret,omitempty"`
+	JWTJWKSURL      string            `json:"jwtJWKSURL,omitempty"`
+	JWTJWKSInterval string            `json:"jwtJWKSInterval,omitempty"`
+	JWTBypassClaims map[string]string `json:"jwtBypassClaims,omitempty"`
+
+	BypassToken BypassTokenConfig `json:"bypassToken,omitempty"`
+	// BasicAuthBypass lists user:hash pairs whose Basic credentials skip
+	// the rules; hashes use the $pbkdf2-sha256$ format.
+	BasicAuthBypass []string `json:"basicAuthBypass,omitempty"`
+	// DenyHeaders are added to every deny response, e.g. Retry-After or
+	// Cache-Control.
+	DenyHeaders map[string]string `json:"denyHeaders,omitempty"`
+	// AllowedContentTypes limits the Content-Type of matching requests; the
+	// first entry covering a request applies.
+	AllowedContentTypes []ContentTypeConfig `json:"allowedContentTypes,omitempty"`
+	// SanitizeForwardingHeaders removes X-Forwarded-For, Forwarded,
+	// X-Real-Ip and X-Forwarded-Host sent by clients outside trustedProxies.
+	SanitizeForwardingHeaders bool `json:"sanitizeForwardingHeaders,omitempty"`
+	// SeverityActions overrides the action of rules with a severity:
+	// by default low logs, medium strips, high blocks and critical bans.
+	SeverityActions map[string]string `json:"severityActions,omitempty"`
+	// ProviderRanges download the IP ranges published by cloud and CDN
+	// providers into trustedProxies, allowedIPs or blockedIPs, refreshed
+	// every ProviderRangesInterval and cached in ProviderRangesCacheDir.
+	ProviderRanges         []ProviderRangesConfig `json:"providerRanges,omitempty"`
+	ProviderRangesInterval string                 `json:"providerRangesInterval,omitempty"`
+	ProviderRangesCacheDir string                 `json:"providerRangesCacheDir,omitempty"`
+	// Hosts adds rules and allowedIPs for single hosts or "*.example.com"
+	// wildcards on top of the shared ones.
+	Hosts map[string]HostConfig `json:"hosts,omitempty"`
 }
 
 // HeaderConfig is part of the plugin configuration.
 type HeaderConfig struct {
-	Name  string `json:"header,omitempty"`
-	Value string `json:"env,omitempty"`
+	// ID names the rule in logs, metrics and hit counters instead of its
+	// position (e.g. requestHeaders[3]).
+	ID              string   `json:"id,omitempty"`
+	Name            string   `json:"name,omitempty"`
+	Value           string   `json:"value,omitempty"`
+	Action          string   `json:"action,omitempty"`
+	Severity        string   `json:"severity,omitempty"`
+	DryRun          bool     `json:"dryRun,omitempty"`
+	AllowedIPs      []string `json:"allowedIPs,omitempty"`
+	CaseInsensitive bool     `json:"caseInsensitive,omitempty"`
+	// MatchType selects how Name and Value are matched: regex (default),
+	// exact, prefix, suffix, contains or glob.
+	MatchType string `json:"matchType,omitempty"`
+	Negate    bool   `json:"negate,omitempty"`
+	// Conflicting makes the rule match when the named header is sent
+	// several times with different values.
+	Conflicting bool `json:"conflicting,omitempty"`
+	// BlockEmptyValue makes the rule match when the named header is sent
+	// with an empty or whitespace-only value.
+	BlockEmptyValue bool `json:"blockEmptyValue,omitempty"`
+	// MaxOccurrences makes the rule match when the named header is sent
+	// more than this many times.
+	MaxOccurrences int `json:"maxOccurrences,omitempty"`
+	// Normalize lists the steps applied to values before Value matches
+	// them: urlDecode, unicode, lowercase and collapseWhitespace.
+	Normalize []string `json:"normalize,omitempty"`
+	// DecodeBase64 also matches Value against the base64-decoded tokens of
+	// the header values.
+	DecodeBase64 bool     `json:"decodeBase64,omitempty"`
+	PathRegex    string   `json:"pathRegex,omitempty"`
+	HostRegex    string   `json:"hostRegex,omitempty"`
+	SourceIPs    []string `json:"sourceIPs,omitempty"`
+	// AllowedRefererDomains exempt requests whose Referer points to one of
+	// the domains or their subdomains, e.g. for hotlink protection.
+	AllowedRefererDomains []string `json:"allowedRefererDomains,omitempty"`
+	// ActiveFrom and ActiveTo ("HH:MM") and DaysOfWeek limit the rule to a
+	// time window in Timezone (default UTC).
+	ActiveFrom string   `json:"activeFrom,omitempty"`
+	ActiveTo   string   `json:"activeTo,omitempty"`
+	DaysOfWeek []string `json:"daysOfWeek,omitempty"`
+	Timezone   string   `json:"timezone,omitempty"`
+	// ExpiresAt (RFC 3339 or YYYY-MM-DD) is when a temporary rule stops
+	// matching.
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	// All turns the entry into a composite rule matching when every
+	// condition matches; Absent is only valid in such conditions.
+	All    []HeaderConfig `json:"all,omitempty"`
+	Absent bool           `json:"absent,omitempty"`
+	// RedirectURL and RedirectStatusCode (default 302) configure the
+	// redirect action.
+	RedirectURL        string `json:"redirectURL,omitempty"`
+	RedirectStatusCode int    `json:"redirectStatusCode,omitempty"`
+	// Priority orders the rules of a section, highest first; rules of
+	// equal priority keep their configured order.
+	Priority int `json:"priority,omitempty"`
+	// Enabled set to false turns the rule off without removing it from the
+	// configuration.
+	Enabled *bool `json:"enabled,omitempty"`
+	// StatusCode, Body and DenyHeaders override denyStatusCode, the deny
+	// body and denyHeaders for requests the rule denies.
+	StatusCode  int               `json:"statusCode,omitempty"`
+	Body        string            `json:"body,omitempty"`
+	DenyHeaders map[string]string `json:"denyHeaders,omitempty"`
+	// Header and Env are the deprecated keys of Name and Value, still
+	// accepted with a warning.
+	Header string `json:"header,omitempty"`
+	Env    string `json:"env,omitempty"`
 }
 
-type rule struct {
-	name  *regexp.Regexp
-	value *regexp.Regexp
-}
+const defaultTagHeader = "X-HeaderBlock-Tag"
 
 // CreateConfig creates the default plugin configuration.
 func CreateConfig() *Config {
 	return &Config{
-		Log: false,
+		DenyStatusCode: http.StatusForbidden,
+		TagHeader:      defaultTagHeader,
+		Log:            false,
 	}
 }
 
 // headerBlock a Traefik plugin.
 type headerBlock struct {
-	next                  http.Handler
-	requestHeaderRules    []rule
-	whitelistRequestRules []rule
-	allowedIPNets         []*net.IPNet
-	log                   bool
+	next       http.Handler
+	rules      atomic.Value // *ruleSet
+	baseRules  *ruleSet
+	rulesFile  *rulesFileSource
+	rulesURL   *rulesURLSource
+	matchCache *matchCache
+	guardrails *guardrails
+	limits     headerLimits
+	// sourcesMu guards the rules loaded from external sources.
+	sourcesMu            sync.Mutex
+	fileRules            *ruleSet
+	urlRules             *ruleSet
+	allowedIPNets        ipList
+	blockedIPNets        ipList
+	ipLists              *ipListSources
+	clientIPs            *clientIPResolver
+	whitelistPaths       *pathMatcher
+	skipPathPrefixes     *prefixTrie
+	skipRequests         *requestSkipper
+	webSocketSkipPaths   *pathMatcher
+	inspectTrailers      bool
+	smugglingProtection  bool
+	strictHeaderBytes    bool
+	headerInjection      bool
+	headerNames          string
+	rejectUnderscores    bool
+	hopByHop             string
+	sanitizeForwarding   bool
+	bodyInspectLimit     int
+	precedence           precedence
+	blockedIPsStatusCode int
+	geoIP                *mmdbReader
+	allowedCountries     map[string]struct{}
+	blockedCountries     map[string]struct{}
+	asnDB                *mmdbReader
+	allowedASNs          map[uint]struct{}
+	blockedASNs          map[uint]struct{}
+	dnsbl                *dnsblChecker
+	denyStatusCode       int
+	denyMode             string
+	severities           severityActions
+	denyHandler          http.Handler
+	violations           *violationTracker
+	bans                 *banTable
+	webhook              *webhookSender
+	crowdSec             *crowdSecBouncer
+	jwt                  *jwtVerifier
+	bypassTokens         *bypassTokens
+	basicAuth            *basicAuthBypass
+	denyBody             []byte
+	denyTemplate         *htmltemplate.Template
+	denyJSONTemplate     *template.Template
+	denyContentType      string
+	denyHeaders          http.Header
+	contentTypes         []contentTypeScope
+	hosts                *hostPolicies
+	dryRun               bool
+	debug                bool
+	tarpit               tarpit
+	tagHeader            string
+	metricsPath          string
+	statsPath            string
+	started              time.Time
+	metrics              *metrics
+	hits                 *ruleHits
+	log                  bool
+	logFormat            string
+	logTemplate          *template.Template
+	logOutput            *log.Logger
+	logSampler           *logSampler
+	audit                *auditTrail
+	redactLogValues      bool
+	tracing              bool
+	requestIDHeader      string
 }
 
-func parseAllowedIPs(raw []string, logEnabled bool) []*net.IPNet {
-	var ipNets []*net.IPNet
+// New creates a new headerBlock plugin.
+func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
+	return NewWithOptions(ctx, next, config, name)
+}
 
-	for _, entry := range raw {
-		// Split by comma to support "1.1.1.1/32, 2.2.2.2/32"
-		parts := strings.Split(entry, ",")
+// NewWithOptions creates a new headerBlock plugin with options that the
+// dynamic configuration cannot express, for programs embedding it.
+func NewWithOptions(ctx context.Context, next http.Handler, config *Config, name string, opts ...Option) (http.Handler, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
 
-		for _, part := range parts {
-			ip := strings.TrimSpace(part)
-			if ip == "" {
-				continue
-			}
+	config, err := expandConfigEnv(config)
+	if err != nil {
+		return nil, err
+	}
+	ipNets := parseIPNets(config.AllowedIPs, "allowedIPs", config.Log)
+	excluded := parseIPNets(config.ExcludedIPs, "excludedIPs", config.Log)
+	for _, n := range excluded.nets.entries {
+		ipNets.excluded.insert(n)
+	}
 
-			// Try CIDR first
-			if _, netCIDR, err := net.ParseCIDR(ip); err == nil {
-				ipNets = append(ipNets, netCIDR)
-				continue
-			}
+	preset, err := presetRules(config.Presets, config.DisabledPresetRules)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Presets) > 0 && config.Log {
+		log.Printf("headerblock: enabled presets %s (version %s, %d rules)", strings.Join(config.Presets, ", "), presetsVersion, len(preset))
+	}
+	generated, err := refererRules(config, preset)
+	if err != nil {
+		return nil, err
+	}
+	requestHeaders := config.RequestHeaders
+	if len(generated) > 0 {
+		requestHeaders = append(append([]HeaderConfig(nil), config.RequestHeaders...), generated...)
+	}
 
-			// Try single IP
-			parsedIP := net.ParseIP(ip)
-			if parsedIP != nil {
-				bits := 128
-				if parsedIP.To4() != nil {
-					bits = 32
-				}
-				ipNets = append(ipNets, &net.IPNet{
-					IP:   parsedIP,
-					Mask: net.CIDRMask(bits, bits),
-				})
-				continue
-			}
+	severities, err := newSeverityActions(config)
+	if err != nil {
+		return nil, err
+	}
+	baseRules, err := compileRuleSet(ruleSections{
+		RequestHeaders:           requestHeaders,
+		WhitelistRequestHeaders:  config.WhitelistRequestHeaders,
+		RequiredHeaders:          config.RequiredHeaders,
+		RequestCookies:           config.RequestCookies,
+		RequestURIRules:          config.RequestURIRules,
+		ResponseHeaders:          config.ResponseHeaders,
+		WhitelistResponseHeaders: config.WhitelistResponseHeaders,
+		TLSClientCertRules:       config.TLSClientCertRules,
+		WhitelistTLSClientCerts:  config.WhitelistTLSClientCerts,
+		BodyRules:                config.BodyRules,
+	}, "", config.Log, severities)
+	if err != nil {
+		return nil, err
+	}
+	included, err := loadIncludeFiles(config.IncludeFiles, config.Log, severities)
+	if err != nil {
+		return nil, err
+	}
+	if included != nil {
+		baseRules = baseRules.merge(included)
+	}
+	denyStatusCode := config.DenyStatusCode
+	if denyStatusCode == 0 {
+		denyStatusCode = http.StatusForbidden
+	}
+	if denyStatusCode < 100 || denyStatusCode > 599 {
+		return nil, fmt.Errorf("denyStatusCode: invalid HTTP status %d", denyStatusCode)
+	}
+
+	blockedIPsStatusCode := config.BlockedIPsStatusCode
+	if blockedIPsStatusCode == 0 {
+		blockedIPsStatusCode = denyStatusCode
+	}
+	if blockedIPsStatusCode < 100 || blockedIPsStatusCode > 599 {
+		return nil, fmt.Errorf("blockedIPsStatusCode: invalid HTTP status %d", blockedIPsStatusCode)
+	}
+
+	ipLists, err := newIPListSources(config)
+	if err != nil {
+		return nil, err
+	}
+	clientIPs, err := newClientIPResolver(config, ipLists)
+	if err != nil {
+		return nil, err
+	}
 
-			// Fault-tolerant: log and skip
-			if logEnabled {
-				log.Printf("headerblock: invalid allowedIP entry skipped: %q", ip)
+	whitelistPaths, err := newPathMatcher(config.WhitelistPaths, "whitelistPaths")
+	if err != nil {
+		return nil, err
+	}
+	skipPathPrefixes, err := newPrefixTrie(config.SkipPathPrefixes, "skipPathPrefixes")
+	if err != nil {
+		return nil, err
+	}
+	skipRequests, err := newRequestSkipper(config)
+	if err != nil {
+		return nil, err
+	}
+	webSocketSkipPaths, err := newPathMatcher(config.WebSocketSkipPaths, "webSocketSkipPaths")
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := parsePrecedence(config.Precedence)
+	if err != nil {
+		return nil, err
+	}
+
+	pit, err := newTarpit(config)
+	if err != nil {
+		return nil, err
+	}
+	store, err := newRedisStore(config)
+	if err != nil {
+		return nil, err
+	}
+
+	violations, err := newViolationTracker(config, store)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook, err := newWebhookSender(config)
+	if err != nil {
+		return nil, err
+	}
+
+	crowdSec, err := newCrowdSecBouncer(config)
+	if err != nil {
+		return nil, err
+	}
+
+	jwt, err := newJWTVerifier(config)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := newBypassTokens(config)
+	if err != nil {
+		return nil, err
+	}
+
+	basicAuth, err := newBasicAuthBypass(config)
+	if err != nil {
+		return nil, err
+	}
+	denyContentType := config.DenyContentType
+	if denyContentType == "" && config.DenyBody != "" {
+		denyContentType = "text/plain; charset=utf-8"
+	}
+	denyTemplate, err := loadDenyTemplate(config)
+	if err != nil {
+		return nil, err
+	}
+	if denyContentType == "" && denyTemplate != nil {
+		denyContentType = "text/html; charset=utf-8"
+	}
+	denyJSONTemplate, err := loadDenyJSONTemplate(config)
+	if err != nil {
+		return nil, err
+	}
+	denyMode, err := parseDenyMode(config)
+	if err != nil {
+		return nil, err
+	}
+	denyHandler, err := newDenyHandler(config, o)
+	if err != nil {
+		return nil, err
+	}
+	denyHeaders, err := parseDenyHeaders(config.DenyHeaders)
+	if err != nil {
+		return nil, err
+	}
+	hopByHop, err := parseHopByHopMode(config.HopByHopHeaders)
+	if err != nil {
+		return nil, err
+	}
+	headerNames, err := parseHeaderNamesMode(config)
+	if err != nil {
+		return nil, err
+	}
+	requestIDHeader, err := parseRequestIDHeader(config)
+	if err != nil {
+		return nil, err
+	}
+	contentTypes, err := newContentTypeScopes(config.AllowedContentTypes)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := newHostPolicies(config, severities)
+	if err != nil {
+		return nil, err
+	}
+	// Rules loaded later from rulesFile or rulesURL may ban as well.
+	rulesBan := bansClients(baseRules.all()) || bansClients(hosts.all()) || config.RulesFile != "" || config.RulesURL != ""
+	bans, err := newBanTable(config, store, rulesBan)
+	if err != nil {
+		return nil, err
+	}
+	active, disabled := baseRules.count()
+	hostActive, hostDisabled := hosts.count()
+	if config.Log && disabled+hostDisabled > 0 {
+		log.Printf("headerblock: %d rules active, %d disabled", active+hostActive, disabled+hostDisabled)
+	}
+	bodyInspectLimit := config.BodyInspectLimit
+	if bodyInspectLimit < 0 {
+		return nil, fmt.Errorf("bodyInspectLimit: must not be negative, got %d", bodyInspectLimit)
+	}
+	if bodyInspectLimit == 0 {
+		bodyInspectLimit = defaultBodyInspectLimit
+	}
+
+	tagHeader := http.CanonicalHeaderKey(strings.TrimSpace(config.TagHeader))
+	if tagHeader == "" {
+		tagHeader = defaultTagHeader
+	}
+
+	logFormat, err := parseLogFormat(config.LogFormat)
+	if err != nil {
+		return nil, err
+	}
+	logTemplate, err := parseLogTemplate(config.LogTemplate, logFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	geoIP, err := openGeoIP(config)
+	if err != nil {
+		return nil, err
+	}
+
+	allowedASNs, err := parseASNs(config.AllowedASNs, "allowedASNs")
+	if err != nil {
+		return nil, err
+	}
+
+	blockedASNs, err := parseASNs(config.BlockedASNs, "blockedASNs")
+	if err != nil {
+		return nil, err
+	}
+
+	asnDB, err := openASNDatabase(config)
+	if err != nil {
+		return nil, err
+	}
+	dnsbl, err := newDNSBLChecker(config)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := newMatchCache(config)
+	if err != nil {
+		return nil, err
+	}
+	guardrails, err := newGuardrails(config)
+	if err != nil {
+		return nil, err
+	}
+
+	limits, err := newHeaderLimits(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var rulesFile *rulesFileSource
+	if config.RulesFile != "" {
+		rulesFile = &rulesFileSource{path: config.RulesFile, interval: defaultRulesFileInterval}
+		if config.RulesFileInterval != "" {
+			if rulesFile.interval, err = time.ParseDuration(config.RulesFileInterval); err != nil {
+				return nil, fmt.Errorf("rulesFileInterval: %w", err)
 			}
 		}
 	}
 
-	return ipNets
-}
-
-func getClientIP(req *http.Request) net.IP {
-	// 1. X-Forwarded-For (Traefik trusted chain)
-	if xff := req.Header.Get("X-Forwarded-For"); xff != "" {
-		parts := strings.Split(xff, ",")
-		if len(parts) > 0 {
-			ip := strings.TrimSpace(parts[0])
-			if parsed := net.ParseIP(ip); parsed != nil {
-				return parsed
+	var rulesURL *rulesURLSource
+	if config.RulesURL != "" {
+		rulesURL = &rulesURLSource{
+			url:      config.RulesURL,
+			interval: defaultRulesURLInterval,
+			client:   &http.Client{Timeout: rulesURLTimeout},
+		}
+		if config.RulesURLInterval != "" {
+			if rulesURL.interval, err = time.ParseDuration(config.RulesURLInterval); err != nil {
+				return nil, fmt.Errorf("rulesURLInterval: %w", err)
 			}
 		}
 	}
 
-	// 2. Fallback to RemoteAddr (already ProxyProtocol-processed by Traefik)
-	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	logOutput, logCloser, err := newLogOutput(config)
 	if err != nil {
-		return net.ParseIP(req.RemoteAddr)
+		return nil, err
+	}
+	if logCloser != nil {
+		go func() {
+			<-ctx.Done()
+			_ = logCloser.Close()
+		}()
 	}
 
-	return net.ParseIP(host)
-}
+	logSampler, err := newLogSampler(config)
+	if err != nil {
+		return nil, err
+	}
+
+	audit, err := newAuditTrail(config)
+	if err != nil {
+		return nil, err
+	}
+	if audit != nil {
+		go func() {
+			<-ctx.Done()
+			_ = audit.Close()
+		}()
+	}
+
+	var pluginMetrics *metrics
+	if config.MetricsPath != "" || config.StatsPath != "" || config.Expvar {
+		pluginMetrics = newMetrics(name)
+	}
+
+	plugin := &headerBlock{
+		next:                 next,
+		baseRules:            baseRules,
+		rulesFile:            rulesFile,
+		rulesURL:             rulesURL,
+		allowedIPNets:        ipNets,
+		blockedIPNets:        parseIPNets(config.BlockedIPs, "blockedIPs", config.Log),
+		ipLists:              ipLists,
+		clientIPs:            clientIPs,
+		whitelistPaths:       whitelistPaths,
+		skipPathPrefixes:     skipPathPrefixes,
+		skipRequests:         skipRequests,
+		webSocketSkipPaths:   webSocketSkipPaths,
+		inspectTrailers:      config.InspectTrailers,
+		smugglingProtection:  config.SmugglingProtection,
+		strictHeaderBytes:    config.StrictHeaderBytes,
+		headerInjection:      config.DetectHeaderInjection,
+		headerNames:          headerNames,
+		rejectUnderscores:    config.RejectUnderscoreHeaders,
+		hopByHop:             hopByHop,
+		sanitizeForwarding:   config.SanitizeForwardingHeaders,
+		bodyInspectLimit:     bodyInspectLimit,
+		precedence:           order,
+		blockedIPsStatusCode: blockedIPsStatusCode,
+		geoIP:                geoIP,
+		allowedCountries:     parseCountries(config.AllowedCountries),
+		blockedCountries:     parseCountries(config.BlockedCountries),
+		asnDB:                asnDB,
+		allowedASNs:          allowedASNs,
+		blockedASNs:          blockedASNs,
+		dnsbl:                dnsbl,
+		matchCache:           cache,
+		guardrails:           guardrails,
+		limits:               limits,
+		denyStatusCode:       denyStatusCode,
+		denyMode:             denyMode,
+		severities:           severities,
+		denyHandler:          denyHandler,
+		violations:           violations,
+		bans:                 bans,
+		webhook:              webhook,
+		crowdSec:             crowdSec,
+		jwt:                  jwt,
+		bypassTokens:         tokens,
+		basicAuth:            basicAuth,
+		denyBody:             []byte(config.DenyBody),
+		denyTemplate:         denyTemplate,
+		denyJSONTemplate:     denyJSONTemplate,
+		denyContentType:      denyContentType,
+		denyHeaders:          denyHeaders,
+		contentTypes:         contentTypes,
+		hosts:                hosts,
+		dryRun:               config.DryRun,
+		debug:                config.Debug,
+		tarpit:               pit,
+		tagHeader:            tagHeader,
+		metricsPath:          config.MetricsPath,
+		statsPath:            config.StatsPath,
+		started:              time.Now(),
+		metrics:              pluginMetrics,
+		hits:                 &ruleHits{},
+		log:                  config.Log,
+		logFormat:            logFormat,
+		logTemplate:          logTemplate,
+		logOutput:            logOutput,
+		logSampler:           logSampler,
+		audit:                audit,
+		redactLogValues:      config.RedactLogValues,
+		tracing:              config.Tracing,
+		requestIDHeader:      requestIDHeader,
+	}
+	plugin.activateRules(baseRules)
+
+	if rulesFile != nil {
+		if err := plugin.loadRulesFile(); err != nil {
+			return nil, err
+		}
+		if rulesFile.interval > 0 {
+			go plugin.watchRulesFile(ctx)
+		}
+	}
 
-func isIPAllowed(ip net.IP, nets []*net.IPNet) bool {
-	if ip == nil {
-		return false
+	if rulesURL != nil {
+		go plugin.watchRulesURL(ctx)
 	}
 
-	for _, n := range nets {
-		if n.Contains(ip) {
-			return true
+	if config.Expvar {
+		if err := publishExpvar(name, plugin); err != nil {
+			return nil, err
 		}
 	}
-	return false
+
+	if ipLists != nil {
+		go ipLists.run(ctx)
+	}
+
+	if webhook != nil {
+		go webhook.run(ctx)
+	}
+
+	if crowdSec != nil && crowdSec.alerts != nil {
+		go crowdSec.runAlerts(ctx)
+	}
+
+	if jwt != nil && jwt.jwksURL != "" {
+		go jwt.runJWKS(ctx)
+	}
+
+	if logSampler != nil && logSampler.window > 0 {
+		go plugin.runLogSummaries(ctx)
+	}
+	return plugin, nil
 }
 
-// New creates a new headerBlock plugin.
-func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
-	ipNets := parseAllowedIPs(config.AllowedIPs, config.Log)
-
-	return &headerBlock{
-		next:                  next,
-		requestHeaderRules:    prepareRules(config.RequestHeaders),
-		whitelistRequestRules: prepareRules(config.WhitelistRequestHeaders),
-		allowedIPNets:         ipNets,
-		log:                   config.Log,
-	}, nil
+// swapRules runs update under the sources lock and then activates the inline
+// rules merged with the latest rules of every external source.
+func (c *headerBlock) swapRules(update func()) {
+	c.sourcesMu.Lock()
+	defer c.sourcesMu.Unlock()
+
+	update()
+
+	rules := c.baseRules
+	if c.fileRules != nil {
+		rules = rules.merge(c.fileRules)
+	}
+	if c.urlRules != nil {
+		rules = rules.merge(c.urlRules)
+	}
+	c.activateRules(rules)
+}
+
+// activateRules makes rules the shared rule set and merges it into the rule
+// set of every host.
+func (c *headerBlock) activateRules(rules *ruleSet) {
+	c.hosts.activate(rules)
+	c.rules.Store(rules)
+}
+
+// currentRules returns the active rule set.
+func (c *headerBlock) currentRules() *ruleSet {
+	return c.rules.Load().(*ruleSet)
 }
 
-func prepareRules(headerConfig []HeaderConfig) []rule {
-	headerRules := make([]rule, 0)
-	for _, requestHeader := range headerConfig {
-		requestRule := rule{}
-		if len(requestHeader.Name) > 0 {
-			requestRule.name = regexp.MustCompile(requestHeader.Name)
+func (c *headerBlock) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if c.metricsPath != "" && req.URL.Path == c.metricsPath {
+		c.serveMetrics(rw, req)
+		return
+	}
+	if c.statsPath != "" && req.URL.Path == c.statsPath {
+		c.serveStats(rw, req)
+		return
+	}
+	if c.sanitizeForwarding {
+		c.sanitizeForwardingHeaders(req)
+	}
+	if c.skipPathPrefixes.matches(req.URL.Path) {
+		c.next.ServeHTTP(rw, req)
+		return
+	}
+	if c.requestIDHeader != "" {
+		c.ensureRequestID(req)
+	}
+
+	if c.metrics != nil {
+		c.metrics.incEvaluated()
+		start := time.Now()
+		defer func() { c.metrics.observeLatency(time.Since(start)) }()
+	}
+
+	rules := c.currentRules()
+	host := c.hosts.lookup(req)
+	if host != nil {
+		rules = host.active.Load().(*ruleSet)
+	}
+	ev := &evaluation{plugin: c, rw: rw, req: req, rules: rules, host: host}
+
+	if c.bans != nil && ev.ip() != nil && c.bans.banned(ev.ip().String(), time.Now()) {
+		entry := logEntry{
+			Decision: decisionBanned,
+			ClientIP: ev.ip().String(),
 		}
-		if len(requestHeader.Value) > 0 {
-			requestRule.value = regexp.MustCompile(requestHeader.Value)
+		if c.log {
+			c.logDecision(req, entry, "access denied - IP %s is banned", ev.ip())
 		}
-		headerRules = append(headerRules, requestRule)
+		c.recordBlock(req, entry)
+		c.deny(rw, req, c.blockedIPsStatusCode, entry)
+		return
 	}
-	return headerRules
-}
-
-func isWhitelisted(name string, values []string, whitelist []rule) bool {
-	for _, rule := range whitelist {
-		if rule.name != nil && !rule.name.MatchString(name) {
-			continue
+	if !c.blockedIPNets.empty() || c.ipLists != nil {
+		if clientIP := ev.ip(); isIPAllowed(clientIP, c.blockedIPNets) || c.ipLists.blockedIP(clientIP) {
+			entry := logEntry{
+				Decision: decisionIPBlocked,
+				ClientIP: clientIP.String(),
+			}
+			if c.log {
+				c.logDecision(req, entry, "access denied - IP %s is blocked", clientIP)
+			}
+			c.recordBlock(req, entry)
+			c.deny(rw, req, c.blockedIPsStatusCode, entry)
+			return
 		}
+	}
 
-		if rule.value == nil {
-			return true
+	if len(c.blockedCountries) > 0 {
+		if country := ev.country(); hasCountry(c.blockedCountries, country) {
+			entry := logEntry{
+				Decision: decisionCountryBlocked,
+				ClientIP: ev.ip().String(),
+				Country:  country,
+			}
+			if c.log {
+				c.logDecision(req, entry, "access denied - IP %s from blocked country %s", ev.ip(), country)
+			}
+			c.recordBlock(req, entry)
+			c.deny(rw, req, c.blockedIPsStatusCode, entry)
+			return
+		}
+	}
+	if len(c.blockedASNs) > 0 {
+		if asn := ev.asn(); hasASN(c.blockedASNs, asn) {
+			entry := logEntry{
+				Decision: decisionASNBlocked,
+				ClientIP: ev.ip().String(),
+				ASN:      asn,
+			}
+			if c.log {
+				c.logDecision(req, entry, "access denied - IP %s from blocked AS%d", ev.ip(), asn)
+			}
+			c.recordBlock(req, entry)
+			c.deny(rw, req, c.blockedIPsStatusCode, entry)
+			return
 		}
+	}
 
-		for _, value := range values {
-			if rule.value.MatchString(value) {
-				return true
+	if c.crowdSec != nil && ev.ip() != nil && !c.allowedIP(ev) {
+		if decision := c.crowdSec.decision(req.Context(), ev.ip().String()); decision != "" {
+			entry := logEntry{
+				Decision: decisionCrowdSec,
+				ClientIP: ev.ip().String(),
+				Rule:     "crowdsec:" + decision,
+			}
+			if c.log {
+				c.logDecision(req, entry, "access denied - IP %s has CrowdSec decision %s", ev.ip(), decision)
 			}
+			c.recordBlock(req, entry)
+			c.deny(rw, req, c.blockedIPsStatusCode, entry)
+			return
 		}
 	}
-	return false
-}
 
-func (c *headerBlock) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
-	for name, values := range req.Header {
-		for _, blockRule := range c.requestHeaderRules {
-			if applyRule(blockRule, name, values) {
-
-				// Header is blocked → check whitelist by header/value
-				if isWhitelisted(name, values, c.whitelistRequestRules) {
-					if c.log {
-						log.Printf("%s: access allowed - whitelisted header %s", req.URL.String(), name)
-					}
-					continue
-				}
-
-				// Header violation → check allowed IPs
-				clientIP := getClientIP(req)
-				if isIPAllowed(clientIP, c.allowedIPNets) {
-					if c.log {
-						log.Printf(
-							"%s: access allowed - IP %s bypassed blocked header %s",
-							req.URL.String(),
-							clientIP,
-							name,
-						)
-					}
-					continue
-				}
-
-				// Final deny
-				if c.log {
-					log.Printf(
-						"%s: access denied - blocked header %s from IP %s",
-						req.URL.String(),
-						name,
-						clientIP,
-					)
-				}
-
-				rw.WriteHeader(http.StatusForbidden)
+	if c.dnsbl != nil && !c.allowedIP(ev) {
+		if zone := c.dnsbl.listed(req.Context(), ev.ip()); zone != "" {
+			entry := logEntry{
+				Decision: decisionDNSBLListed,
+				ClientIP: ev.ip().String(),
+				Rule:     zone,
+			}
+			if c.log {
+				c.logDecision(req, entry, "IP %s is listed by %s (%s)", ev.ip(), zone, c.dnsbl.action)
+			}
+			switch c.dnsbl.action {
+			case actionLog:
+			case actionTag:
+				ev.tags = append(ev.tags, "dnsbl:"+zone)
+			default:
+				c.recordBlock(req, entry)
+				c.deny(rw, req, c.blockedIPsStatusCode, entry)
 				return
 			}
 		}
 	}
 
+	if c.checkSmuggling(ev) {
+		return
+	}
+	if c.checkHeaderBytes(ev) {
+		return
+	}
+	if c.checkHeaderInjection(ev) {
+		return
+	}
+	if c.checkHeaderNames(ev) {
+		return
+	}
+	if c.sanitizeHopByHop(ev) {
+		return
+	}
+	if c.checkLimits(ev) {
+		return
+	}
+	if c.checkContentType(ev) {
+		return
+	}
+
+	if c.tagHeader != "" {
+		// Never trust a tag supplied by the client itself.
+		req.Header.Del(c.tagHeader)
+	}
+
+	if c.whitelistPaths.matches(req.URL.Path) {
+		if c.log {
+			c.logDecision(req, logEntry{Decision: decisionWhitelisted},
+				"access allowed - whitelisted path %s", req.URL.Path)
+		}
+		for _, tag := range ev.tags {
+			req.Header.Add(c.tagHeader, tag)
+		}
+		c.next.ServeHTTP(rw, req)
+		return
+	}
+
+	if c.webSocketSkipPaths.matches(req.URL.Path) && isWebSocketUpgrade(req) {
+		if c.log {
+			c.logDecision(req, logEntry{Decision: decisionWhitelisted},
+				"access allowed - WebSocket handshake to %s", req.URL.Path)
+		}
+		for _, tag := range ev.tags {
+			req.Header.Add(c.tagHeader, tag)
+		}
+		c.next.ServeHTTP(rw, req)
+		return
+	}
+
+	if c.skipRequests.skips(req.Method, req.Header.Get("User-Agent")) {
+		if c.log {
+			c.logDecision(req, logEntry{Decision: decisionWhitelisted},
+				"access allowed - %s request with User-Agent %q skips rules", req.Method, req.Header.Get("User-Agent"))
+		}
+		for _, tag := range ev.tags {
+			req.Header.Add(c.tagHeader, tag)
+		}
+		c.next.ServeHTTP(rw, req)
+		return
+	}
+
+	if c.precedence.allowedIPsFirst && c.clientAllowed(ev) {
+		if c.log {
+			c.logDecision(req, logEntry{Decision: decisionIPBypass, ClientIP: ev.ip().String()},
+				"access allowed - IP %s skips request rules", ev.ip())
+		}
+		c.metrics.incIPBypass()
+		for _, tag := range ev.tags {
+			req.Header.Add(c.tagHeader, tag)
+		}
+		if len(rules.responseHeaderRules) > 0 {
+			rw = &responseWriter{ResponseWriter: rw, plugin: c, req: req, rules: rules}
+		}
+		c.next.ServeHTTP(rw, req)
+		return
+	}
+
+	if c.clientCertWhitelisted(ev) {
+		if c.log {
+			c.logDecision(req, logEntry{Decision: decisionWhitelisted, Header: clientCertHeader},
+				"access allowed - whitelisted client certificate")
+		}
+		for _, tag := range ev.tags {
+			req.Header.Add(c.tagHeader, tag)
+		}
+		if len(rules.responseHeaderRules) > 0 {
+			rw = &responseWriter{ResponseWriter: rw, plugin: c, req: req, rules: rules}
+		}
+		c.next.ServeHTTP(rw, req)
+		return
+	}
+
+	if c.filterRequestURI(ev) {
+		return
+	}
+
+	for _, requiredRule := range rules.requiredHeaderRules {
+		if !requiredRule.appliesTo(req) || hasMatchingHeader(req.Header, requiredRule) {
+			continue
+		}
+		c.hits.inc(requiredRule.id)
+
+		if c.enforce(ev, requiredRule, logEntry{Rule: requiredRule.id}, "missing required header") == outcomeDenied {
+			return
+		}
+	}
+
+	if c.filterClientCert(ev) {
+		return
+	}
+	if c.filterRequestHeaders(ev) {
+		return
+	}
+
+	if c.filterCookies(ev) {
+		return
+	}
+	if c.filterBody(ev) {
+		return
+	}
+
+	// Tags are added once all headers are evaluated so they are never matched themselves
+	for _, tag := range ev.tags {
+		req.Header.Add(c.tagHeader, tag)
+	}
+
+	if c.debug {
+		for _, id := range ev.dryRunRules {
+			rw.Header().Add(debugRuleHeader, id)
+		}
+	}
+
+	if c.inspectTrailers && mayHaveTrailers(req) {
+		req.Body = &trailerBody{ReadCloser: req.Body, plugin: c, req: req, rules: rules}
+	}
+
 	// No blocking rules matched
+	if len(rules.responseHeaderRules) > 0 {
+		rw = &responseWriter{ResponseWriter: rw, plugin: c, req: req, rules: rules}
+	}
 	c.next.ServeHTTP(rw, req)
 }
 
-func applyRule(rule rule, name string, values []string) bool {
-	nameMatch := rule.name != nil && rule.name.MatchString(name)
-	if rule.value == nil && nameMatch {
-		return true
-	} else if rule.value != nil && (nameMatch || rule.name == nil) {
-		for _, value := range values {
-			if rule.value.MatchString(value) {
-				return true
+// deny writes the response sent to clients whose request is blocked. entry
+// describes the decision for the debug header and the deny page.
+func (c *headerBlock) deny(rw http.ResponseWriter, req *http.Request, statusCode int, entry logEntry) {
+	c.denyWith(rw, req, statusCode, entry, nil)
+}
+
+// denyWith writes the deny response with the body and headers of r, when
+// set, in place of the global ones.
+func (c *headerBlock) denyWith(rw http.ResponseWriter, req *http.Request, statusCode int, entry logEntry, r *rule) {
+	if c.debug {
+		c.setDebugHeader(rw, entry)
+	}
+	if id := c.requestID(req); id != "" {
+		rw.Header().Set(c.requestIDHeader, id)
+	}
+	if c.denyHandler != nil {
+		c.handOff(rw, req, entry)
+		return
+	}
+	if c.denyMode == denyModeDrop {
+		c.drop(rw, statusCode)
+		return
+	}
+	var ruleHeaders http.Header
+	if r != nil {
+		ruleHeaders = r.denyHeaders
+	}
+	if isGRPC(req) {
+		for _, headers := range []http.Header{c.denyHeaders, ruleHeaders} {
+			for name, values := range headers {
+				rw.Header()[name] = values
 			}
 		}
+		denyGRPC(rw, statusCode)
+		return
+	}
+
+	var (
+		contentType string
+		body        []byte
+	)
+	if r != nil && r.denyBody != nil {
+		contentType, body = "text/plain; charset=utf-8", r.denyBody
+	} else {
+		contentType, body = c.denyResponse(req, statusCode, entry)
+		if c.denyJSONTemplate != nil {
+			rw.Header().Add("Vary", "Accept")
+		}
+	}
+	if contentType != "" {
+		rw.Header().Set("Content-Type", contentType)
+	}
+	for _, headers := range []http.Header{c.denyHeaders, ruleHeaders} {
+		for name, values := range headers {
+			rw.Header()[name] = values
+		}
+	}
+
+	rw.WriteHeader(statusCode)
+
+	if len(body) > 0 {
+		if _, err := rw.Write(body); err != nil && c.log {
+			log.Printf("headerblock: failed to write deny body: %v", err)
+		}
+	}
+}
+
+// parseDenyHeaders validates the denyHeaders and canonicalizes their names.
+func parseDenyHeaders(raw map[string]string) (http.Header, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	headers := make(http.Header, len(raw))
+	for name, value := range raw {
+		name = strings.TrimSpace(name)
+		if name == "" || strings.ContainsAny(name, " \t:\r\n") {
+			return nil, fmt.Errorf("denyHeaders: invalid header name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("denyHeaders.%s: value must not contain line breaks", name)
+		}
+		headers.Set(name, value)
+	}
+	return headers, nil
+}
+
+// recordBlock counts a denied request and reports it to the audit trail and
+// the webhook.
+func (c *headerBlock) recordBlock(req *http.Request, entry logEntry) {
+	c.metrics.incBlocked()
+
+	if c.webhook == nil && c.audit == nil {
+		return
+	}
+	if entry.ClientIP == "" {
+		if clientIP := c.clientIPs.resolve(req); clientIP != nil {
+			entry.ClientIP = clientIP.String()
+		}
+	}
+	now := time.Now()
+
+	var headers map[string][]string
+	if c.audit != nil {
+		headers = c.auditBlock(req, entry, now)
+	}
+
+	if c.webhook != nil {
+		event := webhookEvent{
+			Time:     now.UTC().Format(time.RFC3339Nano),
+			Decision: entry.Decision,
+			ClientIP: entry.ClientIP,
+			Rule:     entry.Rule,
+			Severity: entry.Severity,
+			Header:   entry.Header,
+			Captures: entry.Captures,
+			Method:   req.Method,
+			Host:     req.Host,
+			Path:     req.URL.Path,
+			Headers:  headers,
+		}
+		if c.redactLogValues {
+			event.Captures = redactCaptures(event.Captures)
+		}
+		if c.tracing {
+			event.TraceID, _ = traceContext(req)
+		}
+		event.RequestID = c.requestID(req)
+		c.webhook.enqueue(event)
 	}
-	return false
 }
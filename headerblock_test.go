@@ -1,9 +1,14 @@
 package headerblock_test
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 
 	tbua "github.com/PRIHLOP/headerblock"
@@ -11,18 +16,26 @@ import (
 
 const pluginName = "headerBlock"
 
-type noopHandler struct{}
+type noopHandler struct {
+	req *http.Request
+}
 
-func (n noopHandler) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+func (n *noopHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	n.req = req
 	rw.WriteHeader(http.StatusTeapot)
 }
 
 type testCase struct {
-	name           string
-	config         func() *tbua.Config
-	headers        map[string]string
-	remoteAddr     string
-	expectedStatus int
+	name             string
+	config           func() *tbua.Config
+	path             string
+	host             string
+	headers          map[string]string
+	remoteAddr       string
+	expectedStatus   int
+	expectedBody     string
+	strippedHeaders  []string
+	forwardedHeaders map[string]string
 }
 
 func TestHeaderBlock(t *testing.T) {
@@ -96,6 +109,42 @@ func TestHeaderBlock(t *testing.T) {
 			},
 			expectedStatus: http.StatusForbidden,
 		},
+		{
+			name: "WhitelistSourceIPMatch",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{Name: "X-Debug"},
+				}
+				cfg.WhitelistRequestHeaders = []tbua.HeaderConfig{
+					{Name: "X-Debug", Value: "^true$", SourceIPs: []string{"192.0.2.0/24"}},
+				}
+				return cfg
+			},
+			remoteAddr: "192.0.2.10:1234",
+			headers: map[string]string{
+				"X-Debug": "true",
+			},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name: "WhitelistSourceIPMismatch",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{Name: "X-Debug"},
+				}
+				cfg.WhitelistRequestHeaders = []tbua.HeaderConfig{
+					{Name: "X-Debug", Value: "^true$", SourceIPs: []string{"192.0.2.0/24"}},
+				}
+				return cfg
+			},
+			remoteAddr: "198.51.100.10:1234",
+			headers: map[string]string{
+				"X-Debug": "true",
+			},
+			expectedStatus: http.StatusForbidden,
+		},
 		{
 			name: "AllowedIPBypass",
 			config: func() *tbua.Config {
@@ -112,6 +161,101 @@ func TestHeaderBlock(t *testing.T) {
 			remoteAddr:     "10.1.1.1:1234",
 			expectedStatus: http.StatusTeapot,
 		},
+		{
+			name: "BlockedIP",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.BlockedIPs = []string{"192.0.2.0/24, 198.51.100.7"}
+				cfg.BlockedIPsStatusCode = http.StatusTooManyRequests
+				return cfg
+			},
+			remoteAddr:     "198.51.100.7:1234",
+			expectedStatus: http.StatusTooManyRequests,
+		},
+		{
+			name: "NotBlockedIP",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.BlockedIPs = []string{"192.0.2.0/24"}
+				return cfg
+			},
+			remoteAddr:     "198.51.100.7:1234",
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name: "PerRuleAllowedIPBypass",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{Name: "X-Debug", AllowedIPs: []string{"10.10.0.0/16"}},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"X-Debug": "1",
+			},
+			remoteAddr:     "10.10.1.1:1234",
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name: "PerRuleAllowedIPOtherRuleStillBlocks",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{Name: "X-Debug", AllowedIPs: []string{"10.10.0.0/16"}},
+					{Name: "X-Admin"},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"X-Debug": "1",
+				"X-Admin": "1",
+			},
+			remoteAddr:     "10.10.1.1:1234",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "RequiredHeaderMissing",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequiredHeaders = []tbua.HeaderConfig{
+					{Name: "^X-Request-Id$"},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"User-Agent": "Mozilla",
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "RequiredHeaderPresent",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequiredHeaders = []tbua.HeaderConfig{
+					{Name: "^X-Internal-Auth$", Value: "^token-"},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"X-Internal-Auth": "token-abc",
+			},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name: "RequiredHeaderWrongValue",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequiredHeaders = []tbua.HeaderConfig{
+					{Name: "^X-Internal-Auth$", Value: "^token-"},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"X-Internal-Auth": "guess",
+			},
+			expectedStatus: http.StatusForbidden,
+		},
 		{
 			name: "RegexHeaderAndValue",
 			config: func() *tbua.Config {
@@ -126,6 +270,62 @@ func TestHeaderBlock(t *testing.T) {
 			},
 			expectedStatus: http.StatusForbidden,
 		},
+		{
+			name: "CaseInsensitiveRule",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{Name: "^user-agent$", Value: "^curl/", CaseInsensitive: true},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"User-Agent": "Curl/7.79",
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "CaseSensitiveByDefault",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{Name: "User-Agent", Value: "^curl/"},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"User-Agent": "Curl/7.79",
+			},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name: "NegatedRuleBlocksMismatch",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{Name: "X-Api-Version", Value: `^v2\.`, Negate: true},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"X-Api-Version": "v1.4",
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "NegatedRuleAllowsMatch",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{Name: "X-Api-Version", Value: `^v2\.`, Negate: true},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"X-Api-Version": "v2.1",
+			},
+			expectedStatus: http.StatusTeapot,
+		},
 		{
 			name: "ValueOnlyRule",
 			config: func() *tbua.Config {
@@ -140,13 +340,274 @@ func TestHeaderBlock(t *testing.T) {
 			},
 			expectedStatus: http.StatusForbidden,
 		},
+		{
+			name: "StripAction",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{Name: "X-Internal-Token", Action: "strip"},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"X-Internal-Token": "secret",
+				"User-Agent":       "Mozilla",
+			},
+			expectedStatus:  http.StatusTeapot,
+			strippedHeaders: []string{"X-Internal-Token"},
+		},
+		{
+			name: "LogAction",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{Name: "User-Agent", Value: "curl", Action: "log"},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"User-Agent": "curl/8.0",
+			},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name: "TagAction",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{Name: "User-Agent", Value: "python", Action: "tag"},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"User-Agent":        "python-requests/2.31",
+				"X-Headerblock-Tag": "forged",
+			},
+			expectedStatus: http.StatusTeapot,
+			forwardedHeaders: map[string]string{
+				"X-HeaderBlock-Tag": "requestHeaders[0]",
+				"User-Agent":        "python-requests/2.31",
+			},
+		},
+		{
+			name: "BlockedCookie",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestCookies = []tbua.HeaderConfig{
+					{Name: "^debug$", Value: "^1$"},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"Cookie": "session=abc; debug=1",
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "StrippedCookie",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestCookies = []tbua.HeaderConfig{
+					{Name: "^_ga", Action: "strip"},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"Cookie": "_ga=GA1.2.3; session=abc; _gat=1",
+			},
+			expectedStatus: http.StatusTeapot,
+			forwardedHeaders: map[string]string{
+				"Cookie": "session=abc",
+			},
+		},
+		{
+			name: "StrippedCookieKeepsOthersVerbatim",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestCookies = []tbua.HeaderConfig{
+					{Name: "^_ga", Action: "strip"},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"Cookie": `_ga=GA1.2.3; pref="a,b"; bad cookie=x;session=abc`,
+			},
+			expectedStatus: http.StatusTeapot,
+			forwardedHeaders: map[string]string{
+				"Cookie": `pref="a,b"; bad cookie=x; session=abc`,
+			},
+		},
+		{
+			name: "StrippedOnlyCookie",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestCookies = []tbua.HeaderConfig{
+					{Name: "^tracking$", Action: "strip"},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"Cookie": "tracking=xyz",
+			},
+			expectedStatus:  http.StatusTeapot,
+			strippedHeaders: []string{"Cookie"},
+		},
+		{
+			name: "PathScopedRuleInScope",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{Name: "X-Forwarded-User", PathRegex: "^/admin/"},
+				}
+				return cfg
+			},
+			path: "/admin/users",
+			headers: map[string]string{
+				"X-Forwarded-User": "root",
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "PathScopedRuleOutOfScope",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{Name: "X-Forwarded-User", PathRegex: "^/admin/"},
+				}
+				return cfg
+			},
+			path: "/public",
+			headers: map[string]string{
+				"X-Forwarded-User": "root",
+			},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name: "HostScopedRuleInScope",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{Name: "X-Debug", HostRegex: `^api\.example\.com$`},
+				}
+				return cfg
+			},
+			host: "api.example.com:8443",
+			headers: map[string]string{
+				"X-Debug": "1",
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "HostScopedRuleOutOfScope",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{Name: "X-Debug", HostRegex: `^api\.example\.com$`},
+				}
+				return cfg
+			},
+			host: "www.example.com",
+			headers: map[string]string{
+				"X-Debug": "1",
+			},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name: "CustomDenyResponse",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{Name: "X-Debug"},
+				}
+				cfg.DenyStatusCode = http.StatusNotFound
+				cfg.DenyBody = `{"error":"not found"}`
+				cfg.DenyContentType = "application/json"
+				return cfg
+			},
+			headers: map[string]string{
+				"X-Debug": "1",
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"not found"}`,
+		},
+		{
+			name: "DryRunForwardsBlocked",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{Name: "User-Agent", Value: "Googlebot"},
+				}
+				cfg.DryRun = true
+				return cfg
+			},
+			headers: map[string]string{
+				"User-Agent": "Googlebot",
+			},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name: "PerRuleDryRun",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{Name: "X-New-Rule", DryRun: true},
+					{Name: "X-Old-Rule"},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"X-New-Rule": "1",
+				"X-Old-Rule": "1",
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "CompositeRuleAllMatch",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{All: []tbua.HeaderConfig{
+						{Name: "^User-Agent$", Value: "python"},
+						{Name: "^Accept$", Value: `^\*/\*$`},
+						{Name: "^Referer$", Absent: true},
+					}},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"User-Agent": "python-requests/2.31",
+				"Accept":     "*/*",
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "CompositeRulePartialMatch",
+			config: func() *tbua.Config {
+				cfg := tbua.CreateConfig()
+				cfg.RequestHeaders = []tbua.HeaderConfig{
+					{All: []tbua.HeaderConfig{
+						{Name: "^User-Agent$", Value: "python"},
+						{Name: "^Accept$", Value: `^\*/\*$`},
+						{Name: "^Referer$", Absent: true},
+					}},
+				}
+				return cfg
+			},
+			headers: map[string]string{
+				"User-Agent": "python-requests/2.31",
+				"Accept":     "*/*",
+				"Referer":    "https://example.com/",
+			},
+			expectedStatus: http.StatusTeapot,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			next := &noopHandler{}
 			p, err := tbua.New(
 				context.Background(),
-				noopHandler{},
+				next,
 				tt.config(),
 				pluginName,
 			)
@@ -154,8 +615,14 @@ func TestHeaderBlock(t *testing.T) {
 				t.Fatalf("plugin init error: %v", err)
 			}
 
-			req := httptest.NewRequest(http.MethodGet, "/test", nil)
-
+			path := tt.path
+			if path == "" {
+				path = "/test"
+			}
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			if tt.host != "" {
+				req.Host = tt.host
+			}
 			for k, v := range tt.headers {
 				req.Header.Set(k, v)
 			}
@@ -170,6 +637,479 @@ func TestHeaderBlock(t *testing.T) {
 			if rr.Code != tt.expectedStatus {
 				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
 			}
+
+			if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+				t.Fatalf("expected body %q, got %q", tt.expectedBody, rr.Body.String())
+			}
+			for header, value := range tt.forwardedHeaders {
+				if next.req == nil {
+					t.Fatalf("request was not forwarded")
+				}
+				if got := next.req.Header.Get(header); got != value {
+					t.Fatalf("expected forwarded header %s=%q, got %q", header, value, got)
+				}
+			}
+
+			for _, header := range tt.strippedHeaders {
+				if next.req == nil {
+					t.Fatalf("request was not forwarded")
+				}
+				if next.req.Header.Get(header) != "" {
+					t.Fatalf("expected header %s to be stripped", header)
+				}
+			}
+		})
+	}
+}
+
+func TestUnknownAction(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Test", Action: "explode"},
+	}
+
+	_, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err == nil {
+		t.Fatal("expected error for unknown action")
+	}
+}
+
+func TestInvalidDenyStatusCode(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.DenyStatusCode = 999
+
+	_, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err == nil {
+		t.Fatal("expected error for invalid deny status code")
+	}
+}
+
+func TestDenyHeaders(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Debug"},
+	}
+	cfg.DenyHeaders = map[string]string{
+		"retry-after":       "120",
+		"Cache-Control":     "no-store",
+		"X-Support-Contact": "security@example.com",
+	}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, debug := range []string{"1", ""} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if debug != "" {
+			req.Header.Set("X-Debug", debug)
+		}
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+
+		expected := map[string]string{
+			"Retry-After":       "120",
+			"Cache-Control":     "no-store",
+			"X-Support-Contact": "security@example.com",
+		}
+		for name, value := range expected {
+			if debug == "" {
+				value = ""
+			}
+			if got := rr.Header().Get(name); got != value {
+				t.Fatalf("expected %s=%q on status %d, got %q", name, value, rr.Code, got)
+			}
+		}
+	}
+}
+
+func TestInvalidDenyHeaders(t *testing.T) {
+	for _, headers := range []map[string]string{
+		{"Retry After": "120"},
+		{"": "value"},
+		{"X-Contact": "a\r\nSet-Cookie: x=1"},
+	} {
+		cfg := tbua.CreateConfig()
+		cfg.DenyHeaders = headers
+
+		if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+			t.Fatalf("expected error for deny headers %q", headers)
+		}
+	}
+}
+
+func TestInvalidRegexReturnsError(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Ok"},
+		{Name: "X-(Broken", Value: "[a-"},
+	}
+
+	_, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err == nil {
+		t.Fatal("expected error for invalid regex")
+	}
+
+	for _, field := range []string{"requestHeaders[1].name", "requestHeaders[1].value"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Fatalf("expected error to mention %s, got %v", field, err)
+		}
+	}
+}
+
+func TestNegateRequiresNameAndValue(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Api-Version", Negate: true},
+	}
+
+	_, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err == nil {
+		t.Fatal("expected error for negated rule without value")
+	}
+}
+
+func TestConflictingHeaders(t *testing.T) {
+	tests := []struct {
+		name           string
+		values         []string
+		expectedStatus int
+	}{
+		{name: "Single", values: []string{"chunked"}, expectedStatus: http.StatusTeapot},
+		{name: "Repeated", values: []string{"chunked", " chunked"}, expectedStatus: http.StatusTeapot},
+		{name: "Conflicting", values: []string{"chunked", "identity"}, expectedStatus: http.StatusForbidden},
+	}
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "^(Transfer-Encoding|X-Forwarded-Proto)$", Conflicting: true},
+	}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			for _, value := range tt.values {
+				req.Header.Add("X-Forwarded-Proto", value)
+			}
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestConflictingRequiresNameOnly(t *testing.T) {
+	for _, rule := range []tbua.HeaderConfig{
+		{Conflicting: true},
+		{Name: "Content-Length", Value: "0", Conflicting: true},
+	} {
+		cfg := tbua.CreateConfig()
+		cfg.RequestHeaders = []tbua.HeaderConfig{rule}
+
+		if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+			t.Errorf("expected error for conflicting rule %+v", rule)
+		}
+	}
+}
+
+func TestBlockEmptyValue(t *testing.T) {
+	tests := []struct {
+		name           string
+		values         []string
+		expectedStatus int
+	}{
+		{name: "Missing", expectedStatus: http.StatusTeapot},
+		{name: "Set", values: []string{"Mozilla/5.0"}, expectedStatus: http.StatusTeapot},
+		{name: "Empty", values: []string{""}, expectedStatus: http.StatusForbidden},
+		{name: "Whitespace", values: []string{" \t"}, expectedStatus: http.StatusForbidden},
+		{name: "EmptyRepeat", values: []string{"Mozilla/5.0", ""}, expectedStatus: http.StatusForbidden},
+	}
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "^User-Agent$", BlockEmptyValue: true},
+	}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			for _, value := range tt.values {
+				req.Header.Add("User-Agent", value)
+			}
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidBlockEmptyValue(t *testing.T) {
+	for _, cfg := range []func(*tbua.Config){
+		func(c *tbua.Config) { c.RequestHeaders = []tbua.HeaderConfig{{BlockEmptyValue: true}} },
+		func(c *tbua.Config) {
+			c.RequestHeaders = []tbua.HeaderConfig{{Name: "User-Agent", Value: "curl", BlockEmptyValue: true}}
+		},
+		func(c *tbua.Config) {
+			c.RequiredHeaders = []tbua.HeaderConfig{{Name: "User-Agent", BlockEmptyValue: true}}
+		},
+	} {
+		config := tbua.CreateConfig()
+		cfg(config)
+
+		if _, err := tbua.New(context.Background(), &noopHandler{}, config, pluginName); err == nil {
+			t.Errorf("expected error for %+v", config)
+		}
+	}
+}
+
+func TestMaxOccurrences(t *testing.T) {
+	tests := []struct {
+		name           string
+		values         []string
+		expectedStatus int
+	}{
+		{name: "Missing", expectedStatus: http.StatusTeapot},
+		{name: "Once", values: []string{"192.0.2.1"}, expectedStatus: http.StatusTeapot},
+		{name: "CommaList", values: []string{"192.0.2.1, 192.0.2.2"}, expectedStatus: http.StatusTeapot},
+		{name: "Repeated", values: []string{"192.0.2.1", "192.0.2.2"}, expectedStatus: http.StatusForbidden},
+	}
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "^X-Forwarded-For$", MaxOccurrences: 1},
+	}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			for _, value := range tt.values {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidMaxOccurrences(t *testing.T) {
+	for _, cfg := range []func(*tbua.Config){
+		func(c *tbua.Config) { c.RequestHeaders = []tbua.HeaderConfig{{MaxOccurrences: 1}} },
+		func(c *tbua.Config) {
+			c.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Forwarded-For", MaxOccurrences: -1}}
+		},
+		func(c *tbua.Config) {
+			c.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Forwarded-For", Value: "10\\.", MaxOccurrences: 1}}
+		},
+		func(c *tbua.Config) {
+			c.RequiredHeaders = []tbua.HeaderConfig{{Name: "X-Forwarded-For", MaxOccurrences: 1}}
+		},
+	} {
+		config := tbua.CreateConfig()
+		cfg(config)
+
+		if _, err := tbua.New(context.Background(), &noopHandler{}, config, pluginName); err == nil {
+			t.Errorf("expected error for %+v", config)
+		}
+	}
+}
+
+func TestInvalidCompositeRules(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(*tbua.Config)
+	}{
+		{name: "NameAndAll", cfg: func(c *tbua.Config) {
+			c.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Debug", All: []tbua.HeaderConfig{{Name: "X-Scan"}}}}
+		}},
+		{name: "StripAction", cfg: func(c *tbua.Config) {
+			c.RequestHeaders = []tbua.HeaderConfig{{Action: "strip", All: []tbua.HeaderConfig{{Name: "X-Scan"}}}}
+		}},
+		{name: "ConditionWithoutName", cfg: func(c *tbua.Config) {
+			c.RequestHeaders = []tbua.HeaderConfig{{All: []tbua.HeaderConfig{{Value: "1"}}}}
+		}},
+		{name: "AbsentOutsideAll", cfg: func(c *tbua.Config) {
+			c.RequestHeaders = []tbua.HeaderConfig{{Name: "Referer", Absent: true}}
+		}},
+		{name: "OtherSection", cfg: func(c *tbua.Config) {
+			c.ResponseHeaders = []tbua.HeaderConfig{{All: []tbua.HeaderConfig{{Name: "Server"}}}}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			tt.cfg(cfg)
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestDisabledRules(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	disabled, enabled := false, true
+	cfg := tbua.CreateConfig()
+	cfg.Log = true
+	cfg.Debug = true
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Scan", Enabled: &disabled},
+		{Name: "X-Scan", Value: "1", Enabled: &enabled},
+		{Name: "X-Legacy"},
+	}
+	cfg.ResponseHeaders = []tbua.HeaderConfig{{Name: "Server", Enabled: &disabled}}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "2 rules active, 2 disabled") {
+		t.Fatalf("expected a startup summary, got %q", buf.String())
+	}
+
+	tests := []struct {
+		name           string
+		value          string
+		expectedStatus int
+		expectedRule   string
+	}{
+		{name: "disabled rule skipped", value: "2", expectedStatus: http.StatusTeapot},
+		{name: "enabled rule keeps its position", value: "1", expectedStatus: http.StatusForbidden, expectedRule: "requestHeaders[1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Scan", tt.value)
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if got := rr.Header().Get("X-HeaderBlock-Rule"); got != tt.expectedRule {
+				t.Fatalf("expected rule %q, got %q", tt.expectedRule, got)
+			}
+		})
+	}
+}
+
+func TestInvalidDisabledRule(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		name  string
+		rules []tbua.HeaderConfig
+	}{
+		{name: "invalid pattern", rules: []tbua.HeaderConfig{{Name: "X-Scan", Value: "(", Enabled: &disabled}}},
+		{name: "disabled condition", rules: []tbua.HeaderConfig{{All: []tbua.HeaderConfig{{Name: "X-Scan", Enabled: &disabled}}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.RequestHeaders = tt.rules
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestServeHTTPWithoutMatchDoesNotAllocate(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector allocates")
+	}
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "^X-Debug$"},
+		{Name: "^User-Agent$", Value: "scanner"},
+		{Name: "^X-", Value: "^payload"},
+	}
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+	rr := httptest.NewRecorder()
+
+	if allocs := testing.AllocsPerRun(100, func() { p.ServeHTTP(rr, req) }); allocs != 0 {
+		t.Fatalf("expected no allocations, got %v per request", allocs)
+	}
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	for _, size := range []int{10, 100, 1000} {
+		cfg := tbua.CreateConfig()
+		cfg.BlockedIPs = []string{"198.51.100.0/24"}
+		for i := 0; i < size; i++ {
+			switch i % 3 {
+			case 0:
+				cfg.RequestHeaders = append(cfg.RequestHeaders, tbua.HeaderConfig{Name: fmt.Sprintf("^X-Debug-%d$", i)})
+			case 1:
+				cfg.RequestHeaders = append(cfg.RequestHeaders, tbua.HeaderConfig{Name: "^User-Agent$", Value: fmt.Sprintf("scanner-%d", i)})
+			default:
+				cfg.RequestHeaders = append(cfg.RequestHeaders, tbua.HeaderConfig{Name: "^X-", Value: fmt.Sprintf("^payload-%d", i)})
+			}
+		}
+
+		p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			b.Fatalf("plugin init error: %v", err)
+		}
+
+		b.Run(fmt.Sprintf("%d rules", size), func(b *testing.B) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/users?page=2", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0")
+			req.Header.Set("Accept", "text/html,application/xhtml+xml")
+			req.Header.Set("Accept-Language", "en-US,en;q=0.5")
+			req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			req.Header.Set("X-Request-Id", "4bf92f3577b34da6")
+			rr := httptest.NewRecorder()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				p.ServeHTTP(rr, req)
+			}
 		})
 	}
 }
@@ -0,0 +1,46 @@
+package headerblock
+
+import "net/http"
+
+// invalidHeaderByte returns the name of a header whose value holds a control byte other than tab (CR, LF, NUL, DEL, ...)
+// or a non-ASCII byte, and that byte. Backends that re-serialize headers
+// carelessly can be tricked by such bytes into splitting or truncating them.
+func invalidHeaderByte(header http.Header) (string, byte, bool) {
+	for name, values := range header {
+		for _, value := range values {
+			for i := 0; i < len(value); i++ {
+				if b := value[i]; (b < 0x20 && b != '\t') || b >= 0x7f {
+					return name, b, true
+				}
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// checkHeaderBytes denies requests with control or non-ASCII bytes in a
+// header value when strictHeaderBytes is enabled and reports whether it did.
+func (c *headerBlock) checkHeaderBytes(ev *evaluation) bool {
+	if !c.strictHeaderBytes {
+		return false
+	}
+	name, b, found := invalidHeaderByte(ev.req.Header)
+	if !found {
+		return false
+	}
+
+	entry := logEntry{
+		Decision: decisionHeaderBytes,
+		Rule:     "strictHeaderBytes",
+		Header:   name,
+	}
+	if ip := ev.ip(); ip != nil {
+		entry.ClientIP = ip.String()
+	}
+	if c.log {
+		c.logDecision(ev.req, entry, "access denied - byte 0x%02x in header %s from IP %s", b, name, entry.ClientIP)
+	}
+	c.recordBlock(ev.req, entry)
+	c.deny(ev.rw, ev.req, http.StatusBadRequest, entry)
+	return true
+}
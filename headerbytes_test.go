@@ -0,0 +1,48 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestStrictHeaderBytes(t *testing.T) {
+	tests := []struct {
+		name           string
+		strict         bool
+		value          string
+		expectedStatus int
+	}{
+		{name: "plain value", strict: true, value: "Mozilla/5.0 (X11; Linux x86_64)", expectedStatus: http.StatusTeapot},
+		{name: "tab", strict: true, value: "a\tb", expectedStatus: http.StatusTeapot},
+		{name: "line feed", strict: true, value: "a\nX-Injected: 1", expectedStatus: http.StatusBadRequest},
+		{name: "nul", strict: true, value: "a\x00b", expectedStatus: http.StatusBadRequest},
+		{name: "delete", strict: true, value: "a\x7fb", expectedStatus: http.StatusBadRequest},
+		{name: "non-ascii", strict: true, value: "café", expectedStatus: http.StatusBadRequest},
+		{name: "disabled", value: "a\x00b", expectedStatus: http.StatusTeapot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.StrictHeaderBytes = tt.strict
+
+			p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header["User-Agent"] = []string{tt.value}
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestStrictHeaderNames(t *testing.T) {
+	tests := []struct {
+		name              string
+		action            string
+		rejectUnderscores bool
+		header            string
+		expectedStatus    int
+		expectedForwarded bool
+	}{
+		{name: "valid name", header: "X-Request-Id", expectedStatus: http.StatusTeapot, expectedForwarded: true},
+		{name: "space", header: "X Forwarded For", expectedStatus: http.StatusBadRequest},
+		{name: "colon", header: "X-Forwarded-For:", expectedStatus: http.StatusBadRequest},
+		{name: "underscore allowed", header: "X_Forwarded_For", expectedStatus: http.StatusTeapot, expectedForwarded: true},
+		{name: "underscore rejected", rejectUnderscores: true, header: "X_Forwarded_For", expectedStatus: http.StatusBadRequest},
+		{name: "stripped", action: "strip", rejectUnderscores: true, header: "X_Forwarded_For", expectedStatus: http.StatusTeapot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.StrictHeaderNames = true
+			cfg.StrictHeaderNamesAction = tt.action
+			cfg.RejectUnderscoreHeaders = tt.rejectUnderscores
+
+			next := &noopHandler{}
+			p, err := tbua.New(context.Background(), next, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header[tt.header] = []string{"1"}
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if next.req == nil {
+				return
+			}
+			if _, ok := next.req.Header[tt.header]; ok != tt.expectedForwarded {
+				t.Fatalf("expected header forwarded %v, got %v", tt.expectedForwarded, ok)
+			}
+		})
+	}
+}
+
+func TestInvalidStrictHeaderNames(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(cfg *tbua.Config)
+	}{
+		{
+			name: "unknown action",
+			config: func(cfg *tbua.Config) {
+				cfg.StrictHeaderNames = true
+				cfg.StrictHeaderNamesAction = "tag"
+			},
+		},
+		{
+			name:   "underscores without strictHeaderNames",
+			config: func(cfg *tbua.Config) { cfg.RejectUnderscoreHeaders = true },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			tt.config(cfg)
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
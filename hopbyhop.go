@@ -0,0 +1,107 @@
+package headerblock
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	hopByHopStrip = "strip"
+	hopByHopBlock = "block"
+)
+
+// hopByHopHeaders are the well-known hop-by-hop request headers removed in
+// both modes. Connection and Upgrade are kept, Traefik needs them for
+// WebSocket handshakes.
+var hopByHopHeaders = []string{"Keep-Alive", "Proxy-Connection", "Proxy-Authorization", "Te"}
+
+// connectionOptions are Connection tokens that are connection options rather
+// than nominated headers.
+var connectionOptions = map[string]struct{}{
+	"close":      {},
+	"keep-alive": {},
+	"upgrade":    {},
+}
+
+func parseHopByHopMode(raw string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(raw)); mode {
+	case "", hopByHopStrip, hopByHopBlock:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("hopByHopHeaders: unknown mode %q", raw)
+	}
+}
+
+// nominatedHeaders returns the headers present in header that its Connection
+// header nominates as hop-by-hop, apart from Connection and Upgrade.
+func nominatedHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			token = strings.TrimSpace(token)
+			if _, ok := connectionOptions[strings.ToLower(token)]; ok || token == "" {
+				continue
+			}
+			name := http.CanonicalHeaderKey(token)
+			if _, ok := header[name]; ok && name != "Connection" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// sanitizeHopByHop removes hop-by-hop headers from the request before any rule
+// sees it. Headers nominated by Connection are stripped, or the request is
+// denied in block mode, since nominating end-to-end headers such as
+// X-Forwarded-For or Authorization makes proxies drop them on the way to the
+// backend. It reports whether the request was denied.
+func (c *headerBlock) sanitizeHopByHop(ev *evaluation) bool {
+	if c.hopByHop == "" {
+		return false
+	}
+
+	var clientIP string
+	if ip := ev.ip(); ip != nil {
+		clientIP = ip.String()
+	}
+
+	nominated := nominatedHeaders(ev.req.Header)
+	if c.hopByHop == hopByHopBlock && len(nominated) > 0 {
+		entry := logEntry{
+			Decision: decisionDenied,
+			Rule:     "hopByHopHeaders",
+			Header:   nominated[0],
+			ClientIP: clientIP,
+		}
+		if c.log {
+			c.logDecision(ev.req, entry, "access denied - Connection nominates header %s from IP %s", nominated[0], clientIP)
+		}
+		c.recordBlock(ev.req, entry)
+		c.deny(ev.rw, ev.req, c.denyStatusCode, entry)
+		return true
+	}
+
+	for _, name := range append(nominated, hopByHopHeaders...) {
+		if _, ok := ev.req.Header[name]; !ok {
+			continue
+		}
+		// TE: trailers is end-to-end in practice: gRPC requires it.
+		if name == "Te" && strings.EqualFold(strings.TrimSpace(ev.req.Header.Get("Te")), "trailers") {
+			continue
+		}
+
+		ev.req.Header.Del(name)
+		if c.log {
+			entry := logEntry{
+				Decision: decisionStripped,
+				Rule:     "hopByHopHeaders",
+				Header:   name,
+				ClientIP: clientIP,
+			}
+			c.logDecision(ev.req, entry, "hop-by-hop header %s stripped from IP %s", name, clientIP)
+		}
+	}
+	return false
+}
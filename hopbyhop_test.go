@@ -0,0 +1,108 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestHopByHopHeaders(t *testing.T) {
+	tests := []struct {
+		name             string
+		mode             string
+		headers          map[string]string
+		expectedStatus   int
+		expectedStripped []string
+	}{
+		{
+			name:             "strip nominated and well-known headers",
+			mode:             "strip",
+			headers:          map[string]string{"Connection": "keep-alive, X-Forwarded-For", "X-Forwarded-For": "10.0.0.1", "Keep-Alive": "300", "Proxy-Authorization": "Basic Zm9v"},
+			expectedStatus:   http.StatusTeapot,
+			expectedStripped: []string{"Keep-Alive", "Proxy-Authorization", "X-Forwarded-For"},
+		},
+		{
+			name:           "keep te trailers and upgrade",
+			mode:           "strip",
+			headers:        map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Te": "trailers"},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:             "strip te other than trailers",
+			mode:             "strip",
+			headers:          map[string]string{"Te": "gzip"},
+			expectedStatus:   http.StatusTeapot,
+			expectedStripped: []string{"Te"},
+		},
+		{
+			name:           "block nominated header",
+			mode:           "block",
+			headers:        map[string]string{"Connection": "close, Authorization", "Authorization": "Bearer token"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:             "block mode strips well-known headers",
+			mode:             "block",
+			headers:          map[string]string{"Connection": "keep-alive", "Keep-Alive": "300"},
+			expectedStatus:   http.StatusTeapot,
+			expectedStripped: []string{"Keep-Alive"},
+		},
+		{
+			name:           "disabled",
+			headers:        map[string]string{"Connection": "close, Authorization", "Authorization": "Bearer token", "Keep-Alive": "300"},
+			expectedStatus: http.StatusTeapot,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.HopByHopHeaders = tt.mode
+
+			next := &noopHandler{}
+			p, err := tbua.New(context.Background(), next, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if next.req == nil {
+				return
+			}
+
+			var stripped []string
+			for name := range tt.headers {
+				if next.req.Header.Get(name) == "" {
+					stripped = append(stripped, name)
+				}
+			}
+			sort.Strings(stripped)
+			if !reflect.DeepEqual(stripped, tt.expectedStripped) {
+				t.Fatalf("expected stripped headers %v, got %v", tt.expectedStripped, stripped)
+			}
+		})
+	}
+}
+
+func TestInvalidHopByHopHeaders(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.HopByHopHeaders = "drop"
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error for unknown hopByHopHeaders mode")
+	}
+}
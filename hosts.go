@@ -0,0 +1,158 @@
+package headerblock
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// HostConfig is the policy of one host in a multi-tenant configuration. Its
+// rules are added to the rules shared by every host, and its allowedIPs to
+// the shared allowedIPs.
+type HostConfig struct {
+	RequestHeaders           []HeaderConfig `json:"requestHeaders,omitempty"`
+	WhitelistRequestHeaders  []HeaderConfig `json:"whitelistRequestHeaders,omitempty"`
+	RequiredHeaders          []HeaderConfig `json:"requiredHeaders,omitempty"`
+	RequestCookies           []HeaderConfig `json:"requestCookies,omitempty"`
+	RequestURIRules          []HeaderConfig `json:"requestURIRules,omitempty"`
+	ResponseHeaders          []HeaderConfig `json:"responseHeaders,omitempty"`
+	WhitelistResponseHeaders []HeaderConfig `json:"whitelistResponseHeaders,omitempty"`
+	BodyRules                []HeaderConfig `json:"bodyRules,omitempty"`
+	AllowedIPs               []string       `json:"allowedIPs,omitempty"`
+}
+
+// hostPolicy is a compiled HostConfig.
+type hostPolicy struct {
+	// rules are the rules of the host alone.
+	rules         *ruleSet
+	allowedIPNets ipList
+	// active is the shared rule set merged with rules, a *ruleSet swapped
+	// whenever the shared rules are reloaded.
+	active atomic.Value
+}
+
+// hostPolicies selects the policy of a request by its host, exactly or by a
+// "*.example.com" wildcard matching any subdomain.
+type hostPolicies struct {
+	exact    map[string]*hostPolicy
+	wildcard map[string]*hostPolicy
+}
+
+func newHostPolicies(config *Config, severities severityActions) (*hostPolicies, error) {
+	if len(config.Hosts) == 0 {
+		return nil, nil
+	}
+
+	policies := &hostPolicies{
+		exact:    make(map[string]*hostPolicy),
+		wildcard: make(map[string]*hostPolicy),
+	}
+	for name, hostConfig := range config.Hosts {
+		host := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+		suffix, isWildcard := strings.CutPrefix(host, "*")
+		if host == "" || strings.ContainsAny(suffix, "*/:@ ") || (isWildcard && !strings.HasPrefix(suffix, ".")) {
+			return nil, fmt.Errorf("hosts: invalid host %q", name)
+		}
+
+		rules, err := compileRuleSet(ruleSections{
+			RequestHeaders:           hostConfig.RequestHeaders,
+			WhitelistRequestHeaders:  hostConfig.WhitelistRequestHeaders,
+			RequiredHeaders:          hostConfig.RequiredHeaders,
+			RequestCookies:           hostConfig.RequestCookies,
+			RequestURIRules:          hostConfig.RequestURIRules,
+			ResponseHeaders:          hostConfig.ResponseHeaders,
+			WhitelistResponseHeaders: hostConfig.WhitelistResponseHeaders,
+			BodyRules:                hostConfig.BodyRules,
+		}, "hosts["+host+"].", config.Log, severities)
+		if err != nil {
+			return nil, err
+		}
+		policy := &hostPolicy{
+			rules:         rules,
+			allowedIPNets: parseIPNets(hostConfig.AllowedIPs, "hosts["+host+"].allowedIPs", config.Log),
+		}
+
+		if isWildcard {
+			policies.wildcard[suffix] = policy
+		} else {
+			policies.exact[host] = policy
+		}
+	}
+	return policies, nil
+}
+
+// lookup returns the policy of the request host, nil when none is
+// configured. An exact host wins over wildcards, and longer wildcards over
+// shorter ones.
+func (p *hostPolicies) lookup(req *http.Request) *hostPolicy {
+	if p == nil {
+		return nil
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(requestHost(req)), ".")
+	if policy, ok := p.exact[host]; ok {
+		return policy
+	}
+	for i := strings.IndexByte(host, '.'); i >= 0; {
+		if policy, ok := p.wildcard[host[i:]]; ok {
+			return policy
+		}
+		next := strings.IndexByte(host[i+1:], '.')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return nil
+}
+
+// activate merges the shared rules with the rules of every host.
+func (p *hostPolicies) activate(shared *ruleSet) {
+	if p == nil {
+		return
+	}
+	for _, policies := range []map[string]*hostPolicy{p.exact, p.wildcard} {
+		for _, policy := range policies {
+			policy.active.Store(shared.merge(policy.rules))
+		}
+	}
+}
+
+// all returns the rules of every host.
+func (p *hostPolicies) all() []rule {
+	if p == nil {
+		return nil
+	}
+	var rules []rule
+	for _, policies := range []map[string]*hostPolicy{p.exact, p.wildcard} {
+		for _, policy := range policies {
+			rules = append(rules, policy.rules.all()...)
+		}
+	}
+	return rules
+}
+
+// count returns the number of active and disabled rules of every host.
+func (p *hostPolicies) count() (active, disabled int) {
+	if p == nil {
+		return 0, 0
+	}
+	for _, policies := range []map[string]*hostPolicy{p.exact, p.wildcard} {
+		for _, policy := range policies {
+			hostActive, hostDisabled := policy.rules.count()
+			active += hostActive
+			disabled += hostDisabled
+		}
+	}
+	return active, disabled
+}
+
+// allowedIP reports whether the client IP is in the shared allowedIPs or in
+// those of the request host.
+func (c *headerBlock) allowedIP(ev *evaluation) bool {
+	if isIPAllowed(ev.ip(), c.allowedIPNets) || c.ipLists.allowedIP(ev.ip()) {
+		return true
+	}
+	return ev.host != nil && isIPAllowed(ev.ip(), ev.host.allowedIPNets)
+}
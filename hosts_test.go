@@ -0,0 +1,95 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestHosts(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Scanner"}}
+	cfg.Hosts = map[string]tbua.HostConfig{
+		"api.example.com": {
+			RequestHeaders: []tbua.HeaderConfig{{Name: "X-Debug"}},
+			AllowedIPs:     []string{"192.0.2.10"},
+		},
+		"*.example.com": {
+			RequestHeaders: []tbua.HeaderConfig{{Name: "X-Legacy"}},
+		},
+		"*.eu.example.com": {
+			RequiredHeaders: []tbua.HeaderConfig{{Name: "X-Tenant"}},
+		},
+	}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		host           string
+		remoteAddr     string
+		header         string
+		noTenant       bool
+		expectedStatus int
+	}{
+		{name: "shared rule on any host", host: "other.org", header: "X-Scanner", expectedStatus: http.StatusForbidden},
+		{name: "host rule on other host", host: "other.org", header: "X-Debug", expectedStatus: http.StatusTeapot},
+		{name: "exact host rule", host: "API.example.com:8443", header: "X-Debug", expectedStatus: http.StatusForbidden},
+		{name: "shared rule on host", host: "api.example.com", header: "X-Scanner", expectedStatus: http.StatusForbidden},
+		{name: "exact host wins over wildcard", host: "api.example.com", header: "X-Legacy", expectedStatus: http.StatusTeapot},
+		{name: "wildcard host rule", host: "shop.example.com", header: "X-Legacy", expectedStatus: http.StatusForbidden},
+		{name: "wildcard excludes apex", host: "example.com", header: "X-Legacy", expectedStatus: http.StatusTeapot},
+		{name: "longest wildcard wins", host: "shop.eu.example.com", header: "X-Legacy", expectedStatus: http.StatusTeapot},
+		{name: "longest wildcard rule", host: "shop.eu.example.com", header: "X-Legacy", noTenant: true, expectedStatus: http.StatusForbidden},
+		{name: "host allowed ip", host: "api.example.com", remoteAddr: "192.0.2.10:1234", header: "X-Debug", expectedStatus: http.StatusTeapot},
+		{name: "host allowed ip on other host", host: "shop.example.com", remoteAddr: "192.0.2.10:1234", header: "X-Legacy", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = tt.host
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			if !tt.noTenant {
+				req.Header.Set("X-Tenant", "acme")
+			}
+			req.Header.Set(tt.header, "1")
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidHosts(t *testing.T) {
+	tests := []struct {
+		name  string
+		hosts map[string]tbua.HostConfig
+	}{
+		{name: "bare wildcard", hosts: map[string]tbua.HostConfig{"*": {}}},
+		{name: "url", hosts: map[string]tbua.HostConfig{"https://example.com/": {}}},
+		{name: "invalid rule", hosts: map[string]tbua.HostConfig{"example.com": {RequestHeaders: []tbua.HeaderConfig{{Name: "("}}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.Hosts = tt.hosts
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected error for invalid hosts")
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package headerblock
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// loadIncludeFiles compiles the rule files matched by the includeFiles glob
+// patterns, in the same JSON format as rulesFile, into one rule set added to
+// the inline rules at startup. Files are merged in pattern order and, within
+// a pattern, in name order.
+func loadIncludeFiles(patterns []string, logEnabled bool, severities severityActions) (*ruleSet, error) {
+	var included *ruleSet
+	for i, pattern := range patterns {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("includeFiles[%d]: %w", i, err)
+		}
+		if len(paths) == 0 && logEnabled {
+			log.Printf("headerblock: includeFiles[%d]: no files match %s", i, pattern)
+		}
+
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("includeFiles[%d]: %w", i, err)
+			}
+			rules, err := decodeRuleSet(data, "includeFiles["+path+"].", logEnabled, severities)
+			if err != nil {
+				return nil, fmt.Errorf("includeFiles[%d] %s: %w", i, path, err)
+			}
+			if included == nil {
+				included = rules
+			} else {
+				included = included.merge(rules)
+			}
+		}
+	}
+	return included, nil
+}
@@ -0,0 +1,60 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestIncludeFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"team-a.json": `{"requestHeaders": [{"name": "X-Team-A"}]}`,
+		"team-b.json": `{"requestHeaders": [{"name": "X-Team-B"}], "responseHeaders": [{"name": "X-Debug"}]}`,
+		"notes.txt":   `not a rules file`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("write include file: %v", err)
+		}
+	}
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Inline"}}
+	cfg.IncludeFiles = []string{filepath.Join(dir, "*.json"), filepath.Join(dir, "missing", "*.json")}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for header, expected := range map[string]int{
+		"X-Inline": http.StatusForbidden,
+		"X-Team-A": http.StatusForbidden,
+		"X-Team-B": http.StatusForbidden,
+		"X-Other":  http.StatusTeapot,
+	} {
+		if code := statusFor(p, header); code != expected {
+			t.Errorf("%s: expected %d, got %d", header, expected, code)
+		}
+	}
+}
+
+func TestInvalidIncludeFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{"requestHeaders": [{"name": "X-(Broken"}]}`), 0o600); err != nil {
+		t.Fatalf("write include file: %v", err)
+	}
+
+	for _, pattern := range []string{filepath.Join(dir, "*.json"), "["} {
+		cfg := tbua.CreateConfig()
+		cfg.IncludeFiles = []string{pattern}
+
+		if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+			t.Errorf("expected error for includeFiles %q", pattern)
+		}
+	}
+}
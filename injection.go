@@ -0,0 +1,81 @@
+package headerblock
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxInjectionDecodes bounds how often a value is percent-decoded, so
+// double-encoded sequences such as %250d%250a are found too.
+const maxInjectionDecodes = 3
+
+// hasLineBreak reports whether value holds a CR or LF, raw or after
+// percent-decoding it up to maxInjectionDecodes times.
+func hasLineBreak(value string) bool {
+	for i := 0; ; i++ {
+		if strings.ContainsAny(value, "\r\n") {
+			return true
+		}
+		if i == maxInjectionDecodes || !strings.Contains(value, "%") {
+			return false
+		}
+		decoded, err := url.PathUnescape(value)
+		if err != nil || decoded == value {
+			return false
+		}
+		value = decoded
+	}
+}
+
+// headerInjection returns where req carries a line break that a backend
+// copying the value into a response header or a log line would turn into a
+// new header or line: "header" or "query" and the header or parameter name.
+func headerInjection(req *http.Request) (string, string, bool) {
+	for name, values := range req.Header {
+		for _, value := range values {
+			if hasLineBreak(value) {
+				return "header", name, true
+			}
+		}
+	}
+	for _, param := range strings.Split(req.URL.RawQuery, "&") {
+		name, value, _ := strings.Cut(param, "=")
+		if hasLineBreak(value) || hasLineBreak(name) {
+			if decoded, err := url.QueryUnescape(name); err == nil {
+				name = decoded
+			}
+			return "query", name, true
+		}
+	}
+	return "", "", false
+}
+
+// checkHeaderInjection denies requests with CRLF sequences in header or
+// query values when detectHeaderInjection is enabled and reports whether it
+// did.
+func (c *headerBlock) checkHeaderInjection(ev *evaluation) bool {
+	if !c.headerInjection {
+		return false
+	}
+	source, name, found := headerInjection(ev.req)
+	if !found {
+		return false
+	}
+
+	entry := logEntry{
+		Decision: decisionHeaderInjection,
+		Rule:     "detectHeaderInjection",
+		Header:   name,
+	}
+	if ip := ev.ip(); ip != nil {
+		entry.ClientIP = ip.String()
+	}
+	if c.log {
+		c.logDecision(ev.req, entry, "access denied - line break in %s %q from IP %s", source, name, entry.ClientIP)
+	}
+	c.metrics.incHeaderInjection()
+	c.recordBlock(ev.req, entry)
+	c.deny(ev.rw, ev.req, http.StatusBadRequest, entry)
+	return true
+}
@@ -0,0 +1,68 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestDetectHeaderInjection(t *testing.T) {
+	tests := []struct {
+		name           string
+		detect         bool
+		query          string
+		header         string
+		expectedStatus int
+	}{
+		{name: "clean request", detect: true, query: "next=/home", header: "text", expectedStatus: http.StatusTeapot},
+		{name: "raw CRLF in header", detect: true, header: "a\r\nSet-Cookie: x=1", expectedStatus: http.StatusBadRequest},
+		{name: "encoded CRLF in header", detect: true, header: "a%0d%0aSet-Cookie:%20x=1", expectedStatus: http.StatusBadRequest},
+		{name: "uppercase encoding", detect: true, header: "a%0D%0A", expectedStatus: http.StatusBadRequest},
+		{name: "double encoded", detect: true, header: "a%250d%250a", expectedStatus: http.StatusBadRequest},
+		{name: "encoded LF in query", detect: true, query: "next=/home%0aLocation:%20http://evil", expectedStatus: http.StatusBadRequest},
+		{name: "encoded CR in query name", detect: true, query: "a%0d=1", expectedStatus: http.StatusBadRequest},
+		{name: "other percent escapes", detect: true, query: "q=100%25%20off", header: "caf%C3%A9", expectedStatus: http.StatusTeapot},
+		{name: "detection disabled", query: "next=%0d%0a", header: "a%0d%0a", expectedStatus: http.StatusTeapot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.DetectHeaderInjection = tt.detect
+			cfg.AllowedIPs = []string{"10.0.0.0/8"}
+			cfg.MetricsPath = "/_headerblock/metrics"
+			p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.URL.RawQuery = tt.query
+			if tt.header != "" {
+				req.Header.Set("X-Data", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+
+			scrape := httptest.NewRequest(http.MethodGet, cfg.MetricsPath, nil)
+			scrape.RemoteAddr = "10.0.0.1:1234"
+			metrics := httptest.NewRecorder()
+			p.ServeHTTP(metrics, scrape)
+			expected := `headerblock_header_injection_total{middleware="headerBlock"} 0`
+			if tt.expectedStatus == http.StatusBadRequest {
+				expected = `headerblock_header_injection_total{middleware="headerBlock"} 1`
+			}
+			if !strings.Contains(metrics.Body.String(), expected) {
+				t.Fatalf("expected %q in metrics, got:\n%s", expected, metrics.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package headerblock
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ipList is a list of networks with exclusions: an address is in the list
+// when one of nets contains it and none of excluded does, so
+// "10.0.0.0/8" with "!10.5.0.0/16" covers 10.0.0.0/8 except 10.5.0.0/16.
+type ipList struct {
+	nets     *ipTrie
+	excluded *ipTrie
+}
+
+func newIPList() ipList {
+	return ipList{nets: &ipTrie{}, excluded: &ipTrie{}}
+}
+
+// empty reports whether the list covers no address.
+func (l ipList) empty() bool {
+	return l.nets == nil || len(l.nets.entries) == 0
+}
+
+// size returns the number of networks and exclusions of the list.
+func (l ipList) size() int {
+	if l.nets == nil {
+		return 0
+	}
+	return len(l.nets.entries) + len(l.excluded.entries)
+}
+
+func parseIPNets(raw []string, field string, logEnabled bool) ipList {
+	ipNets := newIPList()
+
+	for _, entry := range raw {
+		// Split by comma to support "1.1.1.1/32, 2.2.2.2/32"
+		parts := strings.Split(entry, ",")
+
+		for _, part := range parts {
+			ip := strings.TrimSpace(part)
+			if ip == "" {
+				continue
+			}
+			// "!" excludes a network from the others
+			target := ipNets.nets
+			if excluded, ok := strings.CutPrefix(ip, "!"); ok {
+				ip = strings.TrimSpace(excluded)
+				target = ipNets.excluded
+			}
+
+			// Try CIDR first
+			if _, netCIDR, err := net.ParseCIDR(ip); err == nil {
+				target.insert(netCIDR)
+				continue
+			}
+
+			// Try single IP
+			parsedIP := net.ParseIP(ip)
+			if parsedIP != nil {
+				bits := 128
+				if parsedIP.To4() != nil {
+					bits = 32
+				}
+				target.insert(&net.IPNet{
+					IP:   parsedIP,
+					Mask: net.CIDRMask(bits, bits),
+				})
+				continue
+			}
+
+			// Fault-tolerant: log and skip
+			if logEnabled {
+				log.Printf("headerblock: invalid %s entry skipped: %q", field, ip)
+			}
+		}
+	}
+
+	return ipNets
+}
+
+// remoteAddrSource is the clientIPStrategy entry for the connection address.
+const remoteAddrSource = "RemoteAddr"
+
+// defaultClientIPStrategy trusts the first X-Forwarded-For entry set by
+// Traefik and falls back to the connection address.
+var defaultClientIPStrategy = []string{"X-Forwarded-For", remoteAddrSource}
+
+// clientIPResolver finds the client IP in the first source of its strategy
+// that holds a valid address.
+type clientIPResolver struct {
+	sources []string // canonical header names or remoteAddrSource
+	// trustedProxies and depth select the client in a chain of forwarding
+	// proxies, see fromChain.
+	trustedProxies ipList
+	depth          int
+	// lists holds the downloaded trusted proxies of providerRanges.
+	lists *ipListSources
+	// cdn takes precedence over sources on connections from its edge
+	// servers.
+	cdn *cdnClientIP
+}
+
+func newClientIPResolver(config *Config, lists *ipListSources) (*clientIPResolver, error) {
+	strategy := config.ClientIPStrategy
+	if config.IPFromRemoteAddrOnly {
+		if len(strategy) > 0 || config.ClientIPHeader != "" {
+			return nil, fmt.Errorf("ipFromRemoteAddrOnly cannot be combined with clientIPStrategy or clientIPHeader")
+		}
+		strategy = []string{remoteAddrSource}
+	}
+	if config.ClientIPHeader != "" {
+		if len(strategy) > 0 {
+			return nil, fmt.Errorf("clientIPHeader and clientIPStrategy are mutually exclusive")
+		}
+		strategy = []string{config.ClientIPHeader, remoteAddrSource}
+	}
+	if len(strategy) == 0 {
+		strategy = defaultClientIPStrategy
+	}
+
+	if config.ProxyDepth < 0 {
+		return nil, fmt.Errorf("proxyDepth: must not be negative, got %d", config.ProxyDepth)
+	}
+	if config.ProxyDepth > 0 && (len(config.TrustedProxies) > 0 || lists.hasTrusted()) {
+		return nil, fmt.Errorf("proxyDepth and trustedProxies are mutually exclusive")
+	}
+	if config.ProxyDepth > 0 && config.SanitizeForwardingHeaders {
+		return nil, fmt.Errorf("sanitizeForwardingHeaders: requires trustedProxies instead of proxyDepth")
+	}
+
+	resolver := &clientIPResolver{
+		trustedProxies: parseIPNets(config.TrustedProxies, "trustedProxies", config.Log),
+		depth:          config.ProxyDepth,
+		lists:          lists,
+	}
+	var err error
+	if resolver.cdn, err = newCDNClientIP(config); err != nil {
+		return nil, err
+	}
+	for i, raw := range strategy {
+		source := strings.TrimSpace(raw)
+		switch {
+		case source == "":
+			return nil, fmt.Errorf("clientIPStrategy[%d]: empty source", i)
+		case strings.EqualFold(source, remoteAddrSource):
+			source = remoteAddrSource
+		case strings.EqualFold(source, "XFF"):
+			source = "X-Forwarded-For"
+		default:
+			source = http.CanonicalHeaderKey(source)
+		}
+		resolver.sources = append(resolver.sources, source)
+	}
+
+	return resolver, nil
+}
+
+func (r *clientIPResolver) resolve(req *http.Request) net.IP {
+	// The connection address is only parsed when needed, so the common
+	// case of a client IP from X-Forwarded-For parses a single address.
+	var (
+		remoteIP     net.IP
+		remoteParsed bool
+	)
+
+	if r.cdn != nil {
+		remoteIP, remoteParsed = remoteAddrIP(req), true
+		if ip := r.cdn.clientIP(req, remoteIP); ip != nil {
+			return ip
+		}
+	}
+
+	// Forwarding headers are only honoured from a trusted proxy.
+	trustHeaders := !r.hasTrustedProxies()
+	if !trustHeaders {
+		if !remoteParsed {
+			remoteIP, remoteParsed = remoteAddrIP(req), true
+		}
+		trustHeaders = r.trustedProxy(remoteIP)
+	}
+
+	for _, source := range r.sources {
+		if source == remoteAddrSource {
+			if !remoteParsed {
+				remoteIP, remoteParsed = remoteAddrIP(req), true
+			}
+			if remoteIP != nil {
+				return remoteIP
+			}
+			continue
+		}
+
+		if !trustHeaders {
+			continue
+		}
+		values := req.Header.Values(source)
+		if len(values) == 0 {
+			continue
+		}
+		var ip net.IP
+		switch {
+		case source == forwardedHeader:
+			ip = r.fromChain(forwardedChain(values))
+		case r.depth == 0 && !r.hasTrustedProxies():
+			// The leftmost entry needs no split of the chain.
+			first, _, _ := strings.Cut(values[0], ",")
+			ip = net.ParseIP(strings.TrimSpace(first))
+		default:
+			ip = r.fromChain(strings.Split(strings.Join(values, ","), ","))
+		}
+		if ip != nil {
+			return ip
+		}
+	}
+
+	return nil
+}
+
+// fromChain picks the client from a forwarding chain such as
+// X-Forwarded-For or the for= nodes of Forwarded, where every proxy appends the address it received the
+// request from:
+//   - with proxyDepth the entry proxyDepth positions from the right,
+//   - with trustedProxies the rightmost entry that is not a trusted proxy,
+//   - otherwise the leftmost entry.
+func (r *clientIPResolver) fromChain(chain []string) net.IP {
+	switch {
+	case r.depth > 0:
+		if r.depth > len(chain) {
+			return nil
+		}
+		return net.ParseIP(strings.TrimSpace(chain[len(chain)-r.depth]))
+
+	case r.hasTrustedProxies():
+		var ip net.IP
+		for i := len(chain) - 1; i >= 0; i-- {
+			ip = net.ParseIP(strings.TrimSpace(chain[i]))
+			if ip == nil {
+				return nil
+			}
+			if !r.trustedProxy(ip) {
+				return ip
+			}
+		}
+		// Every hop is trusted, the leftmost one is the client.
+		return ip
+
+	default:
+		return net.ParseIP(strings.TrimSpace(chain[0]))
+	}
+}
+
+// hasTrustedProxies reports whether trustedProxies or downloaded provider
+// ranges describe the forwarding proxies.
+func (r *clientIPResolver) hasTrustedProxies() bool {
+	return !r.trustedProxies.empty() || r.lists.hasTrusted()
+}
+
+// trustedProxy reports whether ip is one of the forwarding proxies.
+func (r *clientIPResolver) trustedProxy(ip net.IP) bool {
+	return isIPAllowed(ip, r.trustedProxies) || r.lists.trustedIP(ip)
+}
+
+// remoteAddrIP returns the connection address (already ProxyProtocol-processed
+// by Traefik).
+func remoteAddrIP(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return net.ParseIP(req.RemoteAddr)
+	}
+
+	return net.ParseIP(host)
+}
+
+// isIPAllowed reports whether ip is in the list. Exclusions are checked
+// first.
+func isIPAllowed(ip net.IP, list ipList) bool {
+	if ip == nil || list.empty() {
+		return false
+	}
+	return !list.excluded.contains(ip) && list.nets.contains(ip)
+}
@@ -0,0 +1,212 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestClientIPStrategy(t *testing.T) {
+	const blocked = "203.0.113.7"
+
+	tests := []struct {
+		name           string
+		strategy       []string
+		header         string
+		remoteOnly     bool
+		trustedProxies []string
+		proxyDepth     int
+		remoteAddr     string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{
+			name:           "DefaultUsesXFF",
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"X-Forwarded-For": blocked + ", 10.0.0.2"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "DefaultFallsBackToRemoteAddr",
+			remoteAddr:     blocked + ":1234",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "CloudflareFirst",
+			strategy:       []string{"CF-Connecting-IP", "XFF", "RemoteAddr"},
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"Cf-Connecting-Ip": blocked, "X-Forwarded-For": "192.0.2.1"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "InvalidHeaderSkipped",
+			strategy:       []string{"X-Real-IP", "RemoteAddr"},
+			remoteAddr:     blocked + ":1234",
+			headers:        map[string]string{"X-Real-Ip": "unknown"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "RemoteAddrOnlyIgnoresXFF",
+			strategy:       []string{"RemoteAddr"},
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"X-Forwarded-For": blocked},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "IPFromRemoteAddrOnly",
+			remoteOnly:     true,
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"X-Forwarded-For": blocked, "X-Real-Ip": blocked},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "ClientIPHeader",
+			header:         "X-Real-IP",
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"X-Real-IP": blocked, "X-Forwarded-For": "192.0.2.1"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "TrustedProxiesSkipSpoofedEntry",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"X-Forwarded-For": "192.0.2.1, " + blocked + ", 10.0.0.2"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "TrustedProxiesIgnoreSpoofedLeftmost",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"X-Forwarded-For": blocked + ", 192.0.2.1"},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "UntrustedPeerHeadersIgnored",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "192.0.2.9:1234",
+			headers:        map[string]string{"X-Forwarded-For": blocked},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "ProxyDepth",
+			proxyDepth:     2,
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"X-Forwarded-For": "192.0.2.1, " + blocked + ", 10.0.0.2"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "ProxyDepthBeyondChainFallsBack",
+			proxyDepth:     3,
+			remoteAddr:     blocked + ":1234",
+			headers:        map[string]string{"X-Forwarded-For": "192.0.2.1"},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.BlockedIPs = []string{blocked}
+			cfg.ClientIPStrategy = tt.strategy
+			cfg.ClientIPHeader = tt.header
+			cfg.IPFromRemoteAddrOnly = tt.remoteOnly
+			cfg.TrustedProxies = tt.trustedProxies
+			cfg.ProxyDepth = tt.proxyDepth
+			p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestClientIPHeaderExcludesStrategy(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.ClientIPHeader = "X-Real-IP"
+	cfg.ClientIPStrategy = []string{"RemoteAddr"}
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error when clientIPHeader and clientIPStrategy are both set")
+	}
+}
+
+func TestProxyDepthExcludesTrustedProxies(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.ProxyDepth = 1
+	cfg.TrustedProxies = []string{"10.0.0.0/8"}
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error when proxyDepth and trustedProxies are both set")
+	}
+}
+
+func TestIPFromRemoteAddrOnlyExcludesStrategy(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.IPFromRemoteAddrOnly = true
+	cfg.ClientIPHeader = "X-Real-IP"
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error when ipFromRemoteAddrOnly and clientIPHeader are both set")
+	}
+}
+
+func TestIPExclusions(t *testing.T) {
+	tests := []struct {
+		name           string
+		allowedIPs     []string
+		excludedIPs    []string
+		blockedIPs     []string
+		remoteAddr     string
+		expectedStatus int
+	}{
+		{name: "allowed range", allowedIPs: []string{"10.0.0.0/8", "!10.5.0.0/16"}, remoteAddr: "10.1.2.3:1234", expectedStatus: http.StatusTeapot},
+		{name: "negated entry", allowedIPs: []string{"10.0.0.0/8", "!10.5.0.0/16"}, remoteAddr: "10.5.2.3:1234", expectedStatus: http.StatusForbidden},
+		{name: "exclusion listed first", allowedIPs: []string{"!10.5.0.0/16, 10.0.0.0/8"}, remoteAddr: "10.5.2.3:1234", expectedStatus: http.StatusForbidden},
+		{name: "excludedIPs", allowedIPs: []string{"10.0.0.0/8"}, excludedIPs: []string{"10.5.0.0/16"}, remoteAddr: "10.5.2.3:1234", expectedStatus: http.StatusForbidden},
+		{name: "excluded single address", allowedIPs: []string{"10.0.0.0/8", "!10.1.2.3"}, remoteAddr: "10.1.2.3:1234", expectedStatus: http.StatusForbidden},
+		{name: "blockedIPs exclusion", blockedIPs: []string{"192.0.2.0/24", "!192.0.2.8"}, remoteAddr: "192.0.2.8:1234", expectedStatus: http.StatusForbidden},
+		{name: "blockedIPs range", blockedIPs: []string{"192.0.2.0/24", "!192.0.2.8"}, remoteAddr: "192.0.2.9:1234", expectedStatus: http.StatusUnavailableForLegalReasons},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Debug"}}
+			cfg.AllowedIPs = tt.allowedIPs
+			cfg.ExcludedIPs = tt.excludedIPs
+			cfg.BlockedIPs = tt.blockedIPs
+			cfg.BlockedIPsStatusCode = http.StatusUnavailableForLegalReasons
+
+			p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Debug", "1")
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
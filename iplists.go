@@ -0,0 +1,357 @@
+package headerblock
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultIPListsInterval = 5 * time.Minute
+	// maxIPListSize bounds the size of a downloaded IP list.
+	maxIPListSize = 10 << 20
+)
+
+// ipListSource is an IP list kept in a file or behind a URL, one network per
+// line. The last good version stays active when a refresh fails.
+type ipListSource struct {
+	field    string
+	location string
+	remote   bool
+	modTime  time.Time
+	etag     string
+	// parse extracts the networks of a provider feed, nil for lists with
+	// one network per line.
+	parse func(data []byte) ([]string, error)
+	// cache keeps the last download of a provider feed on disk.
+	cache string
+	// list is the current ipList.
+	list atomic.Value
+}
+
+// ipListSources are the external allowed, blocked and trusted proxy IP
+// lists. Files and URLs are refreshed every interval, provider feeds every
+// feedInterval.
+type ipListSources struct {
+	allowed      []*ipListSource
+	blocked      []*ipListSource
+	trusted      []*ipListSource
+	interval     time.Duration
+	feedInterval time.Duration
+	client       *http.Client
+	log          bool
+}
+
+// newIPListSources loads the configured IP list files. URLs are only fetched
+// once run starts, so a slow server does not delay Traefik.
+func newIPListSources(config *Config) (*ipListSources, error) {
+	sources := &ipListSources{
+		interval: defaultIPListsInterval,
+		client:   &http.Client{Timeout: rulesURLTimeout},
+		log:      config.Log,
+	}
+	for _, source := range []struct {
+		field, location string
+		remote, blocked bool
+	}{
+		{field: "allowedIPsFile", location: config.AllowedIPsFile},
+		{field: "allowedIPsURL", location: config.AllowedIPsURL, remote: true},
+		{field: "blockedIPsFile", location: config.BlockedIPsFile, blocked: true},
+		{field: "blockedIPsURL", location: config.BlockedIPsURL, remote: true, blocked: true},
+	} {
+		if source.location == "" {
+			continue
+		}
+		list := &ipListSource{field: source.field, location: source.location, remote: source.remote}
+		list.list.Store(newIPList())
+		if source.blocked {
+			sources.blocked = append(sources.blocked, list)
+		} else {
+			sources.allowed = append(sources.allowed, list)
+		}
+	}
+
+	if len(sources.allowed) == 0 && len(sources.blocked) == 0 && config.IPListsInterval != "" {
+		return nil, fmt.Errorf("ipListsInterval: requires an IP list file or URL")
+	}
+	if err := newProviderRangeSources(config, sources); err != nil {
+		return nil, err
+	}
+	if len(sources.all()) == 0 {
+		return nil, nil
+	}
+	if config.IPListsInterval != "" {
+		interval, err := time.ParseDuration(config.IPListsInterval)
+		if err != nil {
+			return nil, fmt.Errorf("ipListsInterval: %w", err)
+		}
+		sources.interval = interval
+	}
+
+	for _, source := range sources.all() {
+		if source.remote {
+			sources.loadCache(source)
+			continue
+		}
+		if err := sources.load(context.Background(), source); err != nil {
+			return nil, err
+		}
+	}
+	return sources, nil
+}
+
+func (s *ipListSources) all() []*ipListSource {
+	all := append(append([]*ipListSource(nil), s.allowed...), s.blocked...)
+	return append(all, s.trusted...)
+}
+
+// load reads or downloads one list when it changed and swaps it in. The
+// ETag and the cache only record downloads that parsed.
+func (s *ipListSources) load(ctx context.Context, source *ipListSource) error {
+	var (
+		data    []byte
+		etag    string
+		modTime time.Time
+	)
+	if source.remote {
+		var err error
+		if data, etag, err = s.download(ctx, source); err != nil || data == nil {
+			return err
+		}
+	} else {
+		info, err := os.Stat(source.location)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source.field, err)
+		}
+		if !info.ModTime().After(source.modTime) {
+			return nil
+		}
+		if data, err = os.ReadFile(source.location); err != nil {
+			return fmt.Errorf("%s: %w", source.field, err)
+		}
+		modTime = info.ModTime()
+	}
+
+	list, err := s.parse(source, data)
+	if err != nil {
+		return err
+	}
+	source.list.Store(list)
+	source.etag, source.modTime = etag, modTime
+	if s.log {
+		log.Printf("headerblock: loaded %d networks from %s", list.size(), source.location)
+	}
+	if source.remote && source.cache != "" {
+		if err := writeFileAtomic(source.cache, data); err != nil {
+			log.Printf("headerblock: failed to cache %s: %v", source.field, err)
+		}
+	}
+	return nil
+}
+
+// parse parses a list or provider feed. A download or feed without any
+// valid network is an error, so an empty or unexpected response does not
+// empty the list. A local file may be emptied on purpose.
+func (s *ipListSources) parse(source *ipListSource, data []byte) (ipList, error) {
+	var list ipList
+	if source.parse == nil {
+		list = parseIPList(data, source.field, s.log)
+		if !source.remote {
+			return list, nil
+		}
+	} else {
+		entries, err := source.parse(data)
+		if err != nil {
+			return ipList{}, fmt.Errorf("%s %s: %w", source.field, source.location, err)
+		}
+		list = parseIPNets(entries, source.field, s.log)
+	}
+	if list.empty() {
+		return ipList{}, fmt.Errorf("%s %s: no networks", source.field, source.location)
+	}
+	return list, nil
+}
+
+// loadCache starts a provider feed from its last download, if any, until
+// the first refresh.
+func (s *ipListSources) loadCache(source *ipListSource) {
+	if source.cache == "" {
+		return
+	}
+	data, err := os.ReadFile(source.cache)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("headerblock: ignoring cache of %s: %v", source.field, err)
+		}
+		return
+	}
+	list, err := s.parse(source, data)
+	if err != nil {
+		log.Printf("headerblock: ignoring cache of %s: %v", source.field, err)
+		return
+	}
+	source.list.Store(list)
+}
+
+// writeFileAtomic replaces path with data through a temporary file, so
+// readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// download fetches a remote list and its ETag. It returns nil data when the
+// list did not change since the last download.
+func (s *ipListSources) download(ctx context.Context, source *ipListSource) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.location, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", source.field, err)
+	}
+	if source.etag != "" {
+		req.Header.Set("If-None-Match", source.etag)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", source.field, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("%s %s: unexpected status %d", source.field, source.location, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxIPListSize))
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", source.field, err)
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+// parseIPList parses a list with one network or address per line. Blank
+// lines and "#" comments are ignored, and "!" entries are exclusions.
+func parseIPList(data []byte, field string, logEnabled bool) ipList {
+	var entries []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			entries = append(entries, line)
+		}
+	}
+	return parseIPNets(entries, field, logEnabled)
+}
+
+// run fetches the remote lists right away and then reloads the lists every
+// interval and the provider feeds every feedInterval until ctx is done.
+func (s *ipListSources) run(ctx context.Context) {
+	var lists, feeds bool
+	for _, source := range s.all() {
+		if source.parse != nil {
+			feeds = true
+		} else {
+			lists = true
+		}
+		if !source.remote {
+			continue
+		}
+		if err := s.load(ctx, source); err != nil {
+			log.Printf("headerblock: failed to fetch IP list: %v", err)
+		}
+	}
+
+	// A nil channel never fires, which disables the refresh.
+	var listTicks, feedTicks <-chan time.Time
+	if lists && s.interval > 0 {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		listTicks = ticker.C
+	}
+	if feeds && s.feedInterval > 0 {
+		ticker := time.NewTicker(s.feedInterval)
+		defer ticker.Stop()
+		feedTicks = ticker.C
+	}
+	if listTicks == nil && feedTicks == nil {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-listTicks:
+			s.refresh(ctx, false)
+		case <-feedTicks:
+			s.refresh(ctx, true)
+		}
+	}
+}
+
+// refresh reloads the provider feeds or the other lists.
+func (s *ipListSources) refresh(ctx context.Context, feeds bool) {
+	for _, source := range s.all() {
+		if (source.parse != nil) != feeds {
+			continue
+		}
+		if err := s.load(ctx, source); err != nil {
+			log.Printf("headerblock: keeping previous IP list, refresh failed: %v", err)
+		}
+	}
+}
+
+// allowedIP reports whether ip is in an allowed IP list. A nil receiver has
+// no lists.
+func (s *ipListSources) allowedIP(ip net.IP) bool {
+	return s != nil && inIPLists(ip, s.allowed)
+}
+
+// blockedIP reports whether ip is in a blocked IP list.
+func (s *ipListSources) blockedIP(ip net.IP) bool {
+	return s != nil && inIPLists(ip, s.blocked)
+}
+
+// hasTrusted reports whether trusted proxies are downloaded, even when the
+// first download is still pending.
+func (s *ipListSources) hasTrusted() bool {
+	return s != nil && len(s.trusted) > 0
+}
+
+// trustedIP reports whether ip is in a downloaded trusted proxy list.
+func (s *ipListSources) trustedIP(ip net.IP) bool {
+	return s != nil && inIPLists(ip, s.trusted)
+}
+
+func inIPLists(ip net.IP, sources []*ipListSource) bool {
+	for _, source := range sources {
+		if isIPAllowed(ip, source.list.Load().(ipList)) {
+			return true
+		}
+	}
+	return false
+}
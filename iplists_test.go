@@ -0,0 +1,191 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func statusFrom(p http.Handler, remoteAddr string) int {
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("X-Debug", "1")
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+func waitForStatusFrom(t *testing.T, p http.Handler, remoteAddr string, expected int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for statusFrom(p, remoteAddr) != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s to get %d", remoteAddr, expected)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAllowedIPsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowed.txt")
+	start := time.Now().Add(-time.Hour)
+	writeRulesFile(t, path, "# office\n10.0.0.0/8\n!10.5.0.0/16\n\n192.0.2.7 # monitoring\nnot-an-ip\n", start)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Debug"}}
+	cfg.AllowedIPsFile = path
+	cfg.IPListsInterval = "10ms"
+
+	p, err := tbua.New(ctx, &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for remoteAddr, expected := range map[string]int{
+		"10.1.2.3:1234":   http.StatusTeapot,
+		"10.5.2.3:1234":   http.StatusForbidden,
+		"192.0.2.7:1234":  http.StatusTeapot,
+		"198.51.100.1:80": http.StatusForbidden,
+	} {
+		if code := statusFrom(p, remoteAddr); code != expected {
+			t.Errorf("%s: expected %d, got %d", remoteAddr, expected, code)
+		}
+	}
+
+	writeRulesFile(t, path, "198.51.100.0/24\n", start.Add(time.Minute))
+	waitForStatusFrom(t, p, "198.51.100.1:80", http.StatusTeapot)
+	if code := statusFrom(p, "10.1.2.3:1234"); code != http.StatusForbidden {
+		t.Fatalf("expected the old list to be replaced, got %d", code)
+	}
+}
+
+func TestBlockedIPsURL(t *testing.T) {
+	list := &rulesServer{}
+	list.set(http.StatusOK, "203.0.113.0/24\n")
+	server := httptest.NewServer(list)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := tbua.CreateConfig()
+	cfg.BlockedIPsURL = server.URL
+	cfg.BlockedIPsStatusCode = http.StatusUnavailableForLegalReasons
+	cfg.IPListsInterval = "10ms"
+
+	p, err := tbua.New(ctx, &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	waitForStatusFrom(t, p, "203.0.113.9:1234", http.StatusUnavailableForLegalReasons)
+
+	// A failing refresh or a download without any network keeps the last
+	// good list.
+	for _, response := range []struct {
+		status int
+		body   string
+	}{
+		{status: http.StatusInternalServerError},
+		{status: http.StatusOK},
+		{status: http.StatusOK, body: "<html>maintenance</html>\n"},
+	} {
+		list.set(response.status, response.body)
+		time.Sleep(50 * time.Millisecond)
+		if code := statusFrom(p, "203.0.113.9:1234"); code != http.StatusUnavailableForLegalReasons {
+			t.Fatalf("%d %q: expected the cached list to stay active, got %d", response.status, response.body, code)
+		}
+	}
+
+	list.set(http.StatusOK, "198.51.100.0/24\n")
+	waitForStatusFrom(t, p, "198.51.100.9:1234", http.StatusUnavailableForLegalReasons)
+	waitForStatusFrom(t, p, "203.0.113.9:1234", http.StatusTeapot)
+}
+
+func TestBlockedIPsURLETag(t *testing.T) {
+	var (
+		mu         sync.Mutex
+		etag, body = `"v1"`, "203.0.113.0/24\n"
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if req.Header.Get("If-None-Match") == etag {
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+		rw.Header().Set("ETag", etag)
+		_, _ = rw.Write([]byte(body))
+	}))
+	defer server.Close()
+	set := func(newETag, newBody string) {
+		mu.Lock()
+		defer mu.Unlock()
+		etag, body = newETag, newBody
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := tbua.CreateConfig()
+	cfg.BlockedIPsURL = server.URL
+	cfg.IPListsInterval = "10ms"
+
+	p, err := tbua.New(ctx, &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+	waitForStatusFrom(t, p, "203.0.113.9:1234", http.StatusForbidden)
+
+	// The ETag of a rejected download is not kept, so the repaired list
+	// served under the same ETag is still fetched.
+	set(`"v2"`, "")
+	time.Sleep(50 * time.Millisecond)
+	set(`"v2"`, "198.51.100.0/24\n")
+	waitForStatusFrom(t, p, "198.51.100.9:1234", http.StatusForbidden)
+	waitForStatusFrom(t, p, "203.0.113.9:1234", http.StatusTeapot)
+}
+
+func TestInvalidIPLists(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(cfg *tbua.Config)
+	}{
+		{
+			name:   "missing file",
+			config: func(cfg *tbua.Config) { cfg.AllowedIPsFile = filepath.Join(t.TempDir(), "missing.txt") },
+		},
+		{
+			name: "invalid interval",
+			config: func(cfg *tbua.Config) {
+				cfg.BlockedIPsURL = "https://lists.example.com/blocked.txt"
+				cfg.IPListsInterval = "often"
+			},
+		},
+		{
+			name:   "interval without lists",
+			config: func(cfg *tbua.Config) { cfg.IPListsInterval = "1m" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			tt.config(cfg)
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package headerblock
+
+import "net"
+
+// ipTrie is a binary trie of networks, one level per address bit, so a
+// lookup takes at most 32 (IPv4) or 128 (IPv6) steps however many networks
+// it holds.
+type ipTrie struct {
+	v4, v6 *ipTrieNode
+	// entries are the inserted networks, in insertion order.
+	entries []*net.IPNet
+}
+
+type ipTrieNode struct {
+	children [2]*ipTrieNode
+	// terminal marks the end of a network: every address below is in it.
+	terminal bool
+}
+
+// insert adds a network to the trie.
+func (t *ipTrie) insert(n *net.IPNet) {
+	t.entries = append(t.entries, n)
+
+	ip, root := t.root(n.IP, true)
+	if ip == nil {
+		return
+	}
+	ones, bits := n.Mask.Size()
+	if len(ip) == net.IPv4len && bits == 8*net.IPv6len {
+		// An IPv4-mapped network, as net.IPNet.Contains treats it.
+		if ones -= 96; ones < 0 {
+			ones = 0
+		}
+	}
+	node := *root
+	for i := 0; i < ones; i++ {
+		if node.terminal {
+			// A shorter network already covers this one.
+			return
+		}
+		bit := ip[i/8] >> (7 - uint(i%8)) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &ipTrieNode{}
+		}
+		node = node.children[bit]
+	}
+	node.terminal = true
+	// Longer networks below are covered now.
+	node.children = [2]*ipTrieNode{}
+}
+
+// contains reports whether a network of the trie contains ip.
+func (t *ipTrie) contains(ip net.IP) bool {
+	ip, root := t.root(ip, false)
+	if ip == nil || *root == nil {
+		return false
+	}
+
+	node := *root
+	for i := 0; i < len(ip)*8; i++ {
+		if node.terminal {
+			return true
+		}
+		if node = node.children[ip[i/8]>>(7-uint(i%8))&1]; node == nil {
+			return false
+		}
+	}
+	return node.terminal
+}
+
+// root returns ip in its 4 or 16 byte form and the root of its family,
+// created when create is set. IPv4-mapped IPv6 addresses are IPv4.
+func (t *ipTrie) root(ip net.IP, create bool) (net.IP, **ipTrieNode) {
+	root := &t.v6
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, root = ip4, &t.v4
+	} else if ip = ip.To16(); ip == nil {
+		return nil, nil
+	}
+	if create && *root == nil {
+		*root = &ipTrieNode{}
+	}
+	return ip, root
+}
@@ -0,0 +1,112 @@
+package headerblock
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+func TestIPTrie(t *testing.T) {
+	var trie ipTrie
+	for _, cidr := range []string{"10.0.0.0/8", "10.1.0.0/16", "192.0.2.7/32", "2001:db8::/32", "::ffff:198.51.100.0/120", "0.0.0.0/1"} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("parse %s: %v", cidr, err)
+		}
+		trie.insert(n)
+	}
+
+	tests := []struct {
+		ip       string
+		expected bool
+	}{
+		{ip: "10.1.2.3", expected: true},
+		{ip: "10.200.0.1", expected: true},
+		{ip: "192.0.2.7", expected: true},
+		{ip: "192.0.2.8", expected: false},
+		{ip: "127.0.0.1", expected: true},
+		{ip: "198.51.100.9", expected: true},
+		{ip: "::ffff:192.0.2.7", expected: true},
+		{ip: "2001:db8:1::1", expected: true},
+		{ip: "2001:db9::1", expected: false},
+		{ip: "::1", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := trie.contains(net.ParseIP(tt.ip)); got != tt.expected {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// randomNets returns count random IPv4 networks with prefixes of 16 to 32
+// bits.
+func randomNets(r *rand.Rand, count int) []*net.IPNet {
+	nets := make([]*net.IPNet, count)
+	for i := range nets {
+		ip := net.IPv4(byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256))).To4()
+		mask := net.CIDRMask(16+r.Intn(17), 32)
+		nets[i] = &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+	}
+	return nets
+}
+
+func TestIPTrieMatchesLinearScan(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	nets := randomNets(r, 2000)
+	var trie ipTrie
+	for _, n := range nets {
+		trie.insert(n)
+	}
+
+	for i := 0; i < 10000; i++ {
+		ip := net.IPv4(byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)))
+		if i%2 == 0 {
+			// Pick an address inside a network so both outcomes are covered.
+			n := nets[r.Intn(len(nets))]
+			ip = append(net.IP(nil), n.IP...)
+			ip[3] |= byte(r.Intn(256)) &^ n.Mask[3]
+		}
+
+		expected := false
+		for _, n := range nets {
+			if n.Contains(ip) {
+				expected = true
+				break
+			}
+		}
+		if got := trie.contains(ip); got != expected {
+			t.Fatalf("%s: trie says %v, linear scan %v", ip, got, expected)
+		}
+	}
+}
+
+func BenchmarkIPLookup(b *testing.B) {
+	for _, count := range []int{10, 1000, 10000} {
+		r := rand.New(rand.NewSource(1))
+		nets := randomNets(r, count)
+		var trie ipTrie
+		for _, n := range nets {
+			trie.insert(n)
+		}
+		ip := net.ParseIP("203.0.113.77")
+
+		b.Run(fmt.Sprintf("linear/%d", count), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, n := range nets {
+					if n.Contains(ip) {
+						break
+					}
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("trie/%d", count), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				trie.contains(ip)
+			}
+		})
+	}
+}
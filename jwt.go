@@ -0,0 +1,324 @@
+package headerblock
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultJWKSInterval = time.Hour
+	jwksTimeout         = 10 * time.Second
+	// maxJWKSSize bounds the size of a downloaded key set.
+	maxJWKSSize = 1 << 20
+)
+
+// jwtVerifier lets requests carrying a valid bearer token with the bypass
+// claims skip the rules, like clients in allowedIPs.
+type jwtVerifier struct {
+	secret []byte
+	claims map[string]string
+
+	jwksURL      string
+	jwksInterval time.Duration
+	client       *http.Client
+	// keys holds the map[string]crypto.PublicKey of the last fetched key set,
+	// keyed by kid.
+	keys atomic.Value
+}
+
+func newJWTVerifier(config *Config) (*jwtVerifier, error) {
+	if config.JWTSecret == "" && config.JWTJWKSURL == "" {
+		return nil, nil
+	}
+	if len(config.JWTBypassClaims) == 0 {
+		return nil, errors.New("jwtBypassClaims: at least one claim is required")
+	}
+
+	verifier := &jwtVerifier{
+		secret:       []byte(config.JWTSecret),
+		claims:       config.JWTBypassClaims,
+		jwksURL:      config.JWTJWKSURL,
+		jwksInterval: defaultJWKSInterval,
+		client:       &http.Client{Timeout: jwksTimeout},
+	}
+	verifier.keys.Store(map[string]crypto.PublicKey{})
+
+	if config.JWTJWKSInterval != "" {
+		var err error
+		if verifier.jwksInterval, err = parsePositiveDuration(config.JWTJWKSInterval, defaultJWKSInterval); err != nil {
+			return nil, fmt.Errorf("jwtJWKSInterval: %w", err)
+		}
+	}
+	return verifier, nil
+}
+
+// allows reports whether the request carries a valid bearer token with every
+// bypass claim.
+func (v *jwtVerifier) allows(req *http.Request, now time.Time) bool {
+	scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+
+	claims, err := v.verify(strings.TrimSpace(token), now)
+	if err != nil {
+		return false
+	}
+	for name, want := range v.claims {
+		if !claimMatches(claims[name], want) {
+			return false
+		}
+	}
+	return true
+}
+
+// claimMatches compares a claim with its expected value. Array claims, like
+// roles or groups, match when any element does.
+func claimMatches(claim interface{}, want string) bool {
+	switch value := claim.(type) {
+	case string:
+		return value == want
+	case bool:
+		return fmt.Sprint(value) == want
+	case float64:
+		return fmt.Sprint(value) == want
+	case []interface{}:
+		for _, element := range value {
+			if claimMatches(element, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// verify checks the signature and the exp and nbf claims of token and
+// returns its claims.
+func (v *jwtVerifier) verify(token string, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	if err := v.verifySignature(header, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if exp, ok := claims["exp"].(float64); ok && now.Unix() >= int64(exp) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Unix() < int64(nbf) {
+		return nil, errors.New("token not valid yet")
+	}
+	return claims, nil
+}
+
+func decodeJWTPart(part string, target interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+func (v *jwtVerifier) verifySignature(header jwtHeader, signed string, signature []byte) error {
+	newHash, cryptoHash, err := jwtHash(header.Alg)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(header.Alg, "HS") {
+		if len(v.secret) == 0 {
+			return errors.New("no secret for HMAC token")
+		}
+		mac := hmac.New(newHash, v.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+
+	key, ok := v.keys.Load().(map[string]crypto.PublicKey)[header.Kid]
+	if !ok {
+		return fmt.Errorf("unknown key %q", header.Kid)
+	}
+	digest := newHash()
+	digest.Write([]byte(signed))
+	sum := digest.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(header.Alg, "RS") {
+			return fmt.Errorf("algorithm %s does not match RSA key", header.Alg)
+		}
+		return rsa.VerifyPKCS1v15(key, cryptoHash, sum, signature)
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(header.Alg, "ES") || len(signature) != 2*size {
+			return fmt.Errorf("algorithm %s does not match ECDSA key", header.Alg)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, sum, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	default:
+		return errors.New("unsupported key type")
+	}
+}
+
+// jwtHash returns the hash of a JWS algorithm. "none" and unknown algorithms
+// are rejected.
+func jwtHash(alg string) (func() hash.Hash, crypto.Hash, error) {
+	switch alg {
+	case "HS256", "RS256", "ES256":
+		return sha256.New, crypto.SHA256, nil
+	case "HS384", "RS384", "ES384":
+		return sha512.New384, crypto.SHA384, nil
+	case "HS512", "RS512", "ES512":
+		return sha512.New, crypto.SHA512, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetchJWKS downloads the key set and replaces the known keys. Keys that
+// cannot be parsed are skipped.
+func (v *jwtVerifier) fetchJWKS(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.jwksURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwtJWKSURL %s: unexpected status %d", v.jwksURL, resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSSize)).Decode(&set); err != nil {
+		return fmt.Errorf("jwtJWKSURL %s: %w", v.jwksURL, err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, key := range set.Keys {
+		if publicKey, err := key.publicKey(); err == nil {
+			keys[key.Kid] = publicKey
+		}
+	}
+	v.keys.Store(keys)
+	return nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// runJWKS fetches the key set right away and then on every tick until ctx
+// is done. The previous keys stay active when a refresh fails.
+func (v *jwtVerifier) runJWKS(ctx context.Context) {
+	if err := v.fetchJWKS(ctx); err != nil {
+		log.Printf("headerblock: failed to fetch JWKS: %v", err)
+	}
+
+	ticker := time.NewTicker(v.jwksInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := v.fetchJWKS(ctx); err != nil {
+				log.Printf("headerblock: keeping previous JWKS, refresh failed: %v", err)
+			}
+		}
+	}
+}
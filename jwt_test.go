@@ -0,0 +1,205 @@
+package headerblock_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func encodeJWTPart(t *testing.T, v interface{}) string {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func newHS256Token(t *testing.T, secret string, claims map[string]interface{}) string {
+	t.Helper()
+
+	signed := encodeJWTPart(t, map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encodeJWTPart(t, claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func newES256Token(t *testing.T, key *ecdsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+
+	signed := encodeJWTPart(t, map[string]string{"alg": "ES256", "kid": kid}) + "." + encodeJWTPart(t, claims)
+	sum := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTBypass(t *testing.T) {
+	const secret = "s3cr3t"
+	expires := float64(time.Now().Add(time.Hour).Unix())
+	expired := float64(time.Now().Add(-time.Hour).Unix())
+
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+	}{
+		{name: "NoToken", expectedStatus: http.StatusForbidden},
+		{
+			name:           "BypassClaim",
+			authorization:  "Bearer " + newHS256Token(t, secret, map[string]interface{}{"role": "internal", "exp": expires}),
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "BypassClaimInArray",
+			authorization:  "Bearer " + newHS256Token(t, secret, map[string]interface{}{"role": []string{"user", "internal"}}),
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "OtherClaim",
+			authorization:  "Bearer " + newHS256Token(t, secret, map[string]interface{}{"role": "user", "exp": expires}),
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Expired",
+			authorization:  "Bearer " + newHS256Token(t, secret, map[string]interface{}{"role": "internal", "exp": expired}),
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "WrongSecret",
+			authorization:  "Bearer " + newHS256Token(t, "guess", map[string]interface{}{"role": "internal"}),
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "AlgNone",
+			authorization:  "Bearer " + encodeJWTPart(t, map[string]string{"alg": "none"}) + "." + encodeJWTPart(t, map[string]string{"role": "internal"}) + ".",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "^X-Debug$"}}
+	cfg.JWTSecret = secret
+	cfg.JWTBypassClaims = map[string]string{"role": "internal"}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("X-Debug", "1")
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestJWTBypassWithJWKS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	fetched := make(chan struct{}, 1)
+	jwks := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "EC",
+				"kid": "key-1",
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+				"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+			}},
+		})
+		select {
+		case fetched <- struct{}{}:
+		default:
+		}
+	}))
+	defer jwks.Close()
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "^X-Debug$"}}
+	cfg.JWTJWKSURL = jwks.URL
+	cfg.JWTBypassClaims = map[string]string{"scope": "monitoring"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p, err := tbua.New(ctx, &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	select {
+	case <-fetched:
+	case <-time.After(2 * time.Second):
+		t.Fatal("JWKS was not fetched")
+	}
+
+	for _, tt := range []struct {
+		kid            string
+		expectedStatus int
+	}{
+		{kid: "key-1", expectedStatus: http.StatusTeapot},
+		{kid: "key-2", expectedStatus: http.StatusForbidden},
+	} {
+		token := newES256Token(t, key, tt.kid, map[string]interface{}{"scope": "monitoring"})
+
+		// The key set is stored right after the response is written.
+		deadline := time.Now().Add(time.Second)
+		for {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("X-Debug", "1")
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code == tt.expectedStatus {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("kid %s: expected %d, got %d", tt.kid, tt.expectedStatus, rr.Code)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestJWTBypassRequiresClaims(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.JWTSecret = "s3cr3t"
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error without jwtBypassClaims")
+	}
+}
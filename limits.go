@@ -0,0 +1,173 @@
+package headerblock
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// headerLimits rejects requests by the shape of their headers before any
+// rule is evaluated. Zero limits are disabled.
+type headerLimits struct {
+	maxCount int
+	// maxBytes limits the sum of all header name and value lengths.
+	maxBytes int
+	// maxValueLength applies to headers without an entry in valueLengths,
+	// which is keyed by canonical header name.
+	maxValueLength int
+	valueLengths   map[string]int
+	// truncate cuts long values to the limit instead of denying the request.
+	truncate bool
+}
+
+func newHeaderLimits(config *Config) (headerLimits, error) {
+	if config.MaxHeaderCount < 0 {
+		return headerLimits{}, fmt.Errorf("maxHeaderCount: must not be negative, got %d", config.MaxHeaderCount)
+	}
+	if config.MaxHeaderBytes < 0 {
+		return headerLimits{}, fmt.Errorf("maxHeaderBytes: must not be negative, got %d", config.MaxHeaderBytes)
+	}
+	if config.MaxHeaderValueLength < 0 {
+		return headerLimits{}, fmt.Errorf("maxHeaderValueLength: must not be negative, got %d", config.MaxHeaderValueLength)
+	}
+
+	limits := headerLimits{
+		maxCount:       config.MaxHeaderCount,
+		maxBytes:       config.MaxHeaderBytes,
+		maxValueLength: config.MaxHeaderValueLength,
+	}
+	for name, length := range config.MaxHeaderValueLengths {
+		if length < 0 {
+			return headerLimits{}, fmt.Errorf("maxHeaderValueLengths.%s: must not be negative, got %d", name, length)
+		}
+		if limits.valueLengths == nil {
+			limits.valueLengths = make(map[string]int)
+		}
+		limits.valueLengths[http.CanonicalHeaderKey(name)] = length
+	}
+
+	switch action := strings.ToLower(strings.TrimSpace(config.HeaderValueLengthAction)); action {
+	case "", actionBlock:
+	case "truncate":
+		limits.truncate = true
+	default:
+		return headerLimits{}, fmt.Errorf("headerValueLengthAction: unknown action %q", config.HeaderValueLengthAction)
+	}
+	return limits, nil
+}
+
+func (l headerLimits) enabled() bool {
+	return l.maxCount > 0 || l.maxBytes > 0 || l.maxValueLength > 0 || len(l.valueLengths) > 0
+}
+
+// valueLength returns the value length limit of a header, 0 for none.
+func (l headerLimits) valueLength(name string) int {
+	if length, ok := l.valueLengths[http.CanonicalHeaderKey(name)]; ok {
+		return length
+	}
+	return l.maxValueLength
+}
+
+// checkLimits denies requests exceeding a header limit and reports whether
+// it did. Long values are truncated in place when configured so. Clients in
+// allowedIPs are exempt.
+func (c *headerBlock) checkLimits(ev *evaluation) bool {
+	if !c.limits.enabled() || c.allowedIP(ev) {
+		return false
+	}
+
+	var clientIP string
+	if ip := ev.ip(); ip != nil {
+		clientIP = ip.String()
+	}
+
+	if c.limits.maxCount > 0 && len(ev.req.Header) > c.limits.maxCount {
+		entry := logEntry{
+			Decision: decisionTooManyHeaders,
+			Rule:     "maxHeaderCount",
+			ClientIP: clientIP,
+		}
+		if c.log {
+			c.logDecision(ev.req, entry, "access denied - %d headers from IP %s exceed maxHeaderCount %d",
+				len(ev.req.Header), clientIP, c.limits.maxCount)
+		}
+		c.recordBlock(ev.req, entry)
+		c.deny(ev.rw, ev.req, c.denyStatusCode, entry)
+		return true
+	}
+
+	if c.limits.maxBytes > 0 {
+		if size := headerBytes(ev.req.Header); size > c.limits.maxBytes {
+			entry := logEntry{
+				Decision: decisionHeadersTooLarge,
+				Rule:     "maxHeaderBytes",
+				ClientIP: clientIP,
+			}
+			if c.log {
+				c.logDecision(ev.req, entry, "access denied - %d header bytes from IP %s exceed maxHeaderBytes %d",
+					size, clientIP, c.limits.maxBytes)
+			}
+			c.recordBlock(ev.req, entry)
+			c.deny(ev.rw, ev.req, http.StatusRequestHeaderFieldsTooLarge, entry)
+			return true
+		}
+	}
+
+	for name, values := range ev.req.Header {
+		limit := c.limits.valueLength(name)
+		if limit == 0 {
+			continue
+		}
+
+		for i, value := range values {
+			if len(value) <= limit {
+				continue
+			}
+
+			entry := logEntry{
+				Decision: decisionHeaderTooLong,
+				Rule:     "maxHeaderValueLength",
+				Header:   name,
+				ClientIP: clientIP,
+			}
+			if c.limits.truncate {
+				values[i] = truncateValue(value, limit)
+				if c.log {
+					c.logDecision(ev.req, entry.withDecision(decisionTruncated),
+						"header %s from IP %s truncated from %d to %d bytes", name, clientIP, len(value), limit)
+				}
+				continue
+			}
+
+			if c.log {
+				c.logDecision(ev.req, entry, "access denied - header %s from IP %s is %d bytes, over the limit of %d",
+					name, clientIP, len(value), limit)
+			}
+			c.recordBlock(ev.req, entry)
+			c.deny(ev.rw, ev.req, c.denyStatusCode, entry)
+			return true
+		}
+	}
+	return false
+}
+
+// headerBytes sums the lengths of all header names and values.
+func headerBytes(header http.Header) int {
+	size := 0
+	for name, values := range header {
+		for _, value := range values {
+			size += len(name) + len(value)
+		}
+	}
+	return size
+}
+
+// truncateValue cuts value to at most limit bytes without splitting a UTF-8
+// sequence.
+func truncateValue(value string, limit int) string {
+	for limit > 0 && !utf8.RuneStart(value[limit]) {
+		limit--
+	}
+	return value[:limit]
+}
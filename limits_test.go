@@ -0,0 +1,150 @@
+package headerblock_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestMaxHeaderCount(t *testing.T) {
+	tests := []struct {
+		name           string
+		headers        int
+		remoteAddr     string
+		expectedStatus int
+	}{
+		{name: "AtLimit", headers: 3, remoteAddr: "192.0.2.1:1234", expectedStatus: http.StatusTeapot},
+		{name: "OverLimit", headers: 4, remoteAddr: "192.0.2.1:1234", expectedStatus: http.StatusForbidden},
+		{name: "AllowedIPExempt", headers: 4, remoteAddr: "10.0.0.1:1234", expectedStatus: http.StatusTeapot},
+	}
+
+	cfg := tbua.CreateConfig()
+	cfg.MaxHeaderCount = 3
+	cfg.AllowedIPs = []string{"10.0.0.0/8"}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for i := 0; i < tt.headers; i++ {
+				req.Header.Set(fmt.Sprintf("X-Header-%d", i), "1")
+			}
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidMaxHeaderCount(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.MaxHeaderCount = -1
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error for negative maxHeaderCount")
+	}
+}
+
+func TestMaxHeaderValueLength(t *testing.T) {
+	tests := []struct {
+		name           string
+		action         string
+		header         string
+		value          string
+		expectedStatus int
+		expectedValue  string
+	}{
+		{name: "WithinLimit", header: "X-Data", value: "12345678", expectedStatus: http.StatusTeapot, expectedValue: "12345678"},
+		{name: "OverLimit", header: "X-Data", value: "123456789", expectedStatus: http.StatusForbidden},
+		{name: "PerHeaderOverride", header: "Cookie", value: "session=123456789", expectedStatus: http.StatusTeapot, expectedValue: "session=123456789"},
+		{name: "PerHeaderOverLimit", header: "Referer", value: "https://example.com/", expectedStatus: http.StatusForbidden},
+		{name: "Truncate", action: "truncate", header: "X-Data", value: "123456789", expectedStatus: http.StatusTeapot, expectedValue: "12345678"},
+		{name: "TruncateKeepsRunes", action: "truncate", header: "X-Data", value: "1234567ä", expectedStatus: http.StatusTeapot, expectedValue: "1234567"},
+		{name: "TruncateBeforeMatching", action: "truncate", header: "X-Data", value: "12345678sqlmap", expectedStatus: http.StatusTeapot, expectedValue: "12345678"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.RequestHeaders = []tbua.HeaderConfig{{Value: "sqlmap"}}
+			cfg.MaxHeaderValueLength = 8
+			cfg.MaxHeaderValueLengths = map[string]int{"cookie": 4096, "Referer": 16}
+			cfg.HeaderValueLengthAction = tt.action
+
+			var forwarded string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				forwarded = req.Header.Get(tt.header)
+				rw.WriteHeader(http.StatusTeapot)
+			})
+
+			p, err := tbua.New(context.Background(), next, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set(tt.header, tt.value)
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if forwarded != tt.expectedValue {
+				t.Fatalf("expected forwarded value %q, got %q", tt.expectedValue, forwarded)
+			}
+		})
+	}
+}
+
+func TestInvalidHeaderValueLengthAction(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.MaxHeaderValueLength = 8
+	cfg.HeaderValueLengthAction = "strip"
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error for unknown headerValueLengthAction")
+	}
+}
+
+func TestMaxHeaderBytes(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.MaxHeaderBytes = 32
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		value          string
+		expectedStatus int
+	}{
+		{value: "0123456789abcdefghijklmnopqrstu", expectedStatus: http.StatusTeapot},
+		{value: "0123456789abcdefghijklmnopqrstuv", expectedStatus: http.StatusRequestHeaderFieldsTooLarge},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X", tt.value)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+
+		if rr.Code != tt.expectedStatus {
+			t.Fatalf("value of %d bytes: expected %d, got %d", len(tt.value), tt.expectedStatus, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package headerblock
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// Decisions reported in log entries.
+const (
+	decisionWhitelisted     = "whitelisted"
+	decisionIPBypass        = "ip-bypass"
+	decisionStripped        = "stripped"
+	decisionDenied          = "denied"
+	decisionDryRun          = "dry-run"
+	decisionIPBlocked       = "ip-blocked"
+	decisionLogged          = "logged"
+	decisionTagged          = "tagged"
+	decisionCountryBlocked  = "country-blocked"
+	decisionASNBlocked      = "asn-blocked"
+	decisionDNSBLListed     = "dnsbl-listed"
+	decisionTolerated       = "tolerated"
+	decisionRateLimited     = "rate-limited"
+	decisionBanned          = "banned"
+	decisionCrowdSec        = "crowdsec"
+	decisionRedirected      = "redirected"
+	decisionTooManyHeaders  = "too-many-headers"
+	decisionHeaderTooLong   = "header-too-long"
+	decisionHeadersTooLarge = "headers-too-large"
+	decisionTruncated       = "truncated"
+	decisionSmuggling       = "smuggling"
+	decisionContentType     = "content-type-blocked"
+	decisionHeaderBytes     = "invalid-header-bytes"
+	decisionHeaderName      = "invalid-header-name"
+	decisionHeaderInjection = "header-injection"
+	decisionBudgetExceeded  = "budget-exceeded"
+)
+
+const redactedValue = "[REDACTED]"
+
+// logEntry is a single rule decision. The text format only prints Message,
+// the JSON format and log templates print every field.
+type logEntry struct {
+	Time     string `json:"time"`
+	Decision string `json:"decision"`
+	Rule     string `json:"rule,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	Header   string `json:"header,omitempty"`
+	Value    string `json:"value,omitempty"`
+	ClientIP string `json:"clientIP,omitempty"`
+	Country  string `json:"country,omitempty"`
+	ASN      uint   `json:"asn,omitempty"`
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	Message  string `json:"message"`
+	TraceID  string `json:"traceID,omitempty"`
+	SpanID   string `json:"spanID,omitempty"`
+	// RequestID is set when requestID is enabled.
+	RequestID string `json:"requestID,omitempty"`
+	// Suppressed counts the repeats folded into a log summary.
+	Suppressed int `json:"suppressed,omitempty"`
+	// Captures are the named capture groups of the value pattern.
+	Captures map[string]string `json:"captures,omitempty"`
+}
+
+// matchEntry builds the log entry for a rule that matched a header.
+func matchEntry(r rule, name string, values []string) logEntry {
+	return logEntry{
+		Rule:     r.id,
+		Severity: r.severity,
+		Header:   name,
+		Value:    strings.Join(values, ", "),
+		Captures: r.captures(values),
+	}
+}
+
+// redactCaptures replaces the captured values with redactedValue.
+func redactCaptures(captures map[string]string) map[string]string {
+	if len(captures) == 0 {
+		return captures
+	}
+	redacted := make(map[string]string, len(captures))
+	for name := range captures {
+		redacted[name] = redactedValue
+	}
+	return redacted
+}
+
+func (e logEntry) withDecision(decision string) logEntry {
+	e.Decision = decision
+	return e
+}
+
+func parseLogFormat(raw string) (string, error) {
+	switch format := strings.ToLower(strings.TrimSpace(raw)); format {
+	case "", logFormatText:
+		return logFormatText, nil
+	case logFormatJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("logFormat: unknown format %q", raw)
+	}
+}
+
+// parseLogTemplate compiles the logTemplate used instead of the text format.
+// Templates get the fields of logEntry, e.g. {{.ClientIP}} or {{.Rule}}.
+func parseLogTemplate(raw, format string) (*template.Template, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	if format == logFormatJSON {
+		return nil, errors.New("logTemplate: cannot be combined with logFormat json")
+	}
+	tmpl, err := template.New("logTemplate").Option("missingkey=error").Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("logTemplate: %w", err)
+	}
+	if err := tmpl.Execute(io.Discard, logEntry{}); err != nil {
+		return nil, fmt.Errorf("logTemplate: %w", err)
+	}
+	return tmpl, nil
+}
+
+// logDecision writes entry in the configured log format unless the log
+// sampler drops it. The message is built from format and args.
+func (c *headerBlock) logDecision(req *http.Request, entry logEntry, format string, args ...interface{}) {
+	entry.Message = fmt.Sprintf(format, args...)
+	if c.tracing {
+		entry.TraceID, entry.SpanID = traceContext(req)
+	}
+	entry.RequestID = c.requestID(req)
+
+	now := time.Now()
+	entry.Time = now.UTC().Format(time.RFC3339Nano)
+	entry.Method = req.Method
+	entry.Path = req.URL.Path
+	if c.redactLogValues && entry.Value != "" {
+		entry.Value = redactedValue
+	}
+	if c.redactLogValues {
+		entry.Captures = redactCaptures(entry.Captures)
+	}
+
+	url := req.URL.String()
+	if c.logSampler != nil && !c.logSampler.allow(c.logSampleKey(req, entry), url, entry, now) {
+		return
+	}
+	c.writeLogEntry(url, entry)
+}
+
+// logSampleKey identifies repeats of a decision: the same decision of the same
+// rule for the same client.
+func (c *headerBlock) logSampleKey(req *http.Request, entry logEntry) string {
+	client := entry.ClientIP
+	if client == "" {
+		if clientIP := c.clientIPs.resolve(req); clientIP != nil {
+			client = clientIP.String()
+		}
+	}
+	return client + "|" + entry.Rule + "|" + entry.Decision
+}
+
+// writeLogEntry writes entry to the decision log. The text format prefixes
+// the message with url.
+func (c *headerBlock) writeLogEntry(url string, entry logEntry) {
+	if c.logFormat != logFormatJSON && c.logTemplate == nil {
+		var ids []string
+		if entry.RequestID != "" {
+			ids = append(ids, "request "+entry.RequestID)
+		}
+		if entry.TraceID != "" {
+			ids = append(ids, "trace "+entry.TraceID)
+		}
+		if len(ids) > 0 {
+			c.decisionLogger().Printf("%s: %s (%s)", url, entry.Message, strings.Join(ids, ", "))
+			return
+		}
+		c.decisionLogger().Printf("%s: %s", url, entry.Message)
+		return
+	}
+
+	var line []byte
+	if c.logTemplate != nil {
+		var buf bytes.Buffer
+		if err := c.logTemplate.Execute(&buf, entry); err != nil {
+			log.Printf("headerblock: failed to render log template: %v", err)
+			return
+		}
+		line = bytes.TrimRight(buf.Bytes(), "\n")
+	} else {
+		var err error
+		if line, err = json.Marshal(entry); err != nil {
+			log.Printf("headerblock: failed to encode log entry: %v", err)
+			return
+		}
+	}
+
+	_, _ = c.decisionLogger().Writer().Write(append(line, '\n'))
+}
+
+// decisionLogger returns the logger of the configured logOutput, or the
+// default logger shared with Traefik.
+func (c *headerBlock) decisionLogger() *log.Logger {
+	if c.logOutput != nil {
+		return c.logOutput
+	}
+	return log.Default()
+}
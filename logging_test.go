@@ -0,0 +1,168 @@
+package headerblock_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestJSONLogFormat(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Token"},
+	}
+	cfg.Log = true
+	cfg.LogFormat = "json"
+	cfg.RedactLogValues = true
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.Header.Set("X-Token", "secret")
+	req.RemoteAddr = "192.0.2.1:1234"
+	p.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log line is not JSON: %v: %q", err, buf.String())
+	}
+
+	expected := map[string]string{
+		"decision": "denied",
+		"rule":     "requestHeaders[0]",
+		"header":   "X-Token",
+		"value":    "[REDACTED]",
+		"clientIP": "192.0.2.1",
+		"path":     "/admin",
+	}
+	for field, value := range expected {
+		if entry[field] != value {
+			t.Fatalf("expected %s=%q, got %q", field, value, entry[field])
+		}
+	}
+}
+
+func TestLogCaptures(t *testing.T) {
+	tests := []struct {
+		name     string
+		redact   bool
+		value    string
+		expected map[string]string
+	}{
+		{name: "named groups", value: "sqlmap/1.7.2#stable", expected: map[string]string{"scanner": "sqlmap", "version": "1.7.2"}},
+		{name: "optional group not taken", value: "nikto", expected: map[string]string{"scanner": "nikto"}},
+		{name: "redacted", redact: true, value: "sqlmap/1.7.2", expected: map[string]string{"scanner": "[REDACTED]", "version": "[REDACTED]"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			cfg := tbua.CreateConfig()
+			cfg.RequestHeaders = []tbua.HeaderConfig{
+				{Name: "User-Agent", Value: `^(?P<scanner>sqlmap|nikto)(?:/(?P<version>[\d.]+))?`},
+			}
+			cfg.Log = true
+			cfg.LogFormat = "json"
+			cfg.RedactLogValues = tt.redact
+
+			p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("User-Agent", tt.value)
+			p.ServeHTTP(httptest.NewRecorder(), req)
+
+			var entry struct {
+				Captures map[string]string `json:"captures"`
+			}
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("log line is not JSON: %v: %q", err, buf.String())
+			}
+			if !reflect.DeepEqual(entry.Captures, tt.expected) {
+				t.Fatalf("expected captures %v, got %v", tt.expected, entry.Captures)
+			}
+		})
+	}
+}
+
+func TestUnknownLogFormat(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.LogFormat = "xml"
+
+	_, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err == nil {
+		t.Fatal("expected error for unknown log format")
+	}
+}
+
+func TestLogTemplate(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{ID: "token", Name: "X-Token"},
+	}
+	cfg.Log = true
+	cfg.LogTemplate = `headerblock client={{.ClientIP}} rule={{.Rule}} header={{.Header}} path={{.Path}} decision={{.Decision}}`
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.Header.Set("X-Token", "secret")
+	req.RemoteAddr = "192.0.2.1:1234"
+	p.ServeHTTP(httptest.NewRecorder(), req)
+
+	expected := "headerblock client=192.0.2.1 rule=token header=X-Token path=/admin decision=denied\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestInvalidLogTemplate(t *testing.T) {
+	tests := []struct {
+		name      string
+		template  string
+		logFormat string
+	}{
+		{name: "syntax error", template: "{{.Rule"},
+		{name: "unknown field", template: "{{.Unknown}}"},
+		{name: "json format", template: "{{.Rule}}", logFormat: "json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.LogTemplate = tt.template
+			cfg.LogFormat = tt.logFormat
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected error for invalid log template")
+			}
+		})
+	}
+}
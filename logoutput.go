@@ -0,0 +1,214 @@
+package headerblock
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	logOutputStdout       = "stdout"
+	logOutputFilePrefix   = "file:"
+	logOutputSyslogPrefix = "syslog://"
+
+	defaultLogMaxSize    = 100 // megabytes
+	defaultLogMaxBackups = 3
+
+	// syslogPriority is facility local0 with severity informational.
+	syslogPriority = 16*8 + 6
+	syslogTimeout  = time.Second
+)
+
+// newLogOutput opens the logOutput decisions are written to. It returns a nil
+// logger for the default logger shared with Traefik, and the closer to call
+// once the middleware is replaced.
+func newLogOutput(config *Config) (*log.Logger, io.Closer, error) {
+	if config.LogMaxSize < 0 {
+		return nil, nil, errors.New("logMaxSize: must not be negative")
+	}
+	if config.LogMaxBackups < 0 {
+		return nil, nil, errors.New("logMaxBackups: must not be negative")
+	}
+
+	output := strings.TrimSpace(config.LogOutput)
+	switch {
+	case output == "":
+		return nil, nil, nil
+	case output == logOutputStdout:
+		return log.New(os.Stdout, "", log.LstdFlags), nil, nil
+	case strings.HasPrefix(output, logOutputFilePrefix):
+		path := strings.TrimPrefix(output, logOutputFilePrefix)
+		if path == "" {
+			return nil, nil, errors.New("logOutput: file path is empty")
+		}
+		maxSize := config.LogMaxSize
+		if maxSize == 0 {
+			maxSize = defaultLogMaxSize
+		}
+		maxBackups := config.LogMaxBackups
+		if maxBackups == 0 {
+			maxBackups = defaultLogMaxBackups
+		}
+		file, err := openRotatingFile(path, int64(maxSize)<<20, maxBackups)
+		if err != nil {
+			return nil, nil, fmt.Errorf("logOutput: %w", err)
+		}
+		return log.New(file, "", log.LstdFlags), file, nil
+	case strings.HasPrefix(output, logOutputSyslogPrefix):
+		address := strings.TrimPrefix(output, logOutputSyslogPrefix)
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return nil, nil, fmt.Errorf("logOutput: %w", err)
+		}
+		writer := newSyslogWriter(address)
+		// Syslog messages carry their own timestamp.
+		return log.New(writer, "", 0), writer, nil
+	default:
+		return nil, nil, fmt.Errorf("logOutput: unknown output %q", config.LogOutput)
+	}
+}
+
+// rotatingFile is a log file that is renamed to <path>.1 once it would grow
+// past maxSize, shifting older files up to <path>.<maxBackups>.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	closed bool
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens or creates the file for appending. Callers hold mu, except
+// openRotatingFile.
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backups and starts a new file. Callers hold mu.
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	for i := r.maxBackups - 1; i > 0; i-- {
+		_ = os.Rename(r.path+"."+strconv.Itoa(i), r.path+"."+strconv.Itoa(i+1))
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	return r.file.Close()
+}
+
+// syslogWriter sends every write as one RFC 5424 message over UDP. The
+// connection is dialed on first use and re-established after an error.
+type syslogWriter struct {
+	address  string
+	hostname string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	closed bool
+}
+
+func newSyslogWriter(address string) *syslogWriter {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &syslogWriter{address: address, hostname: hostname}
+}
+
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, os.ErrClosed
+	}
+	if s.conn == nil {
+		conn, err := net.DialTimeout("udp", s.address, syslogTimeout)
+		if err != nil {
+			return 0, err
+		}
+		s.conn = conn
+	}
+
+	message := fmt.Sprintf("<%d>1 %s %s headerblock %d - - %s",
+		syslogPriority, time.Now().UTC().Format(time.RFC3339Nano), s.hostname, os.Getpid(),
+		strings.TrimRight(string(p), "\n"))
+	if _, err := s.conn.Write([]byte(message)); err != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *syslogWriter) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
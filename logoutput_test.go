@@ -0,0 +1,126 @@
+package headerblock_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestLogOutputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "headerblock.log")
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Token"},
+	}
+	cfg.Log = true
+	cfg.LogFormat = "json"
+	cfg.LogOutput = "file:" + path
+	cfg.LogMaxSize = 1
+	cfg.LogMaxBackups = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p, err := tbua.New(ctx, &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	// Every entry logs the 300 KiB value, so the file rotates twice.
+	value := strings.Repeat("a", 300<<10)
+	for i := 0; i < 10; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Token", value)
+		p.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("expected log file %s: %v", name, err)
+		}
+		if info.Size() == 0 || info.Size() > 1<<20 {
+			t.Fatalf("unexpected size %d of %s", info.Size(), name)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected at most 2 backups, got %v", err)
+	}
+}
+
+func TestLogOutputSyslog(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Token"},
+	}
+	cfg.Log = true
+	cfg.LogOutput = "syslog://" + conn.LocalAddr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p, err := tbua.New(ctx, &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.Header.Set("X-Token", "secret")
+	p.ServeHTTP(httptest.NewRecorder(), req)
+
+	buf := make([]byte, 4096)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("no syslog message: %v", err)
+	}
+
+	message := string(buf[:n])
+	if !strings.HasPrefix(message, "<134>1 ") || !strings.Contains(message, " headerblock ") {
+		t.Fatalf("unexpected syslog header: %q", message)
+	}
+	if !strings.HasSuffix(message, "/admin: access denied - header X-Token from IP 192.0.2.1 (rule requestHeaders[0])") {
+		t.Fatalf("unexpected syslog message: %q", message)
+	}
+}
+
+func TestInvalidLogOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		size   int
+	}{
+		{name: "unknown output", output: "kafka://broker:9092"},
+		{name: "empty file path", output: "file:"},
+		{name: "syslog without port", output: "syslog://localhost"},
+		{name: "missing directory", output: "file:" + filepath.Join(t.TempDir(), "missing", "headerblock.log")},
+		{name: "negative size", output: "stdout", size: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.LogOutput = tt.output
+			cfg.LogMaxSize = tt.size
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected error for invalid log output")
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package headerblock
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// logOccurrence is the first logged decision of a client and rule in the
+// current dedup window and the number of repeats suppressed since.
+type logOccurrence struct {
+	start      time.Time
+	url        string
+	entry      logEntry
+	suppressed int
+}
+
+// logSampler thins out decision logs under floods: repeats of a decision for
+// the same client and rule are folded into one summary per dedup window, and
+// only a sampleRate share of the remaining decisions is logged.
+type logSampler struct {
+	sampleRate float64
+	window     time.Duration
+
+	mu          sync.Mutex
+	occurrences map[string]*logOccurrence
+}
+
+func newLogSampler(config *Config) (*logSampler, error) {
+	if config.LogSampleRate < 0 || config.LogSampleRate > 1 {
+		return nil, fmt.Errorf("logSampleRate: must be between 0 and 1, got %v", config.LogSampleRate)
+	}
+
+	// Without logDedupWindow, repeats are not folded.
+	window, err := parsePositiveDuration(config.LogDedupWindow, 0)
+	if err != nil {
+		return nil, fmt.Errorf("logDedupWindow: %w", err)
+	}
+
+	if (config.LogSampleRate == 0 || config.LogSampleRate == 1) && window == 0 {
+		return nil, nil
+	}
+	return &logSampler{
+		sampleRate:  config.LogSampleRate,
+		window:      window,
+		occurrences: make(map[string]*logOccurrence),
+	}, nil
+}
+
+// allow reports whether the decision should be logged. Repeats within the
+// dedup window are counted for the next summary instead.
+func (s *logSampler) allow(key, url string, entry logEntry, now time.Time) bool {
+	if s.window > 0 {
+		s.mu.Lock()
+		occurrence, ok := s.occurrences[key]
+		if ok && now.Sub(occurrence.start) < s.window {
+			occurrence.suppressed++
+			s.mu.Unlock()
+			return false
+		}
+		s.occurrences[key] = &logOccurrence{start: now, url: url, entry: entry}
+		s.mu.Unlock()
+	}
+
+	return s.sampleRate == 0 || s.sampleRate == 1 || rand.Float64() < s.sampleRate
+}
+
+// flush returns the summaries of the expired windows with suppressed repeats
+// and forgets the expired windows.
+func (s *logSampler) flush(now time.Time) []*logOccurrence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var summaries []*logOccurrence
+	for key, occurrence := range s.occurrences {
+		if now.Sub(occurrence.start) < s.window {
+			continue
+		}
+		if occurrence.suppressed > 0 {
+			summaries = append(summaries, occurrence)
+		}
+		delete(s.occurrences, key)
+	}
+	return summaries
+}
+
+// runLogSummaries logs a summary for every window that suppressed repeats until
+// ctx is done.
+func (c *headerBlock) runLogSummaries(ctx context.Context) {
+	ticker := time.NewTicker(c.logSampler.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, occurrence := range c.logSampler.flush(now) {
+				entry := occurrence.entry
+				entry.Time = now.UTC().Format(time.RFC3339Nano)
+				entry.Suppressed = occurrence.suppressed
+				entry.Message = fmt.Sprintf("%s - repeated %d times in the last %s",
+					entry.Message, occurrence.suppressed, c.logSampler.window)
+				c.writeLogEntry(occurrence.url, entry)
+			}
+		}
+	}
+}
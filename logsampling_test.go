@@ -0,0 +1,132 @@
+package headerblock_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+// lockedBuffer is a log output read while background summaries write to it.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestLogDedupWindow(t *testing.T) {
+	var buf lockedBuffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Token"},
+	}
+	cfg.Log = true
+	cfg.LogDedupWindow = "100ms"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p, err := tbua.New(ctx, &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, remoteAddr := range []string{"192.0.2.1:1234", "192.0.2.1:1234", "192.0.2.1:1234", "192.0.2.2:1234"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Token", "secret")
+		req.RemoteAddr = remoteAddr
+		p.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if count := strings.Count(buf.String(), "access denied"); count != 2 {
+		t.Fatalf("expected one line per client, got %d: %q", count, buf.String())
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(buf.String(), "from IP 192.0.2.1 (rule requestHeaders[0]) - repeated 2 times in the last 100ms") {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a summary, got %q", buf.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if strings.Contains(buf.String(), "192.0.2.2 (rule requestHeaders[0]) - repeated") {
+		t.Fatalf("expected no summary without repeats, got %q", buf.String())
+	}
+}
+
+func TestLogSampleRate(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Token"},
+	}
+	cfg.Log = true
+	cfg.LogSampleRate = 0.1
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	const requests = 1000
+	for i := 0; i < requests; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Token", "secret")
+		p.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// The expected 100 lines with a generous margin for randomness.
+	if count := strings.Count(buf.String(), "access denied"); count < 30 || count > 250 {
+		t.Fatalf("expected about 100 of %d lines, got %d", requests, count)
+	}
+}
+
+func TestInvalidLogSampling(t *testing.T) {
+	tests := []struct {
+		name   string
+		rate   float64
+		window string
+	}{
+		{name: "negative rate", rate: -0.5},
+		{name: "rate above one", rate: 1.5},
+		{name: "invalid window", window: "soon"},
+		{name: "zero window", window: "0s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.LogSampleRate = tt.rate
+			cfg.LogDedupWindow = tt.window
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected error for invalid log sampling")
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package headerblock
+
+import "testing"
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newLRUCache(2)
+	cache.add("a", 1)
+	cache.add("b", 2)
+
+	// Touch "a" so that "b" becomes the eviction candidate.
+	if value, ok := cache.get("a"); !ok || value.(int) != 1 {
+		t.Fatalf("expected a=1, got %v %v", value, ok)
+	}
+	cache.add("c", 3)
+
+	if _, ok := cache.get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	if _, ok := cache.get("a"); !ok {
+		t.Error("expected a to be kept")
+	}
+	if cache.len() != 2 {
+		t.Errorf("expected 2 entries, got %d", cache.len())
+	}
+}
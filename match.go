@@ -0,0 +1,120 @@
+package headerblock
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Match types of a rule's name and value patterns.
+const (
+	matchRegex    = "regex"
+	matchExact    = "exact"
+	matchPrefix   = "prefix"
+	matchSuffix   = "suffix"
+	matchContains = "contains"
+	matchGlob     = "glob"
+)
+
+// matcher matches a header name or value. *regexp.Regexp is a matcher.
+type matcher interface {
+	MatchString(s string) bool
+}
+
+// literalMatcher matches with plain string operations.
+type literalMatcher struct {
+	matchType string
+	pattern   string
+	fold      bool // pattern is lower case and input is lowered before matching
+}
+
+func (m literalMatcher) MatchString(s string) bool {
+	if m.fold {
+		if m.matchType == matchExact {
+			return strings.EqualFold(s, m.pattern)
+		}
+		s = strings.ToLower(s)
+	}
+
+	switch m.matchType {
+	case matchExact:
+		return s == m.pattern
+	case matchPrefix:
+		return strings.HasPrefix(s, m.pattern)
+	case matchSuffix:
+		return strings.HasSuffix(s, m.pattern)
+	default:
+		return strings.Contains(s, m.pattern)
+	}
+}
+
+func parseMatchType(raw string) (string, error) {
+	switch matchType := strings.ToLower(strings.TrimSpace(raw)); matchType {
+	case "":
+		return matchRegex, nil
+	case matchRegex, matchExact, matchPrefix, matchSuffix, matchContains, matchGlob:
+		return matchType, nil
+	default:
+		return "", fmt.Errorf("unknown match type %q", raw)
+	}
+}
+
+// compileMatcher compiles pattern for matchType. HTTP header names are case
+// insensitive, so literal and glob name patterns always ignore case.
+func compileMatcher(pattern, matchType string, caseInsensitive, isName bool) (matcher, error) {
+	fold := caseInsensitive || (isName && matchType != matchRegex)
+
+	switch matchType {
+	case matchRegex:
+		return compilePattern(pattern, caseInsensitive)
+	case matchGlob:
+		return compilePattern(globToRegex(pattern), fold)
+	default:
+		if fold {
+			pattern = strings.ToLower(pattern)
+		}
+		return literalMatcher{matchType: matchType, pattern: pattern, fold: fold}, nil
+	}
+}
+
+// regexSource returns a regular expression equivalent to a value pattern of
+// matchType, wrapped in a group that carries its case sensitivity.
+func regexSource(pattern, matchType string, caseInsensitive bool) string {
+	switch matchType {
+	case matchRegex:
+	case matchGlob:
+		pattern = globToRegex(pattern)
+	case matchExact:
+		pattern = "^" + regexp.QuoteMeta(pattern) + "$"
+	case matchPrefix:
+		pattern = "^" + regexp.QuoteMeta(pattern)
+	case matchSuffix:
+		pattern = regexp.QuoteMeta(pattern) + "$"
+	default:
+		pattern = regexp.QuoteMeta(pattern)
+	}
+
+	if caseInsensitive {
+		return "(?i:" + pattern + ")"
+	}
+	return "(?:" + pattern + ")"
+}
+
+// globToRegex translates a glob where "*" matches any run of characters and
+// "?" a single character into an anchored regular expression.
+func globToRegex(glob string) string {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			pattern.WriteString(".*")
+		case '?':
+			pattern.WriteString(".")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	pattern.WriteString("$")
+	return pattern.String()
+}
@@ -0,0 +1,107 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestMatchTypes(t *testing.T) {
+	tests := []struct {
+		name           string
+		rule           tbua.HeaderConfig
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{
+			name:           "ExactMatch",
+			rule:           tbua.HeaderConfig{Name: "User-Agent", Value: "curl/8.0", MatchType: "exact"},
+			headers:        map[string]string{"User-Agent": "curl/8.0"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "ExactNoMatch",
+			rule:           tbua.HeaderConfig{Name: "User-Agent", Value: "curl/8.0", MatchType: "exact"},
+			headers:        map[string]string{"User-Agent": "curl/8.01"},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "ExactNameIgnoresCase",
+			rule:           tbua.HeaderConfig{Name: "x-debug", MatchType: "exact"},
+			headers:        map[string]string{"X-Debug": "1"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "PrefixMatch",
+			rule:           tbua.HeaderConfig{Name: "User-Agent", Value: "python-", MatchType: "prefix"},
+			headers:        map[string]string{"User-Agent": "python-requests/2.31"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "SuffixMatch",
+			rule:           tbua.HeaderConfig{Name: "-Host", Value: ".internal", MatchType: "suffix"},
+			headers:        map[string]string{"X-Forwarded-Host": "db.internal"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "ContainsLiteralDot",
+			rule:           tbua.HeaderConfig{Name: "User-Agent", Value: "v1.2", MatchType: "contains"},
+			headers:        map[string]string{"User-Agent": "bot v102"},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "ContainsCaseInsensitive",
+			rule:           tbua.HeaderConfig{Name: "User-Agent", Value: "SQLMAP", MatchType: "contains", CaseInsensitive: true},
+			headers:        map[string]string{"User-Agent": "Mozilla sqlmap/1.7"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "GlobName",
+			rule:           tbua.HeaderConfig{Name: "x-debug-*", MatchType: "glob"},
+			headers:        map[string]string{"X-Debug-Token": "1"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "GlobValueIsAnchored",
+			rule:           tbua.HeaderConfig{Name: "User-Agent", Value: "bot-?.*", MatchType: "glob"},
+			headers:        map[string]string{"User-Agent": "my-bot-1.0"},
+			expectedStatus: http.StatusTeapot,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.RequestHeaders = []tbua.HeaderConfig{tt.rule}
+
+			p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidMatchType(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Debug", MatchType: "fuzzy"}}
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error for unknown match type")
+	}
+}
@@ -0,0 +1,102 @@
+package headerblock
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxCachedHeaderLength bounds the size of the headers kept in the match
+// cache, so clients cannot fill it with huge unique values.
+const maxCachedHeaderLength = 1024
+
+// matchCache remembers which request header rules matched a header name and
+// its values, so frequent headers skip pattern evaluation. Entries belong to
+// the rule set they were computed with and are ignored once rules reload.
+type matchCache struct {
+	entries *lruCache
+}
+
+type cachedMatch struct {
+	rules     *ruleSet
+	positions []int
+}
+
+// enabled reports whether matches are cached. A nil or zero-sized cache
+// keeps nothing, so callers skip building keys for it.
+func (m *matchCache) enabled() bool {
+	return m != nil && m.entries != nil && m.entries.capacity > 0
+}
+
+func newMatchCache(config *Config) (*matchCache, error) {
+	if config.MatchCacheSize < 0 {
+		return nil, fmt.Errorf("matchCacheSize: must not be negative, got %d", config.MatchCacheSize)
+	}
+	if config.MatchCacheSize == 0 {
+		return nil, nil
+	}
+	return &matchCache{entries: newLRUCache(config.MatchCacheSize)}, nil
+}
+
+// matchingRules returns the positions of the request header rules whose name
+// and value patterns match the header, in config order. Every rule evaluated
+// spends budget; once it is exceeded the remaining rules are skipped and the
+// partial result is not cached.
+func (c *headerBlock) matchingRules(rules *ruleSet, name string, values []string, budget *evaluationBudget) []int {
+	if !c.matchCache.enabled() {
+		positions, _ := c.evaluateHeaderRules(rules, name, values, budget)
+		return positions
+	}
+
+	key, cacheable := matchCacheKey(name, values)
+	if cacheable {
+		if cached, ok := c.matchCache.entries.get(key); ok && cached.(cachedMatch).rules == rules {
+			c.metrics.incMatchCacheHit()
+			c.matchCache.entries.count(true)
+			return cached.(cachedMatch).positions
+		}
+		c.metrics.incMatchCacheMiss()
+		c.matchCache.entries.count(false)
+	}
+
+	positions, complete := c.evaluateHeaderRules(rules, name, values, budget)
+	if cacheable && complete {
+		c.matchCache.entries.add(key, cachedMatch{rules: rules, positions: positions})
+	}
+	return positions
+}
+
+// evaluateHeaderRules tries the candidate request header rules against the
+// header, spending budget on each. complete is false when the budget ran out
+// before every candidate was tried.
+func (c *headerBlock) evaluateHeaderRules(rules *ruleSet, name string, values []string, budget *evaluationBudget) (positions []int, complete bool) {
+	for _, i := range rules.requestHeaderIndex.candidates(name, values) {
+		if !budget.spend(len(values)) {
+			return positions, false
+		}
+		if applyRule(rules.requestHeaderRules[i], name, values) {
+			positions = append(positions, i)
+		}
+	}
+	return positions, true
+}
+
+// matchCacheKey joins the header name and values. Headers longer than
+// maxCachedHeaderLength are not cached.
+func matchCacheKey(name string, values []string) (string, bool) {
+	size := len(name)
+	for _, value := range values {
+		size += len(value) + 1
+	}
+	if size > maxCachedHeaderLength {
+		return "", false
+	}
+
+	var key strings.Builder
+	key.Grow(size)
+	key.WriteString(name)
+	for _, value := range values {
+		key.WriteByte(0)
+		key.WriteString(value)
+	}
+	return key.String(), true
+}
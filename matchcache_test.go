@@ -0,0 +1,103 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestMatchCache(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "^User-Agent$", Value: "sqlmap"},
+		{Name: "^X-Debug$", PathRegex: "^/admin/"},
+	}
+	cfg.MatchCacheSize = 16
+	cfg.MetricsPath = "/_headerblock/metrics"
+	cfg.AllowedIPs = []string{"10.0.0.0/8"}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	tests := []struct {
+		path           string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{path: "/test", headers: map[string]string{"User-Agent": "sqlmap/1.7"}, expectedStatus: http.StatusForbidden},
+		{path: "/test", headers: map[string]string{"User-Agent": "sqlmap/1.7"}, expectedStatus: http.StatusForbidden},
+		{path: "/test", headers: map[string]string{"User-Agent": "Mozilla/5.0"}, expectedStatus: http.StatusTeapot},
+		// Path scoping is checked after the cache, per request.
+		{path: "/test", headers: map[string]string{"X-Debug": "1"}, expectedStatus: http.StatusTeapot},
+		{path: "/admin/users", headers: map[string]string{"X-Debug": "1"}, expectedStatus: http.StatusForbidden},
+	}
+
+	for i, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+
+		if rr.Code != tt.expectedStatus {
+			t.Fatalf("request %d: expected %d, got %d", i, tt.expectedStatus, rr.Code)
+		}
+	}
+
+	scrape := httptest.NewRequest(http.MethodGet, cfg.MetricsPath, nil)
+	scrape.RemoteAddr = "10.0.0.1:1234"
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, scrape)
+
+	for _, line := range []string{
+		`headerblock_match_cache_hits_total{middleware="headerBlock"} 2`,
+		`headerblock_match_cache_misses_total{middleware="headerBlock"} 3`,
+	} {
+		if !strings.Contains(rr.Body.String(), line) {
+			t.Fatalf("expected metrics to contain %q, got:\n%s", line, rr.Body.String())
+		}
+	}
+}
+
+func TestInvalidMatchCacheSize(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.MatchCacheSize = -1
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error for negative matchCacheSize")
+	}
+}
+
+func TestDisabledMatchCacheDoesNotBuildKeys(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector allocates")
+	}
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "^User-Agent$", Value: "sqlmap"},
+		{Name: "^Accept$", Value: "^application/x-"},
+	}
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	req.Header.Add("Accept", "text/html")
+	req.Header.Add("Accept", "application/json")
+	rr := httptest.NewRecorder()
+
+	if allocs := testing.AllocsPerRun(100, func() { p.ServeHTTP(rr, req) }); allocs != 0 {
+		t.Fatalf("expected no allocations, got %v per request", allocs)
+	}
+}
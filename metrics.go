@@ -0,0 +1,158 @@
+package headerblock
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the evaluation latency histogram.
+var latencyBuckets = []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01}
+
+// metrics is a minimal registry rendered in the Prometheus text exposition
+// format. A nil *metrics is valid and records nothing.
+type metrics struct {
+	middleware string
+
+	evaluated        uint64
+	blocked          uint64
+	whitelistBypass  uint64
+	ipBypass         uint64
+	matchCacheHits   uint64
+	matchCacheMisses uint64
+	headerInjections uint64
+	mu               sync.Mutex
+	latencyCounts    []uint64
+	latencySum       float64
+	latencyObserve   uint64
+}
+
+func newMetrics(middleware string) *metrics {
+	return &metrics{
+		middleware:    middleware,
+		latencyCounts: make([]uint64, len(latencyBuckets)),
+	}
+}
+
+func (m *metrics) incEvaluated() {
+	if m != nil {
+		atomic.AddUint64(&m.evaluated, 1)
+	}
+}
+
+func (m *metrics) incBlocked() {
+	if m != nil {
+		atomic.AddUint64(&m.blocked, 1)
+	}
+}
+
+func (m *metrics) incWhitelistBypass() {
+	if m != nil {
+		atomic.AddUint64(&m.whitelistBypass, 1)
+	}
+}
+
+func (m *metrics) incIPBypass() {
+	if m != nil {
+		atomic.AddUint64(&m.ipBypass, 1)
+	}
+}
+
+func (m *metrics) incMatchCacheHit() {
+	if m != nil {
+		atomic.AddUint64(&m.matchCacheHits, 1)
+	}
+}
+
+func (m *metrics) incMatchCacheMiss() {
+	if m != nil {
+		atomic.AddUint64(&m.matchCacheMisses, 1)
+	}
+}
+
+func (m *metrics) incHeaderInjection() {
+	if m != nil {
+		atomic.AddUint64(&m.headerInjections, 1)
+	}
+}
+
+func (m *metrics) observeLatency(d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	seconds := d.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			m.latencyCounts[i]++
+		}
+	}
+	m.latencySum += seconds
+	m.latencyObserve++
+}
+
+// writeTo renders all metrics in the Prometheus text format. ruleHits are
+// the per-rule match counters.
+func (m *metrics) writeTo(w io.Writer, ruleHits map[string]uint64) {
+	label := fmt.Sprintf("middleware=%q", m.middleware)
+
+	writeCounter(w, "headerblock_requests_evaluated_total", "Requests evaluated by the middleware.", label, atomic.LoadUint64(&m.evaluated))
+	writeCounter(w, "headerblock_requests_blocked_total", "Requests denied by a header rule.", label, atomic.LoadUint64(&m.blocked))
+	writeCounter(w, "headerblock_whitelist_bypass_total", "Rule matches allowed by a whitelist rule.", label, atomic.LoadUint64(&m.whitelistBypass))
+	writeCounter(w, "headerblock_ip_bypass_total", "Rule matches allowed by allowedIPs.", label, atomic.LoadUint64(&m.ipBypass))
+	writeCounter(w, "headerblock_match_cache_hits_total", "Request headers whose rule matches came from the match cache.", label, atomic.LoadUint64(&m.matchCacheHits))
+	writeCounter(w, "headerblock_match_cache_misses_total", "Request headers evaluated and added to the match cache.", label, atomic.LoadUint64(&m.matchCacheMisses))
+	writeCounter(w, "headerblock_header_injection_total", "Requests denied for CRLF sequences in header or query values.", label, atomic.LoadUint64(&m.headerInjections))
+
+	ids := make([]string, 0, len(ruleHits))
+	for id := range ruleHits {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	_, _ = fmt.Fprintln(w, "# HELP headerblock_rule_matches_total Header matches per rule.")
+	_, _ = fmt.Fprintln(w, "# TYPE headerblock_rule_matches_total counter")
+	for _, id := range ids {
+		_, _ = fmt.Fprintf(w, "headerblock_rule_matches_total{%s,rule=%q} %d\n", label, id, ruleHits[id])
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, _ = fmt.Fprintln(w, "# HELP headerblock_evaluation_seconds Time spent evaluating request rules.")
+	_, _ = fmt.Fprintln(w, "# TYPE headerblock_evaluation_seconds histogram")
+	for i, bound := range latencyBuckets {
+		le := strconv.FormatFloat(bound, 'g', -1, 64)
+		_, _ = fmt.Fprintf(w, "headerblock_evaluation_seconds_bucket{%s,le=%q} %d\n", label, le, m.latencyCounts[i])
+	}
+	_, _ = fmt.Fprintf(w, "headerblock_evaluation_seconds_bucket{%s,le=\"+Inf\"} %d\n", label, m.latencyObserve)
+	_, _ = fmt.Fprintf(w, "headerblock_evaluation_seconds_sum{%s} %g\n", label, m.latencySum)
+	_, _ = fmt.Fprintf(w, "headerblock_evaluation_seconds_count{%s} %d\n", label, m.latencyObserve)
+}
+
+func writeCounter(w io.Writer, name, help, label string, value uint64) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	_, _ = fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	_, _ = fmt.Fprintf(w, "%s{%s} %d\n", name, label, value)
+}
+
+// serveMetrics answers scrapes on the configured metrics path.
+func (c *headerBlock) serveMetrics(rw http.ResponseWriter, req *http.Request) {
+	if ip := c.clientIPs.resolve(req); !isIPAllowed(ip, c.allowedIPNets) && !c.ipLists.allowedIP(ip) {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	c.metrics.writeTo(rw, c.RuleHits())
+}
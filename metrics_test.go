@@ -0,0 +1,57 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Test"},
+	}
+	cfg.AllowedIPs = []string{"10.0.0.0/8"}
+	cfg.MetricsPath = "/_headerblock/metrics"
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	blocked := httptest.NewRequest(http.MethodGet, "/test", nil)
+	blocked.Header.Set("X-Test", "1")
+	blocked.RemoteAddr = "192.0.2.1:1234"
+	p.ServeHTTP(httptest.NewRecorder(), blocked)
+
+	forbidden := httptest.NewRequest(http.MethodGet, cfg.MetricsPath, nil)
+	forbidden.RemoteAddr = "192.0.2.1:1234"
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, forbidden)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected metrics to be restricted, got %d", rr.Code)
+	}
+
+	scrape := httptest.NewRequest(http.MethodGet, cfg.MetricsPath, nil)
+	scrape.RemoteAddr = "10.0.0.1:1234"
+	rr = httptest.NewRecorder()
+	p.ServeHTTP(rr, scrape)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	for _, line := range []string{
+		`headerblock_requests_evaluated_total{middleware="headerBlock"} 1`,
+		`headerblock_requests_blocked_total{middleware="headerBlock"} 1`,
+		`headerblock_rule_matches_total{middleware="headerBlock",rule="requestHeaders[0]"} 1`,
+		`headerblock_evaluation_seconds_count{middleware="headerBlock"} 1`,
+	} {
+		if !strings.Contains(rr.Body.String(), line) {
+			t.Fatalf("expected metrics to contain %q, got:\n%s", line, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package headerblock
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// mmdbMetadataMarker precedes the metadata section at the end of a MaxMind DB file.
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdbReader is a minimal reader for the MaxMind DB format used by the
+// GeoIP2/GeoLite2 databases. It only supports lookups, which is all the
+// plugin needs, and keeps the whole database in memory.
+type mmdbReader struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	dataStart  uint
+	ipv4Start  uint
+}
+
+func openMMDB(path string) (*mmdbReader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMMDBReader(buf)
+}
+
+func newMMDBReader(buf []byte) (*mmdbReader, error) {
+	markerAt := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if markerAt < 0 {
+		return nil, errors.New("mmdb: metadata marker not found")
+	}
+
+	metadataStart := uint(markerAt + len(mmdbMetadataMarker))
+	metadata, _, err := (&mmdbDecoder{buf: buf[metadataStart:]}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("mmdb: invalid metadata: %w", err)
+	}
+
+	fields, ok := metadata.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("mmdb: metadata is not a map")
+	}
+
+	r := &mmdbReader{
+		buf:        buf,
+		nodeCount:  mmdbUint(fields["node_count"]),
+		recordSize: mmdbUint(fields["record_size"]),
+		ipVersion:  mmdbUint(fields["ip_version"]),
+	}
+
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("mmdb: unsupported record size %d", r.recordSize)
+	}
+
+	treeSize := r.recordSize * 2 / 8 * r.nodeCount
+	r.dataStart = treeSize + 16
+	if r.dataStart > metadataStart {
+		return nil, errors.New("mmdb: search tree exceeds file size")
+	}
+
+	// IPv4 addresses live under ::/96 in IPv6 databases.
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.readRecord(node, 0)
+		}
+		r.ipv4Start = node
+	}
+
+	return r, nil
+}
+
+// lookup returns the record stored for ip, or nil when there is none.
+func (r *mmdbReader) lookup(ip net.IP) (interface{}, error) {
+	node := uint(0)
+	bits := 128
+
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = 32
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else if r.ipVersion == 4 {
+		return nil, nil
+	}
+
+	for i := 0; i < bits && node < r.nodeCount; i++ {
+		bit := (ip[i>>3] >> (7 - uint(i&7))) & 1
+		node = r.readRecord(node, uint(bit))
+	}
+
+	if node <= r.nodeCount {
+		return nil, nil
+	}
+
+	offset := node - r.nodeCount - 16
+	decoder := &mmdbDecoder{buf: r.buf[r.dataStart:]}
+	value, _, err := decoder.decode(offset)
+	return value, err
+}
+
+func (r *mmdbReader) readRecord(node, bit uint) uint {
+	switch r.recordSize {
+	case 24:
+		offset := node*6 + bit*3
+		b := r.buf[offset : offset+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		offset := node * 7
+		b := r.buf[offset : offset+7]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		offset := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(r.buf[offset : offset+4]))
+	}
+}
+
+// mmdbDecoder decodes values of the MaxMind DB data section.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+const (
+	mmdbPointer = 1
+	mmdbString  = 2
+	mmdbDouble  = 3
+	mmdbBytes   = 4
+	mmdbUint16  = 5
+	mmdbUint32  = 6
+	mmdbMap     = 7
+	mmdbInt32   = 8
+	mmdbUint64  = 9
+	mmdbUint128 = 10
+	mmdbArray   = 11
+	mmdbBool    = 14
+	mmdbFloat   = 15
+)
+
+var errMMDBTruncated = errors.New("mmdb: unexpected end of data")
+
+// decode returns the value at offset and the offset right after it.
+func (d *mmdbDecoder) decode(offset uint) (interface{}, uint, error) {
+	if offset >= uint(len(d.buf)) {
+		return nil, 0, errMMDBTruncated
+	}
+
+	ctrl := d.buf[offset]
+	offset++
+	kind := uint(ctrl >> 5)
+
+	if kind == mmdbPointer {
+		pointer, next, err := d.decodePointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer)
+		return value, next, err
+	}
+
+	if kind == 0 {
+		if offset >= uint(len(d.buf)) {
+			return nil, 0, errMMDBTruncated
+		}
+		kind = 7 + uint(d.buf[offset])
+		offset++
+	}
+
+	size, offset, err := d.decodeSize(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch kind {
+	case mmdbMap:
+		value := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			var key, item interface{}
+			if key, offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			if item, offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("mmdb: map key is not a string")
+			}
+			value[name] = item
+		}
+		return value, offset, nil
+
+	case mmdbArray:
+		value := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			var item interface{}
+			if item, offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+			value = append(value, item)
+		}
+		return value, offset, nil
+
+	case mmdbBool:
+		return size != 0, offset, nil
+	}
+
+	end := offset + size
+	if end > uint(len(d.buf)) {
+		return nil, 0, errMMDBTruncated
+	}
+	data := d.buf[offset:end]
+
+	switch kind {
+	case mmdbString:
+		return string(data), end, nil
+	case mmdbBytes:
+		return append([]byte(nil), data...), end, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errors.New("mmdb: invalid double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), end, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errors.New("mmdb: invalid float size")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), end, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbUint128:
+		var value uint64
+		for _, b := range data {
+			value = value<<8 | uint64(b)
+		}
+		return value, end, nil
+	case mmdbInt32:
+		var value uint32
+		for _, b := range data {
+			value = value<<8 | uint32(b)
+		}
+		return int64(int32(value)), end, nil
+	default:
+		return nil, 0, fmt.Errorf("mmdb: unsupported data type %d", kind)
+	}
+}
+
+func (d *mmdbDecoder) decodeSize(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl & 0x1F)
+	if size < 29 {
+		return size, offset, nil
+	}
+
+	extra := size - 28
+	if offset+extra > uint(len(d.buf)) {
+		return 0, 0, errMMDBTruncated
+	}
+
+	var value uint
+	for _, b := range d.buf[offset : offset+extra] {
+		value = value<<8 | uint(b)
+	}
+
+	switch size {
+	case 29:
+		return 29 + value, offset + extra, nil
+	case 30:
+		return 285 + value, offset + extra, nil
+	default:
+		return 65821 + value, offset + extra, nil
+	}
+}
+
+func (d *mmdbDecoder) decodePointer(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint((ctrl>>3)&0x3) + 1
+	if offset+size > uint(len(d.buf)) {
+		return 0, 0, errMMDBTruncated
+	}
+
+	b := d.buf[offset : offset+size]
+	vvv := uint(ctrl & 0x7)
+
+	switch size {
+	case 1:
+		return vvv<<8 | uint(b[0]), offset + size, nil
+	case 2:
+		return (vvv<<16 | uint(b[0])<<8 | uint(b[1])) + 2048, offset + size, nil
+	case 3:
+		return (vvv<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336, offset + size, nil
+	default:
+		return uint(binary.BigEndian.Uint32(b)), offset + size, nil
+	}
+}
+
+// mmdbUint converts a decoded unsigned integer to uint.
+func mmdbUint(value interface{}) uint {
+	if v, ok := value.(uint64); ok {
+		return uint(v)
+	}
+	return 0
+}
+
+// mmdbPath walks nested maps, e.g. mmdbPath(record, "country", "iso_code").
+func mmdbPath(value interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = fields[key]
+	}
+	return value
+}
@@ -0,0 +1,102 @@
+package headerblock_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type mmdbRecord struct {
+	kind  int // 0 empty, 1 node, 2 data
+	value int
+}
+
+// writeTestMMDB builds a small IPv4 MaxMind DB with 24-bit records mapping
+// each CIDR to its data and returns the file path.
+func writeTestMMDB(t *testing.T, networks map[string]map[string]interface{}) string {
+	t.Helper()
+
+	nodes := [][2]mmdbRecord{{}}
+	var data bytes.Buffer
+
+	for cidr, value := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("invalid CIDR %s: %v", cidr, err)
+		}
+		ones, _ := network.Mask.Size()
+		ip := network.IP.To4()
+
+		offset := data.Len()
+		encodeMMDBValue(&data, value)
+
+		node := 0
+		for i := 0; i < ones; i++ {
+			bit := (ip[i/8] >> (7 - uint(i%8))) & 1
+			if i == ones-1 {
+				nodes[node][bit] = mmdbRecord{kind: 2, value: offset}
+				break
+			}
+			if nodes[node][bit].kind != 1 {
+				nodes = append(nodes, [2]mmdbRecord{})
+				nodes[node][bit] = mmdbRecord{kind: 1, value: len(nodes) - 1}
+			}
+			node = nodes[node][bit].value
+		}
+	}
+
+	var file bytes.Buffer
+	nodeCount := len(nodes)
+	for _, node := range nodes {
+		for _, record := range node {
+			value := nodeCount
+			switch record.kind {
+			case 1:
+				value = record.value
+			case 2:
+				value = nodeCount + 16 + record.value
+			}
+			file.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+	file.Write(make([]byte, 16))
+	file.Write(data.Bytes())
+	file.WriteString("\xAB\xCD\xEFMaxMind.com")
+	encodeMMDBValue(&file, map[string]interface{}{
+		"node_count":    uint32(nodeCount),
+		"record_size":   uint16(24),
+		"ip_version":    uint16(4),
+		"database_type": "Test",
+	})
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, file.Bytes(), 0o600); err != nil {
+		t.Fatalf("write mmdb: %v", err)
+	}
+	return path
+}
+
+func encodeMMDBValue(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		buf.WriteByte(2<<5 | byte(len(v)))
+		buf.WriteString(v)
+	case uint16:
+		buf.WriteByte(5<<5 | 2)
+		_ = binary.Write(buf, binary.BigEndian, v)
+	case uint32:
+		buf.WriteByte(6<<5 | 4)
+		_ = binary.Write(buf, binary.BigEndian, v)
+	case map[string]interface{}:
+		buf.WriteByte(7<<5 | byte(len(v)))
+		for key, item := range v {
+			encodeMMDBValue(buf, key)
+			encodeMMDBValue(buf, item)
+		}
+	default:
+		panic("unsupported mmdb test value")
+	}
+}
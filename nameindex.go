@@ -0,0 +1,234 @@
+package headerblock
+
+import (
+	"net/http"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// minPrefilterLiteral is the length of the shortest literal worth scanning
+// for; shorter ones are found in most values anyway.
+const minPrefilterLiteral = 3
+
+// headerIndex selects the request header rules worth trying against a header.
+// Rules whose name pattern only matches one literal header name are tried
+// against that header alone, every other rule against all headers. Rule
+// positions are kept in config order so the first matching rule still wins.
+type headerIndex struct {
+	byName map[string]*candidateSet
+	other  *candidateSet
+}
+
+// candidateSet holds the rules tried against one header. Most value patterns
+// contain a literal every match must contain, like "sqlmap" in
+// "(?i)sqlmap/\\d", or one of a few literals, like "sqlmap" or "nikto" in
+// "sqlmap|nikto". Values are scanned for all of them at once first, so only
+// the rules whose literal occurs and the rules without one run their pattern.
+type candidateSet struct {
+	all []int
+	// literals finds the rules of all whose literal occurs in a value. It is
+	// nil when fewer than two rules have one.
+	literals *literalScanner
+	// filtered reports which rules of all have literals.
+	filtered []bool
+	// rest are the rules of all without a required literal.
+	rest []int
+}
+
+func newHeaderIndex(rules []rule) *headerIndex {
+	// Negated rules fire on values that do not match, so they cannot be
+	// skipped, and the scan only sees the values before decoding and
+	// normalization.
+	literals := make([][]string, len(rules))
+	for i, r := range rules {
+		if r.value != nil && !r.negate && !r.decodeBase64 && len(r.normalize) == 0 {
+			literals[i] = requiredLiterals(r.valueSource)
+		}
+	}
+
+	byName := make(map[string][]int)
+	var other []int
+	for i, r := range rules {
+		if r.literalName == "" {
+			other = append(other, i)
+			continue
+		}
+		byName[r.literalName] = append(byName[r.literalName], i)
+	}
+
+	index := &headerIndex{
+		byName: make(map[string]*candidateSet, len(byName)),
+		other:  newCandidateSet(literals, other),
+	}
+	for name, positions := range byName {
+		positions = append(positions, other...)
+		sort.Ints(positions)
+		index.byName[name] = newCandidateSet(literals, positions)
+	}
+	return index
+}
+
+// newCandidateSet builds the set of the rules at positions. literals holds
+// the required literals of every rule, nil for rules without.
+func newCandidateSet(literals [][]string, positions []int) *candidateSet {
+	set := &candidateSet{all: positions, filtered: make([]bool, len(positions))}
+
+	setLiterals := make([][]string, len(positions))
+	for ordinal, i := range positions {
+		if len(literals[i]) == 0 {
+			set.rest = append(set.rest, i)
+			continue
+		}
+		setLiterals[ordinal] = literals[i]
+		set.filtered[ordinal] = true
+	}
+	// Scanning for a single rule's literals saves too little over running
+	// its pattern.
+	if len(set.all)-len(set.rest) < 2 {
+		set.filtered = nil
+		return set
+	}
+	set.literals = newLiteralScanner(setLiterals)
+	return set
+}
+
+// requiredLiterals returns ASCII literals one of which every match of the
+// value pattern source contains, or nil when there are none worth scanning
+// for.
+func requiredLiterals(source string) []string {
+	re, err := syntax.Parse(source, syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	return requiredLiteralSet(re.Simplify())
+}
+
+func requiredLiteralSet(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		literal := string(re.Rune)
+		if len(literal) < minPrefilterLiteral {
+			return nil
+		}
+		for i := 0; i < len(literal); i++ {
+			if literal[i] >= utf8.RuneSelf {
+				return nil
+			}
+		}
+		return []string{literal}
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiteralSet(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return requiredLiteralSet(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		var best []string
+		for _, sub := range re.Sub {
+			if literals := requiredLiteralSet(sub); betterLiteralSet(literals, best) {
+				best = literals
+			}
+		}
+		return best
+	case syntax.OpAlternate:
+		// Every alternative needs literals of its own.
+		var literals []string
+		for _, sub := range re.Sub {
+			alternative := requiredLiteralSet(sub)
+			if len(alternative) == 0 {
+				return nil
+			}
+			literals = append(literals, alternative...)
+		}
+		return literals
+	}
+	return nil
+}
+
+// betterLiteralSet reports whether a is rarer to find than b: its shortest
+// literal is longer, or it has fewer literals.
+func betterLiteralSet(a, b []string) bool {
+	if len(a) == 0 {
+		return false
+	}
+	if len(b) == 0 {
+		return true
+	}
+	if shortestA, shortestB := shortestLiteral(a), shortestLiteral(b); shortestA != shortestB {
+		return shortestA > shortestB
+	}
+	return len(a) < len(b)
+}
+
+func shortestLiteral(literals []string) int {
+	shortest := len(literals[0])
+	for _, literal := range literals[1:] {
+		if len(literal) < shortest {
+			shortest = len(literal)
+		}
+	}
+	return shortest
+}
+
+// candidates returns the positions of the rules that can match a header.
+func (x *headerIndex) candidates(name string, values []string) []int {
+	set, ok := x.byName[http.CanonicalHeaderKey(name)]
+	if !ok {
+		set = x.other
+	}
+	return set.match(values)
+}
+
+// match returns the rules without literals and the rules whose literal
+// occurs in one of the values, in config order.
+func (s *candidateSet) match(values []string) []int {
+	if s.literals == nil {
+		return s.all
+	}
+	var matched []bool
+	for _, value := range values {
+		matched = s.literals.scan(value, matched)
+	}
+	if matched == nil {
+		return s.rest
+	}
+
+	positions := make([]int, 0, len(s.rest)+1)
+	for ordinal, i := range s.all {
+		if matched[ordinal] || !s.filtered[ordinal] {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
+
+// literalHeaderName returns the canonical header name a name pattern is
+// limited to, or "" when it can match several names. Exact patterns and
+// anchored regular expressions without metacharacters, like "^X-Debug$",
+// are literal.
+func literalHeaderName(pattern, matchType string) string {
+	switch matchType {
+	case matchExact:
+	case matchRegex:
+		pattern = strings.TrimPrefix(pattern, "(?i)")
+		if len(pattern) < 3 || pattern[0] != '^' || pattern[len(pattern)-1] != '$' {
+			return ""
+		}
+		pattern = pattern[1 : len(pattern)-1]
+	default:
+		return ""
+	}
+
+	if pattern == "" {
+		return ""
+	}
+	for i := 0; i < len(pattern); i++ {
+		ch := pattern[i]
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' || ch == '-' || ch == '_') {
+			return ""
+		}
+	}
+	return http.CanonicalHeaderKey(pattern)
+}
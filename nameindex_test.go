@@ -0,0 +1,204 @@
+package headerblock_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+var userAgentRules = []tbua.HeaderConfig{
+	{Name: "^User-Agent$", Value: "sqlmap"},
+	{Name: "^User-Agent$", Value: "nikto", CaseInsensitive: true},
+	{Name: "User-Agent", Value: "python-requests/", MatchType: "prefix"},
+	{Name: "^X-Api-Version$", Value: "^v2\\.", Negate: true},
+	{Value: "<script"},
+}
+
+func TestLiteralNameRules(t *testing.T) {
+	tests := []struct {
+		name           string
+		rules          []tbua.HeaderConfig
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{
+			name:           "AnchoredLiteral",
+			rules:          []tbua.HeaderConfig{{Name: "^X-Debug$"}},
+			headers:        map[string]string{"X-Debug": "1"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "AnchoredLiteralOtherHeader",
+			rules:          []tbua.HeaderConfig{{Name: "^X-Debug$"}},
+			headers:        map[string]string{"X-Debug-Token": "1"},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "CaseSensitiveLiteral",
+			rules:          []tbua.HeaderConfig{{Name: "^x-debug$"}},
+			headers:        map[string]string{"X-Debug": "1"},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "CaseInsensitiveLiteral",
+			rules:          []tbua.HeaderConfig{{Name: "^x-debug$", CaseInsensitive: true}},
+			headers:        map[string]string{"X-Debug": "1"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "PatternRuleKeepsOrder",
+			rules: []tbua.HeaderConfig{
+				{Name: "^X-", Action: "strip"},
+				{Name: "^X-Debug$"},
+			},
+			headers:        map[string]string{"X-Debug": "1"},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name: "ValueOnlyRule",
+			rules: []tbua.HeaderConfig{
+				{Name: "^X-Debug$", Value: "^0$"},
+				{Value: "sqlmap"},
+			},
+			headers:        map[string]string{"X-Debug": "sqlmap"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "CombinedValuesMatch",
+			rules:          userAgentRules,
+			headers:        map[string]string{"User-Agent": "Mozilla/5.0 NIKTO"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "CombinedValuesLiteral",
+			rules:          userAgentRules,
+			headers:        map[string]string{"User-Agent": "python-requests/2.31"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "CombinedValuesNoMatch",
+			rules:          userAgentRules,
+			headers:        map[string]string{"User-Agent": "Mozilla/5.0", "X-Api-Version": "v2.1"},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name: "AlternationWithoutLiteral",
+			rules: append([]tbua.HeaderConfig{
+				{Name: "^User-Agent$", Value: "(?i)masscan|zg/"},
+			}, userAgentRules...),
+			headers:        map[string]string{"User-Agent": "Mozilla/5.0 zg/0.x"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "AlternationLiterals",
+			rules: append([]tbua.HeaderConfig{
+				{Name: "^User-Agent$", Value: "(?i)masscan|zgrab"},
+			}, userAgentRules...),
+			headers:        map[string]string{"User-Agent": "Mozilla/5.0 ZGrab/0.x"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "MatchedLiteralsKeepOrder",
+			rules: append([]tbua.HeaderConfig{
+				{Name: "^User-Agent$", Value: "curl/8", Action: "allow"},
+				{Name: "^User-Agent$", Value: "curl"},
+			}, userAgentRules...),
+			headers:        map[string]string{"User-Agent": "curl/8.5.0"},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "LongSCaseFolding",
+			rules:          userAgentRules,
+			headers:        map[string]string{"User-Agent": "\u017fqlmap"},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name: "LongSCaseInsensitive",
+			rules: append([]tbua.HeaderConfig{
+				{Name: "^User-Agent$", Value: "masscan", CaseInsensitive: true},
+			}, userAgentRules...),
+			headers:        map[string]string{"User-Agent": "ma\u017f\u017fcan"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "UnicodeCaseFolding",
+			rules:          userAgentRules,
+			headers:        map[string]string{"User-Agent": "NI\u212aTO"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "CombinedValuesKeepNegatedRule",
+			rules:          userAgentRules,
+			headers:        map[string]string{"User-Agent": "Mozilla/5.0", "X-Api-Version": "v1"},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.RequestHeaders = tt.rules
+
+			p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+// BenchmarkUserAgentRules measures a long list of bad User-Agent patterns.
+// Clean values contain none of their literals and skip the patterns, values
+// containing one only run the patterns with that literal.
+func BenchmarkUserAgentRules(b *testing.B) {
+	cfg := tbua.CreateConfig()
+	for i := 0; i < 500; i++ {
+		cfg.RequestHeaders = append(cfg.RequestHeaders, tbua.HeaderConfig{
+			Name:            "^User-Agent$",
+			Value:           fmt.Sprintf(`scanbot-%d/\d+\.\d+`, i),
+			CaseInsensitive: i%2 == 0,
+		})
+	}
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		b.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, bench := range []struct {
+		name      string
+		userAgent string
+	}{
+		{name: "CleanValue", userAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"},
+		{name: "ValueWithLiteral", userAgent: "Mozilla/5.0 (compatible; scanbot-1/beta)"},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("User-Agent", bench.userAgent)
+			rr := httptest.NewRecorder()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				p.ServeHTTP(rr, req)
+			}
+			if rr.Code != http.StatusTeapot {
+				b.Fatalf("expected %d, got %d", http.StatusTeapot, rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,5 @@
+//go:build !race
+
+package headerblock_test
+
+const raceEnabled = false
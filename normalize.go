@@ -0,0 +1,124 @@
+package headerblock
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// Normalization steps applied to header values before a rule matches them.
+const (
+	normalizeURLDecode          = "urlDecode"
+	normalizeUnicode            = "unicode"
+	normalizeLowercase          = "lowercase"
+	normalizeCollapseWhitespace = "collapseWhitespace"
+)
+
+// maxURLDecodeRounds bounds the decoding of values encoded several times,
+// like "%2558" for "X".
+const maxURLDecodeRounds = 3
+
+func parseNormalize(raw []string) ([]string, error) {
+	var steps []string
+	for _, entry := range raw {
+		switch step := strings.TrimSpace(entry); strings.ToLower(step) {
+		case "":
+		case strings.ToLower(normalizeURLDecode):
+			steps = append(steps, normalizeURLDecode)
+		case normalizeUnicode:
+			steps = append(steps, normalizeUnicode)
+		case normalizeLowercase:
+			steps = append(steps, normalizeLowercase)
+		case strings.ToLower(normalizeCollapseWhitespace):
+			steps = append(steps, normalizeCollapseWhitespace)
+		default:
+			return nil, fmt.Errorf("unknown step %q", entry)
+		}
+	}
+	return steps, nil
+}
+
+// normalizeValues returns values with every step applied in order.
+func normalizeValues(steps []string, values []string) []string {
+	normalized := make([]string, len(values))
+	for i, value := range values {
+		for _, step := range steps {
+			value = normalizeValue(step, value)
+		}
+		normalized[i] = value
+	}
+	return normalized
+}
+
+func normalizeValue(step, value string) string {
+	switch step {
+	case normalizeURLDecode:
+		for i := 0; i < maxURLDecodeRounds && strings.Contains(value, "%"); i++ {
+			decoded, err := url.PathUnescape(value)
+			if err != nil || decoded == value {
+				break
+			}
+			value = decoded
+		}
+		return value
+	case normalizeUnicode:
+		return strings.Map(foldUnicode, value)
+	case normalizeLowercase:
+		return strings.ToLower(value)
+	default:
+		return strings.Join(strings.Fields(value), " ")
+	}
+}
+
+// base64Encodings are tried in order to decode a token.
+var base64Encodings = []*base64.Encoding{
+	base64.StdEncoding,
+	base64.RawStdEncoding,
+	base64.URLEncoding,
+	base64.RawURLEncoding,
+}
+
+// minBase64TokenLength skips tokens too short to carry a payload.
+const minBase64TokenLength = 8
+
+// appendBase64Decoded returns values followed by the decoded form of every
+// base64 token they contain. Tokens are separated by whitespace, dots and
+// commas, so "Basic <credentials>" and JWT segments are decoded as well.
+func appendBase64Decoded(values []string) []string {
+	all := append([]string(nil), values...)
+	for _, value := range values {
+		tokens := strings.FieldsFunc(value, func(r rune) bool {
+			return unicode.IsSpace(r) || r == '.' || r == ','
+		})
+		for _, token := range tokens {
+			if len(token) < minBase64TokenLength {
+				continue
+			}
+			for _, encoding := range base64Encodings {
+				if decoded, err := encoding.DecodeString(token); err == nil {
+					all = append(all, string(decoded))
+					break
+				}
+			}
+		}
+	}
+	return all
+}
+
+// foldUnicode maps fullwidth forms to their ASCII counterparts and drops
+// invisible format characters such as zero-width spaces, the usual tricks to
+// slip a value past a pattern. Full NFC/NFKC normalization needs tables that
+// are not part of the standard library.
+func foldUnicode(r rune) rune {
+	switch {
+	case r >= 0xFF01 && r <= 0xFF5E:
+		return r - 0xFF01 + '!'
+	case r == 0x3000:
+		return ' '
+	case unicode.Is(unicode.Cf, r):
+		return -1
+	}
+	return r
+}
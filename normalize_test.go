@@ -0,0 +1,102 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name           string
+		normalize      []string
+		value          string
+		expectedStatus int
+	}{
+		{name: "WithoutNormalize", value: "%3Cscript%3E", expectedStatus: http.StatusTeapot},
+		{name: "URLDecode", normalize: []string{"urlDecode"}, value: "%3Cscript%3E", expectedStatus: http.StatusForbidden},
+		{name: "URLDecodeTwice", normalize: []string{"urlDecode"}, value: "%253Cscript%253E", expectedStatus: http.StatusForbidden},
+		{name: "InvalidEncodingKept", normalize: []string{"urlDecode"}, value: "100%", expectedStatus: http.StatusTeapot},
+		{name: "Lowercase", normalize: []string{"lowercase"}, value: "<SCRIPT>", expectedStatus: http.StatusForbidden},
+		{name: "FullwidthUnicode", normalize: []string{"unicode"}, value: "\uff1cscript\uff1e", expectedStatus: http.StatusForbidden},
+		{name: "ZeroWidthUnicode", normalize: []string{"unicode"}, value: "<scr\u200bipt>", expectedStatus: http.StatusForbidden},
+		{name: "CollapseWhitespace", normalize: []string{"collapseWhitespace"}, value: "union \t  select", expectedStatus: http.StatusForbidden},
+		{name: "Pipeline", normalize: []string{"urlDecode", "unicode", "lowercase"}, value: "%EF%BC%9CSCRIPT%EF%BC%9E", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.RequestHeaders = []tbua.HeaderConfig{
+				{Name: "X-Payload", Value: "<script>|union select", Normalize: tt.normalize},
+				{Name: "X-Payload", Value: "^never$"},
+			}
+
+			p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("X-Payload", tt.value)
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestUnknownNormalizeStep(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Payload", Normalize: []string{"base32"}}}
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error for unknown normalize step")
+	}
+}
+
+func TestDecodeBase64(t *testing.T) {
+	tests := []struct {
+		name           string
+		decode         bool
+		value          string
+		expectedStatus int
+	}{
+		{name: "EncodedWithoutDecoding", value: "Basic YWRtaW46JyBPUiAxPTEgLS0=", expectedStatus: http.StatusTeapot},
+		{name: "BasicCredentials", decode: true, value: "Basic YWRtaW46JyBPUiAxPTEgLS0=", expectedStatus: http.StatusForbidden},
+		{name: "JWTSegment", decode: true, value: "Bearer eyJhbGciOiJub25lIn0.eyJzdWIiOiI8c2NyaXB0PiJ9.", expectedStatus: http.StatusForbidden},
+		{name: "PlainValueStillMatched", decode: true, value: "<script>", expectedStatus: http.StatusForbidden},
+		{name: "CleanToken", decode: true, value: "Basic dXNlcjpwYXNzd29yZA==", expectedStatus: http.StatusTeapot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.RequestHeaders = []tbua.HeaderConfig{
+				{Name: "^Authorization$", Value: "<script>|' OR 1=1", DecodeBase64: tt.decode},
+			}
+
+			p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("Authorization", tt.value)
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package headerblock
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pathMatcher matches request paths against prefixes and regular
+// expressions. Entries starting with "^" are regular expressions, every
+// other entry is a path prefix.
+type pathMatcher struct {
+	prefixes []string
+	patterns []*regexp.Regexp
+}
+
+func newPathMatcher(raw []string, field string) (*pathMatcher, error) {
+	matcher := &pathMatcher{}
+	for i, entry := range raw {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.HasPrefix(entry, "^") {
+			pattern, err := regexp.Compile(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d]: %w", field, i, err)
+			}
+			matcher.patterns = append(matcher.patterns, pattern)
+			continue
+		}
+		matcher.prefixes = append(matcher.prefixes, entry)
+	}
+
+	if len(matcher.prefixes) == 0 && len(matcher.patterns) == 0 {
+		return nil, nil
+	}
+	return matcher, nil
+}
+
+// matches reports whether path matches any entry. A nil matcher matches
+// nothing.
+func (m *pathMatcher) matches(path string) bool {
+	if m == nil {
+		return false
+	}
+
+	for _, prefix := range m.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	for _, pattern := range m.patterns {
+		if pattern.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixTrie matches paths against a set of prefixes in a single walk over
+// the path, whatever the number of prefixes.
+type prefixTrie struct {
+	root trieNode
+}
+
+type trieNode struct {
+	children map[byte]*trieNode
+	// terminal marks the end of a prefix.
+	terminal bool
+}
+
+func newPrefixTrie(raw []string, field string) (*prefixTrie, error) {
+	trie := &prefixTrie{}
+	for i, prefix := range raw {
+		prefix = strings.TrimSpace(prefix)
+		if !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("%s[%d]: %q must start with /", field, i, prefix)
+		}
+
+		node := &trie.root
+		for j := 0; j < len(prefix); j++ {
+			child := node.children[prefix[j]]
+			if child == nil {
+				if node.children == nil {
+					node.children = make(map[byte]*trieNode)
+				}
+				child = &trieNode{}
+				node.children[prefix[j]] = child
+			}
+			node = child
+		}
+		node.terminal = true
+	}
+
+	if trie.root.children == nil {
+		return nil, nil
+	}
+	return trie, nil
+}
+
+// matches reports whether path starts with any prefix. A nil trie matches
+// nothing.
+func (t *prefixTrie) matches(path string) bool {
+	if t == nil {
+		return false
+	}
+
+	node := &t.root
+	for i := 0; i < len(path); i++ {
+		if node = node.children[path[i]]; node == nil {
+			return false
+		}
+		if node.terminal {
+			return true
+		}
+	}
+	return false
+}
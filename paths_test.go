@@ -0,0 +1,129 @@
+package headerblock_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestWhitelistPaths(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{name: "Prefix", path: "/.well-known/acme-challenge/token", expectedStatus: http.StatusTeapot},
+		{name: "Regex", path: "/healthz", expectedStatus: http.StatusTeapot},
+		{name: "RegexIsAnchored", path: "/api/healthz", expectedStatus: http.StatusForbidden},
+		{name: "OtherPath", path: "/login", expectedStatus: http.StatusForbidden},
+	}
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Debug"}}
+	cfg.RequiredHeaders = []tbua.HeaderConfig{{Name: "User-Agent"}}
+	cfg.WhitelistPaths = []string{"/.well-known/acme-challenge/", "^/(healthz|readyz)$"}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("X-Debug", "1")
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidWhitelistPath(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.WhitelistPaths = []string{"^/(broken"}
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error for invalid whitelistPaths regex")
+	}
+}
+
+func TestSkipPathPrefixes(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{name: "Prefix", path: "/static/app.js", expectedStatus: http.StatusTeapot},
+		{name: "ShorterPrefixFirst", path: "/healthz/live", expectedStatus: http.StatusTeapot},
+		{name: "PartialPrefix", path: "/stat", expectedStatus: http.StatusForbidden},
+		{name: "OtherPath", path: "/login", expectedStatus: http.StatusForbidden},
+	}
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Debug"}}
+	cfg.ResponseHeaders = []tbua.HeaderConfig{{Name: "X-Powered-By"}}
+	cfg.SkipPathPrefixes = []string{"/static/", "/healthz", "/healthz/live"}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("X-Debug", "1")
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidSkipPathPrefix(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.SkipPathPrefixes = []string{"static/"}
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error for a skipPathPrefixes entry without a leading slash")
+	}
+}
+
+func BenchmarkSkipPathPrefixes(b *testing.B) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Debug"}}
+	for i := 0; i < 1000; i++ {
+		cfg.SkipPathPrefixes = append(cfg.SkipPathPrefixes, fmt.Sprintf("/assets/%d/", i))
+	}
+	cfg.SkipPathPrefixes = append(cfg.SkipPathPrefixes, "/static/")
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		b.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, path := range []string{"/static/js/app.js", "/api/v1/users"} {
+		b.Run(path, func(b *testing.B) {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			rr := httptest.NewRecorder()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				p.ServeHTTP(rr, req)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package headerblock
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Steps of the precedence setting.
+const (
+	precedenceAllowedIPs = "allowedIPs"
+	precedenceWhitelist  = "whitelist"
+	precedenceRules      = "rules"
+)
+
+// defaultPrecedence consults whitelists and allowed clients only once a rule
+// matched.
+var defaultPrecedence = []string{precedenceWhitelist, precedenceAllowedIPs, precedenceRules}
+
+// precedence decides which exemptions are honoured and when.
+type precedence struct {
+	// allowedIPsFirst checks allowedIPs, allowedCountries and allowedASNs
+	// before any request rule is evaluated.
+	allowedIPsFirst bool
+	// allowedIPs and whitelist are false when they come after rules, so a
+	// matching rule is enforced regardless of them.
+	allowedIPs bool
+	whitelist  bool
+}
+
+func parsePrecedence(raw []string) (precedence, error) {
+	if len(raw) == 0 {
+		raw = defaultPrecedence
+	}
+
+	positions := make(map[string]int, len(raw))
+	for i, entry := range raw {
+		var step string
+		for _, known := range []string{precedenceAllowedIPs, precedenceWhitelist, precedenceRules} {
+			if strings.EqualFold(strings.TrimSpace(entry), known) {
+				step = known
+			}
+		}
+		if step == "" {
+			return precedence{}, fmt.Errorf("precedence[%d]: unknown step %q", i, entry)
+		}
+		if _, ok := positions[step]; ok {
+			return precedence{}, fmt.Errorf("precedence[%d]: duplicate step %q", i, entry)
+		}
+		positions[step] = i
+	}
+	if len(positions) != 3 {
+		return precedence{}, fmt.Errorf("precedence: must list %s, %s and %s",
+			precedenceAllowedIPs, precedenceWhitelist, precedenceRules)
+	}
+
+	return precedence{
+		allowedIPsFirst: positions[precedenceAllowedIPs] == 0,
+		allowedIPs:      positions[precedenceAllowedIPs] < positions[precedenceRules],
+		whitelist:       positions[precedenceWhitelist] < positions[precedenceRules],
+	}, nil
+}
@@ -0,0 +1,105 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		name           string
+		precedence     []string
+		remoteAddr     string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{
+			name:           "DefaultAllowedIPBypasses",
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"X-Debug": "1"},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "AllowedIPsFirstSkipsRequiredHeaders",
+			precedence:     []string{"allowedIPs", "whitelist", "rules"},
+			remoteAddr:     "10.0.0.1:1234",
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "AllowedIPsFirstOtherClient",
+			precedence:     []string{"allowedIPs", "whitelist", "rules"},
+			remoteAddr:     "192.0.2.1:1234",
+			headers:        map[string]string{"X-Debug": "1", "X-Client": "1"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "RulesBeforeAllowedIPs",
+			precedence:     []string{"whitelist", "rules", "allowedIPs"},
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"X-Debug": "1", "X-Client": "1"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "RulesBeforeAllowedIPsKeepsWhitelist",
+			precedence:     []string{"whitelist", "rules", "allowedIPs"},
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"X-Debug": "trusted", "X-Client": "1"},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "RulesBeforeWhitelist",
+			precedence:     []string{"allowedIPs", "rules", "whitelist"},
+			remoteAddr:     "192.0.2.1:1234",
+			headers:        map[string]string{"X-Debug": "trusted", "X-Client": "1"},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.AllowedIPs = []string{"10.0.0.0/8"}
+			cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Debug"}}
+			cfg.WhitelistRequestHeaders = []tbua.HeaderConfig{{Name: "X-Debug", Value: "^trusted$"}}
+			cfg.RequiredHeaders = []tbua.HeaderConfig{{Name: "X-Client"}}
+			cfg.Precedence = tt.precedence
+
+			p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidPrecedence(t *testing.T) {
+	for _, precedence := range [][]string{
+		{"allowedIPs", "rules"},
+		{"allowedIPs", "rules", "rules"},
+		{"allowedIPs", "whitelist", "headers"},
+	} {
+		cfg := tbua.CreateConfig()
+		cfg.Precedence = precedence
+
+		if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+			t.Errorf("expected error for precedence %v", precedence)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package headerblock
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// literalScanner finds the rules whose literals occur in a value with an
+// Aho-Corasick automaton, so a value is scanned once however many literals
+// there are. Literals are compared ignoring ASCII case, which covers
+// case-insensitive patterns; for case-sensitive ones it only lets a few more
+// rules run their pattern.
+type literalScanner struct {
+	// classes maps the bytes of the literals, in both cases, to the columns
+	// of next. Every other byte is class 0 and leads back to the root.
+	classes [256]uint8
+	width   int
+	// next is the transition table, width entries per state.
+	next []int32
+	// rules holds the ordinals of the rules whose literal ends at a state,
+	// including through its suffixes.
+	rules [][]int
+	size  int
+}
+
+// newLiteralScanner builds the automaton for the literals of each rule
+// ordinal; ordinals without literals are skipped.
+func newLiteralScanner(literals [][]string) *literalScanner {
+	m := &literalScanner{width: 1, size: len(literals)}
+	for _, ruleLiterals := range literals {
+		for _, literal := range ruleLiterals {
+			for i := 0; i < len(literal); i++ {
+				ch := lowerASCII(literal[i])
+				if m.classes[ch] == 0 {
+					m.classes[ch] = uint8(m.width)
+					m.classes[upperASCII(ch)] = uint8(m.width)
+					m.width++
+				}
+			}
+		}
+	}
+
+	// The trie of the literals, with 0 for missing transitions.
+	m.next = make([]int32, m.width)
+	m.rules = make([][]int, 1)
+	for ordinal, ruleLiterals := range literals {
+		for _, literal := range ruleLiterals {
+			state := int32(0)
+			for i := 0; i < len(literal); i++ {
+				at := int(state)*m.width + int(m.classes[literal[i]])
+				if m.next[at] == 0 {
+					m.next[at] = int32(len(m.rules))
+					m.next = append(m.next, make([]int32, m.width)...)
+					m.rules = append(m.rules, nil)
+				}
+				state = m.next[at]
+			}
+			m.rules[state] = append(m.rules[state], ordinal)
+		}
+	}
+
+	// Breadth first, missing transitions follow the failure link of their
+	// state, which is already complete.
+	fail := make([]int32, len(m.rules))
+	var queue []int32
+	for class := 1; class < m.width; class++ {
+		if child := m.next[class]; child != 0 {
+			queue = append(queue, child)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for class := 1; class < m.width; class++ {
+			at := int(state)*m.width + class
+			fallback := m.next[int(fail[state])*m.width+class]
+			child := m.next[at]
+			if child == 0 {
+				m.next[at] = fallback
+				continue
+			}
+			fail[child] = fallback
+			m.rules[child] = append(m.rules[child], m.rules[fallback]...)
+			queue = append(queue, child)
+		}
+	}
+	return m
+}
+
+// scan marks the ordinals of the rules whose literals occur in value. matched
+// is only allocated once a literal is found.
+func (m *literalScanner) scan(value string, matched []bool) []bool {
+	state := int32(0)
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+		if ch >= utf8.RuneSelf {
+			// Unicode case folding matches the Kelvin sign for k and the
+			// long s for s; no other non-ASCII character folds to ASCII.
+			switch {
+			case strings.HasPrefix(value[i:], "\u212a"):
+				ch = 'k'
+				i += len("\u212a") - 1
+			case strings.HasPrefix(value[i:], "\u017f"):
+				ch = 's'
+				i += len("\u017f") - 1
+			}
+		}
+		state = m.next[int(state)*m.width+int(m.classes[ch])]
+		for _, ordinal := range m.rules[state] {
+			if matched == nil {
+				matched = make([]bool, m.size)
+			}
+			matched[ordinal] = true
+		}
+	}
+	return matched
+}
+
+func lowerASCII(ch byte) byte {
+	if 'A' <= ch && ch <= 'Z' {
+		return ch + 'a' - 'A'
+	}
+	return ch
+}
+
+func upperASCII(ch byte) byte {
+	if 'a' <= ch && ch <= 'z' {
+		return ch - 'a' + 'A'
+	}
+	return ch
+}
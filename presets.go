@@ -0,0 +1,97 @@
+package headerblock
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// presetsVersion identifies the revision of the built-in presets. Bump it
+// whenever a preset rule is added, changed or removed.
+const presetsVersion = "2026.10.2"
+
+// presets are curated requestHeaders rules enabled by name. Rule ids have the
+// form "preset:<preset>:<rule>" so they can be told apart from custom rules
+// and listed in disabledPresetRules.
+var presets = map[string][]HeaderConfig{
+	"scanners": userAgentPreset("scanners", []string{
+		"sqlmap", "nikto", "nmap", "masscan", "zgrab", "nuclei", "wpscan", "dirbuster",
+		"gobuster", "feroxbuster", "ffuf", "wfuzz", "acunetix", "netsparker", "w3af",
+		"openvas", "nessus", "arachni", "skipfish", "whatweb", "jaeles", "commix",
+	}),
+	"badbots": userAgentPreset("badbots", []string{
+		"mj12bot", "blexbot", "dotbot", "seekportbot", "serpstatbot", "dataforseobot",
+		"bytespider", "zoominfobot", "megaindex", "petalbot", "barkrowler", "mauibot",
+	}),
+	"referer-spam": refererPreset("referer-spam", refererSpamDomains),
+	"sqli-headers": {
+		sqliRule("union-select", `(?i)union(\s|/\*.*?\*/|\+)+(all(\s|/\*.*?\*/|\+)+)?select`),
+		sqliRule("tautology", `(?i)['"]\s*(or|and)\s+['"]?\w+['"]?\s*=\s*['"]?\w+`),
+		sqliRule("time-based", `(?i)\b(sleep|benchmark|pg_sleep|waitfor\s+delay)\s*[\('"]`),
+		sqliRule("stacked-query", `(?i);\s*(drop|delete|insert|update|alter|create|exec)\s`),
+		sqliRule("schema-probe", `(?i)\b(information_schema|sysobjects|pg_catalog|sqlite_master)\b`),
+	},
+}
+
+func userAgentPreset(preset string, agents []string) []HeaderConfig {
+	rules := make([]HeaderConfig, 0, len(agents))
+	for _, agent := range agents {
+		rules = append(rules, HeaderConfig{
+			ID:              "preset:" + preset + ":" + agent,
+			Name:            "User-Agent",
+			Value:           agent,
+			MatchType:       matchContains,
+			CaseInsensitive: true,
+		})
+	}
+	return rules
+}
+
+// sqliRule matches the values of every header, decoded first since
+// injections are usually percent-encoded.
+func sqliRule(name, pattern string) HeaderConfig {
+	return HeaderConfig{
+		ID:        "preset:sqli-headers:" + name,
+		Value:     pattern,
+		Normalize: []string{normalizeURLDecode, normalizeUnicode},
+	}
+}
+
+// presetRules returns the rules of the named presets, without the rules
+// listed in disabled.
+func presetRules(names, disabled []string) ([]HeaderConfig, error) {
+	skip := make(map[string]struct{}, len(disabled))
+	for _, id := range disabled {
+		skip[strings.TrimSpace(id)] = struct{}{}
+	}
+
+	var rules []HeaderConfig
+	seen := make(map[string]struct{})
+	for _, raw := range names {
+		name := strings.ToLower(strings.TrimSpace(raw))
+		preset, ok := presets[name]
+		if !ok {
+			return nil, fmt.Errorf("presets: unknown preset %q, available: %s", raw, strings.Join(presetNames(), ", "))
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+
+		for _, rule := range preset {
+			if _, ok := skip[rule.ID]; !ok {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return rules, nil
+}
+
+func presetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,63 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestPresets(t *testing.T) {
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{name: "Browser", headers: map[string]string{"User-Agent": "Mozilla/5.0 (X11; Linux x86_64) Firefox/131.0"}, expectedStatus: http.StatusTeapot},
+		{name: "Scanner", headers: map[string]string{"User-Agent": "sqlmap/1.7.2#stable (https://sqlmap.org)"}, expectedStatus: http.StatusForbidden},
+		{name: "ScannerCase", headers: map[string]string{"User-Agent": "Mozilla/5.00 (Nikto/2.1.6)"}, expectedStatus: http.StatusForbidden},
+		{name: "BadBot", headers: map[string]string{"User-Agent": "Mozilla/5.0 (compatible; MJ12bot/v1.4.8)"}, expectedStatus: http.StatusForbidden},
+		{name: "DisabledRule", headers: map[string]string{"User-Agent": "Mozilla/5.0 (compatible; PetalBot)"}, expectedStatus: http.StatusTeapot},
+		{name: "EncodedUnionSelect", headers: map[string]string{"Referer": "https://example.com/?id=1%20UNION%20ALL%20SELECT%20null"}, expectedStatus: http.StatusForbidden},
+		{name: "Tautology", headers: map[string]string{"X-Forwarded-User": "admin' OR '1'='1"}, expectedStatus: http.StatusForbidden},
+		{name: "CustomRule", headers: map[string]string{"X-Debug": "1"}, expectedStatus: http.StatusForbidden},
+		{name: "PlainHeaders", headers: map[string]string{"Accept": "text/html; q=0.9", "Cookie": "session=abc; theme=dark"}, expectedStatus: http.StatusTeapot},
+	}
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "^X-Debug$"}}
+	cfg.Presets = []string{"scanners", "badbots", "sqli-headers"}
+	cfg.DisabledPresetRules = []string{"preset:badbots:petalbot"}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestUnknownPreset(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.Presets = []string{"scanners", "everything"}
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error for unknown preset")
+	}
+}
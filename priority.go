@@ -0,0 +1,141 @@
+package headerblock
+
+import (
+	"net/http"
+	"sort"
+)
+
+// byPriority orders rules by descending priority. It is used with
+// sort.Stable, so rules of equal priority keep their configured order.
+type byPriority []rule
+
+func (r byPriority) Len() int           { return len(r) }
+func (r byPriority) Less(i, j int) bool { return r[i].priority > r[j].priority }
+func (r byPriority) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// sortRules orders rules by priority in place and returns them.
+func sortRules(rules []rule) []rule {
+	sort.Stable(byPriority(rules))
+	return rules
+}
+
+// headerMatch is a rule that matched a header, identified by its position in
+// the rule list.
+type headerMatch struct {
+	index  int
+	name   string
+	values []string
+}
+
+// byRuleOrder orders matches by rule position, then by header name, so the
+// outcome never depends on the iteration order of the header map.
+type byRuleOrder []headerMatch
+
+func (m byRuleOrder) Len() int { return len(m) }
+func (m byRuleOrder) Less(i, j int) bool {
+	if m[i].index != m[j].index {
+		return m[i].index < m[j].index
+	}
+	return m[i].name < m[j].name
+}
+func (m byRuleOrder) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+
+// headerMatches returns the request header rules matching header, in
+// evaluation order. Matching stops once budget is exceeded.
+func (c *headerBlock) headerMatches(req *http.Request, header http.Header, rules *ruleSet, budget *evaluationBudget) []headerMatch {
+	var matches []headerMatch
+	for name, values := range header {
+		matched, ok := budget.capValues(name, values)
+		if !ok {
+			break
+		}
+		for _, i := range c.matchingRules(rules, name, matched, budget) {
+			if rules.requestHeaderRules[i].appliesTo(req) {
+				matches = append(matches, headerMatch{index: i, name: name, values: values})
+			}
+		}
+	}
+	sort.Sort(byRuleOrder(matches))
+	return matches
+}
+
+// responseHeaderMatches returns the response header rules matching header,
+// in evaluation order.
+func (c *headerBlock) responseHeaderMatches(req *http.Request, header http.Header, rules *ruleSet) []headerMatch {
+	var matches []headerMatch
+	for name, values := range header {
+		for i, blockRule := range rules.responseHeaderRules {
+			if blockRule.appliesTo(req) && applyRule(blockRule, name, values) {
+				matches = append(matches, headerMatch{index: i, name: name, values: values})
+			}
+		}
+	}
+	sort.Sort(byRuleOrder(matches))
+	return matches
+}
+
+// filterRequestHeaders enforces the composite and request header rules from
+// the highest priority down; composite rules go first on equal priority. The
+// first rule that blocks or allows decides, log and tag rules never stop
+// the evaluation. It reports whether the request was denied.
+func (c *headerBlock) filterRequestHeaders(ev *evaluation) bool {
+	rules := ev.rules
+	budget := c.newBudget()
+	matches := c.headerMatches(ev.req, ev.req.Header, rules, budget)
+	if c.checkBudget(ev, budget) {
+		return true
+	}
+	composites := rules.compositeRules
+	var stripped map[string]struct{}
+
+	for len(composites) > 0 || len(matches) > 0 {
+		if len(composites) > 0 && (len(matches) == 0 || composites[0].priority >= rules.requestHeaderRules[matches[0].index].priority) {
+			compositeRule := composites[0]
+			composites = composites[1:]
+			if !compositeRule.appliesTo(ev.req) || !compositeRule.matchesAll(ev.req.Header) {
+				continue
+			}
+			c.hits.inc(compositeRule.id)
+
+			switch c.enforce(ev, compositeRule, logEntry{Rule: compositeRule.id}, "header combination") {
+			case outcomeDenied:
+				return true
+			case outcomeAllow:
+				return false
+			}
+			continue
+		}
+
+		match := matches[0]
+		matches = matches[1:]
+		if _, ok := stripped[match.name]; ok {
+			continue
+		}
+		blockRule := rules.requestHeaderRules[match.index]
+		c.hits.inc(blockRule.id)
+
+		// Header is matched → check whitelist by header/value
+		if c.precedence.whitelist && isWhitelisted(match.name, match.values, ev.ip(), rules.whitelistRequestRules) {
+			if c.log {
+				c.logDecision(ev.req, matchEntry(blockRule, match.name, match.values).withDecision(decisionWhitelisted),
+					"access allowed - whitelisted header %s", match.name)
+			}
+			c.metrics.incWhitelistBypass()
+			continue
+		}
+
+		switch c.enforce(ev, blockRule, matchEntry(blockRule, match.name, match.values), "header "+match.name) {
+		case outcomeDenied:
+			return true
+		case outcomeAllow:
+			return false
+		case outcomeStrip:
+			ev.req.Header.Del(match.name)
+			if stripped == nil {
+				stripped = make(map[string]struct{})
+			}
+			stripped[match.name] = struct{}{}
+		}
+	}
+	return false
+}
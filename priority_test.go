@@ -0,0 +1,98 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestRulePriority(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.Debug = true
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{ID: "block-a", Name: "X-A"},
+		{ID: "block-b", Name: "X-B", Priority: 5},
+		{ID: "block-z", Name: "X-Z"},
+		{ID: "partner", Name: "X-Partner-Key", Value: "^secret$", Action: "allow", Priority: 10},
+		{ID: "internal-combo", All: []tbua.HeaderConfig{{Name: "X-Internal"}, {Name: "X-Z"}}, Action: "allow"},
+	}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		expectedStatus int
+		expectedRule   string
+	}{
+		{name: "higher priority decides", headers: map[string]string{"X-A": "1", "X-B": "1"}, expectedStatus: http.StatusForbidden, expectedRule: "block-b"},
+		{name: "configured order on equal priority", headers: map[string]string{"X-A": "1", "X-Z": "1"}, expectedStatus: http.StatusForbidden, expectedRule: "block-a"},
+		{name: "allow rule skips lower priority", headers: map[string]string{"X-B": "1", "X-Partner-Key": "secret"}, expectedStatus: http.StatusTeapot},
+		{name: "allow rule not matching", headers: map[string]string{"X-B": "1", "X-Partner-Key": "guess"}, expectedStatus: http.StatusForbidden, expectedRule: "block-b"},
+		{name: "composite allow first on equal priority", headers: map[string]string{"X-A": "1", "X-Internal": "1", "X-Z": "1"}, expectedStatus: http.StatusTeapot},
+		{name: "higher priority before composite allow", headers: map[string]string{"X-B": "1", "X-Internal": "1", "X-Z": "1"}, expectedStatus: http.StatusForbidden, expectedRule: "block-b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Header maps iterate in random order, the outcome must not.
+			for range 20 {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				for name, value := range tt.headers {
+					req.Header.Set(name, value)
+				}
+				rr := httptest.NewRecorder()
+				p.ServeHTTP(rr, req)
+
+				if rr.Code != tt.expectedStatus {
+					t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+				}
+				if got := rr.Header().Get("X-HeaderBlock-Rule"); got != tt.expectedRule {
+					t.Fatalf("expected rule %q, got %q", tt.expectedRule, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRulePriorityTagOrder(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{ID: "tag-low", Name: "^X-Tag-", Action: "tag"},
+		{ID: "tag-high", Name: "X-Tag-B", Action: "tag", Priority: 1},
+	}
+
+	next := &noopHandler{}
+	p, err := tbua.New(context.Background(), next, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	expected := []string{"tag-high", "tag-low", "tag-low"}
+	for range 20 {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Tag-B", "1")
+		req.Header.Set("X-Tag-A", "1")
+		p.ServeHTTP(httptest.NewRecorder(), req)
+
+		if got := next.req.Header.Values("X-HeaderBlock-Tag"); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected tags %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestAllowActionOnlyInRequestHeaders(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestCookies = []tbua.HeaderConfig{{Name: "session", Action: "allow"}}
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error for allow action outside requestHeaders")
+	}
+}
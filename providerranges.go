@@ -0,0 +1,219 @@
+package headerblock
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ProviderRangesConfig downloads the IP ranges published by a cloud or CDN
+// provider.
+type ProviderRangesConfig struct {
+	// Provider is cloudflare, fastly, aws or gcp.
+	Provider string `json:"provider,omitempty"`
+	// Use adds the ranges to trustedProxies, allowedIPs or blockedIPs.
+	Use string `json:"use,omitempty"`
+	// Services (aws) and Regions (aws and gcp) keep the matching ranges
+	// only, e.g. CLOUDFRONT or us-east-1.
+	Services []string `json:"services,omitempty"`
+	Regions  []string `json:"regions,omitempty"`
+	// URL replaces the feed of the provider, e.g. with a mirror.
+	URL string `json:"url,omitempty"`
+}
+
+const defaultProviderRangesInterval = 24 * time.Hour
+
+// Uses of provider ranges, named after the settings they extend.
+const (
+	useTrustedProxies = "trustedProxies"
+	useAllowedIPs     = "allowedIPs"
+	useBlockedIPs     = "blockedIPs"
+)
+
+// rangeFilter keeps the ranges of some services and regions. Empty sets keep
+// every range.
+type rangeFilter struct {
+	services map[string]bool
+	regions  map[string]bool
+}
+
+func (f rangeFilter) keeps(service, region string) bool {
+	return (len(f.services) == 0 || f.services[strings.ToUpper(service)]) &&
+		(len(f.regions) == 0 || f.regions[strings.ToLower(region)])
+}
+
+// rangeFeed is the published IP range list of a provider.
+type rangeFeed struct {
+	url   string
+	parse func(data []byte, filter rangeFilter) ([]string, error)
+	// services and regions report whether the feed can be filtered.
+	services bool
+	regions  bool
+}
+
+var rangeFeeds = map[string]rangeFeed{
+	"cloudflare": {url: "https://api.cloudflare.com/client/v4/ips", parse: parseCloudflareRanges},
+	"fastly":     {url: "https://api.fastly.com/public-ip-list", parse: parseFastlyRanges},
+	"aws":        {url: "https://ip-ranges.amazonaws.com/ip-ranges.json", parse: parseAWSRanges, services: true, regions: true},
+	"gcp":        {url: "https://www.gstatic.com/ipranges/cloud.json", parse: parseGCPRanges, regions: true},
+}
+
+// newProviderRangeSources adds the configured provider feeds to sources.
+// They are refreshed every providerRangesInterval and, with
+// providerRangesCacheDir, start from the last download after a restart.
+func newProviderRangeSources(config *Config, sources *ipListSources) error {
+	if len(config.ProviderRanges) == 0 {
+		if config.ProviderRangesInterval != "" || config.ProviderRangesCacheDir != "" {
+			return fmt.Errorf("providerRangesInterval and providerRangesCacheDir: require providerRanges")
+		}
+		return nil
+	}
+
+	sources.feedInterval = defaultProviderRangesInterval
+	if config.ProviderRangesInterval != "" {
+		interval, err := time.ParseDuration(config.ProviderRangesInterval)
+		if err != nil {
+			return fmt.Errorf("providerRangesInterval: %w", err)
+		}
+		sources.feedInterval = interval
+	}
+
+	for i, cfg := range config.ProviderRanges {
+		field := fmt.Sprintf("providerRanges[%d]", i)
+		provider := strings.ToLower(strings.TrimSpace(cfg.Provider))
+		feed, ok := rangeFeeds[provider]
+		if !ok {
+			return fmt.Errorf("%s: unknown provider %q", field, cfg.Provider)
+		}
+		if len(cfg.Services) > 0 && !feed.services {
+			return fmt.Errorf("%s: provider %s has no services", field, provider)
+		}
+		if len(cfg.Regions) > 0 && !feed.regions {
+			return fmt.Errorf("%s: provider %s has no regions", field, provider)
+		}
+
+		filter := rangeFilter{services: make(map[string]bool), regions: make(map[string]bool)}
+		for _, service := range cfg.Services {
+			filter.services[strings.ToUpper(strings.TrimSpace(service))] = true
+		}
+		for _, region := range cfg.Regions {
+			filter.regions[strings.ToLower(strings.TrimSpace(region))] = true
+		}
+
+		source := &ipListSource{
+			field:    field,
+			location: feed.url,
+			remote:   true,
+			parse: func(data []byte) ([]string, error) {
+				return feed.parse(data, filter)
+			},
+		}
+		if cfg.URL != "" {
+			source.location = cfg.URL
+		}
+		if config.ProviderRangesCacheDir != "" {
+			source.cache = filepath.Join(config.ProviderRangesCacheDir, fmt.Sprintf("%s-%d.json", provider, i))
+		}
+		source.list.Store(newIPList())
+
+		switch cfg.Use {
+		case useTrustedProxies:
+			sources.trusted = append(sources.trusted, source)
+		case useAllowedIPs:
+			sources.allowed = append(sources.allowed, source)
+		case useBlockedIPs:
+			sources.blocked = append(sources.blocked, source)
+		default:
+			return fmt.Errorf("%s: use must be %s, %s or %s, got %q", field, useTrustedProxies, useAllowedIPs, useBlockedIPs, cfg.Use)
+		}
+	}
+	return nil
+}
+
+// parseCloudflareRanges reads the response of the Cloudflare IPs API.
+func parseCloudflareRanges(data []byte, _ rangeFilter) ([]string, error) {
+	var feed struct {
+		Result struct {
+			IPv4 []string `json:"ipv4_cidrs"`
+			IPv6 []string `json:"ipv6_cidrs"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(data, &feed); err != nil {
+		return nil, err
+	}
+	return append(feed.Result.IPv4, feed.Result.IPv6...), nil
+}
+
+// parseFastlyRanges reads the Fastly public IP list.
+func parseFastlyRanges(data []byte, _ rangeFilter) ([]string, error) {
+	var feed struct {
+		IPv4 []string `json:"addresses"`
+		IPv6 []string `json:"ipv6_addresses"`
+	}
+	if err := json.Unmarshal(data, &feed); err != nil {
+		return nil, err
+	}
+	return append(feed.IPv4, feed.IPv6...), nil
+}
+
+// parseAWSRanges reads ip-ranges.json of AWS.
+func parseAWSRanges(data []byte, filter rangeFilter) ([]string, error) {
+	var feed struct {
+		IPv4 []struct {
+			Prefix  string `json:"ip_prefix"`
+			Region  string `json:"region"`
+			Service string `json:"service"`
+		} `json:"prefixes"`
+		IPv6 []struct {
+			Prefix  string `json:"ipv6_prefix"`
+			Region  string `json:"region"`
+			Service string `json:"service"`
+		} `json:"ipv6_prefixes"`
+	}
+	if err := json.Unmarshal(data, &feed); err != nil {
+		return nil, err
+	}
+
+	var ranges []string
+	for _, p := range feed.IPv4 {
+		if filter.keeps(p.Service, p.Region) {
+			ranges = append(ranges, p.Prefix)
+		}
+	}
+	for _, p := range feed.IPv6 {
+		if filter.keeps(p.Service, p.Region) {
+			ranges = append(ranges, p.Prefix)
+		}
+	}
+	return ranges, nil
+}
+
+// parseGCPRanges reads cloud.json of Google Cloud, whose scope is the region.
+func parseGCPRanges(data []byte, filter rangeFilter) ([]string, error) {
+	var feed struct {
+		Prefixes []struct {
+			IPv4  string `json:"ipv4Prefix"`
+			IPv6  string `json:"ipv6Prefix"`
+			Scope string `json:"scope"`
+		} `json:"prefixes"`
+	}
+	if err := json.Unmarshal(data, &feed); err != nil {
+		return nil, err
+	}
+
+	var ranges []string
+	for _, p := range feed.Prefixes {
+		if !filter.keeps("", p.Scope) {
+			continue
+		}
+		if p.IPv4 != "" {
+			ranges = append(ranges, p.IPv4)
+		}
+		if p.IPv6 != "" {
+			ranges = append(ranges, p.IPv6)
+		}
+	}
+	return ranges, nil
+}
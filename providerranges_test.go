@@ -0,0 +1,186 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestProviderRangesTrustedProxies(t *testing.T) {
+	feed := &rulesServer{}
+	feed.set(http.StatusOK, `{"result":{"ipv4_cidrs":["198.51.100.0/24"],"ipv6_cidrs":["2001:db8::/32"]},"success":true}`)
+	server := httptest.NewServer(feed)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := tbua.CreateConfig()
+	cfg.BlockedIPs = []string{"203.0.113.7"}
+	cfg.ProviderRanges = []tbua.ProviderRangesConfig{
+		{Provider: "cloudflare", Use: "trustedProxies", URL: server.URL},
+	}
+
+	p, err := tbua.New(ctx, &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	forwarded := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// X-Forwarded-For is honoured once the edge ranges are downloaded.
+	deadline := time.Now().Add(2 * time.Second)
+	for forwarded("198.51.100.9:443") != http.StatusForbidden {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the provider ranges")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if code := forwarded("192.0.2.1:443"); code != http.StatusTeapot {
+		t.Fatalf("expected X-Forwarded-For to be ignored outside the ranges, got %d", code)
+	}
+}
+
+func TestProviderRangesFilters(t *testing.T) {
+	feed := &rulesServer{}
+	feed.set(http.StatusOK, `{
+		"prefixes": [
+			{"ip_prefix": "203.0.113.0/24", "region": "us-east-1", "service": "CLOUDFRONT"},
+			{"ip_prefix": "198.51.100.0/24", "region": "us-east-1", "service": "EC2"},
+			{"ip_prefix": "192.0.2.0/24", "region": "eu-west-1", "service": "CLOUDFRONT"}
+		],
+		"ipv6_prefixes": [
+			{"ipv6_prefix": "2001:db8::/32", "region": "us-east-1", "service": "CLOUDFRONT"}
+		]
+	}`)
+	server := httptest.NewServer(feed)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := tbua.CreateConfig()
+	cfg.BlockedIPsStatusCode = http.StatusUnavailableForLegalReasons
+	cfg.ProviderRanges = []tbua.ProviderRangesConfig{
+		{Provider: "aws", Use: "blockedIPs", Services: []string{"cloudfront"}, Regions: []string{"US-EAST-1"}, URL: server.URL},
+	}
+
+	p, err := tbua.New(ctx, &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	waitForStatusFrom(t, p, "203.0.113.9:1234", http.StatusUnavailableForLegalReasons)
+	for remoteAddr, expected := range map[string]int{
+		"[2001:db8::1]:1234": http.StatusUnavailableForLegalReasons,
+		"198.51.100.9:1234":  http.StatusTeapot,
+		"192.0.2.9:1234":     http.StatusTeapot,
+	} {
+		if code := statusFrom(p, remoteAddr); code != expected {
+			t.Errorf("%s: expected %d, got %d", remoteAddr, expected, code)
+		}
+	}
+}
+
+func TestProviderRangesCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := filepath.Join(dir, "gcp-0.json")
+	if err := os.WriteFile(cache, []byte(`{"prefixes":[{"ipv4Prefix":"203.0.113.0/24","scope":"us-central1"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	feed := &rulesServer{}
+	feed.set(http.StatusInternalServerError, "")
+	server := httptest.NewServer(feed)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := tbua.CreateConfig()
+	cfg.ProviderRanges = []tbua.ProviderRangesConfig{
+		{Provider: "gcp", Use: "blockedIPs", URL: server.URL},
+	}
+	cfg.ProviderRangesInterval = "10ms"
+	cfg.ProviderRangesCacheDir = dir
+
+	p, err := tbua.New(ctx, &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	// The cached ranges apply right away, even though the feed is down.
+	if code := statusFrom(p, "203.0.113.9:1234"); code != http.StatusForbidden {
+		t.Fatalf("expected the cached ranges to apply, got %d", code)
+	}
+
+	// A feed without networks does not replace the ranges.
+	feed.set(http.StatusOK, `{"prefixes":[]}`)
+	time.Sleep(50 * time.Millisecond)
+	if code := statusFrom(p, "203.0.113.9:1234"); code != http.StatusForbidden {
+		t.Fatalf("expected the ranges to survive an empty feed, got %d", code)
+	}
+
+	body := `{"prefixes":[{"ipv6Prefix":"2001:db8::/32","scope":"us-central1"},{"ipv4Prefix":"198.51.100.0/24","scope":"us-central1"}]}`
+	feed.set(http.StatusOK, body)
+	waitForStatusFrom(t, p, "198.51.100.9:1234", http.StatusForbidden)
+	waitForStatusFrom(t, p, "203.0.113.9:1234", http.StatusTeapot)
+
+	data, err := os.ReadFile(cache)
+	if err != nil || string(data) != body {
+		t.Fatalf("expected the download to be cached, got %q (%v)", data, err)
+	}
+}
+
+func TestInvalidProviderRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(cfg *tbua.Config)
+	}{
+		{name: "unknown provider", config: func(cfg *tbua.Config) {
+			cfg.ProviderRanges = []tbua.ProviderRangesConfig{{Provider: "oracle", Use: "allowedIPs"}}
+		}},
+		{name: "unknown use", config: func(cfg *tbua.Config) {
+			cfg.ProviderRanges = []tbua.ProviderRangesConfig{{Provider: "cloudflare", Use: "trusted"}}
+		}},
+		{name: "gcp services", config: func(cfg *tbua.Config) {
+			cfg.ProviderRanges = []tbua.ProviderRangesConfig{{Provider: "gcp", Use: "allowedIPs", Services: []string{"Google Cloud"}}}
+		}},
+		{name: "cloudflare regions", config: func(cfg *tbua.Config) {
+			cfg.ProviderRanges = []tbua.ProviderRangesConfig{{Provider: "cloudflare", Use: "allowedIPs", Regions: []string{"eu"}}}
+		}},
+		{name: "invalid interval", config: func(cfg *tbua.Config) {
+			cfg.ProviderRanges = []tbua.ProviderRangesConfig{{Provider: "fastly", Use: "trustedProxies"}}
+			cfg.ProviderRangesInterval = "daily"
+		}},
+		{name: "cache without ranges", config: func(cfg *tbua.Config) { cfg.ProviderRangesCacheDir = t.TempDir() }},
+		{name: "trusted ranges with proxyDepth", config: func(cfg *tbua.Config) {
+			cfg.ProviderRanges = []tbua.ProviderRangesConfig{{Provider: "fastly", Use: "trustedProxies"}}
+			cfg.ProxyDepth = 1
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			tt.config(cfg)
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected error for invalid providerRanges")
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+//go:build race
+
+package headerblock_test
+
+// raceEnabled reports whether the tests run with the race detector, which
+// allocates on its own and breaks allocation counts.
+const raceEnabled = true
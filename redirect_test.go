@@ -0,0 +1,74 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestRedirectAction(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Scan", Action: "redirect", RedirectURL: "https://example.com/challenge"},
+		{Name: "X-Bot", Action: "redirect", RedirectURL: "/honeypot", RedirectStatusCode: http.StatusTemporaryRedirect},
+	}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	tests := []struct {
+		header           string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{header: "X-Scan", expectedStatus: http.StatusFound, expectedLocation: "https://example.com/challenge"},
+		{header: "X-Bot", expectedStatus: http.StatusTemporaryRedirect, expectedLocation: "/honeypot"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set(tt.header, "1")
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+
+		if rr.Code != tt.expectedStatus {
+			t.Errorf("%s: expected %d, got %d", tt.header, tt.expectedStatus, rr.Code)
+		}
+		if got := rr.Header().Get("Location"); got != tt.expectedLocation {
+			t.Errorf("%s: expected location %q, got %q", tt.header, tt.expectedLocation, got)
+		}
+	}
+}
+
+func TestInvalidRedirectRules(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(*tbua.Config)
+	}{
+		{name: "MissingURL", cfg: func(c *tbua.Config) {
+			c.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Scan", Action: "redirect"}}
+		}},
+		{name: "NotARedirectStatus", cfg: func(c *tbua.Config) {
+			c.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Scan", Action: "redirect", RedirectURL: "/", RedirectStatusCode: 200}}
+		}},
+		{name: "ResponseRule", cfg: func(c *tbua.Config) {
+			c.ResponseHeaders = []tbua.HeaderConfig{{Name: "Server", Action: "redirect", RedirectURL: "/"}}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			tt.cfg(cfg)
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
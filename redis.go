@@ -0,0 +1,353 @@
+package headerblock
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRedisKeyPrefix = "headerblock:"
+	defaultRedisTimeout   = 100 * time.Millisecond
+	// redisPoolSize is the number of idle connections kept for reuse.
+	redisPoolSize = 8
+)
+
+// errRedisUnavailable is returned without contacting Redis while it is
+// backing off after a failure.
+var errRedisUnavailable = errors.New("redis: unavailable, waiting before the next attempt")
+
+// redisReplyError is an error reply of the server. The connection stays
+// usable after it.
+type redisReplyError string
+
+func (e redisReplyError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisConn is a connection of the pool.
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// redisStore shares violation counters and bans between Traefik instances.
+// It speaks the small subset of RESP it needs over a small connection pool
+// so the plugin keeps working without third-party dependencies. After a
+// failure it stops contacting Redis for a growing backoff, then lets a
+// single request probe it again.
+type redisStore struct {
+	address  string
+	password string
+	db       int
+	prefix   string
+	timeout  time.Duration
+
+	mu       sync.Mutex
+	idle     []*redisConn
+	retry    backoff
+	warnings warnLimiter
+}
+
+func newRedisStore(config *Config) (*redisStore, error) {
+	if config.RedisAddress == "" {
+		return nil, nil
+	}
+
+	timeout, err := parsePositiveDuration(config.RedisTimeout, defaultRedisTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("redisTimeout: %w", err)
+	}
+
+	prefix := config.RedisKeyPrefix
+	if prefix == "" {
+		prefix = defaultRedisKeyPrefix
+	}
+
+	return &redisStore{
+		address:  config.RedisAddress,
+		password: config.RedisPassword,
+		db:       config.RedisDB,
+		prefix:   prefix,
+		timeout:  timeout,
+	}, nil
+}
+
+// incr increments key and sets its expiry when the key has none, which is
+// the case for a new key and for a key whose expiry was never set because
+// the PEXPIRE of its first increment failed. The increment and the expiry
+// check run in one transaction, so a key cannot be counted without being
+// checked.
+func (s *redisStore) incr(key string, ttl time.Duration) (int, error) {
+	replies, err := s.transaction([]string{"INCR", s.prefix + key}, []string{"PTTL", s.prefix + key})
+	if err != nil {
+		return 0, err
+	}
+	count, ok := replies[0].(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected INCR reply %v", replies[0])
+	}
+	remaining, ok := replies[1].(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected PTTL reply %v", replies[1])
+	}
+
+	// The increment counted already, so a failing PEXPIRE is only logged;
+	// the next increment sets it again.
+	if remaining == -1 {
+		if err := s.expire(key, ttl); err != nil {
+			s.warnf("failed to set the expiry of %s%s: %v", s.prefix, key, err)
+		}
+	}
+	return int(count), nil
+}
+
+// expire sets the ttl of key.
+func (s *redisStore) expire(key string, ttl time.Duration) error {
+	_, err := s.do("PEXPIRE", s.prefix+key, strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// set stores key with the given ttl.
+func (s *redisStore) set(key string, ttl time.Duration) error {
+	_, err := s.do("SET", s.prefix+key, "1", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// ttl returns how long key lives on, or 0 when it does not exist. Keys
+// without an expiry report -1.
+func (s *redisStore) ttl(key string) (time.Duration, error) {
+	reply, err := s.do("PTTL", s.prefix+key)
+	if err != nil {
+		return 0, err
+	}
+	ms, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected PTTL reply %v", reply)
+	}
+	switch {
+	case ms == -1:
+		return -1, nil
+	case ms < 0:
+		return 0, nil
+	default:
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+}
+
+// do sends one command and returns its reply.
+func (s *redisStore) do(args ...string) (interface{}, error) {
+	replies, err := s.pipeline([][]string{args})
+	if err != nil {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+// transaction runs commands in a MULTI/EXEC block and returns their replies.
+func (s *redisStore) transaction(commands ...[]string) ([]interface{}, error) {
+	pipeline := append(append([][]string{{"MULTI"}}, commands...), []string{"EXEC"})
+	replies, err := s.pipeline(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	results, ok := replies[len(replies)-1].([]interface{})
+	if !ok || len(results) != len(commands) {
+		return nil, fmt.Errorf("redis: unexpected EXEC reply %v", replies[len(replies)-1])
+	}
+	return results, nil
+}
+
+// pipeline sends commands over a pooled connection at once and returns
+// their replies. A connection failing for any other reason than an error
+// reply is closed and starts the backoff.
+func (s *redisStore) pipeline(commands [][]string) ([]interface{}, error) {
+	conn, err := s.acquire(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := conn.roundTrip(commands, s.timeout)
+	var replyErr redisReplyError
+	if err != nil && !errors.As(err, &replyErr) {
+		_ = conn.conn.Close()
+		s.failed(time.Now())
+		return nil, err
+	}
+	s.release(conn)
+	return replies, err
+}
+
+// acquire returns an idle connection or dials a new one. While backing off
+// it fails right away, except for the one caller probing Redis again.
+func (s *redisStore) acquire(now time.Time) (*redisConn, error) {
+	s.mu.Lock()
+	if n := len(s.idle); n > 0 {
+		conn := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return conn, nil
+	}
+	s.mu.Unlock()
+
+	if !s.retry.allow(now) {
+		return nil, errRedisUnavailable
+	}
+	conn, err := s.connect()
+	if err != nil {
+		s.failed(now)
+		return nil, err
+	}
+	s.retry.succeeded()
+	return conn, nil
+}
+
+// release returns conn to the pool, or closes it when the pool is full.
+func (s *redisStore) release(conn *redisConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.idle) < redisPoolSize {
+		s.idle = append(s.idle, conn)
+		return
+	}
+	_ = conn.conn.Close()
+}
+
+// failed starts or extends the backoff and closes the idle connections,
+// which are likely broken as well.
+func (s *redisStore) failed(now time.Time) {
+	s.retry.failed(now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.idle {
+		_ = conn.conn.Close()
+	}
+	s.idle = nil
+}
+
+// warnf logs a fallback to local state at most once per warnInterval.
+func (s *redisStore) warnf(format string, args ...interface{}) {
+	s.warnings.printf(format, args...)
+}
+
+// connect dials the server and authenticates.
+func (s *redisStore) connect() (*redisConn, error) {
+	netConn, err := net.DialTimeout("tcp", s.address, s.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	conn := &redisConn{conn: netConn, reader: bufio.NewReader(netConn)}
+
+	if s.password != "" {
+		if _, err := conn.roundTrip([][]string{{"AUTH", s.password}}, s.timeout); err != nil {
+			_ = netConn.Close()
+			return nil, err
+		}
+	}
+	if s.db != 0 {
+		if _, err := conn.roundTrip([][]string{{"SELECT", strconv.Itoa(s.db)}}, s.timeout); err != nil {
+			_ = netConn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// roundTrip writes commands and reads their replies. Every reply is read
+// even after an error reply, so the connection stays in sync; the first
+// error reply is returned.
+func (c *redisConn) roundTrip(commands [][]string, timeout time.Duration) ([]interface{}, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+
+	var request strings.Builder
+	for _, args := range commands {
+		fmt.Fprintf(&request, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(&request, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if _, err := io.WriteString(c.conn, request.String()); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+
+	return readRESPReplies(c.reader, len(commands))
+}
+
+// readRESPReplies reads count replies, returning the first error reply after
+// reading all of them.
+func readRESPReplies(reader *bufio.Reader, count int) ([]interface{}, error) {
+	replies := make([]interface{}, 0, count)
+	var firstErr error
+	for i := 0; i < count; i++ {
+		reply, err := readRESP(reader)
+		var replyErr redisReplyError
+		if err != nil && !errors.As(err, &replyErr) {
+			return nil, err
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		replies = append(replies, reply)
+	}
+	return replies, firstErr
+}
+
+// readRESP reads a simple string, error, integer, bulk string or array
+// reply.
+func readRESP(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisReplyError(line[1:])
+	case ':':
+		value, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid integer reply %q", line)
+		}
+		return value, nil
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk reply %q", line)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+		return string(data[:size]), nil
+	case '*':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array reply %q", line)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		return readRESPReplies(reader, size)
+	default:
+		return nil, fmt.Errorf("redis: unsupported reply %q", line)
+	}
+}
@@ -0,0 +1,384 @@
+package headerblock_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+// fakeRedis implements the commands the plugin uses. Keys never expire, it
+// only records whether they have an expiry.
+type fakeRedis struct {
+	listener net.Listener
+	mu       sync.Mutex
+	data     map[string]int
+	expiring map[string]bool
+	commands []string
+	// delay is added before every reply.
+	delay time.Duration
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeRedis{listener: listener, data: make(map[string]int), expiring: make(map[string]bool)}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	var queued [][]string
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, strings.Join(args, " "))
+		var reply string
+		switch command := strings.ToUpper(args[0]); {
+		case command == "MULTI":
+			queued = [][]string{}
+			reply = "+OK\r\n"
+		case command == "EXEC":
+			reply = fmt.Sprintf("*%d\r\n", len(queued))
+			for _, args := range queued {
+				reply += s.execute(args)
+			}
+			queued = nil
+		case queued != nil:
+			queued = append(queued, args)
+			reply = "+QUEUED\r\n"
+		default:
+			reply = s.execute(args)
+		}
+		delay := s.delay
+		s.mu.Unlock()
+
+		time.Sleep(delay)
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// execute runs one command and returns its reply. Callers hold mu.
+func (s *fakeRedis) execute(args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "AUTH", "SELECT":
+		return "+OK\r\n"
+	case "SET":
+		s.data[args[1]] = 1
+		s.expiring[args[1]] = len(args) > 3
+		return "+OK\r\n"
+	case "INCR":
+		s.data[args[1]]++
+		return fmt.Sprintf(":%d\r\n", s.data[args[1]])
+	case "PEXPIRE":
+		if _, ok := s.data[args[1]]; !ok {
+			return ":0\r\n"
+		}
+		s.expiring[args[1]] = true
+		return ":1\r\n"
+	case "PTTL":
+		switch _, ok := s.data[args[1]]; {
+		case !ok:
+			return ":-2\r\n"
+		case !s.expiring[args[1]]:
+			return ":-1\r\n"
+		default:
+			return ":60000\r\n"
+		}
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		if _, err := reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, strings.TrimSuffix(arg, "\r\n"))
+	}
+	return args, nil
+}
+
+func (s *fakeRedis) sawCommand(prefix string) bool {
+	return s.countCommands(prefix) > 0
+}
+
+func (s *fakeRedis) countCommands(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, command := range s.commands {
+		if strings.HasPrefix(command, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestRedisSharesBansBetweenInstances(t *testing.T) {
+	redis := newFakeRedis(t)
+
+	newInstance := func() http.Handler {
+		cfg := tbua.CreateConfig()
+		cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Scan"}}
+		cfg.BanThreshold = 1
+		cfg.RedisAddress = redis.listener.Addr().String()
+		cfg.RedisPassword = "secret"
+		cfg.RedisKeyPrefix = "edge:"
+
+		p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+		if err != nil {
+			t.Fatalf("plugin init error: %v", err)
+		}
+		return p
+	}
+	first, second := newInstance(), newInstance()
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Scan", "1")
+	first.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	rr := httptest.NewRecorder()
+	second.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected ban shared by the second instance, got %d", rr.Code)
+	}
+
+	for _, command := range []string{"AUTH secret", "INCR edge:banViolations:192.0.2.1", "SET edge:bans:192.0.2.1 1 PX", "PTTL edge:bans:192.0.2.1"} {
+		if !redis.sawCommand(command) {
+			t.Errorf("expected command %q", command)
+		}
+	}
+}
+
+func TestRedisExpiresKeysWithoutExpiry(t *testing.T) {
+	redis := newFakeRedis(t)
+	// Left behind by an instance that stopped between INCR and PEXPIRE, or
+	// by hand.
+	redis.data["headerblock:violations:192.0.2.1"] = 3
+	redis.data["headerblock:bans:192.0.2.9"] = 1
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Scan"}}
+	cfg.ViolationLimit = 10
+	cfg.BanThreshold = 10
+	cfg.RedisAddress = redis.listener.Addr().String()
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Scan", "1")
+	p.ServeHTTP(httptest.NewRecorder(), req)
+
+	if code := statusFrom(p, "192.0.2.9:1234"); code != http.StatusForbidden {
+		t.Fatalf("expected the stored ban to apply, got %d", code)
+	}
+
+	redis.mu.Lock()
+	defer redis.mu.Unlock()
+	for _, key := range []string{"headerblock:violations:192.0.2.1", "headerblock:bans:192.0.2.9"} {
+		if !redis.expiring[key] {
+			t.Errorf("expected %s to get an expiry", key)
+		}
+	}
+}
+
+func TestRedisUnavailableFallsBackToMemory(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Scan"}}
+	cfg.ViolationLimit = 1
+	cfg.RedisAddress = address
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	codes := make([]int, 0, 2)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Scan", "1")
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+		codes = append(codes, rr.Code)
+	}
+
+	if codes[0] != http.StatusTeapot || codes[1] != http.StatusTooManyRequests {
+		t.Fatalf("expected local violation limit, got %v", codes)
+	}
+}
+
+func TestRedisBanLookupsArePooledAndCached(t *testing.T) {
+	redis := newFakeRedis(t)
+	redis.delay = 50 * time.Millisecond
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Scan"}}
+	cfg.BanThreshold = 1
+	cfg.RedisAddress = redis.listener.Addr().String()
+	cfg.RedisTimeout = "1s"
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	})
+	p, err := tbua.New(context.Background(), next, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	// Concurrent lookups use several connections instead of queueing
+	// behind one.
+	const clients = 8
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statusFrom(p, fmt.Sprintf("192.0.2.%d:1234", i+1))
+		}(i)
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed >= clients*redis.delay/2 {
+		t.Fatalf("expected concurrent lookups, took %s", elapsed)
+	}
+
+	// The ban state of a client is read once per cache period.
+	statusFrom(p, "192.0.2.1:1234")
+	if count := redis.countCommands("PTTL headerblock:bans:192.0.2.1"); count != 1 {
+		t.Fatalf("expected one PTTL for the client, got %d", count)
+	}
+}
+
+func TestRedisOutageBacksOff(t *testing.T) {
+	// The listener accepts connections but never replies, so every command
+	// runs into redisTimeout.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu    sync.Mutex
+		conns []net.Conn
+	)
+	t.Cleanup(func() {
+		_ = listener.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+
+	var buf lockedBuffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Scan"}}
+	cfg.BanThreshold = 5
+	cfg.RedisAddress = listener.Addr().String()
+	cfg.RedisTimeout = "50ms"
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		if code := statusFrom(p, "192.0.2.1:1234"); code != http.StatusTeapot {
+			t.Fatalf("expected the request to pass, got %d", code)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("expected requests to skip Redis while it is down, took %s", elapsed)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(conns) != 1 {
+		t.Fatalf("expected a single connection attempt, got %d", len(conns))
+	}
+	if count := strings.Count(buf.String(), "falling back to local bans"); count != 1 {
+		t.Fatalf("expected one fallback warning, got %d:\n%s", count, buf.String())
+	}
+}
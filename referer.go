@@ -0,0 +1,98 @@
+package headerblock
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// refererSpamDomains are well-known referer spam domains blocked by the
+// referer-spam preset, including their subdomains.
+var refererSpamDomains = []string{
+	"semalt.com", "buttons-for-website.com", "best-seo-offer.com", "darodar.com",
+	"ilovevitaly.com", "priceg.com", "hulfingtonpost.com", "social-buttons.com",
+	"free-share-buttons.com", "simple-share-buttons.com", "floating-share-buttons.com",
+	"4webmasters.org", "trafficmonetize.com", "get-free-traffic-now.com", "makemoneyonline.com",
+}
+
+// refererPreset builds the rules of the referer-spam preset.
+func refererPreset(preset string, domains []string) []HeaderConfig {
+	rules := make([]HeaderConfig, 0, len(domains))
+	for _, domain := range domains {
+		rules = append(rules, refererRule("preset:"+preset+":"+domain, domain))
+	}
+	return rules
+}
+
+// refererRule matches Referer URLs whose host is domain or one of its
+// subdomains.
+func refererRule(id, domain string) HeaderConfig {
+	return HeaderConfig{
+		ID:    id,
+		Name:  "^Referer$",
+		Value: `(?i)^[a-z][a-z0-9+.-]*://([^/?#@]*@)?([^/?#:]*\.)?` + regexp.QuoteMeta(domain) + `\.?(:\d+)?([/?#]|$)`,
+	}
+}
+
+// refererRules returns the rules of blockedRefererDomains followed by the
+// preset rules. allowedRefererDomains exempts the blocked domains and the
+// referer-spam preset.
+func refererRules(config *Config, preset []HeaderConfig) ([]HeaderConfig, error) {
+	blocked, err := parseRefererDomains(config.BlockedRefererDomains, "blockedRefererDomains")
+	if err != nil {
+		return nil, err
+	}
+	allowed, err := parseRefererDomains(config.AllowedRefererDomains, "allowedRefererDomains")
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]HeaderConfig, 0, len(blocked)+len(preset))
+	for i, domain := range blocked {
+		blockedRule := refererRule(fmt.Sprintf("blockedRefererDomains[%d]", i), domain)
+		blockedRule.AllowedRefererDomains = allowed
+		rules = append(rules, blockedRule)
+	}
+	for _, presetRule := range preset {
+		if strings.HasPrefix(presetRule.ID, "preset:referer-spam:") {
+			presetRule.AllowedRefererDomains = allowed
+		}
+		rules = append(rules, presetRule)
+	}
+	return rules, nil
+}
+
+// parseRefererDomains lowercases domains and removes a leading "*." or ".",
+// since subdomains always match.
+func parseRefererDomains(raw []string, field string) ([]string, error) {
+	domains := make([]string, 0, len(raw))
+	for _, domain := range raw {
+		domain = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "*"), ".")
+		if domain == "" || strings.ContainsAny(domain, "/:@?# *") {
+			return nil, fmt.Errorf("%s: invalid domain %q", field, domain)
+		}
+		domains = append(domains, domain)
+	}
+	return domains, nil
+}
+
+// refererFrom reports whether the Referer of req points to one of domains or
+// their subdomains.
+func refererFrom(req *http.Request, domains []string) bool {
+	referer, err := url.Parse(req.Header.Get("Referer"))
+	if err != nil {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(referer.Hostname()), ".")
+	if host == "" {
+		return false
+	}
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestRefererRules(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.Presets = []string{"referer-spam"}
+	cfg.BlockedRefererDomains = []string{"*.blogspot.example", "spam.example"}
+	cfg.AllowedRefererDomains = []string{"friend.blogspot.example"}
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "^Referer$", PathRegex: `\.(png|jpg)$`, AllowedRefererDomains: []string{"example.com"}},
+	}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		referer        string
+		expectedStatus int
+	}{
+		{name: "no referer", path: "/", expectedStatus: http.StatusTeapot},
+		{name: "preset domain", path: "/", referer: "http://semalt.com/crawler.php?u=x", expectedStatus: http.StatusForbidden},
+		{name: "preset subdomain", path: "/", referer: "https://www.Semalt.com", expectedStatus: http.StatusForbidden},
+		{name: "lookalike domain", path: "/", referer: "https://notsemalt.com/", expectedStatus: http.StatusTeapot},
+		{name: "domain in path", path: "/", referer: "https://example.org/semalt.com", expectedStatus: http.StatusTeapot},
+		{name: "custom domain", path: "/", referer: "https://spam.example:8443/", expectedStatus: http.StatusForbidden},
+		{name: "custom wildcard", path: "/", referer: "https://someone.blogspot.example/post", expectedStatus: http.StatusForbidden},
+		{name: "allowed subdomain", path: "/", referer: "https://friend.blogspot.example/post", expectedStatus: http.StatusTeapot},
+		{name: "hotlink", path: "/logo.png", referer: "https://forum.example.org/thread", expectedStatus: http.StatusForbidden},
+		{name: "own page embed", path: "/logo.png", referer: "https://www.example.com/", expectedStatus: http.StatusTeapot},
+		{name: "direct image", path: "/logo.png", expectedStatus: http.StatusTeapot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.referer != "" {
+				req.Header.Set("Referer", tt.referer)
+			}
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidRefererDomains(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(cfg *tbua.Config)
+	}{
+		{
+			name:   "url instead of domain",
+			config: func(cfg *tbua.Config) { cfg.BlockedRefererDomains = []string{"https://spam.example/"} },
+		},
+		{
+			name:   "empty allowed domain",
+			config: func(cfg *tbua.Config) { cfg.AllowedRefererDomains = []string{" "} },
+		},
+		{
+			name: "rule domain with port",
+			config: func(cfg *tbua.Config) {
+				cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "^Referer$", AllowedRefererDomains: []string{"example.com:443"}}}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			tt.config(cfg)
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected error for invalid referer domains")
+			}
+		})
+	}
+}
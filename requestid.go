@@ -0,0 +1,76 @@
+package headerblock
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// defaultRequestIDHeader carries the request id, e.g. set by a load balancer
+// in front of Traefik.
+const defaultRequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength bounds reused request ids so clients cannot flood the
+// logs through them.
+const maxRequestIDLength = 128
+
+// parseRequestIDHeader returns the header carrying request ids, empty when
+// requestID is disabled.
+func parseRequestIDHeader(config *Config) (string, error) {
+	name := strings.TrimSpace(config.RequestIDHeader)
+	if !config.RequestID {
+		if name != "" {
+			return "", errors.New("requestIDHeader: requires requestID")
+		}
+		return "", nil
+	}
+
+	if name == "" {
+		return defaultRequestIDHeader, nil
+	}
+	if !validHeaderName(name, false) {
+		return "", fmt.Errorf("requestIDHeader: invalid header name %q", config.RequestIDHeader)
+	}
+	return http.CanonicalHeaderKey(name), nil
+}
+
+// ensureRequestID reuses the request id sent by the client or a proxy in
+// front, or sets a new one, so the backend sees the same id as the logs.
+func (c *headerBlock) ensureRequestID(req *http.Request) {
+	if validRequestID(req.Header.Get(c.requestIDHeader)) {
+		return
+	}
+	req.Header.Set(c.requestIDHeader, newRequestID())
+}
+
+// requestID returns the request id of req, empty when requestID is disabled.
+func (c *headerBlock) requestID(req *http.Request) string {
+	if c.requestIDHeader == "" {
+		return ""
+	}
+	return req.Header.Get(c.requestIDHeader)
+}
+
+// validRequestID reports whether id is short and made of visible ASCII
+// characters, so it is safe to echo in logs and response headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns 16 random bytes in hex.
+func newRequestID() string {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,183 @@
+package headerblock_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestRequestID(t *testing.T) {
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+	tests := []struct {
+		name     string
+		header   string
+		sent     string
+		block    bool
+		expected string
+	}{
+		{name: "reused on denial", sent: "lb-1234", block: true, expected: "lb-1234"},
+		{name: "generated on denial", block: true},
+		{name: "generated for backend"},
+		{name: "reused for backend", sent: "lb-1234", expected: "lb-1234"},
+		{name: "invalid id replaced", sent: "bad id", block: true},
+		{name: "custom header", header: "X-Correlation-Id", sent: "c-42", block: true, expected: "c-42"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			header := tt.header
+			if header == "" {
+				header = "X-Request-Id"
+			}
+
+			cfg := tbua.CreateConfig()
+			cfg.RequestHeaders = []tbua.HeaderConfig{
+				{Name: "X-Scan"},
+			}
+			cfg.Log = true
+			cfg.LogFormat = "json"
+			cfg.RequestID = true
+			cfg.RequestIDHeader = tt.header
+
+			next := &noopHandler{}
+			p, err := tbua.New(context.Background(), next, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.sent != "" {
+				req.Header.Set(header, tt.sent)
+			}
+			if tt.block {
+				req.Header.Set("X-Scan", "1")
+			}
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			var id string
+			if tt.block {
+				if rr.Code != http.StatusForbidden {
+					t.Fatalf("expected 403, got %d", rr.Code)
+				}
+				id = rr.Header().Get(header)
+
+				var entry map[string]string
+				if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+					t.Fatalf("log line is not JSON: %v: %q", err, buf.String())
+				}
+				if entry["requestID"] != id {
+					t.Fatalf("expected logged request id %q, got %q", id, entry["requestID"])
+				}
+			} else {
+				if next.req == nil {
+					t.Fatal("expected the request to reach the backend")
+				}
+				id = next.req.Header.Get(header)
+			}
+
+			if tt.expected != "" && id != tt.expected {
+				t.Fatalf("expected request id %q, got %q", tt.expected, id)
+			}
+			if tt.expected == "" && !generated.MatchString(id) {
+				t.Fatalf("expected a generated request id, got %q", id)
+			}
+		})
+	}
+}
+
+func TestRequestIDInTextLog(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Scan"},
+	}
+	cfg.Log = true
+	cfg.RequestID = true
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Scan", "1")
+	req.Header.Set("X-Request-Id", "lb-1234")
+	p.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.Contains(buf.String(), "(request lb-1234)") {
+		t.Fatalf("expected the request id in the log line, got %q", buf.String())
+	}
+}
+
+func TestRequestIDOnDenyPage(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Scan"},
+	}
+	cfg.RequestID = true
+	cfg.DenyJSONBody = `{"requestID": "{{.RequestID}}"}`
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Scan", "1")
+	req.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, req)
+
+	expected := `{"requestID": "` + rr.Header().Get("X-Request-Id") + `"}`
+	if rr.Body.String() != expected {
+		t.Fatalf("expected body %s, got %s", expected, rr.Body.String())
+	}
+}
+
+func TestInvalidRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(cfg *tbua.Config)
+	}{
+		{
+			name:   "header without requestID",
+			config: func(cfg *tbua.Config) { cfg.RequestIDHeader = "X-Correlation-Id" },
+		},
+		{
+			name: "invalid header name",
+			config: func(cfg *tbua.Config) {
+				cfg.RequestID = true
+				cfg.RequestIDHeader = "X Request"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			tt.config(cfg)
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected error for invalid request id configuration")
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package headerblock
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// errUpgradeDenied is returned by Hijack when the response header rules deny
+// an upgrade response.
+var errUpgradeDenied = errors.New("headerblock: upgrade response denied")
+
+// responseWriter applies the response header rules right before the
+// upstream status line and headers are sent to the client.
+type responseWriter struct {
+	http.ResponseWriter
+	plugin      *headerBlock
+	req         *http.Request
+	rules       *ruleSet
+	wroteHeader bool
+	blocked     bool
+}
+
+func (r *responseWriter) WriteHeader(code int) {
+	if r.wroteHeader {
+		return
+	}
+	// Informational responses such as 103 Early Hints precede the final one,
+	// which is the one the rules apply to. 101 Switching Protocols is final.
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		r.ResponseWriter.WriteHeader(code)
+		return
+	}
+	r.wroteHeader = true
+
+	if entry, blockRule := r.plugin.filterResponseHeaders(r.req, r.Header(), r.rules); blockRule != nil {
+		r.deny(entry, blockRule)
+		return
+	}
+
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// deny replaces the upstream response with the deny response of blockRule.
+func (r *responseWriter) deny(entry logEntry, blockRule *rule) {
+	r.blocked = true
+	for name := range r.Header() {
+		delete(r.Header(), name)
+	}
+	r.plugin.denyWith(r.ResponseWriter, r.req, blockRule.denyStatus(r.plugin.denyStatusCode), entry, blockRule)
+}
+
+func (r *responseWriter) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+
+	// The upstream body is discarded once the response has been replaced.
+	if r.blocked {
+		return len(b), nil
+	}
+
+	return r.ResponseWriter.Write(b)
+}
+
+// Hijack implements http.Hijacker so WebSocket and other upgrades keep
+// working. The response header rules are applied to the upgrade response
+// first; once hijacked, the connection belongs to the upstream handler and the
+// middleware never touches it again.
+func (r *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if !r.wroteHeader {
+		r.wroteHeader = true
+		if entry, blockRule := r.plugin.filterResponseHeaders(r.req, r.Header(), r.rules); blockRule != nil {
+			r.deny(entry, blockRule)
+			return nil, nil, errUpgradeDenied
+		}
+	}
+	if r.blocked {
+		return nil, nil, errUpgradeDenied
+	}
+
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// set deadlines.
+func (r *responseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Flush implements http.Flusher so streaming backends keep working.
+func (r *responseWriter) Flush() {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok && !r.blocked {
+		flusher.Flush()
+	}
+}
+
+// filterResponseHeaders applies the response header rules to header and
+// returns the block rule that matched, if any, along with its log entry.
+func (c *headerBlock) filterResponseHeaders(req *http.Request, header http.Header, rules *ruleSet) (logEntry, *rule) {
+	var (
+		tags     []string
+		stripped map[string]struct{}
+	)
+	for _, match := range c.responseHeaderMatches(req, header, rules) {
+		name, values := match.name, match.values
+		if _, ok := stripped[name]; ok {
+			continue
+		}
+		blockRule := rules.responseHeaderRules[match.index]
+		c.hits.inc(blockRule.id)
+
+		if c.precedence.whitelist && isWhitelisted(name, values, c.clientIPs.resolve(req), rules.whitelistResponseRules) {
+			if c.log {
+				c.logDecision(req, matchEntry(blockRule, name, values).withDecision(decisionWhitelisted),
+					"response allowed - whitelisted header %s", name)
+			}
+			c.metrics.incWhitelistBypass()
+			continue
+		}
+
+		if c.dryRun || blockRule.dryRun {
+			c.logDecision(req, matchEntry(blockRule, name, values).withDecision(decisionDryRun),
+				"dry-run - would %s response header %s (rule %s)", blockRule.action, name, blockRule.id)
+			continue
+		}
+
+		switch blockRule.action {
+		case actionLog:
+			c.logDecision(req, matchEntry(blockRule, name, values).withDecision(decisionLogged),
+				"response header %s matched rule %s", name, blockRule.id)
+
+		case actionTag:
+			if c.log {
+				c.logDecision(req, matchEntry(blockRule, name, values).withDecision(decisionTagged),
+					"response tagged by rule %s on header %s", blockRule.id, name)
+			}
+			tags = append(tags, blockRule.id)
+
+		case actionStrip:
+			if c.log {
+				c.logDecision(req, matchEntry(blockRule, name, values).withDecision(decisionStripped),
+					"response header %s stripped", name)
+			}
+			header.Del(name)
+			if stripped == nil {
+				stripped = make(map[string]struct{})
+			}
+			stripped[name] = struct{}{}
+
+		default:
+			entry := matchEntry(blockRule, name, values).withDecision(decisionDenied)
+			if c.log {
+				c.logDecision(req, entry, "response denied - blocked header %s", name)
+			}
+			c.recordBlock(req, entry)
+			return entry, &rules.responseHeaderRules[match.index]
+		}
+	}
+
+	for _, tag := range tags {
+		header.Add(c.tagHeader, tag)
+	}
+
+	return logEntry{}, nil
+}
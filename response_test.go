@@ -0,0 +1,137 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+type upstreamHandler struct {
+	headers map[string]string
+}
+
+func (u upstreamHandler) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+	for k, v := range u.headers {
+		rw.Header().Set(k, v)
+	}
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write([]byte("upstream body"))
+}
+
+func TestResponseHeaders(t *testing.T) {
+	tests := []struct {
+		name           string
+		rules          []tbua.HeaderConfig
+		whitelist      []tbua.HeaderConfig
+		headers        map[string]string
+		expectedStatus int
+		expectedBody   string
+		strippedHeader string
+	}{
+		{
+			name:           "StripServerHeader",
+			rules:          []tbua.HeaderConfig{{Name: "^(Server|X-Powered-By)$", Action: "strip"}},
+			headers:        map[string]string{"Server": "nginx", "X-Powered-By": "PHP"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "upstream body",
+			strippedHeader: "X-Powered-By",
+		},
+		{
+			name:           "BlockLeakingResponse",
+			rules:          []tbua.HeaderConfig{{Name: "X-Debug-Trace"}},
+			headers:        map[string]string{"X-Debug-Trace": "stack"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "WhitelistedResponseHeader",
+			rules:          []tbua.HeaderConfig{{Name: "Server"}},
+			whitelist:      []tbua.HeaderConfig{{Name: "Server", Value: "^traefik$"}},
+			headers:        map[string]string{"Server": "traefik"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "upstream body",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.ResponseHeaders = tt.rules
+			cfg.WhitelistResponseHeaders = tt.whitelist
+
+			p, err := tbua.New(context.Background(), upstreamHandler{headers: tt.headers}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Body.String() != tt.expectedBody {
+				t.Fatalf("expected body %q, got %q", tt.expectedBody, rr.Body.String())
+			}
+			if tt.strippedHeader != "" && rr.Header().Get(tt.strippedHeader) != "" {
+				t.Fatalf("expected header %s to be stripped", tt.strippedHeader)
+			}
+		})
+	}
+}
+
+func TestResponseHeadersAfterEarlyHints(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.ResponseHeaders = []tbua.HeaderConfig{{Name: "X-Powered-By", Action: "strip"}}
+
+	upstream := http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		rw.WriteHeader(http.StatusEarlyHints)
+
+		if err := http.NewResponseController(rw).SetWriteDeadline(time.Now().Add(time.Minute)); err != nil {
+			t.Errorf("SetWriteDeadline through the middleware: %v", err)
+		}
+		rw.Header().Set("X-Powered-By", "PHP")
+		rw.WriteHeader(http.StatusOK)
+		_, _ = rw.Write([]byte("upstream body"))
+	})
+
+	p, err := tbua.New(context.Background(), upstream, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+	server := httptest.NewServer(p)
+	defer server.Close()
+
+	var hints []int
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, _ textproto.MIMEHeader) error {
+			hints = append(hints, code)
+			return nil
+		},
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if len(hints) != 1 || hints[0] != http.StatusEarlyHints {
+		t.Fatalf("expected one 103 response, got %v", hints)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if resp.Header.Get("X-Powered-By") != "" {
+		t.Fatal("expected X-Powered-By to be stripped from the final response")
+	}
+}
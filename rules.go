@@ -0,0 +1,524 @@
+package headerblock
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// actionBlock denies the request when the rule matches.
+	actionBlock = "block"
+	// actionStrip removes the matched header and forwards the request.
+	actionStrip = "strip"
+	// actionLog only logs the match and forwards the request.
+	actionLog = "log"
+	// actionTag adds the rule id to the tag header for downstream middlewares.
+	actionTag = "tag"
+	// actionTarpit denies the request after tarpitDelay.
+	actionTarpit = "tarpit"
+	// actionRedirect redirects the request to the rule's redirectURL.
+	actionRedirect = "redirect"
+	// actionAllow skips the request header rules of lower priority.
+	actionAllow = "allow"
+	// actionBan denies the request and bans the client for banDuration.
+	actionBan = "ban"
+)
+
+// rule is the compiled form of a HeaderConfig.
+type rule struct {
+	id   string
+	name matcher
+	// literalName is the canonical header name the name pattern is limited
+	// to, or empty when it can match several names.
+	literalName string
+	value       matcher
+	// valueSource is the value pattern as a regular expression, used to
+	// find the literals the header index scans values for.
+	valueSource   string
+	action        string
+	dryRun        bool
+	allowedIPNets ipList
+	sourceIPNets  ipList
+	negate        bool
+	// conflicting rules match headers sent with differing values.
+	conflicting bool
+	// emptyValue rules match headers sent with an empty value.
+	emptyValue bool
+	// maxOccurrences rules match headers sent more often than this.
+	maxOccurrences int
+	// normalize are the steps applied to values before value matches them.
+	normalize []string
+	// decodeBase64 also matches value against decoded base64 tokens.
+	decodeBase64 bool
+	path         *regexp.Regexp
+	host         *regexp.Regexp
+	// refererDomains exempt requests with a Referer from these domains.
+	refererDomains []string
+	// schedule limits the rule to a time window, nil when always active.
+	schedule *schedule
+	// expiresAt is when the rule stops matching, zero for never.
+	expiresAt time.Time
+	// conditions of a composite rule, which matches when all of them match.
+	conditions []rule
+	// absent makes a condition match when no header matches its name.
+	absent bool
+	// redirectURL and redirectStatusCode are set for redirect rules.
+	redirectURL        string
+	redirectStatusCode int
+	// priority orders the rules of a section, highest first.
+	priority int
+	// disabled rules are validated but dropped from the rule set.
+	disabled bool
+	// statusCode, denyBody and denyHeaders override the deny response.
+	statusCode  int
+	denyBody    []byte
+	denyHeaders http.Header
+	// severity is the severity the action was mapped from, if any.
+	severity string
+}
+
+// prepareRules compiles the rules of one config section. Every invalid
+// field is collected so a single error reports all of them at once.
+func prepareRules(headerConfig []HeaderConfig, section string, logEnabled bool) ([]rule, error) {
+	headerRules := make([]rule, 0)
+	var problems []string
+
+	for i, requestHeader := range headerConfig {
+		requestRule := rule{
+			id:             ruleID(requestHeader, section, i),
+			dryRun:         requestHeader.DryRun,
+			negate:         requestHeader.Negate,
+			conflicting:    requestHeader.Conflicting,
+			emptyValue:     requestHeader.BlockEmptyValue,
+			decodeBase64:   requestHeader.DecodeBase64,
+			maxOccurrences: requestHeader.MaxOccurrences,
+			priority:       requestHeader.Priority,
+			disabled:       requestHeader.Enabled != nil && !*requestHeader.Enabled,
+			severity:       requestHeader.Severity,
+		}
+		requestRule.allowedIPNets = parseIPNets(requestHeader.AllowedIPs, requestRule.id+".allowedIPs", logEnabled)
+		requestRule.sourceIPNets = parseIPNets(requestHeader.SourceIPs, requestRule.id+".sourceIPs", logEnabled)
+		matchType, err := parseMatchType(requestHeader.MatchType)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s.matchType: %v", requestRule.id, err))
+			matchType = matchRegex
+		}
+		if len(requestHeader.Name) > 0 {
+			if requestRule.name, err = compileMatcher(requestHeader.Name, matchType, requestHeader.CaseInsensitive, true); err != nil {
+				problems = append(problems, fmt.Sprintf("%s.name: %v", requestRule.id, err))
+			}
+			requestRule.literalName = literalHeaderName(requestHeader.Name, matchType)
+		}
+		if len(requestHeader.Value) > 0 {
+			if requestRule.value, err = compileMatcher(requestHeader.Value, matchType, requestHeader.CaseInsensitive, false); err != nil {
+				problems = append(problems, fmt.Sprintf("%s.value: %v", requestRule.id, err))
+			}
+			requestRule.valueSource = regexSource(requestHeader.Value, matchType, requestHeader.CaseInsensitive)
+		}
+		if requestRule.normalize, err = parseNormalize(requestHeader.Normalize); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.normalize: %v", requestRule.id, err))
+		}
+		if len(requestHeader.PathRegex) > 0 {
+			if requestRule.path, err = regexp.Compile(requestHeader.PathRegex); err != nil {
+				problems = append(problems, fmt.Sprintf("%s.pathRegex: %v", requestRule.id, err))
+			}
+		}
+		if len(requestHeader.HostRegex) > 0 {
+			if requestRule.host, err = regexp.Compile(requestHeader.HostRegex); err != nil {
+				problems = append(problems, fmt.Sprintf("%s.hostRegex: %v", requestRule.id, err))
+			}
+		}
+		if requestRule.refererDomains, err = parseRefererDomains(requestHeader.AllowedRefererDomains, requestRule.id+".allowedRefererDomains"); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if requestRule.schedule, err = parseSchedule(requestHeader); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.%v", requestRule.id, err))
+		}
+		if requestRule.expiresAt, err = parseExpiresAt(requestHeader.ExpiresAt); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.expiresAt: %v", requestRule.id, err))
+		} else if logEnabled && !requestRule.expiresAt.IsZero() && !time.Now().Before(requestRule.expiresAt) {
+			log.Printf("headerblock: rule %s expired at %s and no longer matches, remove it from the configuration",
+				requestRule.id, requestRule.expiresAt.Format(time.RFC3339))
+		}
+		if requestHeader.Negate && (requestHeader.Name == "" || requestHeader.Value == "") {
+			problems = append(problems, fmt.Sprintf("%s.negate: requires both a name and a value pattern", requestRule.id))
+		}
+		if requestHeader.Conflicting && (requestHeader.Name == "" || requestHeader.Value != "" || requestHeader.Negate) {
+			problems = append(problems, fmt.Sprintf("%s.conflicting: requires a name pattern and cannot be combined with value or negate", requestRule.id))
+		}
+		if requestHeader.BlockEmptyValue && (requestHeader.Name == "" || requestHeader.Value != "" || requestHeader.Negate || requestHeader.Conflicting) {
+			problems = append(problems, fmt.Sprintf("%s.blockEmptyValue: requires a name pattern and cannot be combined with value, negate or conflicting", requestRule.id))
+		}
+		if requestHeader.MaxOccurrences < 0 {
+			problems = append(problems, fmt.Sprintf("%s.maxOccurrences: must not be negative, got %d", requestRule.id, requestHeader.MaxOccurrences))
+		} else if requestHeader.MaxOccurrences > 0 && (requestHeader.Name == "" || requestHeader.Value != "" || requestHeader.Negate || requestHeader.Conflicting || requestHeader.BlockEmptyValue) {
+			problems = append(problems, fmt.Sprintf("%s.maxOccurrences: requires a name pattern and cannot be combined with value, negate, conflicting or blockEmptyValue", requestRule.id))
+		}
+		if requestRule.action, err = parseAction(requestHeader.Action); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.action: %v", requestRule.id, err))
+		}
+		if requestRule.action == actionRedirect {
+			requestRule.redirectURL = requestHeader.RedirectURL
+			if requestRule.redirectURL == "" {
+				problems = append(problems, fmt.Sprintf("%s.redirectURL: required for action %s", requestRule.id, actionRedirect))
+			}
+			requestRule.redirectStatusCode = requestHeader.RedirectStatusCode
+			switch requestRule.redirectStatusCode {
+			case 0:
+				requestRule.redirectStatusCode = http.StatusFound
+			case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+			default:
+				problems = append(problems, fmt.Sprintf("%s.redirectStatusCode: %d is not a redirect status", requestRule.id, requestRule.redirectStatusCode))
+			}
+		}
+		if requestHeader.StatusCode != 0 || requestHeader.Body != "" || len(requestHeader.DenyHeaders) > 0 {
+			if requestRule.action != actionBlock && requestRule.action != actionTarpit && requestRule.action != actionBan {
+				problems = append(problems, fmt.Sprintf("%s.statusCode: only supported for actions %s, %s and %s", requestRule.id, actionBlock, actionTarpit, actionBan))
+			}
+			requestRule.statusCode = requestHeader.StatusCode
+			if requestRule.statusCode != 0 && (requestRule.statusCode < 100 || requestRule.statusCode > 599) {
+				problems = append(problems, fmt.Sprintf("%s.statusCode: invalid HTTP status %d", requestRule.id, requestRule.statusCode))
+			}
+			if requestHeader.Body != "" {
+				requestRule.denyBody = []byte(requestHeader.Body)
+			}
+			if requestRule.denyHeaders, err = parseDenyHeaders(requestHeader.DenyHeaders); err != nil {
+				problems = append(problems, fmt.Sprintf("%s.%v", requestRule.id, err))
+			}
+		}
+		if requestHeader.Absent {
+			problems = append(problems, fmt.Sprintf("%s.absent: only supported in all conditions", requestRule.id))
+		}
+		if len(requestHeader.All) > 0 {
+			if requestHeader.Name != "" || requestHeader.Value != "" || requestHeader.Negate {
+				problems = append(problems, fmt.Sprintf("%s.all: cannot be combined with name, value or negate", requestRule.id))
+			}
+			if requestRule.action == actionStrip {
+				problems = append(problems, fmt.Sprintf("%s.action: %s is not supported with all", requestRule.id, actionStrip))
+			}
+			for j, condition := range requestHeader.All {
+				conditionRule, conditionProblems := prepareCondition(condition, fmt.Sprintf("%s.all[%d]", requestRule.id, j))
+				requestRule.conditions = append(requestRule.conditions, conditionRule)
+				problems = append(problems, conditionProblems...)
+			}
+		}
+		headerRules = append(headerRules, requestRule)
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid rules: %s", strings.Join(problems, "; "))
+	}
+	return headerRules, nil
+}
+
+// prepareRequiredRules compiles the requiredHeaders section. A required
+// header always needs a name pattern and cannot be stripped.
+func prepareRequiredRules(headerConfig []HeaderConfig, section string, logEnabled bool) ([]rule, error) {
+	var problems []string
+	for i, requiredHeader := range headerConfig {
+		if requiredHeader.Name == "" {
+			problems = append(problems, fmt.Sprintf("%s[%d].name: a name pattern is required", section, i))
+		}
+		if strings.EqualFold(strings.TrimSpace(requiredHeader.Action), actionStrip) {
+			problems = append(problems, fmt.Sprintf("%s[%d].action: %s is not supported", section, i, actionStrip))
+		}
+		if requiredHeader.BlockEmptyValue || requiredHeader.MaxOccurrences != 0 {
+			problems = append(problems, fmt.Sprintf("%s[%d]: blockEmptyValue and maxOccurrences are not supported", section, i))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid rules: %s", strings.Join(problems, "; "))
+	}
+
+	return prepareRules(headerConfig, section, logEnabled)
+}
+
+// prepareValueRules compiles a section whose rules only have a value pattern,
+// matched against something other than headers, such as the request URI or
+// body.
+func prepareValueRules(headerConfig []HeaderConfig, section string, logEnabled bool) ([]rule, error) {
+	var problems []string
+	for i, valueRule := range headerConfig {
+		if valueRule.Name != "" {
+			problems = append(problems, fmt.Sprintf("%s[%d].name: not supported, only values are matched", section, i))
+		}
+		if valueRule.Value == "" {
+			problems = append(problems, fmt.Sprintf("%s[%d].value: a value pattern is required", section, i))
+		}
+		if strings.EqualFold(strings.TrimSpace(valueRule.Action), actionStrip) {
+			problems = append(problems, fmt.Sprintf("%s[%d].action: %s is not supported", section, i, actionStrip))
+		}
+		if valueRule.Negate || valueRule.Conflicting || len(valueRule.All) > 0 {
+			problems = append(problems, fmt.Sprintf("%s[%d]: negate, conflicting and all are not supported", section, i))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid rules: %s", strings.Join(problems, "; "))
+	}
+
+	return prepareRules(headerConfig, section, logEnabled)
+}
+
+// ruleID returns the configured id of a rule or its position in section.
+func ruleID(headerConfig HeaderConfig, section string, i int) string {
+	if id := strings.TrimSpace(headerConfig.ID); id != "" {
+		return id
+	}
+	return fmt.Sprintf("%s[%d]", section, i)
+}
+
+// prepareCondition compiles one condition of a composite rule.
+func prepareCondition(condition HeaderConfig, id string) (rule, []string) {
+	conditionRule := rule{
+		id:             id,
+		negate:         condition.Negate,
+		absent:         condition.Absent,
+		conflicting:    condition.Conflicting,
+		emptyValue:     condition.BlockEmptyValue,
+		decodeBase64:   condition.DecodeBase64,
+		maxOccurrences: condition.MaxOccurrences,
+	}
+	var problems []string
+
+	matchType, err := parseMatchType(condition.MatchType)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("%s.matchType: %v", id, err))
+		matchType = matchRegex
+	}
+	if condition.Name == "" {
+		problems = append(problems, fmt.Sprintf("%s.name: a name pattern is required", id))
+	} else if conditionRule.name, err = compileMatcher(condition.Name, matchType, condition.CaseInsensitive, true); err != nil {
+		problems = append(problems, fmt.Sprintf("%s.name: %v", id, err))
+	}
+	if len(condition.Value) > 0 {
+		if conditionRule.value, err = compileMatcher(condition.Value, matchType, condition.CaseInsensitive, false); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.value: %v", id, err))
+		}
+	}
+	if conditionRule.normalize, err = parseNormalize(condition.Normalize); err != nil {
+		problems = append(problems, fmt.Sprintf("%s.normalize: %v", id, err))
+	}
+	if condition.Negate && condition.Value == "" {
+		problems = append(problems, fmt.Sprintf("%s.negate: requires both a name and a value pattern", id))
+	}
+	if condition.Absent && (condition.Value != "" || condition.Negate) {
+		problems = append(problems, fmt.Sprintf("%s.absent: cannot be combined with value or negate", id))
+	}
+	if condition.Conflicting && (condition.Value != "" || condition.Negate || condition.Absent) {
+		problems = append(problems, fmt.Sprintf("%s.conflicting: cannot be combined with value, negate or absent", id))
+	}
+	if condition.BlockEmptyValue && (condition.Value != "" || condition.Negate || condition.Absent || condition.Conflicting) {
+		problems = append(problems, fmt.Sprintf("%s.blockEmptyValue: cannot be combined with value, negate, absent or conflicting", id))
+	}
+	if condition.MaxOccurrences < 0 || (condition.MaxOccurrences > 0 && (condition.Value != "" || condition.Negate || condition.Absent || condition.Conflicting || condition.BlockEmptyValue)) {
+		problems = append(problems, fmt.Sprintf("%s.maxOccurrences: must be positive and cannot be combined with value, negate, absent, conflicting or blockEmptyValue", id))
+	}
+	if len(condition.All) > 0 {
+		problems = append(problems, fmt.Sprintf("%s.all: conditions cannot be nested", id))
+	}
+	if condition.Enabled != nil {
+		problems = append(problems, fmt.Sprintf("%s.enabled: only supported on rules, not on conditions", id))
+	}
+
+	return conditionRule, problems
+}
+
+// matchesAll reports whether every condition of a composite rule matches.
+func (r rule) matchesAll(header http.Header) bool {
+	for _, condition := range r.conditions {
+		if hasMatchingHeader(header, condition) == condition.absent {
+			return false
+		}
+	}
+	return true
+}
+
+func hasMatchingHeader(header http.Header, r rule) bool {
+	for name, values := range header {
+		if applyRule(r, name, values) {
+			return true
+		}
+	}
+	return false
+}
+
+func compilePattern(pattern string, caseInsensitive bool) (*regexp.Regexp, error) {
+	if caseInsensitive {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// captures returns the named capture groups of the value pattern in the
+// first value it matches, nil when the pattern has none.
+func (r rule) captures(values []string) map[string]string {
+	re, ok := r.value.(*regexp.Regexp)
+	if !ok || r.negate || re.NumSubexp() == 0 {
+		return nil
+	}
+	names := re.SubexpNames()
+	for _, value := range r.values(values) {
+		match := re.FindStringSubmatch(value)
+		if match == nil {
+			continue
+		}
+		var captures map[string]string
+		for i, name := range names {
+			if name == "" || match[i] == "" {
+				continue
+			}
+			if captures == nil {
+				captures = make(map[string]string)
+			}
+			captures[name] = match[i]
+		}
+		return captures
+	}
+	return nil
+}
+
+// denyStatus returns the status code of r, or fallback when it sets none.
+func (r rule) denyStatus(fallback int) int {
+	if r.statusCode != 0 {
+		return r.statusCode
+	}
+	return fallback
+}
+
+func parseAction(raw string) (string, error) {
+	switch action := strings.ToLower(strings.TrimSpace(raw)); action {
+	case "":
+		return actionBlock, nil
+	case actionBlock, actionStrip, actionLog, actionTag, actionTarpit, actionRedirect, actionAllow, actionBan:
+		return action, nil
+	default:
+		return "", fmt.Errorf("unknown action %q", raw)
+	}
+}
+
+// isWhitelisted reports whether a whitelist rule matches the header. Rules
+// with sourceIPs only apply to clients from those networks.
+func isWhitelisted(name string, values []string, clientIP net.IP, whitelist []rule) bool {
+	for _, rule := range whitelist {
+		if rule.name != nil && !rule.name.MatchString(name) {
+			continue
+		}
+		if !rule.sourceIPNets.empty() && !isIPAllowed(clientIP, rule.sourceIPNets) {
+			continue
+		}
+		if rule.value == nil {
+			return true
+		}
+
+		for _, value := range rule.values(values) {
+			if rule.value.MatchString(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasConflictingValues reports whether a header was sent several times with
+// different values, a request smuggling indicator.
+func hasConflictingValues(values []string) bool {
+	if len(values) < 2 {
+		return false
+	}
+	for _, value := range values[1:] {
+		if strings.TrimSpace(value) != strings.TrimSpace(values[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasEmptyValue reports whether a header was sent with an empty or
+// whitespace-only value, a common sign of broken bots.
+func hasEmptyValue(values []string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// appliesTo reports whether the request is in the scope of the rule.
+func (r rule) appliesTo(req *http.Request) bool {
+	if r.path != nil && !r.path.MatchString(req.URL.Path) {
+		return false
+	}
+	if len(r.refererDomains) > 0 && refererFrom(req, r.refererDomains) {
+		return false
+	}
+	if (r.schedule != nil || !r.expiresAt.IsZero()) && !r.activeAt(time.Now()) {
+		return false
+	}
+	return r.host == nil || r.host.MatchString(requestHost(req))
+}
+
+// requestHost returns req.Host without its port.
+func requestHost(req *http.Request) string {
+	if host, _, err := net.SplitHostPort(req.Host); err == nil {
+		return host
+	}
+	return req.Host
+}
+
+// values returns the header values the value pattern of r is matched
+// against, with their decoded base64 tokens and normalized when the rule
+// asks for it.
+func (r rule) values(values []string) []string {
+	if r.decodeBase64 {
+		values = appendBase64Decoded(values)
+	}
+	if len(r.normalize) > 0 {
+		values = normalizeValues(r.normalize, values)
+	}
+	return values
+}
+
+func applyRule(rule rule, name string, values []string) bool {
+	nameMatch := rule.name != nil && rule.name.MatchString(name)
+	if rule.conflicting {
+		return nameMatch && hasConflictingValues(values)
+	}
+	if rule.emptyValue {
+		return nameMatch && hasEmptyValue(values)
+	}
+	if rule.maxOccurrences > 0 {
+		return nameMatch && len(values) > rule.maxOccurrences
+	}
+	if rule.negate {
+		// Negated rules fire when the named header carries no matching value
+		if !nameMatch {
+			return false
+		}
+		for _, value := range rule.values(values) {
+			if rule.value.MatchString(value) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if rule.value == nil && nameMatch {
+		return true
+	} else if rule.value != nil && (nameMatch || rule.name == nil) {
+		for _, value := range rule.values(values) {
+			if rule.value.MatchString(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,305 @@
+package headerblock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+)
+
+// ruleSections are the rule lists that can be configured both inline in the
+// middleware configuration and in a rules file.
+type ruleSections struct {
+	RequestHeaders           []HeaderConfig `json:"requestHeaders,omitempty"`
+	WhitelistRequestHeaders  []HeaderConfig `json:"whitelistRequestHeaders,omitempty"`
+	RequiredHeaders          []HeaderConfig `json:"requiredHeaders,omitempty"`
+	RequestCookies           []HeaderConfig `json:"requestCookies,omitempty"`
+	RequestURIRules          []HeaderConfig `json:"requestURIRules,omitempty"`
+	ResponseHeaders          []HeaderConfig `json:"responseHeaders,omitempty"`
+	WhitelistResponseHeaders []HeaderConfig `json:"whitelistResponseHeaders,omitempty"`
+	TLSClientCertRules       []HeaderConfig `json:"tlsClientCertRules,omitempty"`
+	WhitelistTLSClientCerts  []HeaderConfig `json:"whitelistTLSClientCerts,omitempty"`
+	BodyRules                []HeaderConfig `json:"bodyRules,omitempty"`
+}
+
+// ruleSet is the compiled form of ruleSections. It is never modified once
+// built, so it can be swapped atomically when rules are reloaded.
+type ruleSet struct {
+	requestHeaderRules     []rule
+	requestHeaderIndex     *headerIndex
+	compositeRules         []rule
+	whitelistRequestRules  []rule
+	requiredHeaderRules    []rule
+	cookieRules            []rule
+	uriRules               []rule
+	responseHeaderRules    []rule
+	whitelistResponseRules []rule
+	certRules              []rule
+	whitelistCertRules     []rule
+	bodyRules              []rule
+	// disabled is the number of rules turned off with enabled: false.
+	disabled int
+}
+
+// compileRuleSet compiles every section. prefix is prepended to the rule ids
+// so rules from different sources can be told apart.
+func compileRuleSet(sections ruleSections, prefix string, logEnabled bool, severities severityActions) (*ruleSet, error) {
+	sections, err := resolveLegacyKeys(sections, prefix, logEnabled)
+	if err != nil {
+		return nil, err
+	}
+	if sections, err = severities.apply(sections, prefix); err != nil {
+		return nil, err
+	}
+	rs := &ruleSet{}
+
+	if rs.requestHeaderRules, err = prepareRules(sections.RequestHeaders, prefix+"requestHeaders", logEnabled); err != nil {
+		return nil, err
+	}
+	if rs.whitelistRequestRules, err = prepareRules(sections.WhitelistRequestHeaders, prefix+"whitelistRequestHeaders", logEnabled); err != nil {
+		return nil, err
+	}
+	if rs.requiredHeaderRules, err = prepareRequiredRules(sections.RequiredHeaders, prefix+"requiredHeaders", logEnabled); err != nil {
+		return nil, err
+	}
+	if rs.cookieRules, err = prepareRules(sections.RequestCookies, prefix+"requestCookies", logEnabled); err != nil {
+		return nil, err
+	}
+	if rs.uriRules, err = prepareValueRules(sections.RequestURIRules, prefix+"requestURIRules", logEnabled); err != nil {
+		return nil, err
+	}
+	if rs.responseHeaderRules, err = prepareRules(sections.ResponseHeaders, prefix+"responseHeaders", logEnabled); err != nil {
+		return nil, err
+	}
+	if rs.whitelistResponseRules, err = prepareRules(sections.WhitelistResponseHeaders, prefix+"whitelistResponseHeaders", logEnabled); err != nil {
+		return nil, err
+	}
+	if rs.certRules, err = prepareCertRules(sections.TLSClientCertRules, prefix+"tlsClientCertRules", logEnabled); err != nil {
+		return nil, err
+	}
+	if rs.whitelistCertRules, err = prepareCertRules(sections.WhitelistTLSClientCerts, prefix+"whitelistTLSClientCerts", logEnabled); err != nil {
+		return nil, err
+	}
+	if rs.bodyRules, err = prepareValueRules(sections.BodyRules, prefix+"bodyRules", logEnabled); err != nil {
+		return nil, err
+	}
+
+	for _, rules := range []*[]rule{&rs.requestHeaderRules, &rs.whitelistRequestRules, &rs.requiredHeaderRules, &rs.cookieRules, &rs.uriRules,
+		&rs.responseHeaderRules, &rs.whitelistResponseRules, &rs.certRules, &rs.whitelistCertRules, &rs.bodyRules} {
+		*rules = rs.dropDisabled(*rules)
+	}
+	rs.requestHeaderRules, rs.compositeRules = splitComposite(sortRules(rs.requestHeaderRules))
+	rs.requestHeaderIndex = newHeaderIndex(rs.requestHeaderRules)
+
+	for _, rules := range [][]rule{rs.whitelistRequestRules, rs.requiredHeaderRules, rs.cookieRules, rs.responseHeaderRules, rs.whitelistResponseRules} {
+		for _, r := range rules {
+			if len(r.conditions) > 0 {
+				return nil, fmt.Errorf("invalid rules: %s.all: only supported in requestHeaders", r.id)
+			}
+		}
+	}
+
+	for _, rules := range [][]rule{rs.responseHeaderRules, rs.whitelistResponseRules} {
+		for _, r := range rules {
+			if r.action == actionRedirect || r.action == actionBan {
+				return nil, fmt.Errorf("invalid rules: %s.action: %s is not supported for responses", r.id, r.action)
+			}
+		}
+	}
+
+	executable := [][]rule{rs.requiredHeaderRules, rs.cookieRules, rs.uriRules, rs.responseHeaderRules, rs.certRules, rs.bodyRules}
+	for _, rules := range executable {
+		for _, r := range rules {
+			if r.action == actionAllow {
+				return nil, fmt.Errorf("invalid rules: %s.action: %s is only supported in requestHeaders", r.id, actionAllow)
+			}
+		}
+		sortRules(rules)
+	}
+
+	seen := make(map[string]struct{})
+	for _, rules := range [][]rule{rs.all(), rs.whitelistRequestRules, rs.whitelistResponseRules, rs.whitelistCertRules} {
+		for _, r := range rules {
+			if _, ok := seen[r.id]; ok {
+				return nil, fmt.Errorf("invalid rules: duplicate rule id %q", r.id)
+			}
+			seen[r.id] = struct{}{}
+		}
+	}
+
+	return rs, nil
+}
+
+// dropDisabled returns the enabled rules and counts the others.
+func (s *ruleSet) dropDisabled(rules []rule) []rule {
+	enabled := rules[:0]
+	for _, r := range rules {
+		if r.disabled {
+			s.disabled++
+			continue
+		}
+		enabled = append(enabled, r)
+	}
+	return enabled
+}
+
+// splitComposite separates composite rules, which are evaluated once per
+// request, from rules matched against every header.
+func splitComposite(rules []rule) (headerRules, compositeRules []rule) {
+	headerRules = make([]rule, 0, len(rules))
+	for _, r := range rules {
+		if len(r.conditions) > 0 {
+			compositeRules = append(compositeRules, r)
+			continue
+		}
+		headerRules = append(headerRules, r)
+	}
+	return headerRules, compositeRules
+}
+
+// resolveLegacyKeys returns sections with the deprecated header and env keys
+// of every rule moved to name and value.
+func resolveLegacyKeys(sections ruleSections, prefix string, logEnabled bool) (ruleSections, error) {
+	var problems []string
+	for _, section := range []struct {
+		name  string
+		rules *[]HeaderConfig
+	}{
+		{name: "requestHeaders", rules: &sections.RequestHeaders},
+		{name: "whitelistRequestHeaders", rules: &sections.WhitelistRequestHeaders},
+		{name: "requiredHeaders", rules: &sections.RequiredHeaders},
+		{name: "requestCookies", rules: &sections.RequestCookies},
+		{name: "requestURIRules", rules: &sections.RequestURIRules},
+		{name: "responseHeaders", rules: &sections.ResponseHeaders},
+		{name: "whitelistResponseHeaders", rules: &sections.WhitelistResponseHeaders},
+		{name: "tlsClientCertRules", rules: &sections.TLSClientCertRules},
+		{name: "whitelistTLSClientCerts", rules: &sections.WhitelistTLSClientCerts},
+		{name: "bodyRules", rules: &sections.BodyRules},
+	} {
+		*section.rules = resolveLegacyRules(*section.rules, func(i int, headerConfig HeaderConfig) string {
+			return ruleID(headerConfig, prefix+section.name, i)
+		}, logEnabled, &problems)
+	}
+
+	if len(problems) > 0 {
+		return ruleSections{}, fmt.Errorf("invalid rules: %s", strings.Join(problems, "; "))
+	}
+	return sections, nil
+}
+
+// resolveLegacyRules moves header and env to name and value in rules and
+// their conditions. The configured rules are shared, so rules using the old
+// keys are resolved in a copy.
+func resolveLegacyRules(rules []HeaderConfig, idOf func(int, HeaderConfig) string, logEnabled bool, problems *[]string) []HeaderConfig {
+	if !usesLegacyKeys(rules) {
+		return rules
+	}
+
+	resolved := append([]HeaderConfig(nil), rules...)
+	for i := range resolved {
+		headerConfig := &resolved[i]
+		id := idOf(i, *headerConfig)
+		headerConfig.All = resolveLegacyRules(headerConfig.All, func(j int, _ HeaderConfig) string {
+			return fmt.Sprintf("%s.all[%d]", id, j)
+		}, logEnabled, problems)
+
+		if headerConfig.Header == "" && headerConfig.Env == "" {
+			continue
+		}
+		if (headerConfig.Header != "" && headerConfig.Name != "") || (headerConfig.Env != "" && headerConfig.Value != "") {
+			*problems = append(*problems, fmt.Sprintf("%s: header and env cannot be combined with name and value", id))
+			continue
+		}
+		if logEnabled {
+			log.Printf("headerblock: %s: the header and env keys are deprecated, use name and value", id)
+		}
+		if headerConfig.Header != "" {
+			headerConfig.Name, headerConfig.Header = headerConfig.Header, ""
+		}
+		if headerConfig.Env != "" {
+			headerConfig.Value, headerConfig.Env = headerConfig.Env, ""
+		}
+	}
+	return resolved
+}
+
+// usesLegacyKeys reports whether a rule of rules or of their conditions sets
+// header or env.
+func usesLegacyKeys(rules []HeaderConfig) bool {
+	for _, headerConfig := range rules {
+		if headerConfig.Header != "" || headerConfig.Env != "" || usesLegacyKeys(headerConfig.All) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeRuleSet parses and compiles a JSON or YAML document of rule
+// sections. Unknown fields are rejected so typos in external rule sources are
+// caught.
+func decodeRuleSet(data []byte, prefix string, logEnabled bool, severities severityActions) (*ruleSet, error) {
+	// JSON documents are objects; anything else is read as YAML.
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		var err error
+		if data, err = yamlToJSON(data, reflect.TypeOf(ruleSections{})); err != nil {
+			return nil, err
+		}
+	}
+
+	var sections ruleSections
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&sections); err != nil {
+		return nil, err
+	}
+
+	return compileRuleSet(sections, prefix, logEnabled, severities)
+}
+
+// merge returns a new rule set holding the rules of s followed by those of other.
+func (s *ruleSet) merge(other *ruleSet) *ruleSet {
+	merged := &ruleSet{
+		requestHeaderRules:     sortRules(concatRules(s.requestHeaderRules, other.requestHeaderRules)),
+		compositeRules:         sortRules(concatRules(s.compositeRules, other.compositeRules)),
+		whitelistRequestRules:  concatRules(s.whitelistRequestRules, other.whitelistRequestRules),
+		requiredHeaderRules:    sortRules(concatRules(s.requiredHeaderRules, other.requiredHeaderRules)),
+		cookieRules:            sortRules(concatRules(s.cookieRules, other.cookieRules)),
+		uriRules:               sortRules(concatRules(s.uriRules, other.uriRules)),
+		responseHeaderRules:    sortRules(concatRules(s.responseHeaderRules, other.responseHeaderRules)),
+		whitelistResponseRules: concatRules(s.whitelistResponseRules, other.whitelistResponseRules),
+		certRules:              sortRules(concatRules(s.certRules, other.certRules)),
+		whitelistCertRules:     concatRules(s.whitelistCertRules, other.whitelistCertRules),
+		bodyRules:              sortRules(concatRules(s.bodyRules, other.bodyRules)),
+		disabled:               s.disabled + other.disabled,
+	}
+	merged.requestHeaderIndex = newHeaderIndex(merged.requestHeaderRules)
+	return merged
+}
+
+func concatRules(a, b []rule) []rule {
+	rules := make([]rule, 0, len(a)+len(b))
+	rules = append(rules, a...)
+	return append(rules, b...)
+}
+
+// all returns the rules whose matches are counted in metrics.
+func (s *ruleSet) all() []rule {
+	var rules []rule
+	rules = append(rules, s.requestHeaderRules...)
+	rules = append(rules, s.compositeRules...)
+	rules = append(rules, s.requiredHeaderRules...)
+	rules = append(rules, s.cookieRules...)
+	rules = append(rules, s.uriRules...)
+	rules = append(rules, s.certRules...)
+	rules = append(rules, s.bodyRules...)
+	return append(rules, s.responseHeaderRules...)
+}
+
+// count returns the number of active rules, whitelists included, and of
+// disabled rules.
+func (s *ruleSet) count() (active, disabled int) {
+	active = len(s.all()) + len(s.whitelistRequestRules) + len(s.whitelistResponseRules) + len(s.whitelistCertRules)
+	return active, s.disabled
+}
@@ -0,0 +1,68 @@
+package headerblock
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+const defaultRulesFileInterval = 30 * time.Second
+
+// rulesFileSource keeps track of the external rules file so it is only
+// recompiled when it changes.
+type rulesFileSource struct {
+	path     string
+	interval time.Duration
+	modTime  time.Time
+}
+
+// loadRulesFile compiles the rules file when it changed since the last load
+// and atomically swaps the active rule set. On error the previous rules stay
+// active.
+func (c *headerBlock) loadRulesFile() error {
+	info, err := os.Stat(c.rulesFile.path)
+	if err != nil {
+		return err
+	}
+	if !info.ModTime().After(c.rulesFile.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.rulesFile.path)
+	if err != nil {
+		return err
+	}
+
+	fileRules, err := decodeRuleSet(data, "rulesFile.", c.log, c.severities)
+	if err != nil {
+		return fmt.Errorf("rulesFile %s: %w", c.rulesFile.path, err)
+	}
+
+	c.rulesFile.modTime = info.ModTime()
+	c.swapRules(func() { c.fileRules = fileRules })
+
+	if c.log {
+		log.Printf("headerblock: loaded %d request header rules from %s", len(fileRules.requestHeaderRules), c.rulesFile.path)
+	}
+
+	return nil
+}
+
+// watchRulesFile reloads the rules file on every tick until ctx is done.
+func (c *headerBlock) watchRulesFile(ctx context.Context) {
+	ticker := time.NewTicker(c.rulesFile.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.loadRulesFile(); err != nil {
+				log.Printf("headerblock: keeping previous rules, reload failed: %v", err)
+			}
+		}
+	}
+}
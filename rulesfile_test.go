@@ -0,0 +1,125 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func writeRulesFile(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write rules file: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("touch rules file: %v", err)
+	}
+}
+
+func statusFor(p http.Handler, header string) int {
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set(header, "1")
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+func TestRulesFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	start := time.Now().Add(-time.Hour)
+	writeRulesFile(t, path, `{"requestHeaders": [{"name": "X-Old"}]}`, start)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Inline"}}
+	cfg.RulesFile = path
+	cfg.RulesFileInterval = "10ms"
+
+	p, err := tbua.New(ctx, &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	if code := statusFor(p, "X-Old"); code != http.StatusForbidden {
+		t.Fatalf("expected file rule to block, got %d", code)
+	}
+	if code := statusFor(p, "X-Inline"); code != http.StatusForbidden {
+		t.Fatalf("expected inline rule to block, got %d", code)
+	}
+
+	writeRulesFile(t, path, `{"requestHeaders": [{"name": "X-New"}]}`, start.Add(time.Minute))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for statusFor(p, "X-New") != http.StatusForbidden {
+		if time.Now().After(deadline) {
+			t.Fatal("rules file was not reloaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if code := statusFor(p, "X-Old"); code != http.StatusTeapot {
+		t.Fatalf("expected old file rule to be gone, got %d", code)
+	}
+
+	// A broken file keeps the last good rules.
+	writeRulesFile(t, path, `{"requestHeaders": [{"name": "X-(Broken"}]}`, start.Add(2*time.Minute))
+	time.Sleep(50 * time.Millisecond)
+
+	if code := statusFor(p, "X-New"); code != http.StatusForbidden {
+		t.Fatalf("expected last good rules to stay active, got %d", code)
+	}
+}
+
+func TestRulesFileInvalidAtStartup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRulesFile(t, path, `{"requestHeaders": [{"nmae": "X-Typo"}]}`, time.Now())
+
+	cfg := tbua.CreateConfig()
+	cfg.RulesFile = path
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error for invalid rules file")
+	}
+}
+
+func TestDeprecatedHeaderEnvKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	writeRulesFile(t, path, `{"requestHeaders": [{"header": "X-File", "env": "^1$"}]}`, time.Now())
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Header: "X-Inline"},
+		{All: []tbua.HeaderConfig{{Header: "X-Composite", Env: "^1$"}, {Header: "X-Other", Absent: true}}},
+	}
+	cfg.RulesFile = path
+	cfg.RulesFileInterval = "0s"
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, header := range []string{"X-File", "X-Inline", "X-Composite"} {
+		if code := statusFor(p, header); code != http.StatusForbidden {
+			t.Errorf("%s: expected %d, got %d", header, http.StatusForbidden, code)
+		}
+	}
+	if code := statusFor(p, "X-Unrelated"); code != http.StatusTeapot {
+		t.Errorf("expected %d, got %d", http.StatusTeapot, code)
+	}
+
+	cfg = tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-New", Header: "X-Old"}}
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected an error for a rule setting both name and header")
+	}
+}
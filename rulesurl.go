@@ -0,0 +1,95 @@
+package headerblock
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultRulesURLInterval = 5 * time.Minute
+	rulesURLTimeout         = 10 * time.Second
+	// maxRulesURLSize bounds the size of a downloaded rule list.
+	maxRulesURLSize = 10 << 20
+)
+
+// rulesURLSource is a remote rule list. The last good version stays active
+// when a refresh fails.
+type rulesURLSource struct {
+	url      string
+	interval time.Duration
+	client   *http.Client
+	etag     string
+}
+
+// fetchRulesURL downloads and compiles the remote rule list and swaps it in.
+func (c *headerBlock) fetchRulesURL(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.rulesURL.url, nil)
+	if err != nil {
+		return err
+	}
+	if c.rulesURL.etag != "" {
+		req.Header.Set("If-None-Match", c.rulesURL.etag)
+	}
+
+	resp, err := c.rulesURL.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rulesURL %s: unexpected status %d", c.rulesURL.url, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRulesURLSize))
+	if err != nil {
+		return err
+	}
+
+	urlRules, err := decodeRuleSet(data, "rulesURL.", c.log, c.severities)
+	if err != nil {
+		return fmt.Errorf("rulesURL %s: %w", c.rulesURL.url, err)
+	}
+
+	c.rulesURL.etag = resp.Header.Get("ETag")
+	c.swapRules(func() { c.urlRules = urlRules })
+
+	if c.log {
+		log.Printf("headerblock: loaded %d request header rules from %s", len(urlRules.requestHeaderRules), c.rulesURL.url)
+	}
+
+	return nil
+}
+
+// watchRulesURL fetches the remote rules right away and then on every tick
+// until ctx is done.
+func (c *headerBlock) watchRulesURL(ctx context.Context) {
+	if err := c.fetchRulesURL(ctx); err != nil {
+		log.Printf("headerblock: failed to fetch rules: %v", err)
+	}
+
+	if c.rulesURL.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.rulesURL.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.fetchRulesURL(ctx); err != nil {
+				log.Printf("headerblock: keeping previous rules, refresh failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+type rulesServer struct {
+	mu     sync.Mutex
+	body   string
+	status int
+}
+
+func (s *rulesServer) set(status int, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status, s.body = status, body
+}
+
+func (s *rulesServer) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rw.WriteHeader(s.status)
+	_, _ = rw.Write([]byte(s.body))
+}
+
+func waitForStatus(t *testing.T, p http.Handler, header string, expected int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for statusFor(p, header) != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s to return %d", header, expected)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRulesURLRefresh(t *testing.T) {
+	rules := &rulesServer{}
+	rules.set(http.StatusOK, `{"requestHeaders": [{"name": "X-Remote"}]}`)
+	server := httptest.NewServer(rules)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := tbua.CreateConfig()
+	cfg.RulesURL = server.URL
+	cfg.RulesURLInterval = "10ms"
+
+	p, err := tbua.New(ctx, &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	waitForStatus(t, p, "X-Remote", http.StatusForbidden)
+
+	// A failing refresh keeps the last good rules.
+	rules.set(http.StatusInternalServerError, "")
+	time.Sleep(50 * time.Millisecond)
+	if code := statusFor(p, "X-Remote"); code != http.StatusForbidden {
+		t.Fatalf("expected cached rules to stay active, got %d", code)
+	}
+
+	rules.set(http.StatusOK, `{"requestHeaders": [{"name": "X-Updated"}]}`)
+	waitForStatus(t, p, "X-Updated", http.StatusForbidden)
+	waitForStatus(t, p, "X-Remote", http.StatusTeapot)
+}
@@ -0,0 +1,162 @@
+package headerblock
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const minutesPerDay = 24 * 60
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// schedule limits a rule to a daily time window on some days of the week,
+// evaluated at request time.
+type schedule struct {
+	// from and to are minutes since midnight; a window with from after to
+	// spans midnight.
+	from     int
+	to       int
+	days     map[time.Weekday]struct{}
+	location *time.Location
+}
+
+// parseSchedule compiles the activeFrom, activeTo, daysOfWeek and timezone
+// fields of a rule. It returns nil when the rule is always active.
+func parseSchedule(config HeaderConfig) (*schedule, error) {
+	if config.ActiveFrom == "" && config.ActiveTo == "" && len(config.DaysOfWeek) == 0 {
+		if config.Timezone != "" {
+			return nil, errors.New("timezone: requires activeFrom, activeTo or daysOfWeek")
+		}
+		return nil, nil
+	}
+
+	s := &schedule{from: 0, to: minutesPerDay, location: time.UTC}
+	var err error
+	if config.ActiveFrom != "" {
+		if s.from, err = parseClock(config.ActiveFrom); err != nil {
+			return nil, fmt.Errorf("activeFrom: %w", err)
+		}
+	}
+	if config.ActiveTo != "" {
+		if s.to, err = parseClock(config.ActiveTo); err != nil {
+			return nil, fmt.Errorf("activeTo: %w", err)
+		}
+	}
+	if s.from == s.to {
+		return nil, errors.New("activeTo: must differ from activeFrom")
+	}
+	if config.Timezone != "" {
+		if s.location, err = time.LoadLocation(config.Timezone); err != nil {
+			return nil, fmt.Errorf("timezone: %w", err)
+		}
+	}
+	if len(config.DaysOfWeek) > 0 {
+		if s.days, err = parseDaysOfWeek(config.DaysOfWeek); err != nil {
+			return nil, fmt.Errorf("daysOfWeek: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// parseClock parses a 24-hour "HH:MM" time into minutes since midnight.
+func parseClock(raw string) (int, error) {
+	clock, err := time.Parse("15:04", strings.TrimSpace(raw))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", raw)
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+// parseDaysOfWeek parses day names such as "mon" or "Monday" and ranges such
+// as "mon-fri".
+func parseDaysOfWeek(raw []string) (map[time.Weekday]struct{}, error) {
+	days := make(map[time.Weekday]struct{}, 7)
+	for _, entry := range raw {
+		first, last, isRange := strings.Cut(entry, "-")
+		start, err := parseWeekday(first)
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if isRange {
+			if end, err = parseWeekday(last); err != nil {
+				return nil, err
+			}
+		}
+		for day := start; ; day = (day + 1) % 7 {
+			days[day] = struct{}{}
+			if day == end {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseWeekday(raw string) (time.Weekday, error) {
+	name := strings.ToLower(strings.TrimSpace(raw))
+	if len(name) >= 3 {
+		if day, ok := weekdays[name[:3]]; ok && strings.HasPrefix(strings.ToLower(day.String()), name) {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day %q", raw)
+}
+
+// active reports whether now falls in the window. The part of a window
+// spanning midnight that falls on the next day belongs to the day it
+// started.
+func (s *schedule) active(now time.Time) bool {
+	local := now.In(s.location)
+	minute := local.Hour()*60 + local.Minute()
+	day := local.Weekday()
+
+	switch {
+	case s.from < s.to:
+		if minute < s.from || minute >= s.to {
+			return false
+		}
+	case minute >= s.from:
+	case minute < s.to:
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+
+	if s.days == nil {
+		return true
+	}
+	_, ok := s.days[day]
+	return ok
+}
+
+// parseExpiresAt parses the expiresAt field of a rule: an RFC 3339 time, or
+// a date after which the rule stops matching at midnight UTC.
+func parseExpiresAt(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if expiresAt, err := time.Parse(time.RFC3339, raw); err == nil {
+		return expiresAt, nil
+	}
+	date, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339 or YYYY-MM-DD", raw)
+	}
+	return date.AddDate(0, 0, 1), nil
+}
+
+// activeAt reports whether the rule has not expired and its schedule, if
+// any, is active at now.
+func (r rule) activeAt(now time.Time) bool {
+	if !r.expiresAt.IsZero() && !now.Before(r.expiresAt) {
+		return false
+	}
+	return r.schedule == nil || r.schedule.active(now)
+}
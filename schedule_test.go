@@ -0,0 +1,110 @@
+package headerblock
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduleActive(t *testing.T) {
+	// 2026-10-16 is a Friday.
+	friday := func(clock string) time.Time {
+		at, err := time.Parse("2006-01-02 15:04", "2026-10-16 "+clock)
+		if err != nil {
+			t.Fatalf("invalid time %q: %v", clock, err)
+		}
+		return at
+	}
+
+	tests := []struct {
+		name     string
+		config   HeaderConfig
+		now      time.Time
+		expected bool
+	}{
+		{name: "inside window", config: HeaderConfig{ActiveFrom: "09:00", ActiveTo: "17:00"}, now: friday("12:00"), expected: true},
+		{name: "window end is exclusive", config: HeaderConfig{ActiveFrom: "09:00", ActiveTo: "17:00"}, now: friday("17:00")},
+		{name: "before window", config: HeaderConfig{ActiveFrom: "09:00", ActiveTo: "17:00"}, now: friday("08:59")},
+		{name: "only start", config: HeaderConfig{ActiveFrom: "22:00"}, now: friday("23:30"), expected: true},
+		{name: "only end", config: HeaderConfig{ActiveTo: "06:00"}, now: friday("07:00")},
+		{name: "overnight evening", config: HeaderConfig{ActiveFrom: "18:00", ActiveTo: "08:00"}, now: friday("20:00"), expected: true},
+		{name: "overnight morning", config: HeaderConfig{ActiveFrom: "18:00", ActiveTo: "08:00"}, now: friday("07:00"), expected: true},
+		{name: "overnight daytime", config: HeaderConfig{ActiveFrom: "18:00", ActiveTo: "08:00"}, now: friday("12:00")},
+		{name: "weekday range", config: HeaderConfig{DaysOfWeek: []string{"mon-fri"}}, now: friday("12:00"), expected: true},
+		{name: "weekend", config: HeaderConfig{DaysOfWeek: []string{"Saturday", "sun"}}, now: friday("12:00")},
+		{name: "wrapping day range", config: HeaderConfig{DaysOfWeek: []string{"fri-mon"}}, now: friday("12:00").AddDate(0, 0, 2), expected: true},
+		{name: "overnight belongs to start day", config: HeaderConfig{ActiveFrom: "22:00", ActiveTo: "02:00", DaysOfWeek: []string{"thu"}}, now: friday("01:00"), expected: true},
+		{name: "overnight not started", config: HeaderConfig{ActiveFrom: "22:00", ActiveTo: "02:00", DaysOfWeek: []string{"fri"}}, now: friday("01:00")},
+		{name: "timezone", config: HeaderConfig{ActiveFrom: "09:00", ActiveTo: "17:00", Timezone: "Asia/Tokyo"}, now: friday("01:00"), expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseSchedule(tt.config)
+			if err != nil {
+				t.Fatalf("parse schedule: %v", err)
+			}
+			if got := s.active(tt.now); got != tt.expected {
+				t.Fatalf("expected active %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config HeaderConfig
+	}{
+		{name: "invalid time", config: HeaderConfig{ActiveFrom: "9am"}},
+		{name: "empty window", config: HeaderConfig{ActiveFrom: "09:00", ActiveTo: "09:00"}},
+		{name: "unknown day", config: HeaderConfig{DaysOfWeek: []string{"funday"}}},
+		{name: "unknown timezone", config: HeaderConfig{ActiveFrom: "09:00", Timezone: "Mars/Olympus"}},
+		{name: "timezone alone", config: HeaderConfig{Timezone: "UTC"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseSchedule(tt.config); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestRuleExpiresAt(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	rules, err := prepareRules([]HeaderConfig{
+		{Name: "X-Exploit", ExpiresAt: "2020-01-01T00:00:00Z"},
+		{Name: "X-Exploit", ExpiresAt: "2026-10-16"},
+		{Name: "X-Exploit", ExpiresAt: "2026-10-16T14:00:00+02:00"},
+		{Name: "X-Exploit"},
+	}, "requestHeaders", true)
+	if err != nil {
+		t.Fatalf("prepare rules: %v", err)
+	}
+
+	expected := []bool{false, true, false, true}
+	for i, r := range rules {
+		if got := r.activeAt(now); got != expected[i] {
+			t.Errorf("%s: expected active %v, got %v", r.id, expected[i], got)
+		}
+	}
+
+	if !strings.Contains(buf.String(), "rule requestHeaders[0] expired at 2020-01-01T00:00:00Z") {
+		t.Fatalf("expected a warning for the expired rule, got %q", buf.String())
+	}
+}
+
+func TestInvalidExpiresAt(t *testing.T) {
+	if _, err := prepareRules([]HeaderConfig{{Name: "X-Exploit", ExpiresAt: "next week"}}, "requestHeaders", false); err == nil {
+		t.Fatal("expected error for invalid expiresAt")
+	}
+}
@@ -0,0 +1,133 @@
+package headerblock
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severities of a rule, from least to most severe.
+const (
+	severityLow      = "low"
+	severityMedium   = "medium"
+	severityHigh     = "high"
+	severityCritical = "critical"
+)
+
+// severityActions maps rule severities to the action of the rules that set
+// one instead of an action.
+type severityActions map[string]string
+
+// defaultSeverityActions logs low, strips medium, blocks high and bans
+// critical matches.
+var defaultSeverityActions = severityActions{
+	severityLow:      actionLog,
+	severityMedium:   actionStrip,
+	severityHigh:     actionBlock,
+	severityCritical: actionBan,
+}
+
+// newSeverityActions returns the default mapping with the overrides of
+// severityActions.
+func newSeverityActions(config *Config) (severityActions, error) {
+	actions := make(severityActions, len(defaultSeverityActions))
+	for severity, action := range defaultSeverityActions {
+		actions[severity] = action
+	}
+
+	severities := make([]string, 0, len(config.SeverityActions))
+	for severity := range config.SeverityActions {
+		severities = append(severities, severity)
+	}
+	sort.Strings(severities)
+	for _, raw := range severities {
+		severity := strings.ToLower(strings.TrimSpace(raw))
+		if _, ok := defaultSeverityActions[severity]; !ok {
+			return nil, fmt.Errorf("severityActions: unknown severity %q", raw)
+		}
+		action, err := parseAction(config.SeverityActions[raw])
+		if err != nil {
+			return nil, fmt.Errorf("severityActions.%s: %w", severity, err)
+		}
+		if action == actionRedirect || action == actionAllow {
+			return nil, fmt.Errorf("severityActions.%s: action %s is not supported", severity, action)
+		}
+		actions[severity] = action
+	}
+	return actions, nil
+}
+
+// bansClients reports whether one of rules bans clients.
+func bansClients(rules []rule) bool {
+	for _, r := range rules {
+		if r.action == actionBan {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns sections with the action of every rule that sets a severity
+// taken from the mapping. Severities are checked against what each section
+// supports, so a mapping to strip is rejected where strip is.
+func (s severityActions) apply(sections ruleSections, prefix string) (ruleSections, error) {
+	var problems []string
+	for _, section := range []struct {
+		name      string
+		rules     *[]HeaderConfig
+		stripping bool
+		whitelist bool
+		response  bool
+	}{
+		{name: "requestHeaders", rules: &sections.RequestHeaders, stripping: true},
+		{name: "whitelistRequestHeaders", rules: &sections.WhitelistRequestHeaders, whitelist: true},
+		{name: "requiredHeaders", rules: &sections.RequiredHeaders},
+		{name: "requestCookies", rules: &sections.RequestCookies, stripping: true},
+		{name: "requestURIRules", rules: &sections.RequestURIRules},
+		{name: "responseHeaders", rules: &sections.ResponseHeaders, stripping: true, response: true},
+		{name: "whitelistResponseHeaders", rules: &sections.WhitelistResponseHeaders, whitelist: true},
+		{name: "tlsClientCertRules", rules: &sections.TLSClientCertRules},
+		{name: "whitelistTLSClientCerts", rules: &sections.WhitelistTLSClientCerts, whitelist: true},
+		{name: "bodyRules", rules: &sections.BodyRules},
+	} {
+		var mapped []HeaderConfig
+		for i, headerConfig := range *section.rules {
+			if headerConfig.Severity == "" {
+				continue
+			}
+			id := ruleID(headerConfig, prefix+section.name, i)
+			severity := strings.ToLower(strings.TrimSpace(headerConfig.Severity))
+			action, ok := s[severity]
+			switch {
+			case section.whitelist:
+				problems = append(problems, fmt.Sprintf("%s.severity: not supported in whitelist rules", id))
+				continue
+			case !ok:
+				problems = append(problems, fmt.Sprintf("%s.severity: unknown severity %q", id, headerConfig.Severity))
+				continue
+			case headerConfig.Action != "":
+				problems = append(problems, fmt.Sprintf("%s.severity: cannot be combined with action", id))
+				continue
+			case (action == actionStrip && !section.stripping) || (action == actionBan && section.response):
+				problems = append(problems, fmt.Sprintf("%s.severity: %s maps to %s, which is not supported in %s", id, severity, action, section.name))
+				continue
+			}
+
+			// The configured rules are shared, so the section is copied
+			// before its first change.
+			if mapped == nil {
+				mapped = append([]HeaderConfig(nil), *section.rules...)
+			}
+			mapped[i].Action = action
+			mapped[i].Severity = severity
+		}
+		if mapped != nil {
+			*section.rules = mapped
+		}
+	}
+
+	if len(problems) > 0 {
+		return ruleSections{}, fmt.Errorf("invalid rules: %s", strings.Join(problems, "; "))
+	}
+	return sections, nil
+}
@@ -0,0 +1,140 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestSeverity(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{ID: "probe", Name: "X-Probe", Severity: "low"},
+		{ID: "internal", Name: "X-Internal", Severity: "Medium"},
+		{ID: "scanner", Name: "X-Scanner", Severity: "high"},
+		{ID: "exploit", Name: "X-Exploit", Severity: "critical"},
+	}
+	cfg.BlockedIPsStatusCode = http.StatusGone
+
+	next := &noopHandler{}
+	p, err := tbua.New(context.Background(), next, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	send := func(remoteAddr, header string) int {
+		next.req = nil
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = remoteAddr
+		if header != "" {
+			req.Header.Set(header, "1")
+		}
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := send("192.0.2.1:1", "X-Probe"); code != http.StatusTeapot {
+		t.Fatalf("low: expected %d, got %d", http.StatusTeapot, code)
+	}
+	if next.req.Header.Get("X-Probe") == "" {
+		t.Fatal("low: expected the header to reach the backend")
+	}
+
+	if code := send("192.0.2.1:1", "X-Internal"); code != http.StatusTeapot {
+		t.Fatalf("medium: expected %d, got %d", http.StatusTeapot, code)
+	}
+	if next.req.Header.Get("X-Internal") != "" {
+		t.Fatal("medium: expected the header to be stripped")
+	}
+
+	if code := send("192.0.2.1:1", "X-Scanner"); code != http.StatusForbidden {
+		t.Fatalf("high: expected %d, got %d", http.StatusForbidden, code)
+	}
+	if code := send("192.0.2.1:1", ""); code != http.StatusTeapot {
+		t.Fatalf("after high: expected %d, got %d", http.StatusTeapot, code)
+	}
+
+	if code := send("192.0.2.2:1", "X-Exploit"); code != http.StatusForbidden {
+		t.Fatalf("critical: expected %d, got %d", http.StatusForbidden, code)
+	}
+	if code := send("192.0.2.2:1", ""); code != http.StatusGone {
+		t.Fatalf("after critical: expected %d, got %d", http.StatusGone, code)
+	}
+	if code := send("192.0.2.3:1", ""); code != http.StatusTeapot {
+		t.Fatalf("other client: expected %d, got %d", http.StatusTeapot, code)
+	}
+}
+
+func TestSeverityActionsOverride(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Probe", Severity: "low"},
+		{Name: "X-Scanner", Severity: "high"},
+	}
+	cfg.SeverityActions = map[string]string{"low": "block", "high": "log"}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for header, expected := range map[string]int{
+		"X-Probe":   http.StatusForbidden,
+		"X-Scanner": http.StatusTeapot,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set(header, "1")
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+		if rr.Code != expected {
+			t.Errorf("%s: expected %d, got %d", header, expected, rr.Code)
+		}
+	}
+}
+
+func TestInvalidSeverity(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(*tbua.Config)
+	}{
+		{name: "UnknownSeverity", cfg: func(c *tbua.Config) {
+			c.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Scan", Severity: "severe"}}
+		}},
+		{name: "SeverityAndAction", cfg: func(c *tbua.Config) {
+			c.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Scan", Severity: "high", Action: "block"}}
+		}},
+		{name: "WhitelistSeverity", cfg: func(c *tbua.Config) {
+			c.WhitelistRequestHeaders = []tbua.HeaderConfig{{Name: "User-Agent", Severity: "low"}}
+		}},
+		{name: "StripInURIRules", cfg: func(c *tbua.Config) {
+			c.RequestURIRules = []tbua.HeaderConfig{{Value: "/admin", Severity: "medium"}}
+		}},
+		{name: "BanInResponseHeaders", cfg: func(c *tbua.Config) {
+			c.ResponseHeaders = []tbua.HeaderConfig{{Name: "X-Debug", Severity: "critical"}}
+		}},
+		{name: "UnknownSeverityKey", cfg: func(c *tbua.Config) {
+			c.SeverityActions = map[string]string{"severe": "block"}
+		}},
+		{name: "UnknownSeverityAction", cfg: func(c *tbua.Config) {
+			c.SeverityActions = map[string]string{"high": "explode"}
+		}},
+		{name: "RedirectSeverityAction", cfg: func(c *tbua.Config) {
+			c.SeverityActions = map[string]string{"high": "redirect"}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			tt.cfg(cfg)
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
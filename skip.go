@@ -0,0 +1,60 @@
+package headerblock
+
+import (
+	"fmt"
+	"strings"
+)
+
+// requestSkipper lets requests past the rules by method or User-Agent, e.g.
+// CORS preflights and load balancer health probes. A nil *requestSkipper
+// skips nothing.
+type requestSkipper struct {
+	methods []string
+	// userAgents are lower-case User-Agent prefixes.
+	userAgents []string
+}
+
+func newRequestSkipper(config *Config) (*requestSkipper, error) {
+	skipper := &requestSkipper{}
+	for i, method := range config.SkipMethods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if !validHeaderName(method, false) {
+			return nil, fmt.Errorf("skipMethods[%d]: invalid method %q", i, config.SkipMethods[i])
+		}
+		skipper.methods = append(skipper.methods, method)
+	}
+	for i, userAgent := range config.SkipUserAgents {
+		userAgent = strings.ToLower(strings.TrimSpace(userAgent))
+		if userAgent == "" {
+			return nil, fmt.Errorf("skipUserAgents[%d]: empty prefix", i)
+		}
+		skipper.userAgents = append(skipper.userAgents, userAgent)
+	}
+
+	if len(skipper.methods) == 0 && len(skipper.userAgents) == 0 {
+		return nil, nil
+	}
+	return skipper, nil
+}
+
+// skips reports whether the request uses one of the methods or its
+// User-Agent starts with one of the prefixes, ignoring case.
+func (s *requestSkipper) skips(method, userAgent string) bool {
+	if s == nil {
+		return false
+	}
+	for _, m := range s.methods {
+		if method == m {
+			return true
+		}
+	}
+	if userAgent == "" {
+		return false
+	}
+	for _, prefix := range s.userAgents {
+		if len(userAgent) >= len(prefix) && strings.EqualFold(userAgent[:len(prefix)], prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestSkipMethodsAndUserAgents(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Scan"},
+	}
+	cfg.RequiredHeaders = []tbua.HeaderConfig{
+		{Name: "Accept"},
+	}
+	cfg.BlockedIPs = []string{"203.0.113.7"}
+	cfg.SkipMethods = []string{"options"}
+	cfg.SkipUserAgents = []string{"kube-probe/", "ELB-HealthChecker/"}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		userAgent      string
+		remoteAddr     string
+		expectedStatus int
+	}{
+		{name: "preflight", method: http.MethodOptions, expectedStatus: http.StatusTeapot},
+		{name: "regular request", method: http.MethodGet, expectedStatus: http.StatusForbidden},
+		{name: "kubernetes probe", method: http.MethodGet, userAgent: "kube-probe/1.29", expectedStatus: http.StatusTeapot},
+		{name: "probe prefix ignores case", method: http.MethodGet, userAgent: "elb-healthchecker/2.0", expectedStatus: http.StatusTeapot},
+		{name: "prefix only", method: http.MethodGet, userAgent: "Mozilla/5.0 kube-probe/1.29", expectedStatus: http.StatusForbidden},
+		{name: "blocked IP still denied", method: http.MethodOptions, remoteAddr: "203.0.113.7:1234", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			req.Header.Set("X-Scan", "1")
+			if tt.userAgent != "" {
+				req.Header.Set("User-Agent", tt.userAgent)
+			}
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidSkipRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(cfg *tbua.Config)
+	}{
+		{name: "invalid method", config: func(cfg *tbua.Config) { cfg.SkipMethods = []string{"GET /"} }},
+		{name: "empty method", config: func(cfg *tbua.Config) { cfg.SkipMethods = []string{" "} }},
+		{name: "empty user agent", config: func(cfg *tbua.Config) { cfg.SkipUserAgents = []string{""} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			tt.config(cfg)
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected error for invalid skip configuration")
+			}
+		})
+	}
+}
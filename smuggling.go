@@ -0,0 +1,64 @@
+package headerblock
+
+import (
+	"net/http"
+	"strings"
+)
+
+// smugglingReason returns why req has ambiguous framing that front and back
+// ends could read differently, or an empty string.
+//
+// Go's HTTP server, and so Traefik, already drops Content-Length when a
+// chunked Transfer-Encoding is present, rejects differing Content-Length
+// values and joins obs-fold lines, so these checks are a second line of
+// defense for framing that reaches the middleware anyway.
+func smugglingReason(req *http.Request) string {
+	_, hasContentLength := req.Header["Content-Length"]
+	_, hasTransferEncoding := req.Header["Transfer-Encoding"]
+	if hasContentLength && (hasTransferEncoding || len(req.TransferEncoding) > 0) {
+		return "both Content-Length and Transfer-Encoding"
+	}
+
+	if lengths := req.Header.Values("Content-Length"); len(lengths) > 1 || (len(lengths) == 1 && strings.Contains(lengths[0], ",")) {
+		return "multiple Content-Length values"
+	}
+
+	if len(req.TransferEncoding) > 1 || (len(req.TransferEncoding) == 1 && req.TransferEncoding[0] != "chunked") {
+		return "unsupported Transfer-Encoding " + strings.Join(req.TransferEncoding, ", ")
+	}
+
+	for name, values := range req.Header {
+		for _, value := range values {
+			if strings.ContainsAny(value, "\r\n") {
+				return "obs-fold line in header " + name
+			}
+		}
+	}
+	return ""
+}
+
+// checkSmuggling denies requests with ambiguous framing when
+// smugglingProtection is enabled and reports whether it did.
+func (c *headerBlock) checkSmuggling(ev *evaluation) bool {
+	if !c.smugglingProtection {
+		return false
+	}
+	reason := smugglingReason(ev.req)
+	if reason == "" {
+		return false
+	}
+
+	entry := logEntry{
+		Decision: decisionSmuggling,
+		Rule:     "smugglingProtection",
+	}
+	if ip := ev.ip(); ip != nil {
+		entry.ClientIP = ip.String()
+	}
+	if c.log {
+		c.logDecision(ev.req, entry, "access denied - %s from IP %s", reason, entry.ClientIP)
+	}
+	c.recordBlock(ev.req, entry)
+	c.deny(ev.rw, ev.req, http.StatusBadRequest, entry)
+	return true
+}
@@ -0,0 +1,102 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestSmugglingProtection(t *testing.T) {
+	tests := []struct {
+		name             string
+		protection       bool
+		transferEncoding []string
+		headers          http.Header
+		expectedStatus   int
+	}{
+		{
+			name:           "plain request",
+			protection:     true,
+			headers:        http.Header{"Content-Length": {"4"}},
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:             "chunked request",
+			protection:       true,
+			transferEncoding: []string{"chunked"},
+			expectedStatus:   http.StatusTeapot,
+		},
+		{
+			name:             "content length and transfer encoding",
+			protection:       true,
+			transferEncoding: []string{"chunked"},
+			headers:          http.Header{"Content-Length": {"4"}},
+			expectedStatus:   http.StatusBadRequest,
+		},
+		{
+			name:           "raw transfer encoding header",
+			protection:     true,
+			headers:        http.Header{"Content-Length": {"4"}, "Transfer-Encoding": {"chunked"}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "multiple content lengths",
+			protection:     true,
+			headers:        http.Header{"Content-Length": {"4", "5"}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "comma separated content length",
+			protection:     true,
+			headers:        http.Header{"Content-Length": {"4, 4"}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:             "unsupported transfer encoding",
+			protection:       true,
+			transferEncoding: []string{"gzip", "chunked"},
+			expectedStatus:   http.StatusBadRequest,
+		},
+		{
+			name:           "obs-fold line",
+			protection:     true,
+			headers:        http.Header{"X-Custom": {"a\r\n b"}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:             "protection disabled",
+			transferEncoding: []string{"chunked"},
+			headers:          http.Header{"Content-Length": {"4", "5"}},
+			expectedStatus:   http.StatusTeapot,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.SmugglingProtection = tt.protection
+			cfg.AllowedIPs = []string{"192.0.2.1"}
+
+			p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			req.TransferEncoding = tt.transferEncoding
+			for name, values := range tt.headers {
+				req.Header[name] = values
+			}
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package headerblock
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RuleStats is implemented by the handler returned by New. It lets the code
+// embedding the middleware see which rules are doing any work.
+type RuleStats interface {
+	// RuleHits returns the number of matches per rule id, including rules
+	// that never matched.
+	RuleHits() map[string]uint64
+}
+
+// ruleHits counts matches per rule id. Counters are kept by id so they
+// survive rule reloads.
+type ruleHits struct {
+	counters sync.Map // rule id -> *uint64
+}
+
+func (h *ruleHits) inc(id string) {
+	counter, ok := h.counters.Load(id)
+	if !ok {
+		counter, _ = h.counters.LoadOrStore(id, new(uint64))
+	}
+	atomic.AddUint64(counter.(*uint64), 1)
+}
+
+// RuleHits returns the hit counters of every active rule and of every rule
+// that matched since startup.
+func (c *headerBlock) RuleHits() map[string]uint64 {
+	hits := make(map[string]uint64)
+	for _, r := range append(c.currentRules().all(), c.hosts.all()...) {
+		hits[r.id] = 0
+	}
+	c.hits.counters.Range(func(key, value interface{}) bool {
+		hits[key.(string)] = atomic.LoadUint64(value.(*uint64))
+		return true
+	})
+	return hits
+}
+
+// statsResponse is the JSON document served on statsPath.
+type statsResponse struct {
+	UptimeSeconds float64               `json:"uptimeSeconds"`
+	Requests      requestStats          `json:"requests"`
+	Rules         map[string]uint64     `json:"rules"`
+	Bans          int                   `json:"bans"`
+	Caches        map[string]cacheStats `json:"caches"`
+}
+
+type requestStats struct {
+	Evaluated uint64 `json:"evaluated"`
+	Blocked   uint64 `json:"blocked"`
+}
+
+type cacheStats struct {
+	Size    int     `json:"size"`
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	HitRate float64 `json:"hitRate"`
+}
+
+func newCacheStats(cache *lruCache) cacheStats {
+	stats := cacheStats{
+		Size:   cache.len(),
+		Hits:   atomic.LoadUint64(&cache.hits),
+		Misses: atomic.LoadUint64(&cache.misses),
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(lookups)
+	}
+	return stats
+}
+
+// serveStats answers the configured stats path with a JSON summary of the
+// middleware. The path is only answered for clients in allowedIPs.
+func (c *headerBlock) serveStats(rw http.ResponseWriter, req *http.Request) {
+	if ip := c.clientIPs.resolve(req); !isIPAllowed(ip, c.allowedIPNets) && !c.ipLists.allowedIP(ip) {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	stats := statsResponse{
+		UptimeSeconds: time.Since(c.started).Seconds(),
+		Requests: requestStats{
+			Evaluated: atomic.LoadUint64(&c.metrics.evaluated),
+			Blocked:   atomic.LoadUint64(&c.metrics.blocked),
+		},
+		Rules:  c.RuleHits(),
+		Caches: make(map[string]cacheStats),
+	}
+	if c.bans != nil {
+		stats.Bans = c.bans.size()
+	}
+	if c.matchCache != nil {
+		stats.Caches["match"] = newCacheStats(c.matchCache.entries)
+	}
+	if c.dnsbl != nil {
+		stats.Caches["dnsbl"] = newCacheStats(c.dnsbl.cache)
+	}
+	if c.crowdSec != nil {
+		stats.Caches["crowdsec"] = newCacheStats(c.crowdSec.cache)
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(rw).Encode(stats); err != nil && c.log {
+		log.Printf("headerblock: failed to write stats: %v", err)
+	}
+}
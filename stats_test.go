@@ -0,0 +1,129 @@
+package headerblock_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestRuleHits(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{ID: "debug-header", Name: "X-Debug"},
+		{Name: "X-Scan", Action: "log"},
+		{ID: "unused", Name: "X-Never"},
+	}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, header := range []string{"X-Debug", "X-Scan", "X-Scan"} {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set(header, "1")
+		p.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	stats, ok := p.(tbua.RuleStats)
+	if !ok {
+		t.Fatal("handler does not implement RuleStats")
+	}
+
+	expected := map[string]uint64{"debug-header": 1, "requestHeaders[1]": 2, "unused": 0}
+	hits := stats.RuleHits()
+	if len(hits) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, hits)
+	}
+	for id, count := range expected {
+		if hits[id] != count {
+			t.Errorf("rule %s: expected %d hits, got %d", id, count, hits[id])
+		}
+	}
+}
+
+func TestDuplicateRuleID(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{ID: "scanner", Name: "X-Scan"}}
+	cfg.ResponseHeaders = []tbua.HeaderConfig{{ID: "scanner", Name: "Server"}}
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error for duplicate rule id")
+	}
+}
+
+func TestStatsEndpoint(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{ID: "scanner", Name: "X-Scan"},
+	}
+	cfg.AllowedIPs = []string{"10.0.0.0/8"}
+	cfg.StatsPath = "/_headerblock/stats"
+	cfg.MatchCacheSize = 16
+	cfg.BanThreshold = 1
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, scan := range []string{"1", "", ""} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("User-Agent", "curl")
+		if scan != "" {
+			req.Header.Set("X-Scan", scan)
+		}
+		p.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	forbidden := httptest.NewRequest(http.MethodGet, cfg.StatsPath, nil)
+	forbidden.RemoteAddr = "192.0.2.1:1234"
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, forbidden)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 outside allowedIPs, got %d", rr.Code)
+	}
+
+	scrape := httptest.NewRequest(http.MethodGet, cfg.StatsPath, nil)
+	scrape.RemoteAddr = "10.0.0.1:1234"
+	rr = httptest.NewRecorder()
+	p.ServeHTTP(rr, scrape)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	var stats struct {
+		UptimeSeconds float64 `json:"uptimeSeconds"`
+		Requests      struct {
+			Evaluated uint64 `json:"evaluated"`
+			Blocked   uint64 `json:"blocked"`
+		} `json:"requests"`
+		Rules  map[string]uint64 `json:"rules"`
+		Bans   int               `json:"bans"`
+		Caches map[string]struct {
+			Hits    uint64  `json:"hits"`
+			Misses  uint64  `json:"misses"`
+			HitRate float64 `json:"hitRate"`
+		} `json:"caches"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&stats); err != nil {
+		t.Fatalf("stats are not JSON: %v", err)
+	}
+
+	// The banned client's later requests are denied before header rules run,
+	// so only the first request looks up the match cache.
+	if stats.UptimeSeconds <= 0 || stats.Requests.Evaluated != 3 || stats.Requests.Blocked != 3 {
+		t.Fatalf("unexpected request stats: %+v", stats)
+	}
+	if stats.Rules["scanner"] != 1 || stats.Bans != 1 {
+		t.Fatalf("unexpected rule or ban stats: %+v", stats)
+	}
+	if match, ok := stats.Caches["match"]; !ok || match.Misses == 0 {
+		t.Fatalf("expected match cache stats, got %+v", stats.Caches)
+	}
+}
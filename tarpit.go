@@ -0,0 +1,49 @@
+package headerblock
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const defaultTarpitDelay = 5 * time.Second
+
+// tarpit holds the response of a tarpit rule back to slow scanners down.
+type tarpit struct {
+	delay  time.Duration
+	jitter time.Duration
+}
+
+func newTarpit(config *Config) (tarpit, error) {
+	delay, err := parsePositiveDuration(config.TarpitDelay, defaultTarpitDelay)
+	if err != nil {
+		return tarpit{}, fmt.Errorf("tarpitDelay: %w", err)
+	}
+
+	var jitter time.Duration
+	if config.TarpitJitter != "" {
+		if jitter, err = parsePositiveDuration(config.TarpitJitter, 0); err != nil {
+			return tarpit{}, fmt.Errorf("tarpitJitter: %w", err)
+		}
+	}
+
+	return tarpit{delay: delay, jitter: jitter}, nil
+}
+
+// wait sleeps for the delay plus a random jitter, returning early when ctx
+// is done so shutdowns and client disconnects are not held up.
+func (t tarpit) wait(ctx context.Context) {
+	delay := t.delay
+	if t.jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(t.jitter)))
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
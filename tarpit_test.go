@@ -0,0 +1,75 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func newTarpitPlugin(t *testing.T, delay string) http.Handler {
+	t.Helper()
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Scan", Action: "tarpit"}}
+	cfg.TarpitDelay = delay
+	cfg.TarpitJitter = "10ms"
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+	return p
+}
+
+func TestTarpitDelaysDenial(t *testing.T) {
+	p := newTarpitPlugin(t, "50ms")
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("X-Scan", "1")
+	rr := httptest.NewRecorder()
+
+	start := time.Now()
+	p.ServeHTTP(rr, req)
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected at least 50ms delay, got %s", elapsed)
+	}
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d", http.StatusForbidden, rr.Code)
+	}
+}
+
+func TestTarpitRespectsContext(t *testing.T) {
+	p := newTarpitPlugin(t, "1h")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil).WithContext(ctx)
+	req.Header.Set("X-Scan", "1")
+
+	done := make(chan struct{})
+	go func() {
+		p.ServeHTTP(httptest.NewRecorder(), req)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("tarpit ignored the request context")
+	}
+}
+
+func TestInvalidTarpitDelay(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.TarpitDelay = "-1s"
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error for negative tarpitDelay")
+	}
+}
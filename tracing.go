@@ -0,0 +1,36 @@
+package headerblock
+
+import (
+	"net/http"
+	"strings"
+)
+
+// traceparentHeader carries the W3C trace context propagated by Traefik's
+// tracing.
+const traceparentHeader = "traceparent"
+
+// traceContext returns the trace and parent span ids of the request's W3C
+// traceparent header, e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+//
+// Plugins cannot reach Traefik's active span, since the OpenTelemetry API is
+// not part of the standard library they are limited to, so decisions carry
+// these ids instead and tracing backends link them to the trace.
+func traceContext(req *http.Request) (traceID, spanID string) {
+	parts := strings.Split(req.Header.Get(traceparentHeader), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", ""
+	}
+	if !isLowerHex(parts[1]) || !isLowerHex(parts[2]) || strings.Trim(parts[1], "0") == "" {
+		return "", ""
+	}
+	return parts[1], parts[2]
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !('0' <= s[i] && s[i] <= '9' || 'a' <= s[i] && s[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
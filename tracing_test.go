@@ -0,0 +1,86 @@
+package headerblock_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestTracingAddsTraceContext(t *testing.T) {
+	tests := []struct {
+		name        string
+		tracing     bool
+		traceparent string
+		traceID     string
+		spanID      string
+	}{
+		{
+			name:        "valid traceparent",
+			tracing:     true,
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			traceID:     "4bf92f3577b34da6a3ce929d0e0e4736",
+			spanID:      "00f067aa0ba902b7",
+		},
+		{
+			name:        "tracing disabled",
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+		{
+			name:        "invalid trace id",
+			tracing:     true,
+			traceparent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		},
+		{
+			name:        "malformed traceparent",
+			tracing:     true,
+			traceparent: "00-4BF92F35-00f067aa0ba902b7",
+		},
+		{
+			name:    "no traceparent",
+			tracing: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			cfg := tbua.CreateConfig()
+			cfg.RequestHeaders = []tbua.HeaderConfig{
+				{Name: "X-Token"},
+			}
+			cfg.Log = true
+			cfg.LogFormat = "json"
+			cfg.Tracing = tt.tracing
+
+			p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Token", "secret")
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			p.ServeHTTP(httptest.NewRecorder(), req)
+
+			var entry map[string]string
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("log line is not JSON: %v: %q", err, buf.String())
+			}
+			if entry["traceID"] != tt.traceID || entry["spanID"] != tt.spanID {
+				t.Fatalf("expected trace %q/%q, got %q/%q", tt.traceID, tt.spanID, entry["traceID"], entry["spanID"])
+			}
+		})
+	}
+}
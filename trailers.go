@@ -0,0 +1,96 @@
+package headerblock
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// errTrailerDenied fails the body read of a request whose trailers matched a
+// blocking rule, so the upstream handler aborts instead of using them.
+var errTrailerDenied = errors.New("headerblock: request trailer denied")
+
+// trailerBody applies the request header rules to the request trailers once
+// the handler has read the whole body, as trailers only arrive after it.
+type trailerBody struct {
+	io.ReadCloser
+	plugin  *headerBlock
+	req     *http.Request
+	rules   *ruleSet
+	checked bool
+	denied  bool
+}
+
+func (b *trailerBody) Read(p []byte) (int, error) {
+	if b.denied {
+		return 0, errTrailerDenied
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if errors.Is(err, io.EOF) && !b.checked {
+		b.checked = true
+		if b.plugin.filterTrailers(b.req, b.rules) {
+			b.denied = true
+			return n, errTrailerDenied
+		}
+	}
+	return n, err
+}
+
+// mayHaveTrailers reports whether req can carry trailers: they are announced
+// or the body is streamed without a known length.
+func mayHaveTrailers(req *http.Request) bool {
+	if req.Body == nil || req.Body == http.NoBody {
+		return false
+	}
+	return len(req.Trailer) > 0 || req.ContentLength < 0
+}
+
+// filterTrailers applies the request header rules to the trailers and reports
+// whether the request was denied. The response is already in the hands of the
+// upstream handler, so a denial is logged and recorded but not written.
+func (c *headerBlock) filterTrailers(req *http.Request, rules *ruleSet) bool {
+	ev := &evaluation{plugin: c, rw: discardResponseWriter{header: make(http.Header)}, req: req, rules: rules}
+
+	var stripped map[string]struct{}
+	for _, match := range c.headerMatches(req, req.Trailer, rules, nil) {
+		name, values := match.name, match.values
+		if _, ok := stripped[name]; ok {
+			continue
+		}
+		blockRule := rules.requestHeaderRules[match.index]
+		c.hits.inc(blockRule.id)
+
+		if c.precedence.whitelist && isWhitelisted(name, values, ev.ip(), rules.whitelistRequestRules) {
+			if c.log {
+				c.logDecision(req, matchEntry(blockRule, name, values).withDecision(decisionWhitelisted),
+					"access allowed - whitelisted trailer %s", name)
+			}
+			c.metrics.incWhitelistBypass()
+			continue
+		}
+
+		switch c.enforce(ev, blockRule, matchEntry(blockRule, name, values), "trailer "+name) {
+		case outcomeDenied:
+			return true
+		case outcomeAllow:
+			return false
+		case outcomeStrip:
+			req.Trailer.Del(name)
+			if stripped == nil {
+				stripped = make(map[string]struct{})
+			}
+			stripped[name] = struct{}{}
+		}
+	}
+	return false
+}
+
+// discardResponseWriter swallows the deny response of a trailer rule.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (d discardResponseWriter) Header() http.Header         { return d.header }
+func (d discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d discardResponseWriter) WriteHeader(int)             {}
@@ -0,0 +1,78 @@
+package headerblock_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+// trailerReader reads the whole body and reports the read error and the
+// trailers it saw.
+type trailerReader struct {
+	readErr  chan error
+	trailers chan http.Header
+}
+
+func (h trailerReader) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	_, err := io.ReadAll(req.Body)
+	h.readErr <- err
+	h.trailers <- req.Trailer.Clone()
+	rw.WriteHeader(http.StatusOK)
+}
+
+func TestInspectTrailers(t *testing.T) {
+	tests := []struct {
+		name            string
+		inspect         bool
+		action          string
+		trailer         string
+		expectedErr     bool
+		expectedTrailer string
+	}{
+		{name: "blocking trailer", inspect: true, trailer: "' OR 1=1", expectedErr: true, expectedTrailer: "' OR 1=1"},
+		{name: "clean trailer", inspect: true, trailer: "ok", expectedTrailer: "ok"},
+		{name: "stripped trailer", inspect: true, action: "strip", trailer: "' OR 1=1"},
+		{name: "inspection disabled", trailer: "' OR 1=1", expectedTrailer: "' OR 1=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.RequestHeaders = []tbua.HeaderConfig{
+				{Name: "X-Payload", Value: "(?i)' or 1=1", Action: tt.action},
+			}
+			cfg.InspectTrailers = tt.inspect
+
+			next := trailerReader{readErr: make(chan error, 1), trailers: make(chan http.Header, 1)}
+			p, err := tbua.New(context.Background(), next, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+			server := httptest.NewServer(p)
+			defer server.Close()
+
+			req, err := http.NewRequest(http.MethodPost, server.URL, io.NopCloser(strings.NewReader("body")))
+			if err != nil {
+				t.Fatalf("new request: %v", err)
+			}
+			req.Trailer = http.Header{"X-Payload": {tt.trailer}}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			_ = resp.Body.Close()
+
+			if readErr := <-next.readErr; (readErr != nil) != tt.expectedErr {
+				t.Fatalf("expected read error %v, got %v", tt.expectedErr, readErr)
+			}
+			if got := (<-next.trailers).Get("X-Payload"); got != tt.expectedTrailer {
+				t.Fatalf("expected trailer %q, got %q", tt.expectedTrailer, got)
+			}
+		})
+	}
+}
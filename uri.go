@@ -0,0 +1,31 @@
+package headerblock
+
+import "strings"
+
+// filterRequestURI matches the request URI rules against the raw path and
+// query string as sent by the client. Absolute-form targets are reduced to
+// their path and query so patterns anchored at "/" still apply. It reports
+// whether the request was denied.
+func (c *headerBlock) filterRequestURI(ev *evaluation) bool {
+	if len(ev.rules.uriRules) == 0 {
+		return false
+	}
+
+	uri := ev.req.RequestURI
+	if !strings.HasPrefix(uri, "/") {
+		uri = ev.req.URL.RequestURI()
+	}
+	values := []string{uri}
+
+	for _, uriRule := range ev.rules.uriRules {
+		if !uriRule.appliesTo(ev.req) || !applyRule(uriRule, "", values) {
+			continue
+		}
+		c.hits.inc(uriRule.id)
+
+		if c.enforce(ev, uriRule, matchEntry(uriRule, "", values), "request URI") == outcomeDenied {
+			return true
+		}
+	}
+	return false
+}
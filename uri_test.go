@@ -0,0 +1,59 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestRequestURIRules(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestURIRules = []tbua.HeaderConfig{
+		{Value: `\.\./|%2e%2e%2f`, CaseInsensitive: true},
+		{Value: `^/(wp-login\.php|\.env)`},
+		{Value: `[?&]debug=`, HostRegex: `^api\.`},
+	}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		target         string
+		expectedStatus int
+	}{
+		{name: "clean uri", target: "http://example.com/blog?page=2", expectedStatus: http.StatusTeapot},
+		{name: "traversal in query", target: "http://example.com/download?file=../../etc/passwd", expectedStatus: http.StatusForbidden},
+		{name: "encoded traversal", target: "http://example.com/static/%2E%2E%2Fsecret", expectedStatus: http.StatusForbidden},
+		{name: "wordpress probe", target: "http://example.com/wp-login.php", expectedStatus: http.StatusForbidden},
+		{name: "dotenv probe", target: "http://example.com/.env", expectedStatus: http.StatusForbidden},
+		{name: "host scoped rule", target: "http://api.example.com/users?debug=1", expectedStatus: http.StatusForbidden},
+		{name: "host scoped rule elsewhere", target: "http://example.com/users?debug=1", expectedStatus: http.StatusTeapot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestInvalidRequestURIRules(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestURIRules = []tbua.HeaderConfig{{Name: "X-Path", Value: "/admin"}}
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected error for a request URI rule with a name")
+	}
+}
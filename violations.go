@@ -0,0 +1,101 @@
+package headerblock
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultViolationWindow = time.Minute
+
+// violationCounter counts the violations of one client in a fixed window.
+type violationCounter struct {
+	start time.Time
+	count int
+}
+
+// violationTracker tolerates up to limit blocking matches per client IP and
+// window before requests are denied.
+type violationTracker struct {
+	limit      int
+	window     time.Duration
+	statusCode int
+	// store shares the counters under keyspace when redisAddress is set.
+	store     *redisStore
+	keyspace  string
+	mu        sync.Mutex
+	clients   map[string]*violationCounter
+	lastSweep time.Time
+}
+
+func newViolationTracker(config *Config, store *redisStore) (*violationTracker, error) {
+	if config.ViolationLimit < 0 {
+		return nil, fmt.Errorf("violationLimit: must not be negative, got %d", config.ViolationLimit)
+	}
+	if config.ViolationLimit == 0 {
+		return nil, nil
+	}
+
+	tracker := &violationTracker{
+		limit:      config.ViolationLimit,
+		statusCode: config.ViolationStatusCode,
+		clients:    make(map[string]*violationCounter),
+		store:      store,
+		keyspace:   "violations",
+	}
+
+	window, err := parsePositiveDuration(config.ViolationWindow, defaultViolationWindow)
+	if err != nil {
+		return nil, fmt.Errorf("violationWindow: %w", err)
+	}
+	tracker.window = window
+	if tracker.statusCode == 0 {
+		tracker.statusCode = http.StatusTooManyRequests
+	}
+	if tracker.statusCode < 100 || tracker.statusCode > 599 {
+		return nil, fmt.Errorf("violationStatusCode: invalid HTTP status %d", tracker.statusCode)
+	}
+
+	return tracker, nil
+}
+
+// record counts a violation of client and returns its violations in the
+// current window.
+func (v *violationTracker) record(client string, now time.Time) int {
+	if v.store != nil {
+		count, err := v.store.incr(v.keyspace+":"+client, v.window)
+		if err == nil {
+			return count
+		}
+		v.store.warnf("falling back to local %s: %v", v.keyspace, err)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.sweep(now)
+
+	counter, ok := v.clients[client]
+	if !ok || now.Sub(counter.start) >= v.window {
+		counter = &violationCounter{start: now}
+		v.clients[client] = counter
+	}
+	counter.count++
+
+	return counter.count
+}
+
+// sweep drops expired counters at most once per window. Callers hold mu.
+func (v *violationTracker) sweep(now time.Time) {
+	if now.Sub(v.lastSweep) < v.window {
+		return
+	}
+	v.lastSweep = now
+
+	for client, counter := range v.clients {
+		if now.Sub(counter.start) >= v.window {
+			delete(v.clients, client)
+		}
+	}
+}
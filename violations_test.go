@@ -0,0 +1,80 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestViolationLimit(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Debug"}, {Name: "X-Scan"}}
+	cfg.ViolationLimit = 2
+	cfg.ViolationWindow = "100ms"
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	send := func(remoteAddr string, headers ...string) int {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = remoteAddr
+		for _, header := range headers {
+			req.Header.Set(header, "1")
+		}
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// Matching both rules still counts as a single violation.
+	if code := send("192.0.2.1:1234", "X-Debug", "X-Scan"); code != http.StatusTeapot {
+		t.Fatalf("first violation: expected %d, got %d", http.StatusTeapot, code)
+	}
+	if code := send("192.0.2.1:1234", "X-Debug"); code != http.StatusTeapot {
+		t.Fatalf("second violation: expected %d, got %d", http.StatusTeapot, code)
+	}
+	if code := send("192.0.2.1:1234", "X-Debug"); code != http.StatusTooManyRequests {
+		t.Fatalf("third violation: expected %d, got %d", http.StatusTooManyRequests, code)
+	}
+
+	if code := send("192.0.2.1:1234"); code != http.StatusTeapot {
+		t.Fatalf("clean request: expected %d, got %d", http.StatusTeapot, code)
+	}
+	if code := send("192.0.2.2:1234", "X-Debug"); code != http.StatusTeapot {
+		t.Fatalf("other client: expected %d, got %d", http.StatusTeapot, code)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if code := send("192.0.2.1:1234", "X-Debug"); code != http.StatusTeapot {
+		t.Fatalf("after window: expected %d, got %d", http.StatusTeapot, code)
+	}
+}
+
+func TestInvalidViolationConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(*tbua.Config)
+	}{
+		{name: "NegativeLimit", cfg: func(c *tbua.Config) { c.ViolationLimit = -1 }},
+		{name: "BadWindow", cfg: func(c *tbua.Config) { c.ViolationLimit = 1; c.ViolationWindow = "soon" }},
+		{name: "BadStatus", cfg: func(c *tbua.Config) { c.ViolationLimit = 1; c.ViolationStatusCode = 42 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			tt.cfg(cfg)
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
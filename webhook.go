@@ -0,0 +1,178 @@
+package headerblock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultWebhookBatchSize     = 50
+	defaultWebhookFlushInterval = 5 * time.Second
+	defaultWebhookRetries       = 3
+	defaultWebhookTimeout       = 10 * time.Second
+	webhookQueueSize            = 1024
+	webhookRetryBackoff         = 500 * time.Millisecond
+)
+
+// webhookEvent is the JSON payload sent for every denied request.
+type webhookEvent struct {
+	Time     string `json:"time"`
+	Decision string `json:"decision"`
+	ClientIP string `json:"clientIP,omitempty"`
+	Rule     string `json:"rule,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	Header   string `json:"header,omitempty"`
+	Method   string `json:"method"`
+	Host     string `json:"host"`
+	Path     string `json:"path"`
+	TraceID  string `json:"traceID,omitempty"`
+	// RequestID is set when requestID is enabled.
+	RequestID string `json:"requestID,omitempty"`
+	// Headers holds the redacted request headers when auditWebhook is set.
+	Headers map[string][]string `json:"headers,omitempty"`
+	// Captures are the named capture groups of the value pattern.
+	Captures map[string]string `json:"captures,omitempty"`
+}
+
+// webhookSender posts block events in batches from a background goroutine so
+// requests never wait for the receiver.
+type webhookSender struct {
+	url           string
+	batchSize     int
+	flushInterval time.Duration
+	retries       int
+	backoff       time.Duration
+	client        *http.Client
+	events        chan webhookEvent
+}
+
+func newWebhookSender(config *Config) (*webhookSender, error) {
+	if config.WebhookURL == "" {
+		return nil, nil
+	}
+
+	flushInterval, err := parsePositiveDuration(config.WebhookFlushInterval, defaultWebhookFlushInterval)
+	if err != nil {
+		return nil, fmt.Errorf("webhookFlushInterval: %w", err)
+	}
+
+	sender := &webhookSender{
+		url:           config.WebhookURL,
+		batchSize:     config.WebhookBatchSize,
+		flushInterval: flushInterval,
+		retries:       defaultWebhookRetries,
+		backoff:       webhookRetryBackoff,
+		client:        &http.Client{Timeout: defaultWebhookTimeout},
+		events:        make(chan webhookEvent, webhookQueueSize),
+	}
+	if sender.batchSize <= 0 {
+		sender.batchSize = defaultWebhookBatchSize
+	}
+	if config.WebhookRetries != nil {
+		if *config.WebhookRetries < 0 {
+			return nil, fmt.Errorf("webhookRetries: must not be negative, got %d", *config.WebhookRetries)
+		}
+		sender.retries = *config.WebhookRetries
+	}
+
+	return sender, nil
+}
+
+// enqueue queues an event, dropping it when the queue is full.
+func (w *webhookSender) enqueue(event webhookEvent) {
+	select {
+	case w.events <- event:
+	default:
+		log.Printf("headerblock: webhook queue full, dropping event for %s", event.ClientIP)
+	}
+}
+
+// run batches queued events until ctx is done, then flushes what is left.
+func (w *webhookSender) run(ctx context.Context) {
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]webhookEvent, 0, w.batchSize)
+	flush := func(ctx context.Context, retries int) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := w.send(ctx, batch, retries); err != nil {
+			log.Printf("headerblock: dropping %d webhook events: %v", len(batch), err)
+		}
+		batch = make([]webhookEvent, 0, w.batchSize)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case event := <-w.events:
+					batch = append(batch, event)
+				default:
+					// The plugin is shutting down; give the last batch one try
+					// without the cancelled context.
+					flush(context.Background(), 0)
+					return
+				}
+			}
+		case event := <-w.events:
+			batch = append(batch, event)
+			if len(batch) >= w.batchSize {
+				flush(ctx, w.retries)
+			}
+		case <-ticker.C:
+			flush(ctx, w.retries)
+		}
+	}
+}
+
+// send posts a batch, retrying up to retries times with exponential backoff.
+func (w *webhookSender) send(ctx context.Context, batch []webhookEvent, retries int) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	backoff := w.backoff
+	for attempt := 1; ; attempt++ {
+		err = w.post(ctx, body)
+		if err == nil || attempt > retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (w *webhookSender) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package headerblock_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+type webhookEvent struct {
+	Decision string `json:"decision"`
+	ClientIP string `json:"clientIP"`
+	Rule     string `json:"rule"`
+	Header   string `json:"header"`
+	Path     string `json:"path"`
+	Time     string `json:"time"`
+
+	Captures map[string]string `json:"captures"`
+}
+
+func TestWebhookBatchesAndRetries(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		batches  [][]webhookEvent
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		if attempts == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var batch []webhookEvent
+		if err := json.NewDecoder(req.Body).Decode(&batch); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+		batches = append(batches, batch)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Scan"}}
+	cfg.WebhookURL = server.URL
+	cfg.WebhookBatchSize = 2
+	cfg.WebhookFlushInterval = "1h"
+
+	p, err := tbua.New(ctx, &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	for _, path := range []string{"/a", "/clean", "/b"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if path != "/clean" {
+			req.Header.Set("X-Scan", "1")
+		}
+		p.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		done := len(batches) == 1
+		mu.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("webhook batch was never delivered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if attempts != 2 {
+		t.Errorf("expected one retry, got %d attempts", attempts)
+	}
+
+	batch := batches[0]
+	if len(batch) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(batch))
+	}
+	first := batch[0]
+	if first.Decision != "denied" || first.ClientIP != "192.0.2.1" || first.Rule != "requestHeaders[0]" ||
+		first.Header != "X-Scan" || first.Path != "/a" || first.Time == "" {
+		t.Errorf("unexpected event %+v", first)
+	}
+	if batch[1].Path != "/b" {
+		t.Errorf("expected second event for /b, got %q", batch[1].Path)
+	}
+}
+
+func TestWebhookCaptures(t *testing.T) {
+	events := make(chan []webhookEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var batch []webhookEvent
+		if err := json.NewDecoder(req.Body).Decode(&batch); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+		events <- batch
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "User-Agent", Value: `(?P<scanner>sqlmap|nikto)/(?P<version>[\d.]+)`, CaseInsensitive: true},
+	}
+	cfg.WebhookURL = server.URL
+	cfg.WebhookBatchSize = 1
+
+	p, err := tbua.New(ctx, &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Nikto/2.5.0)")
+	p.ServeHTTP(httptest.NewRecorder(), req)
+
+	select {
+	case batch := <-events:
+		if len(batch) != 1 || batch[0].Captures["scanner"] != "Nikto" || batch[0].Captures["version"] != "2.5.0" {
+			t.Fatalf("unexpected events %+v", batch)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook event was never delivered")
+	}
+}
+
+func TestWebhookWithoutRetries(t *testing.T) {
+	attempts := make(chan struct{}, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		attempts <- struct{}{}
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	retries := 0
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{{Name: "X-Scan"}}
+	cfg.WebhookURL = server.URL
+	cfg.WebhookBatchSize = 1
+	cfg.WebhookRetries = &retries
+
+	p, err := tbua.New(ctx, &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Scan", "1")
+	p.ServeHTTP(httptest.NewRecorder(), req)
+
+	select {
+	case <-attempts:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook batch was never sent")
+	}
+	// The first retry would follow after 500ms.
+	select {
+	case <-attempts:
+		t.Fatal("webhook batch was retried with webhookRetries set to 0")
+	case <-time.After(time.Second):
+	}
+}
+
+func TestInvalidWebhookRetries(t *testing.T) {
+	retries := -1
+	cfg := tbua.CreateConfig()
+	cfg.WebhookURL = "http://127.0.0.1:1"
+	cfg.WebhookRetries = &retries
+
+	if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+		t.Fatal("expected an error for negative webhookRetries")
+	}
+}
@@ -0,0 +1,23 @@
+package headerblock
+
+import (
+	"net/http"
+	"strings"
+)
+
+// isWebSocketUpgrade reports whether req is a WebSocket handshake. The
+// middleware only ever sees the handshake; frames sent after the upgrade go
+// straight through the hijacked connection.
+func isWebSocketUpgrade(req *http.Request) bool {
+	if !strings.EqualFold(strings.TrimSpace(req.Header.Get("Upgrade")), "websocket") {
+		return false
+	}
+	for _, value := range req.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package headerblock_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestWebSocketSkipPaths(t *testing.T) {
+	cfg := tbua.CreateConfig()
+	cfg.RequestHeaders = []tbua.HeaderConfig{
+		{Name: "X-Client", Value: "legacy"},
+	}
+	cfg.WebSocketSkipPaths = []string{"/ws/", "^/live$"}
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		upgrade        bool
+		expectedStatus int
+	}{
+		{name: "handshake to skipped prefix", path: "/ws/chat", upgrade: true, expectedStatus: http.StatusTeapot},
+		{name: "handshake to skipped pattern", path: "/live", upgrade: true, expectedStatus: http.StatusTeapot},
+		{name: "plain request to skipped path", path: "/ws/chat", expectedStatus: http.StatusForbidden},
+		{name: "handshake to other path", path: "/api", upgrade: true, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("X-Client", "legacy")
+			if tt.upgrade {
+				req.Header.Set("Connection", "keep-alive, Upgrade")
+				req.Header.Set("Upgrade", "websocket")
+			}
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+// echoUpgrader answers a WebSocket handshake by hijacking the connection and
+// echoing one line, standing in for a WebSocket backend.
+type echoUpgrader struct {
+	headers map[string]string
+}
+
+func (e echoUpgrader) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+	for k, v := range e.headers {
+		rw.Header().Set(k, v)
+	}
+	conn, buf, err := http.NewResponseController(rw).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	_, _ = buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	_ = buf.Flush()
+	line, err := buf.ReadString('\n')
+	if err != nil {
+		return
+	}
+	_, _ = buf.WriteString(line)
+	_ = buf.Flush()
+}
+
+func TestWebSocketHijackWithResponseRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		upgraded bool
+	}{
+		{name: "upgrade allowed", upgraded: true},
+		{name: "upgrade response denied", headers: map[string]string{"X-Debug-Token": "1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tbua.CreateConfig()
+			cfg.ResponseHeaders = []tbua.HeaderConfig{{Name: "X-Debug-Token"}}
+
+			p, err := tbua.New(context.Background(), echoUpgrader{headers: tt.headers}, cfg, pluginName)
+			if err != nil {
+				t.Fatalf("plugin init error: %v", err)
+			}
+			server := httptest.NewServer(p)
+			defer server.Close()
+
+			conn, err := net.Dial("tcp", server.Listener.Addr().String())
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer conn.Close()
+
+			_, _ = conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+			reader := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(reader, nil)
+			if err != nil {
+				t.Fatalf("read handshake response: %v", err)
+			}
+
+			if !tt.upgraded {
+				if resp.StatusCode != http.StatusForbidden {
+					t.Fatalf("expected 403, got %d", resp.StatusCode)
+				}
+				return
+			}
+			if resp.StatusCode != http.StatusSwitchingProtocols {
+				t.Fatalf("expected 101, got %d", resp.StatusCode)
+			}
+			_, _ = conn.Write([]byte("ping\n"))
+			line, err := reader.ReadString('\n')
+			if err != nil || line != "ping\n" {
+				t.Fatalf("expected echo after upgrade, got %q: %v", line, err)
+			}
+		})
+	}
+}
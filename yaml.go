@@ -0,0 +1,473 @@
+package headerblock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// yamlNumber matches the plain scalars decoded as numbers.
+var yamlNumber = regexp.MustCompile(`^[-+]?(\d+|\d*\.\d+)([eE][-+]?\d+)?$`)
+
+// yamlPlain is an unquoted scalar. Its type depends on the field it is
+// decoded into: "200" is a number for a numeric field and a string for a
+// string field.
+type yamlPlain string
+
+// yamlLine is a non-empty line of a YAML document without its comment.
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// yamlParser decodes the block-style subset of YAML used by rules files:
+// mappings, sequences, plain and quoted scalars and flow sequences of
+// scalars. Anchors, tags, block scalars and flow mappings are not supported.
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// yamlToJSON converts a YAML document to JSON for decoding into a value of
+// type target, so it goes through the same strict decoding as JSON files.
+func yamlToJSON(data []byte, target reflect.Type) ([]byte, error) {
+	p := &yamlParser{}
+	if err := p.split(string(data)); err != nil {
+		return nil, err
+	}
+	if len(p.lines) == 0 {
+		return nil, errors.New("yaml: empty document")
+	}
+
+	value, err := p.node(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, p.errorf(p.lines[p.pos], "unexpected indentation")
+	}
+	return json.Marshal(typeYAML(value, target))
+}
+
+// typeYAML resolves the plain scalars of value by the type they are decoded
+// into: booleans for bool fields, numbers for numeric fields and strings
+// otherwise. Values without a matching field stay strings and are left to
+// the JSON decoder to reject.
+func typeYAML(value interface{}, target reflect.Type) interface{} {
+	for target != nil && target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		typed := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			var itemType reflect.Type
+			if target != nil {
+				switch target.Kind() {
+				case reflect.Struct:
+					itemType = jsonFieldType(target, key)
+				case reflect.Map:
+					itemType = target.Elem()
+				}
+			}
+			typed[key] = typeYAML(item, itemType)
+		}
+		return typed
+	case []interface{}:
+		var itemType reflect.Type
+		if target != nil && (target.Kind() == reflect.Slice || target.Kind() == reflect.Array) {
+			itemType = target.Elem()
+		}
+		typed := make([]interface{}, len(value))
+		for i, item := range value {
+			typed[i] = typeYAML(item, itemType)
+		}
+		return typed
+	case yamlPlain:
+		return typePlainYAML(string(value), target)
+	}
+	return value
+}
+
+func typePlainYAML(text string, target reflect.Type) interface{} {
+	switch text {
+	case "null", "Null", "NULL", "~":
+		return nil
+	}
+	if target == nil {
+		return text
+	}
+
+	switch target.Kind() {
+	case reflect.Bool:
+		switch text {
+		case "true", "True", "TRUE":
+			return true
+		case "false", "False", "FALSE":
+			return false
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if yamlNumber.MatchString(text) {
+			return json.Number(strings.TrimPrefix(text, "+"))
+		}
+	}
+	return text
+}
+
+// jsonFieldType returns the type of the field of the struct type t that
+// encoding/json decodes key into, or nil when there is none.
+func jsonFieldType(t reflect.Type, key string) reflect.Type {
+	var folded reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if name == key {
+			return field.Type
+		}
+		if folded == nil && strings.EqualFold(name, key) {
+			folded = field.Type
+		}
+	}
+	return folded
+}
+
+// split strips comments and blank lines and records the indentation of the
+// remaining lines.
+func (p *yamlParser) split(document string) error {
+	for i, raw := range strings.Split(strings.ReplaceAll(document, "\r\n", "\n"), "\n") {
+		text := strings.TrimRight(stripYAMLComment(raw), " \t")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || (i == 0 && trimmed == "---") {
+			continue
+		}
+		if trimmed == "..." {
+			break
+		}
+		line := yamlLine{number: i + 1, indent: len(text) - len(trimmed), text: trimmed}
+		if trimmed[0] == '\t' {
+			return p.errorf(line, "tabs are not allowed in indentation")
+		}
+		p.lines = append(p.lines, line)
+	}
+	return nil
+}
+
+// stripYAMLComment removes a comment starting with # at the beginning of the
+// line or after a space, outside quoted scalars.
+func stripYAMLComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; {
+		case ch == '"' || ch == '\'':
+			if i == 0 || strings.IndexByte(" [,:-", line[i-1]) >= 0 {
+				i = yamlQuoteEnd(line, i)
+			}
+		case ch == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// yamlQuoteEnd returns the index of the quote closing the quoted scalar
+// starting at start, or len(text) when it is not closed. Double-quoted
+// scalars escape with a backslash, single-quoted ones by doubling the quote.
+func yamlQuoteEnd(text string, start int) int {
+	quote := text[start]
+	for i := start + 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case text[i] != quote:
+		case quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		default:
+			return i
+		}
+	}
+	return len(text)
+}
+
+func (p *yamlParser) errorf(line yamlLine, format string, args ...interface{}) error {
+	return fmt.Errorf("yaml: line %d: %s", line.number, fmt.Sprintf(format, args...))
+}
+
+// node parses the mapping or sequence starting at the current line.
+func (p *yamlParser) node(indent int) (interface{}, error) {
+	if isYAMLSequenceItem(p.lines[p.pos].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	items := make([]interface{}, 0)
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		// A key at the indentation of the sequence belongs to the mapping
+		// holding it.
+		if line.indent < indent || (line.indent == indent && !isYAMLSequenceItem(line.text)) {
+			break
+		}
+		if line.indent > indent {
+			return nil, p.errorf(line, "unexpected indentation")
+		}
+
+		text := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if text == "" {
+			p.pos++
+			item, err := p.nested(indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+
+		// The item is parsed as if it started on its own line, indented
+		// to its column, so "- name: x" opens a mapping.
+		p.lines[p.pos] = yamlLine{number: line.number, indent: line.indent + len(line.text) - len(text), text: text}
+		if isYAMLSequenceItem(text) || yamlKeyEnd(text) >= 0 {
+			item, err := p.node(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+		item, err := parseYAMLScalar(text)
+		if err != nil {
+			return nil, p.errorf(line, "%v", err)
+		}
+		items = append(items, item)
+		p.pos++
+	}
+	return items, nil
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	values := make(map[string]interface{})
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, p.errorf(line, "unexpected indentation")
+		}
+		if isYAMLSequenceItem(line.text) {
+			return nil, p.errorf(line, "unexpected sequence item in a mapping")
+		}
+
+		end := yamlKeyEnd(line.text)
+		if end < 0 {
+			return nil, p.errorf(line, "expected a key followed by a colon")
+		}
+		key, err := parseYAMLKey(line.text[:end])
+		if err != nil {
+			return nil, p.errorf(line, "%v", err)
+		}
+		if _, ok := values[key]; ok {
+			return nil, p.errorf(line, "duplicate key %q", key)
+		}
+		p.pos++
+
+		text := strings.TrimSpace(line.text[end+1:])
+		if text != "" {
+			if values[key], err = parseYAMLScalar(text); err != nil {
+				return nil, p.errorf(line, "%v", err)
+			}
+			continue
+		}
+		// A sequence may sit at the indentation of its key.
+		if p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isYAMLSequenceItem(p.lines[p.pos].text) {
+			if values[key], err = p.sequence(indent); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if values[key], err = p.nested(indent); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// nested parses the node indented deeper than indent on the current line,
+// or returns nil when there is none.
+func (p *yamlParser) nested(indent int) (interface{}, error) {
+	if p.pos >= len(p.lines) || p.lines[p.pos].indent <= indent {
+		return nil, nil
+	}
+	return p.node(p.lines[p.pos].indent)
+}
+
+// yamlKeyEnd returns the index of the colon ending the key of text, or -1
+// when text is not a key-value pair.
+func yamlKeyEnd(text string) int {
+	for i := 0; i < len(text); i++ {
+		switch ch := text[i]; {
+		case i == 0 && (ch == '"' || ch == '\''):
+			i = yamlQuoteEnd(text, i)
+		case i == 0 && (ch == '[' || ch == '{'):
+			return -1
+		case ch == ':' && (i == len(text)-1 || text[i+1] == ' '):
+			return i
+		}
+	}
+	return -1
+}
+
+func parseYAMLKey(raw string) (string, error) {
+	key, err := parseYAMLScalar(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	switch key := key.(type) {
+	case string:
+		return key, nil
+	case yamlPlain:
+		return string(key), nil
+	}
+	return "", fmt.Errorf("invalid key %s", strings.TrimSpace(raw))
+}
+
+// parseYAMLScalar decodes a quoted or plain scalar or a flow sequence of
+// scalars. Plain scalars are returned as yamlPlain.
+func parseYAMLScalar(text string) (interface{}, error) {
+	switch text[0] {
+	case '"':
+		end := yamlQuoteEnd(text, 0)
+		if end != len(text)-1 {
+			return nil, fmt.Errorf("invalid double-quoted scalar %s", text)
+		}
+		return unescapeYAML(text[1:end])
+	case '\'':
+		if yamlQuoteEnd(text, 0) != len(text)-1 {
+			return nil, fmt.Errorf("invalid single-quoted scalar %s", text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case '[':
+		return parseYAMLFlowSequence(text)
+	case '{':
+		if text == "{}" {
+			return map[string]interface{}{}, nil
+		}
+		return nil, errors.New("flow mappings are not supported")
+	case '|', '>':
+		return nil, errors.New("block scalars are not supported")
+	case '&', '*', '!':
+		return nil, errors.New("anchors, aliases and tags are not supported")
+	}
+
+	return yamlPlain(text), nil
+}
+
+// yamlEscapes are the single-character escapes of double-quoted scalars.
+var yamlEscapes = map[byte]string{
+	'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n", 'v': "\v",
+	'f': "\f", 'r': "\r", 'e': "\x1b", ' ': " ", '"': "\"", '/': "/", '\\': "\\",
+	'N': "\u0085", '_': "\u00a0", 'L': "\u2028", 'P': "\u2029",
+}
+
+// unescapeYAML resolves the escape sequences of a double-quoted scalar.
+func unescapeYAML(text string) (string, error) {
+	if !strings.Contains(text, "\\") {
+		return text, nil
+	}
+
+	var unescaped strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\\' {
+			unescaped.WriteByte(text[i])
+			continue
+		}
+		i++
+		if i == len(text) {
+			return "", errors.New("unterminated escape sequence")
+		}
+		if escaped, ok := yamlEscapes[text[i]]; ok {
+			unescaped.WriteString(escaped)
+			continue
+		}
+
+		var digits int
+		switch text[i] {
+		case 'x':
+			digits = 2
+		case 'u':
+			digits = 4
+		case 'U':
+			digits = 8
+		default:
+			return "", fmt.Errorf("invalid escape sequence \\%c", text[i])
+		}
+		if i+digits >= len(text) {
+			return "", fmt.Errorf("invalid escape sequence \\%s", text[i:])
+		}
+		code, err := strconv.ParseUint(text[i+1:i+1+digits], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return "", fmt.Errorf("invalid escape sequence \\%s", text[i:i+1+digits])
+		}
+		unescaped.WriteRune(rune(code))
+		i += digits
+	}
+	return unescaped.String(), nil
+}
+
+func parseYAMLFlowSequence(text string) (interface{}, error) {
+	if text[len(text)-1] != ']' {
+		return nil, fmt.Errorf("invalid flow sequence %s", text)
+	}
+	items := make([]interface{}, 0)
+	inner := strings.TrimSpace(text[1 : len(text)-1])
+	if inner == "" {
+		return items, nil
+	}
+
+	var start int
+	for i := 0; i <= len(inner); i++ {
+		if i < len(inner) {
+			ch := inner[i]
+			if ch == '"' || ch == '\'' {
+				i = yamlQuoteEnd(inner, i)
+				continue
+			}
+			if ch == '[' || ch == '{' {
+				return nil, errors.New("nested flow collections are not supported")
+			}
+			if ch != ',' {
+				continue
+			}
+		}
+		item := strings.TrimSpace(inner[start:i])
+		if item == "" {
+			return nil, fmt.Errorf("invalid flow sequence %s", text)
+		}
+		value, err := parseYAMLScalar(item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, value)
+		start = i + 1
+	}
+	return items, nil
+}
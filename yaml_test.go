@@ -0,0 +1,165 @@
+package headerblock_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tbua "github.com/PRIHLOP/headerblock"
+)
+
+func TestYAMLRulesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	writeRulesFile(t, path, `---
+# Scanners
+requestHeaders:
+- name: "User-Agent"
+  value: '(?i)sqlmap|nikto' # quoted regex
+  id: scanners
+  priority: 10
+- name: X-Debug
+  allowedIPs: ["10.0.0.0/8", '198.51.100.1']
+- all:
+    - name: "^Accept$"
+      value: "^\\*/\\*$"
+    - name: "^Referer$"
+      absent: true
+requestCookies:
+  - name: ^tracking$
+    action: strip
+`, time.Now())
+
+	cfg := tbua.CreateConfig()
+	cfg.RulesFile = path
+	cfg.RulesFileInterval = "0s"
+
+	next := &noopHandler{}
+	p, err := tbua.New(context.Background(), next, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   int
+	}{
+		{name: "Scanner", headers: map[string]string{"User-Agent": "sqlmap/1.7"}, expected: http.StatusForbidden},
+		{name: "Browser", headers: map[string]string{"User-Agent": "Mozilla/5.0", "Referer": "https://example.com/"}, expected: http.StatusTeapot},
+		{name: "DebugFromOutside", headers: map[string]string{"X-Debug": "1"}, expected: http.StatusForbidden},
+		{name: "DebugFromAllowedIP", remoteAddr: "198.51.100.1:1", headers: map[string]string{"X-Debug": "1"}, expected: http.StatusTeapot},
+		{name: "CompositeRule", headers: map[string]string{"Accept": "*/*"}, expected: http.StatusForbidden},
+		{name: "StrippedCookie", headers: map[string]string{"Cookie": "tracking=1; session=abc", "Referer": "https://example.com/"}, expected: http.StatusTeapot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expected {
+				t.Fatalf("expected %d, got %d", tt.expected, rr.Code)
+			}
+		})
+	}
+
+	if cookie := next.req.Header.Get("Cookie"); cookie != "session=abc" {
+		t.Fatalf("expected the tracking cookie to be stripped, got %q", cookie)
+	}
+}
+
+func TestYAMLRulesFileScalars(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	writeRulesFile(t, path, `requestHeaders:
+  - name: X-Code
+    value: 200
+    statusCode: 451
+    dryRun: false
+  - name: X-Flag
+    value: true
+    caseInsensitive: TRUE
+  - name: X-Path
+    value: "^/a\/b\t\x41\u00e9\U0001F600$"
+  - name: X-Quote
+    value: "say \"hi\" # not a comment" # a comment
+  - name: X-Single
+    value: 'it''s # here'
+`, time.Now())
+
+	cfg := tbua.CreateConfig()
+	cfg.RulesFile = path
+
+	p, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName)
+	if err != nil {
+		t.Fatalf("plugin init error: %v", err)
+	}
+
+	tests := []struct {
+		header, value string
+		expected      int
+	}{
+		{header: "X-Code", value: "200", expected: http.StatusUnavailableForLegalReasons},
+		{header: "X-Code", value: "201", expected: http.StatusTeapot},
+		{header: "X-Flag", value: "TRUE", expected: http.StatusForbidden},
+		{header: "X-Path", value: "/a/b\tA\u00e9\U0001F600", expected: http.StatusForbidden},
+		{header: "X-Quote", value: `say "hi" # not a comment`, expected: http.StatusForbidden},
+		{header: "X-Quote", value: "say", expected: http.StatusTeapot},
+		{header: "X-Single", value: "it's # here", expected: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set(tt.header, tt.value)
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+
+		if rr.Code != tt.expected {
+			t.Errorf("%s: %q: expected %d, got %d", tt.header, tt.value, tt.expected, rr.Code)
+		}
+	}
+}
+
+func TestInvalidYAMLRulesFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "Empty", content: "# nothing here\n"},
+		{name: "BadIndentation", content: "requestHeaders:\n  - name: X-A\n      value: b\n"},
+		{name: "DuplicateKey", content: "requestHeaders:\n  - name: X-A\n    name: X-B\n"},
+		{name: "UnknownField", content: "requestHeaders:\n  - nmae: X-A\n"},
+		{name: "WordForBool", content: "requestHeaders:\n  - name: X-A\n    dryRun: maybe\n"},
+		{name: "WordForNumber", content: "requestHeaders:\n  - name: X-A\n    priority: high\n"},
+		{name: "QuotedNumber", content: "requestHeaders:\n  - name: X-A\n    priority: \"10\"\n"},
+		{name: "InvalidEscape", content: "requestHeaders:\n  - name: X-A\n    value: \"\\q\"\n"},
+		{name: "TrailingTextAfterQuote", content: "requestHeaders:\n  - name: \"X-A\" b\n"},
+		{name: "BlockScalar", content: "requestHeaders:\n  - name: X-A\n    body: |\n      denied\n"},
+		{name: "UnterminatedQuote", content: "requestHeaders:\n  - name: \"X-A\n"},
+		{name: "MissingColon", content: "requestHeaders\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.yaml")
+			writeRulesFile(t, path, tt.content, time.Now())
+
+			cfg := tbua.CreateConfig()
+			cfg.RulesFile = path
+
+			if _, err := tbua.New(context.Background(), &noopHandler{}, cfg, pluginName); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}